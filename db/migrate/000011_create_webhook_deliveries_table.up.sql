@@ -0,0 +1,29 @@
+-- Outbound product webhooks are queued here before delivery
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    product_id integer,
+    url text,
+    payload text,
+    signature text,
+    status text,
+    attempts integer DEFAULT 0,
+    next_attempt_at text,
+    last_status_code integer,
+    last_error text,
+    delivered_at text
+);
+
+-- Every delivery attempt is logged with its response
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    delivery_id integer,
+    attempt integer,
+    status_code integer,
+    latency_ms integer,
+    response_body text,
+    error text
+);
@@ -0,0 +1 @@
+ALTER TABLE webhook_deliveries DROP COLUMN event_type;
\ No newline at end of file
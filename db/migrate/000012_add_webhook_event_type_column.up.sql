@@ -0,0 +1 @@
+ALTER TABLE webhook_deliveries ADD event_type text;
\ No newline at end of file
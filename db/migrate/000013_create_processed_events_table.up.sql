@@ -0,0 +1,10 @@
+-- Gateway webhook events are recorded here once processed so redeliveries are ignored
+CREATE TABLE IF NOT EXISTS processed_events (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    pg text,
+    event_id text,
+    event_type text,
+    UNIQUE (pg, event_id)
+);
\ No newline at end of file
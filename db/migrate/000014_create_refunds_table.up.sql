@@ -0,0 +1,14 @@
+-- Refunds and disputes of the payments in the subscriptions table
+CREATE TABLE IF NOT EXISTS refunds (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    pg text,
+    refund_id text,
+    transaction_id integer,
+    kind text,
+    amount real,
+    currency text,
+    reason text,
+    UNIQUE (pg, refund_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN license_seats;
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Add license_seats column to products table, products with seats issue a license key for each payment
+ALTER TABLE products ADD COLUMN license_seats INTEGER DEFAULT 0;
\ No newline at end of file
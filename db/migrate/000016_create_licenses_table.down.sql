@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS license_activations;
+DROP TABLE IF EXISTS licenses;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- License keys issued for the payments of products with license seats
+CREATE TABLE IF NOT EXISTS licenses (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    license_key text UNIQUE,
+    product_id integer,
+    transaction_id integer,
+    subscr_id text,
+    email text,
+    seats integer,
+    status text,
+    revoked_at text
+);
+
+-- Each device or installation a license key is activated on
+CREATE TABLE IF NOT EXISTS license_activations (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    license_id integer,
+    instance text,
+    UNIQUE (license_id, instance)
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS download_attempts;
+DROP TABLE IF EXISTS downloads;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- Download links issued for the payments of products with a file
+CREATE TABLE IF NOT EXISTS downloads (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    token text UNIQUE,
+    product_id integer,
+    transaction_id integer,
+    email text,
+    expires_at text,
+    max_downloads integer,
+    downloads integer DEFAULT 0,
+    status text
+);
+
+-- Every request for a download link, whether it was allowed or not
+CREATE TABLE IF NOT EXISTS download_attempts (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    download_id integer,
+    product_id integer,
+    ip text,
+    user_agent text,
+    result text
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- One-time login links emailed to customers for the customer area
+CREATE TABLE IF NOT EXISTS customer_logins (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    email text,
+    token_hash text UNIQUE,
+    expires_at text,
+    used_at text
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
\ No newline at end of file
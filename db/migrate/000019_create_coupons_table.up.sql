@@ -0,0 +1,32 @@
+-- Discount codes entered on the product page
+CREATE TABLE IF NOT EXISTS coupons (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    code text UNIQUE,
+    kind text,
+    value integer,
+    currency text,
+    product_id integer DEFAULT 0,
+    duration_months integer DEFAULT 0,
+    max_redemptions integer DEFAULT 0,
+    redemptions integer DEFAULT 0,
+    expires_at text,
+    status text
+);
+
+-- Each checkout a coupon was applied to, redeemed once the payment is recorded
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    coupon_id integer,
+    code text,
+    product_id integer,
+    pg text,
+    reference text,
+    discount integer,
+    currency text,
+    transaction_id integer DEFAULT 0,
+    status text
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN coupon_code;
+ALTER TABLE subscriptions DROP COLUMN discount;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Add the coupon redeemed for the payment or subscription and its discount to the subscriptions table
+ALTER TABLE subscriptions ADD COLUMN coupon_code TEXT;
+ALTER TABLE subscriptions ADD COLUMN discount REAL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE products DROP COLUMN price_mode;
+ALTER TABLE products DROP COLUMN suggested_price;
\ No newline at end of file
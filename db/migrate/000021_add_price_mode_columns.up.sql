@@ -0,0 +1,3 @@
+-- Add price_mode and suggested_price columns to products table, buyers choose what they pay above the price of pay what you want products
+ALTER TABLE products ADD COLUMN price_mode TEXT DEFAULT 'fixed';
+ALTER TABLE products ADD COLUMN suggested_price REAL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE products DROP COLUMN trial_days;
+ALTER TABLE subscriptions DROP COLUMN trial_status;
+ALTER TABLE subscriptions DROP COLUMN trial_ends_at;
+ALTER TABLE subscriptions DROP COLUMN trial_reminded_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Add trial_days to products table and the trial state of a subscription to subscriptions table, subscriptions of products with a trial are charged once it ends
+ALTER TABLE products ADD COLUMN trial_days INTEGER DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN trial_status TEXT;
+ALTER TABLE subscriptions ADD COLUMN trial_ends_at TEXT;
+ALTER TABLE subscriptions ADD COLUMN trial_reminded_at TEXT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE subscriptions DROP COLUMN ip_country;
+ALTER TABLE subscriptions DROP COLUMN tax_country;
+ALTER TABLE subscriptions DROP COLUMN tax_id;
+ALTER TABLE subscriptions DROP COLUMN tax_rate;
+ALTER TABLE subscriptions DROP COLUMN reverse_charge;
+DROP TABLE IF EXISTS tax_evidence;
+DROP TABLE IF EXISTS tax_rates;
@@ -0,0 +1,38 @@
+-- VAT and GST rates by the country of the buyer
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    country text UNIQUE,
+    name text,
+    percent real,
+    reverse_charge integer DEFAULT 0
+);
+
+-- The location evidence and tax of each checkout, attached to the payment or subscription once it is recorded
+CREATE TABLE IF NOT EXISTS tax_evidence (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    product_id integer,
+    pg text,
+    reference text,
+    ip_country text,
+    billing_country text,
+    tax_country text,
+    tax_id text,
+    tax_name text,
+    tax_percent real,
+    reverse_charge integer DEFAULT 0,
+    tax integer DEFAULT 0,
+    currency text,
+    transaction_id integer DEFAULT 0,
+    status text
+);
+
+-- Add the location evidence and tax rate of the payment or subscription to the subscriptions table, the billing country is stored in address_country_code
+ALTER TABLE subscriptions ADD COLUMN ip_country TEXT;
+ALTER TABLE subscriptions ADD COLUMN tax_country TEXT;
+ALTER TABLE subscriptions ADD COLUMN tax_id TEXT;
+ALTER TABLE subscriptions ADD COLUMN tax_rate REAL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN reverse_charge INTEGER DEFAULT 0;
\ No newline at end of file
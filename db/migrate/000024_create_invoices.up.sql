@@ -0,0 +1,38 @@
+-- Invoices issued for the payments and subscriptions in the subscriptions table, numbered in sequence
+CREATE TABLE IF NOT EXISTS invoices (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    number integer UNIQUE,
+    code text UNIQUE,
+    token text UNIQUE,
+    transaction_id integer UNIQUE,
+    product_id integer,
+    email text,
+    seller_name text,
+    seller_address text,
+    seller_tax_id text,
+    buyer_name text,
+    buyer_address text,
+    buyer_tax_id text,
+    currency text,
+    coupon_code text,
+    discount integer DEFAULT 0,
+    tax_label text,
+    tax integer DEFAULT 0,
+    total integer DEFAULT 0,
+    pg text,
+    reference text,
+    paid_at text
+);
+
+-- The items of each invoice
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    invoice_id integer,
+    description text,
+    quantity integer DEFAULT 1,
+    amount integer DEFAULT 0
+);
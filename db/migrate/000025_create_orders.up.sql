@@ -0,0 +1,26 @@
+-- Orders of carts of products paid in one checkout, the payment is recorded in the subscriptions table
+CREATE TABLE IF NOT EXISTS orders (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    token text UNIQUE,
+    pg text,
+    reference text,
+    transaction_id integer,
+    email text,
+    currency text,
+    amount integer DEFAULT 0,
+    tax integer DEFAULT 0,
+    status text
+);
+
+-- The products of each order
+CREATE TABLE IF NOT EXISTS order_items (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    order_id integer,
+    product_id integer,
+    name text,
+    amount integer DEFAULT 0
+);
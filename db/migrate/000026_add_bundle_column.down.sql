@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN bundle_product_ids;
\ No newline at end of file
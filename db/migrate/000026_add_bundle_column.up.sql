@@ -0,0 +1,2 @@
+-- Add bundle_product_ids column to products table, a bundle delivers each of the products with these ids when it is paid
+ALTER TABLE products ADD COLUMN bundle_product_ids TEXT DEFAULT '';
\ No newline at end of file
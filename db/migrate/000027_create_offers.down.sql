@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS offers;
+ALTER TABLE products DROP COLUMN bump_product_id;
+ALTER TABLE products DROP COLUMN upsell_product_id;
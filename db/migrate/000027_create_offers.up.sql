@@ -0,0 +1,24 @@
+-- Add bump_product_id and upsell_product_id columns to products table, the products offered as an add-on on the product page and after it is bought
+ALTER TABLE products ADD COLUMN bump_product_id INTEGER DEFAULT 0;
+ALTER TABLE products ADD COLUMN upsell_product_id INTEGER DEFAULT 0;
+
+-- Offers of order bumps and upsells made to buyers, tracked until they are paid for the offer report
+CREATE TABLE IF NOT EXISTS offers (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    token text UNIQUE,
+    kind text,
+    product_id integer,
+    offer_product_id integer,
+    pg text,
+    purchase_reference text,
+    customer_id text,
+    payment_method text,
+    reference text,
+    order_id integer DEFAULT 0,
+    transaction_id integer DEFAULT 0,
+    currency text,
+    amount integer DEFAULT 0,
+    status text
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS commissions;
+DROP TABLE IF EXISTS affiliates;
+ALTER TABLE subscriptions DROP COLUMN affiliate_id;
+ALTER TABLE products DROP COLUMN affiliate_rate;
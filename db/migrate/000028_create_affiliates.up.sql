@@ -0,0 +1,32 @@
+-- Add affiliate_rate column to products table, the percentage of the payment before tax earned by the affiliate who referred the buyer
+ALTER TABLE products ADD COLUMN affiliate_rate REAL DEFAULT 0;
+
+-- Add affiliate_id column to subscriptions table, the affiliate whose referral link the buyer followed
+ALTER TABLE subscriptions ADD COLUMN affiliate_id INTEGER DEFAULT 0;
+
+-- Affiliates with a referral code for their links and a secret token for their dashboard
+CREATE TABLE IF NOT EXISTS affiliates (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    name text,
+    email text,
+    code text UNIQUE,
+    token text UNIQUE,
+    status text
+);
+
+-- Ledger of the commissions earned by affiliates, reversed on refunds and paid out, the balance is the sum of the commissions
+CREATE TABLE IF NOT EXISTS commissions (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    affiliate_id integer,
+    transaction_id integer DEFAULT 0,
+    product_id integer DEFAULT 0,
+    kind text,
+    reference text,
+    currency text,
+    amount integer DEFAULT 0,
+    commission integer DEFAULT 0
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS subscription_state_changes;
+ALTER TABLE subscriptions DROP COLUMN state;
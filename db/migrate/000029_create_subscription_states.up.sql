@@ -0,0 +1,28 @@
+-- Add state column to subscriptions table, the canonical lifecycle state mapped from the status reported by the gateway
+ALTER TABLE subscriptions ADD COLUMN state TEXT DEFAULT '';
+
+-- History of the changes in the state of each payment and subscription with the gateway event which caused them
+CREATE TABLE IF NOT EXISTS subscription_state_changes (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    transaction_id integer,
+    from_state text,
+    to_state text,
+    pg text,
+    event_id text,
+    event_type text,
+    raw_status text
+);
+
+-- The state of existing payments and subscriptions is mapped from the last status reported by their gateway
+UPDATE subscriptions SET state = CASE
+    WHEN COALESCE(subscr_id, '') = '' AND lower(payment_status) IN ('refunded', 'disputed') THEN 'refunded'
+    WHEN COALESCE(subscr_id, '') = '' THEN 'active'
+    WHEN lower(payment_status) IN ('canceled', 'cancelled') THEN 'cancelled'
+    WHEN lower(payment_status) IN ('expired', 'deactivated', 'completed', 'incomplete_expired') THEN 'expired'
+    WHEN lower(payment_status) IN ('paused', 'suspended') THEN 'paused'
+    WHEN lower(payment_status) IN ('past_due', 'unpaid', 'halted', 'pending') THEN 'past_due'
+    WHEN trial_status = 'trialing' THEN 'trialing'
+    ELSE 'active'
+END;
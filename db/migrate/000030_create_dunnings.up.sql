@@ -0,0 +1,16 @@
+-- Failed payments of subscriptions being recovered, each is open until a later charge succeeds or the grace period ends
+CREATE TABLE IF NOT EXISTS dunnings (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    transaction_id integer,
+    product_id integer DEFAULT 0,
+    pg text,
+    status text,
+    amount integer DEFAULT 0,
+    currency text,
+    reminders integer DEFAULT 0,
+    reminded_at text,
+    grace_ends_at text,
+    closed_at text
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS subscription_plan_changes;
+ALTER TABLE products DROP COLUMN plan_product_ids;
\ No newline at end of file
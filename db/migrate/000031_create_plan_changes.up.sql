@@ -0,0 +1,15 @@
+-- Add plan_product_ids column to products table, subscribers of the product can change their plan to the products with these ids
+ALTER TABLE products ADD COLUMN plan_product_ids TEXT DEFAULT '';
+
+-- Changes of the plan of subscriptions from one product to another, pending until the customer approves them at the gateway if it asks
+CREATE TABLE IF NOT EXISTS subscription_plan_changes (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    transaction_id integer,
+    from_product_id integer DEFAULT 0,
+    to_product_id integer DEFAULT 0,
+    pg text,
+    plan_id text,
+    status text
+);
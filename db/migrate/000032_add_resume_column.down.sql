@@ -0,0 +1 @@
+ALTER TABLE subscriptions DROP COLUMN resumes_at;
\ No newline at end of file
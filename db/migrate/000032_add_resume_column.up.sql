@@ -0,0 +1,2 @@
+-- Add resumes_at column to subscriptions table, a paused subscription is resumed at this time if one was chosen
+ALTER TABLE subscriptions ADD COLUMN resumes_at TEXT;
\ No newline at end of file
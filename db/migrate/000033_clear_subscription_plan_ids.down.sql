@@ -0,0 +1,2 @@
+-- The plan ids cleared from the payment ids of subscriptions are not restored
+SELECT 1;
@@ -0,0 +1,2 @@
+-- Clear the plan ids recorded as the payment ids of PayPal, Square and Razorpay subscriptions, the plan is shared by every subscriber
+UPDATE subscriptions SET txn_id = NULL WHERE subscr_id <> '' AND (pg IN ('paypal', 'square') OR (pg = 'razorpay' AND txn_id LIKE 'plan!_%' ESCAPE '!'));
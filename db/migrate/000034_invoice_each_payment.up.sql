@@ -0,0 +1,39 @@
+-- Each payment of a subscription gets an invoice of its own, so invoices are unique by the payment at the gateway
+-- rather than the transaction. SQLite doesn't support dropping a constraint, so the table is recreated
+
+CREATE TABLE invoices_new (
+    id integer primary key autoincrement,
+    created_at text,
+    updated_at text,
+    number integer UNIQUE,
+    code text UNIQUE,
+    token text UNIQUE,
+    transaction_id integer,
+    product_id integer,
+    email text,
+    seller_name text,
+    seller_address text,
+    seller_tax_id text,
+    buyer_name text,
+    buyer_address text,
+    buyer_tax_id text,
+    currency text,
+    coupon_code text,
+    discount integer DEFAULT 0,
+    tax_label text,
+    tax integer DEFAULT 0,
+    total integer DEFAULT 0,
+    pg text,
+    reference text,
+    paid_at text
+);
+
+INSERT INTO invoices_new (id, created_at, updated_at, number, code, token, transaction_id, product_id, email, seller_name, seller_address, seller_tax_id, buyer_name, buyer_address, buyer_tax_id, currency, coupon_code, discount, tax_label, tax, total, pg, reference, paid_at)
+SELECT id, created_at, updated_at, number, code, token, transaction_id, product_id, email, seller_name, seller_address, seller_tax_id, buyer_name, buyer_address, buyer_tax_id, currency, coupon_code, discount, tax_label, tax, total, pg, reference, paid_at FROM invoices;
+
+DROP TABLE invoices;
+
+ALTER TABLE invoices_new RENAME TO invoices;
+
+CREATE INDEX IF NOT EXISTS invoices_transaction_id ON invoices (transaction_id);
+CREATE UNIQUE INDEX IF NOT EXISTS invoices_pg_reference ON invoices (pg, reference) WHERE reference <> '';
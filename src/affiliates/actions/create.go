@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandleCreate responds to POST /affiliates/create by adding the affiliate.
+func HandleCreate(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can add affiliates"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	affiliateParams, err := affiliates.CreateParams(params.Map())
+	if err != nil {
+		return server.Redirect(w, r, "/affiliates?error="+url.QueryEscape(err.Error()))
+	}
+
+	id, err := affiliates.New().Create(affiliateParams)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	log.Info(log.V{"msg": "Affiliate added", "id": id, "code": affiliateParams["code"]})
+
+	return server.Redirect(w, r, "/affiliates")
+}
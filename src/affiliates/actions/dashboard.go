@@ -0,0 +1,73 @@
+package actions
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// commissionListLimit is the number of ledger entries shown on the dashboard
+const commissionListLimit = 100
+
+// HandleDashboard responds to GET /affiliates/dashboard/{token} by showing the affiliate their referral link,
+// the commission owed to them and their ledger, the token is the secret link of the affiliate.
+func HandleDashboard(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	affiliate, err := affiliates.FindToken(params.Get("token"))
+	if err != nil {
+		return server.NotFoundError(err, "Dashboard not found", "This link to an affiliate dashboard is not valid.")
+	}
+
+	balances, err := affiliates.Balances(affiliate.ID)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	commissions, err := affiliates.FindCommissions(affiliates.CommissionsQuery().Where("affiliate_id=?", affiliate.ID).Limit(commissionListLimit))
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// The products are shown by name, a deleted product by its id
+	names := make(map[int64]string)
+	for _, commission := range commissions {
+		if _, ok := names[commission.ProductID]; ok || commission.ProductID == 0 {
+			continue
+		}
+		names[commission.ProductID] = "#" + strconv.FormatInt(commission.ProductID, 10)
+		product, err := products.Find(commission.ProductID)
+		if err == nil {
+			names[commission.ProductID] = product.Name
+		}
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("affiliate", affiliate)
+	view.AddKey("balances", balances)
+	view.AddKey("commissions", commissions)
+	view.AddKey("names", names)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("meta_title", "Affiliate Dashboard")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("affiliates/views/dashboard.html.got")
+
+	return view.Render()
+}
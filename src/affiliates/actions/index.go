@@ -0,0 +1,72 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+)
+
+// affiliateListLimit is the number of affiliates shown on a page
+const affiliateListLimit = 50
+
+// HandleIndex responds to GET /affiliates by listing the affiliates with the commission owed to them and a form to add one.
+func HandleIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view affiliates"))
+	}
+
+	q := affiliates.Query().Limit(affiliateListLimit)
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(affiliateListLimit * page)
+	}
+
+	affiliateList, err := affiliates.FindAll(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// The balances of each affiliate by currency
+	allBalances, err := affiliates.Balances(0)
+	if err != nil {
+		return server.InternalError(err)
+	}
+	balances := make(map[int64][]*affiliates.Balance)
+	for _, balance := range allBalances {
+		balances[balance.AffiliateID] = append(balances[balance.AffiliateID], balance)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("affiliates", affiliateList)
+	view.AddKey("balances", balances)
+	view.AddKey("page", page)
+	view.AddKey("error", params.Get("error"))
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Affiliates")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("affiliates/views/index.html.got")
+
+	return view.Render()
+}
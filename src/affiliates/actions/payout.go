@@ -0,0 +1,96 @@
+package actions
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandlePayout responds to POST /affiliates/n/payout by recording the commission owed to the affiliate as paid out,
+// the admin pays the affiliate outside of the store.
+func HandlePayout(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can pay out commissions"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	affiliate, err := affiliates.Find(params.GetInt(affiliates.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	paid, err := affiliates.Payout(affiliate.ID)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	for _, balance := range paid {
+		log.Info(log.V{"msg": "Affiliate commission paid out", "id": affiliate.ID, "amount": balance.Owed(), "currency": balance.Currency})
+	}
+
+	return server.Redirect(w, r, "/affiliates")
+}
+
+// HandlePayouts responds to GET /affiliates/payouts.csv with the commission owed to each affiliate in each currency,
+// it is the list of payouts to make before they are recorded.
+func HandlePayouts(w http.ResponseWriter, r *http.Request) error {
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view payouts"))
+	}
+
+	balances, err := affiliates.Balances(0)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=affiliate-payouts-"+time.Now().UTC().Format("2006-01-02")+".csv")
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"affiliate_id", "name", "email", "code", "currency", "earned", "paid", "owed"})
+	for _, balance := range balances {
+		if balance.Owed() <= 0 {
+			continue
+		}
+
+		affiliate, err := affiliates.Find(balance.AffiliateID)
+		if err != nil {
+			affiliate = affiliates.New()
+		}
+
+		writer.Write([]string{strconv.FormatInt(balance.AffiliateID, 10), affiliate.Name, affiliate.Email, affiliate.Code, balance.Currency,
+			majorUnits(balance.Earned), majorUnits(balance.Paid), majorUnits(balance.Owed())})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// majorUnits returns the amount in the smallest currency unit as a decimal like 10.50
+func majorUnits(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/100, 'f', 2, 64)
+}
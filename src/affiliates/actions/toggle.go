@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandleToggle responds to POST /affiliates/n/toggle by disabling an active affiliate or enabling a disabled one.
+func HandleToggle(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can update affiliates"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	affiliate, err := affiliates.Find(params.GetInt(affiliates.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if affiliate.Active() {
+		err = affiliate.Disable()
+	} else {
+		err = affiliate.Enable()
+	}
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/affiliates")
+}
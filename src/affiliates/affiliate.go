@@ -0,0 +1,57 @@
+// Package affiliates represents the affiliates who refer buyers with their links and the commissions they earn
+package affiliates
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+// tokenLength is the number of random bytes in the token of an affiliate's dashboard
+const tokenLength = 16
+
+// Affiliate refers buyers with links carrying their code and earns a commission on their purchases
+type Affiliate struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Name  string
+	Email string
+	// Code is added to links as ?ref=code, Token is the secret of the affiliate's dashboard
+	Code   string
+	Token  string
+	Status string
+}
+
+// Active reports whether purchases referred by the affiliate earn a commission
+func (a *Affiliate) Active() bool {
+	return a.Status == StatusActive
+}
+
+// ReferralURL returns the link to the store with the affiliate's code, the code can be added to the link of any page
+func (a *Affiliate) ReferralURL() string {
+	return config.Get("root_url") + "/?ref=" + a.Code
+}
+
+// DashboardURL returns the link the affiliate views their commissions with
+func (a *Affiliate) DashboardURL() string {
+	return config.Get("root_url") + "/affiliates/dashboard/" + a.Token
+}
+
+// NormaliseCode returns the code in the form it is stored, codes are not case sensitive
+func NormaliseCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// generateToken returns a new random token for an affiliate's dashboard
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,54 @@
+// Tests for affiliates
+package affiliates
+
+import (
+	"testing"
+)
+
+// Test commissions are rounded to the smallest currency unit and nothing is earned without a rate
+func TestRate(t *testing.T) {
+	tests := []struct {
+		amount     int64
+		rate       float64
+		commission int64
+	}{
+		{1000, 20, 200},
+		{999, 12.5, 125},
+		{1000, 0, 0},
+		{0, 20, 0},
+	}
+
+	for _, test := range tests {
+		commission := Rate(test.amount, test.rate)
+		if commission != test.commission {
+			t.Fatalf("affiliates: expected commission %d on %d at %v%% got:%d", test.commission, test.amount, test.rate, commission)
+		}
+	}
+}
+
+// Test reversals are in proportion to the refund and never take back more than is left of the commission
+func TestReversal(t *testing.T) {
+	tests := []struct {
+		commission int64
+		reversed   int64
+		refunded   int64
+		gross      int64
+		reversal   int64
+	}{
+		{200, 0, 1000, 1000, 200},
+		{200, 0, 500, 1000, 100},
+		{200, -100, 500, 1000, 100},
+		{200, -150, 500, 1000, 50},
+		{200, -200, 500, 1000, 0},
+		{200, 0, 1200, 1000, 200},
+		{200, 0, 0, 1000, 0},
+		{200, -50, 100, 0, 150},
+	}
+
+	for _, test := range tests {
+		amount := reversal(test.commission, test.reversed, test.refunded, test.gross)
+		if amount != test.reversal {
+			t.Fatalf("affiliates: expected reversal %d of %d with %d reversed for %d of %d got:%d", test.reversal, test.commission, test.reversed, test.refunded, test.gross, amount)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package affiliates
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// CommissionsTableName is the database table of the commission ledger
+	CommissionsTableName = "commissions"
+
+	// KindCommission is the commission earned on a payment referred by the affiliate
+	KindCommission = "commission"
+	// KindReversal takes back the commission on the part of a payment which was refunded or disputed
+	KindReversal = "reversal"
+	// KindPayout is the commission paid out to the affiliate
+	KindPayout = "payout"
+)
+
+// Commission is an entry in the ledger of an affiliate, the balance owed to the affiliate is the sum of the entries
+type Commission struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	AffiliateID int64
+	// TransactionID is the payment in the subscriptions table the commission is earned on or reversed for
+	TransactionID int64
+	ProductID     int64
+	Kind          string
+	// Reference is the refund or dispute id of a reversal
+	Reference string
+	Currency  string
+	// Amount is the payment including tax, the amount refunded or the amount paid out, Commission is negative
+	// for reversals and payouts, both in the smallest currency unit
+	Amount     int64
+	Commission int64
+}
+
+// CommissionDisplay returns the commission with its currency like -1.50 USD
+func (c *Commission) CommissionDisplay() string {
+	return amountDisplay(c.Commission, c.Currency)
+}
+
+// AmountDisplay returns the amount the commission is on with its currency like 15.00 USD
+func (c *Commission) AmountDisplay() string {
+	return amountDisplay(c.Amount, c.Currency)
+}
+
+// Balance is the commission earned by an affiliate in a currency and the part of it paid out
+type Balance struct {
+	AffiliateID int64
+	Currency    string
+	// Earned is the commissions less their reversals, in the smallest currency unit
+	Earned int64
+	Paid   int64
+}
+
+// Owed returns the commission which hasn't been paid out yet in the smallest currency unit
+func (b *Balance) Owed() int64 {
+	return b.Earned - b.Paid
+}
+
+// OwedDisplay returns the commission owed with its currency like 12.50 USD
+func (b *Balance) OwedDisplay() string {
+	return amountDisplay(b.Owed(), b.Currency)
+}
+
+// EarnedDisplay returns the commission earned with its currency like 20.00 USD
+func (b *Balance) EarnedDisplay() string {
+	return amountDisplay(b.Earned, b.Currency)
+}
+
+// PaidDisplay returns the commission paid out with its currency like 7.50 USD
+func (b *Balance) PaidDisplay() string {
+	return amountDisplay(b.Paid, b.Currency)
+}
+
+// Rate returns the commission at the percentage rate on the amount in the smallest currency unit.
+func Rate(amount int64, rate float64) int64 {
+	if amount <= 0 || rate <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(amount) * rate / 100))
+}
+
+// reversal returns the part of the commission taken back for a refund of the payment of the gross amount, it is in proportion
+// to the amount refunded and never more than the commission left after the earlier reversals, which are negative.
+func reversal(commission int64, reversed int64, refunded int64, gross int64) int64 {
+	remaining := commission + reversed
+	if remaining <= 0 || refunded <= 0 {
+		return 0
+	}
+
+	amount := remaining
+	if gross > 0 {
+		amount = int64(math.Round(float64(commission) * float64(refunded) / float64(gross)))
+	}
+	if amount > remaining {
+		amount = remaining
+	}
+	return amount
+}
+
+// NewCommissionWithColumns creates a new commission instance and fills it with data from the database cols provided.
+func NewCommissionWithColumns(cols map[string]interface{}) *Commission {
+	commission := NewCommission()
+	commission.ID = resource.ValidateInt(cols["id"])
+	commission.CreatedAt = resource.ValidateTime(cols["created_at"])
+	commission.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	commission.AffiliateID = resource.ValidateInt(cols["affiliate_id"])
+	commission.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	commission.ProductID = resource.ValidateInt(cols["product_id"])
+	commission.Kind = resource.ValidateString(cols["kind"])
+	commission.Reference = resource.ValidateString(cols["reference"])
+	commission.Currency = resource.ValidateString(cols["currency"])
+	commission.Amount = resource.ValidateInt(cols["amount"])
+	commission.Commission = resource.ValidateInt(cols["commission"])
+	return commission
+}
+
+// NewCommission creates and initialises a new commission instance.
+func NewCommission() *Commission {
+	commission := &Commission{}
+	commission.CreatedAt = time.Now()
+	commission.UpdatedAt = time.Now()
+	commission.TableName = CommissionsTableName
+	commission.KeyName = KeyName
+	return commission
+}
+
+// Earn records the commission of the affiliate on the payment of the amount in the subscriptions table
+// in the transaction, a payment earns a commission once.
+func Earn(tx *query.Tx, affiliateID int64, transactionID int64, productID int64, currency string, amount int64, commission int64) error {
+	if commission <= 0 {
+		return nil
+	}
+
+	_, err := CommissionsQueryTx(tx).Where("transaction_id=?", transactionID).Where("kind=?", KindCommission).FirstResult()
+	if err == nil {
+		return nil
+	}
+
+	return record(tx, &Commission{
+		AffiliateID:   affiliateID,
+		TransactionID: transactionID,
+		ProductID:     productID,
+		Kind:          KindCommission,
+		Currency:      currency,
+		Amount:        amount,
+		Commission:    commission,
+	})
+}
+
+// Reverse takes back the part of the commission on the payment in the subscriptions table for the refund or dispute with the
+// reference of the amount in the smallest currency unit in the transaction. Payments which earned no commission are ignored.
+func Reverse(tx *query.Tx, transactionID int64, reference string, refunded int64) error {
+	entries, err := FindCommissions(CommissionsQueryTx(tx).Where("transaction_id=?", transactionID))
+	if err != nil {
+		return err
+	}
+
+	var earned *Commission
+	var reversed int64
+	for _, entry := range entries {
+		switch entry.Kind {
+		case KindCommission:
+			earned = entry
+		case KindReversal:
+			if reference != "" && entry.Reference == reference {
+				return nil
+			}
+			reversed += entry.Commission
+		}
+	}
+	if earned == nil {
+		return nil
+	}
+
+	amount := reversal(earned.Commission, reversed, refunded, earned.Amount)
+	if amount == 0 {
+		return nil
+	}
+
+	return record(tx, &Commission{
+		AffiliateID:   earned.AffiliateID,
+		TransactionID: transactionID,
+		ProductID:     earned.ProductID,
+		Kind:          KindReversal,
+		Reference:     reference,
+		Currency:      earned.Currency,
+		Amount:        refunded,
+		Commission:    -amount,
+	})
+}
+
+// Payout records the commission owed to the affiliate in each currency as paid out, it returns the balances paid.
+func Payout(affiliateID int64) ([]*Balance, error) {
+	balances, err := Balances(affiliateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var paid []*Balance
+	for _, balance := range balances {
+		if balance.Owed() <= 0 {
+			continue
+		}
+
+		err = record(nil, &Commission{
+			AffiliateID: affiliateID,
+			Kind:        KindPayout,
+			Currency:    balance.Currency,
+			Amount:      balance.Owed(),
+			Commission:  -balance.Owed(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		paid = append(paid, balance)
+	}
+
+	return paid, nil
+}
+
+// Balances sums the ledger of the affiliate by currency, or of every affiliate for 0.
+func Balances(affiliateID int64) ([]*Balance, error) {
+	q := CommissionsQuery()
+	if affiliateID > 0 {
+		q.Where("affiliate_id=?", affiliateID)
+	}
+
+	entries, err := FindCommissions(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]*Balance)
+	var balances []*Balance
+	for _, entry := range entries {
+		currency := strings.ToUpper(entry.Currency)
+		key := strconv.FormatInt(entry.AffiliateID, 10) + "/" + currency
+		balance, ok := sums[key]
+		if !ok {
+			balance = &Balance{AffiliateID: entry.AffiliateID, Currency: currency}
+			sums[key] = balance
+			balances = append(balances, balance)
+		}
+
+		if entry.Kind == KindPayout {
+			balance.Paid -= entry.Commission
+		} else {
+			balance.Earned += entry.Commission
+		}
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].AffiliateID != balances[j].AffiliateID {
+			return balances[i].AffiliateID < balances[j].AffiliateID
+		}
+		return balances[i].Currency < balances[j].Currency
+	})
+
+	return balances, nil
+}
+
+// FindCommissions fetches all commission records matching this query from the database.
+func FindCommissions(q *query.Query) ([]*Commission, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var commissions []*Commission
+	for _, cols := range results {
+		commissions = append(commissions, NewCommissionWithColumns(cols))
+	}
+
+	return commissions, nil
+}
+
+// CommissionsQuery returns a new query for the commission ledger with a default order.
+func CommissionsQuery() *query.Query {
+	return CommissionsQueryTx(nil)
+}
+
+// CommissionsQueryTx returns a new query for the commission ledger with a default order in the transaction.
+func CommissionsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(CommissionsTableName, KeyName).Order(Order)
+}
+
+// record adds the entry to the ledger in the transaction
+func record(tx *query.Tx, entry *Commission) error {
+	if entry.AffiliateID == 0 {
+		return errors.New("no affiliate for the commission")
+	}
+
+	commissionParams := map[string]string{
+		"affiliate_id":   strconv.FormatInt(entry.AffiliateID, 10),
+		"transaction_id": strconv.FormatInt(entry.TransactionID, 10),
+		"product_id":     strconv.FormatInt(entry.ProductID, 10),
+		"kind":           entry.Kind,
+		"reference":      entry.Reference,
+		"currency":       strings.ToUpper(entry.Currency),
+		"amount":         strconv.FormatInt(entry.Amount, 10),
+		"commission":     strconv.FormatInt(entry.Commission, 10),
+	}
+
+	_, err := NewCommission().CreateTx(tx, commissionParams)
+	return err
+}
+
+// amountDisplay returns the amount in the smallest currency unit as a decimal with its currency like 10.50 USD
+func amountDisplay(amount int64, currency string) string {
+	return strconv.FormatFloat(float64(amount)/100, 'f', 2, 64) + " " + strings.ToUpper(currency)
+}
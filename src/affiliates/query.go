@@ -0,0 +1,189 @@
+package affiliates
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "affiliates"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "id desc"
+
+	// StatusActive is the status of an affiliate whose referrals earn a commission
+	StatusActive = "active"
+	// StatusDisabled is the status of an affiliate who has been switched off by the admin
+	StatusDisabled = "disabled"
+)
+
+// AllowedParams returns an array of acceptable params in create
+func AllowedParams() []string {
+	return []string{"name", "email", "code"}
+}
+
+// CodePattern is the format of a referral code after it is normalised
+var CodePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// CreateParams validates the affiliate submitted by the admin and returns the params to create it with.
+func CreateParams(params map[string]string) (map[string]string, error) {
+	params = New().ValidateParams(params, AllowedParams())
+
+	affiliateParams := make(map[string]string)
+
+	affiliateParams["name"] = strings.TrimSpace(params["name"])
+	if affiliateParams["name"] == "" {
+		return nil, errors.New("name of the affiliate is required")
+	}
+
+	affiliateParams["email"] = strings.TrimSpace(params["email"])
+	if !strings.Contains(affiliateParams["email"], "@") {
+		return nil, errors.New("email of the affiliate is required")
+	}
+
+	code := NormaliseCode(params["code"])
+	if !CodePattern.MatchString(code) {
+		return nil, errors.New("code should be up to 32 letters, numbers, dashes or underscores")
+	}
+	if _, err := FindCode(code); err == nil {
+		return nil, errors.New("an affiliate with this code already exists")
+	}
+	affiliateParams["code"] = code
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	affiliateParams["token"] = token
+	affiliateParams["status"] = StatusActive
+
+	return affiliateParams, nil
+}
+
+// NewWithColumns creates a new affiliate instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Affiliate {
+	affiliate := New()
+	affiliate.ID = resource.ValidateInt(cols["id"])
+	affiliate.CreatedAt = resource.ValidateTime(cols["created_at"])
+	affiliate.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	affiliate.Name = resource.ValidateString(cols["name"])
+	affiliate.Email = resource.ValidateString(cols["email"])
+	affiliate.Code = resource.ValidateString(cols["code"])
+	affiliate.Token = resource.ValidateString(cols["token"])
+	affiliate.Status = resource.ValidateString(cols["status"])
+	return affiliate
+}
+
+// New creates and initialises a new affiliate instance.
+func New() *Affiliate {
+	affiliate := &Affiliate{}
+	affiliate.CreatedAt = time.Now()
+	affiliate.UpdatedAt = time.Now()
+	affiliate.TableName = TableName
+	affiliate.KeyName = KeyName
+	return affiliate
+}
+
+// Disable switches the affiliate off so their referrals don't earn a commission anymore
+func (a *Affiliate) Disable() error {
+	return a.setStatus(StatusDisabled)
+}
+
+// Enable switches the affiliate back on
+func (a *Affiliate) Enable() error {
+	return a.setStatus(StatusActive)
+}
+
+func (a *Affiliate) setStatus(status string) error {
+	err := a.Update(map[string]string{"status": status})
+	if err != nil {
+		return err
+	}
+
+	a.Status = status
+	return nil
+}
+
+// Find fetches a single affiliate record from the database by id.
+func Find(id int64) (*Affiliate, error) {
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single affiliate record by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*Affiliate, error) {
+	result, err := QueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindCode fetches the affiliate with the referral code, codes are not case sensitive.
+func FindCode(code string) (*Affiliate, error) {
+	result, err := Query().Where("code=?", NormaliseCode(code)).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindReferral fetches the active affiliate with the referral code of the link the buyer followed.
+func FindReferral(code string) (*Affiliate, error) {
+	if code == "" {
+		return nil, errors.New("no referral code")
+	}
+
+	affiliate, err := FindCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if !affiliate.Active() {
+		return nil, errors.New("affiliate has been disabled")
+	}
+	return affiliate, nil
+}
+
+// FindToken fetches the affiliate with the token of their dashboard.
+func FindToken(token string) (*Affiliate, error) {
+	if token == "" {
+		return nil, errors.New("no token for the affiliate")
+	}
+
+	result, err := Query().Where("token=?", token).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAll fetches all affiliate records matching this query from the database.
+func FindAll(q *query.Query) ([]*Affiliate, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var affiliates []*Affiliate
+	for _, cols := range results {
+		affiliates = append(affiliates, NewWithColumns(cols))
+	}
+
+	return affiliates, nil
+}
+
+// Query returns a new query for affiliates with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for affiliates with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
@@ -50,14 +50,28 @@ func Setup(mu *sync.RWMutex) {
 	// Setup our database
 	SetupDatabase(mu)
 
+	// Deliver queued product webhooks
+	SetupWebhooks()
+
+	// Remind customers before their free trial ends
+	SetupTrials()
+
+	// Remind customers whose subscription payment failed
+	SetupDunning()
+
+	// Resume paused subscriptions on their resume date
+	SetupPauses()
+
 	// Setup our authentication and authorisation
 	SetupAuth()
 
 	// Setup our router and handlers
 	SetupRoutes()
 
-	// Setup mail from config
-	// SetupMail()
+	// Setup mail from config, mail is only sent when a mail service is configured
+	if config.Get("mail_secret") != "" {
+		SetupMail()
+	}
 
 	// Set up default user
 	SetupDefaultUser()
@@ -291,6 +291,24 @@ function paymentScriptType() {
   return meta.getAttribute("content");
 }
 
+// Collect the start time of a subscription with a free trial from the meta tags in header
+function subscriptionStartTime() {
+  var meta = DOM.First("meta[name='subscription_start_time']");
+  if (meta === undefined) {
+    return "";
+  }
+  return meta.getAttribute("content");
+}
+
+// Collect the affiliate who referred the buyer from the meta tags in header
+function affiliateID() {
+  var meta = DOM.First("meta[name='affiliate_ID']");
+  if (meta === undefined) {
+    return "";
+  }
+  return meta.getAttribute("content");
+}
+
 // Collect the product order ID from the meta tags in header
 function orderID() {
   var meta = DOM.First("meta[name='product_order_ID']");
@@ -76,6 +76,7 @@ func generateConfig(projectPath string) error {
 		"db_adapter":                  "sqlite3",
 		"hmac_key":                    randomKey(32),
 		"secret_key":                  randomKey(32),
+		"license_secret":              randomKey(32),
 		"log":                         "log/development.log",
 		"name":                        "Open Payment Host",
 		"meta_url":                    "",
@@ -93,6 +94,14 @@ func generateConfig(projectPath string) error {
 		"turnstile_site_key":          "1x00000000000000000000AA",
 		"turnstile_secret_key":        "1x0000000000000000000000000000000AA",
 		"mailchimp_token":             "",
+		"mail_from":                   "",
+		"mail_secret":                 "",
+		"email_receipts":              "no",
+		"email_invoices":              "yes",
+		"invoice_prefix":              "INV-",
+		"invoice_seller_name":         "",
+		"invoice_seller_address":      "",
+		"invoice_seller_tax_id":       "",
 		"stripe_key":                  "",
 		"stripe_secret":               "",
 		"stripe_webhook_secret":       "",
@@ -109,6 +118,15 @@ func generateConfig(projectPath string) error {
 		"square_sandbox_source_id":    "cnon:card-nonce-ok",
 		"s3_access_key":               "",
 		"s3_secret_key":               "",
+		"s3_region":                   "us-east-1",
+		"s3_endpoint":                 "",
+		"download_expiry_hours":       "72",
+		"download_limit":              "5",
+		"trial_reminder_days":         "3",
+		"dunning_reminder_days":       "0,3,6",
+		"dunning_grace_days":          "7",
+		"dunning_cancel_at_gateway":   "no",
+		"tax_inclusive":               "no",
 		"paypal":                      "",
 		"paypal_client_id":            "",
 		"paypal_client_secret":        "",
@@ -120,6 +138,7 @@ func generateConfig(projectPath string) error {
 		"razorpay_key_secret":         "",
 		"razorpay_webhook_secret":     "",
 		"whatsapp_number":             "",
+		"webhook_max_attempts":        "10",
 	}
 
 	// Copying development values to production and then adding more
@@ -136,6 +155,7 @@ func generateConfig(projectPath string) error {
 	ConfigProduction["autocert_ssl"] = "no"
 	ConfigProduction["hmac_key"] = randomKey(32)
 	ConfigProduction["secret_key"] = randomKey(32)
+	ConfigProduction["license_secret"] = randomKey(32)
 	ConfigProduction["turnstile_site_key"] = ""
 	ConfigProduction["turnstile_secret_key"] = ""
 	ConfigProduction["root_url"] = ""
@@ -9,9 +9,18 @@ import (
 	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
 
 	// Resource Actions
+	affiliateactions "github.com/abishekmuthian/open-payment-host/src/affiliates/actions"
 	appactions "github.com/abishekmuthian/open-payment-host/src/app/actions"
+	couponactions "github.com/abishekmuthian/open-payment-host/src/coupons/actions"
+	customeractions "github.com/abishekmuthian/open-payment-host/src/customers/actions"
+	downloadactions "github.com/abishekmuthian/open-payment-host/src/downloads/actions"
+	invoiceactions "github.com/abishekmuthian/open-payment-host/src/invoices/actions"
+	licenseactions "github.com/abishekmuthian/open-payment-host/src/licenses/actions"
+	offeractions "github.com/abishekmuthian/open-payment-host/src/offers/actions"
+	orderactions "github.com/abishekmuthian/open-payment-host/src/orders/actions"
 	storyactions "github.com/abishekmuthian/open-payment-host/src/products/actions"
 	subscriptionactions "github.com/abishekmuthian/open-payment-host/src/subscriptions/actions"
+	taxactions "github.com/abishekmuthian/open-payment-host/src/taxes/actions"
 	useractions "github.com/abishekmuthian/open-payment-host/src/users/actions"
 )
 
@@ -61,6 +70,13 @@ func SetupRoutes() *mux.Mux {
 	router.Get("/products/{id:[0-9]+}/subscription", subscriptions.HandleSubscriptionShow)
 	router.Post("/products/{id:[0-9]+}/subscription/subscribe", subscriptions.HandleSubscription)
 	router.Post("/products/{id:[0-9]+}/subscription/unsubscribe", subscriptions.HandleUnSubscription)
+	router.Get("/products/{id:[0-9]+}/webhooks", subscriptionactions.HandleWebhookIndex)
+	router.Post("/products/{id:[0-9]+}/webhooks/{delivery_id:[0-9]+}/replay", subscriptionactions.HandleWebhookReplay)
+	router.Get("/products/{id:[0-9]+}/payments", subscriptionactions.HandlePaymentIndex)
+	router.Post("/products/{id:[0-9]+}/payments/{transaction_id:[0-9]+}/refund", subscriptionactions.HandleRefund)
+	router.Post("/products/{id:[0-9]+}/payments/{transaction_id:[0-9]+}/pause", subscriptionactions.HandlePause)
+	router.Post("/products/{id:[0-9]+}/payments/{transaction_id:[0-9]+}/resume", subscriptionactions.HandleResume)
+	router.Get("/products/{id:[0-9]+}/downloads", downloadactions.HandleAttemptIndex)
 	// For show insights link the product page
 	//router.Post("/products/{id:[0-9]+}/insights", storyactions.HandleInsights)
 	router.Get("/products/{id:[0-9]+}", storyactions.HandleShow)
@@ -79,7 +95,8 @@ func SetupRoutes() *mux.Mux {
 	router.Get("/subscriptions/razorpay", subscriptions.HandleRazorpayShow)
 	router.Post("/subscriptions/subscribe", subscriptions.HandleCreateSubscription)
 	router.Get("/subscriptions/success", subscriptions.HandlePaymentSuccess)
-	router.Get("/subscriptions/cancel", subscriptionactions.HandlePaymentCancel)
+	router.Get("/subscriptions/cancel", subscriptionactions.HandlePaymentCancelShow)
+	router.Post("/subscriptions/cancel", subscriptionactions.HandlePaymentCancel)
 	router.Post("/subscriptions/stripe-webhook", subscriptions.HandleWebhook)
 	router.Post("/subscriptions/square-webhook", subscriptions.HandleSquareWebhook)
 	router.Post("/subscriptions/paypal-webhook", subscriptions.HandlePaypalWebhook)
@@ -88,6 +105,69 @@ func SetupRoutes() *mux.Mux {
 	// Billing not yet active
 	// router.Post("/subscriptions/manage-billing", subscriptions.HandleCustomerPortal)
 
+	// Add customer routes
+	router.Get("/customers", customeractions.HandleShow)
+	router.Get("/customers/login", customeractions.HandleLoginShow)
+	router.Post("/customers/login", customeractions.HandleLogin)
+	router.Get("/customers/login/{token:[a-f0-9]+}", customeractions.HandleLoginLink)
+	router.Post("/customers/logout", customeractions.HandleLogout)
+	router.Post("/customers/purchases/{id:[0-9]+}/download", customeractions.HandleDownload)
+	router.Post("/customers/purchases/{id:[0-9]+}/cancel", customeractions.HandleCancel)
+	router.Post("/customers/purchases/{id:[0-9]+}/payment", customeractions.HandlePaymentUpdate)
+	router.Post("/customers/purchases/{id:[0-9]+}/plan", customeractions.HandlePlanChange)
+	router.Post("/customers/purchases/{id:[0-9]+}/pause", customeractions.HandlePause)
+	router.Post("/customers/purchases/{id:[0-9]+}/resume", customeractions.HandleResume)
+
+	// Add cart and order routes
+	router.Get("/cart", orderactions.HandleCartShow)
+	router.Post("/cart/add", orderactions.HandleCartAdd)
+	router.Post("/cart/remove", orderactions.HandleCartRemove)
+	router.Post("/cart/checkout", subscriptions.HandleCartCheckout)
+	router.Get("/cart/paypal", subscriptions.HandleCartPaypalReturn)
+	router.Get("/orders", orderactions.HandleIndex)
+
+	// Add offer routes, the report is matched before the tokens of offers
+	router.Post("/subscriptions/bump", subscriptions.HandleBumpCheckout)
+	router.Get("/offers/report{format:(.csv)?}", offeractions.HandleReport)
+	router.Get("/offers/{token:[a-f0-9]+}", subscriptions.HandleOfferShow)
+	router.Post("/offers/{token:[a-f0-9]+}/accept", subscriptions.HandleOfferAccept)
+	router.Post("/offers/{token:[a-f0-9]+}/decline", subscriptions.HandleOfferDecline)
+
+	// Add coupon routes
+	router.Get("/coupons", couponactions.HandleIndex)
+	router.Post("/coupons/create", couponactions.HandleCreate)
+	router.Post("/coupons/{id:[0-9]+}/toggle", couponactions.HandleToggle)
+	router.Post("/coupons/{id:[0-9]+}/destroy", couponactions.HandleDestroy)
+
+	// Add affiliate routes
+	router.Get("/affiliates", affiliateactions.HandleIndex)
+	router.Post("/affiliates/create", affiliateactions.HandleCreate)
+	router.Post("/affiliates/{id:[0-9]+}/toggle", affiliateactions.HandleToggle)
+	router.Post("/affiliates/{id:[0-9]+}/payout", affiliateactions.HandlePayout)
+	router.Get("/affiliates/payouts.csv", affiliateactions.HandlePayouts)
+	router.Get("/affiliates/dashboard/{token:[a-f0-9]+}", affiliateactions.HandleDashboard)
+
+	// Add dunning routes
+	router.Get("/dunning/report{format:(.csv)?}", subscriptionactions.HandleDunningReport)
+
+	// Add tax routes
+	router.Get("/taxes", taxactions.HandleIndex)
+	router.Post("/taxes/create", taxactions.HandleCreate)
+	router.Post("/taxes/{id:[0-9]+}/destroy", taxactions.HandleDestroy)
+	router.Get("/taxes/report{format:(.csv)?}", taxactions.HandleReport)
+
+	// Add invoice routes
+	router.Get("/invoices", invoiceactions.HandleIndex)
+	router.Get("/invoices/{token:[a-f0-9]+}", invoiceactions.HandleDownload)
+
+	// Add download routes
+	router.Get("/downloads/{token:[a-f0-9]+}", downloadactions.HandleDownload)
+
+	// Add license routes
+	router.Post("/licenses/validate", licenseactions.HandleValidate)
+	router.Post("/licenses/activate", licenseactions.HandleActivate)
+	router.Post("/licenses/deactivate", licenseactions.HandleDeactivate)
+
 	// Add user routes
 	router.Get("/users/{id:[0-9]+}/password/change", useractions.HandlePasswordChangeShow)
 	router.Post("/users/{id:[0-9]+}/password/change", useractions.HandlePasswordChange)
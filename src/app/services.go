@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
 )
 
 // SetupServices sets up external services from our config file
@@ -16,6 +17,27 @@ func SetupServices() {
 
 }
 
+// SetupWebhooks schedules the worker which delivers and retries queued product webhooks
+func SetupWebhooks() {
+	ScheduleAt(subscriptions.DeliverWebhooks, time.Now().UTC(), time.Minute)
+}
+
+// SetupTrials schedules the worker which reminds customers before their free trial ends
+func SetupTrials() {
+	ScheduleAt(subscriptions.RemindTrials, time.Now().UTC(), time.Hour)
+}
+
+// SetupDunning schedules the worker which reminds customers whose subscription payment failed
+// and ends the subscriptions whose grace period ran out
+func SetupDunning() {
+	ScheduleAt(subscriptions.RemindDunning, time.Now().UTC(), time.Hour)
+}
+
+// SetupPauses schedules the worker which resumes paused subscriptions on their resume date
+func SetupPauses() {
+	ScheduleAt(subscriptions.ResumeSubscriptions, time.Now().UTC(), time.Hour)
+}
+
 // ScheduleAt schedules execution for a particular time and at intervals thereafter.
 // If interval is 0, the function will be called only once.
 // Callers should call close(task) before exiting the app or to stop repeating the action.
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandleCreate responds to POST /coupons/create by adding the coupon.
+func HandleCreate(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can add coupons"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	couponParams, err := coupons.CreateParams(params.Map())
+	if err != nil {
+		return server.Redirect(w, r, "/coupons?error="+url.QueryEscape(err.Error()))
+	}
+
+	id, err := coupons.New().Create(couponParams)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	log.Info(log.V{"msg": "Coupon added", "id": id, "code": couponParams["code"]})
+
+	return server.Redirect(w, r, "/coupons")
+}
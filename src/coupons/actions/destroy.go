@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandleDestroy responds to POST /coupons/n/destroy by deleting a coupon which hasn't been redeemed,
+// redeemed coupons are disabled instead so the payments they were used for keep their code.
+func HandleDestroy(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can delete coupons"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	coupon, err := coupons.Find(params.GetInt(coupons.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if coupon.Redemptions > 0 {
+		err = coupon.Disable()
+	} else {
+		err = coupon.Destroy()
+	}
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/coupons")
+}
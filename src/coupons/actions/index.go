@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// couponListLimit is the number of coupons shown on a page
+const couponListLimit = 50
+
+// HandleIndex responds to GET /coupons by listing the coupons with a form to add one.
+func HandleIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view coupons"))
+	}
+
+	q := coupons.Query().Limit(couponListLimit)
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(couponListLimit * page)
+	}
+
+	couponList, err := coupons.FindAll(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// The products a coupon can be limited to
+	productList, err := products.FindAll(products.Query())
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("coupons", couponList)
+	view.AddKey("products", productList)
+	view.AddKey("page", page)
+	view.AddKey("error", params.Get("error"))
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Coupons")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("coupons/views/index.html.got")
+
+	return view.Render()
+}
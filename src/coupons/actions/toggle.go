@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+)
+
+// HandleToggle responds to POST /coupons/n/toggle by disabling an active coupon or enabling a disabled one.
+func HandleToggle(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can update coupons"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	coupon, err := coupons.Find(params.GetInt(coupons.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if coupon.Active() {
+		err = coupon.Disable()
+	} else {
+		err = coupon.Enable()
+	}
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/coupons")
+}
@@ -0,0 +1,119 @@
+// Package coupons represents the discount codes customers enter on the product page
+package coupons
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+var (
+	// ErrNotFound is returned when using a code which doesn't exist
+	ErrNotFound = errors.New("coupon code not found")
+	// ErrDisabled is returned when using a coupon which has been disabled
+	ErrDisabled = errors.New("coupon has been disabled")
+	// ErrExpired is returned when using a coupon after it has expired
+	ErrExpired = errors.New("coupon has expired")
+	// ErrLimitReached is returned when using a coupon more times than allowed
+	ErrLimitReached = errors.New("coupon has been used the maximum number of times")
+	// ErrProduct is returned when using a coupon for a product it isn't valid for
+	ErrProduct = errors.New("coupon is not valid for this product")
+	// ErrCurrency is returned when using a fixed amount coupon for a price in another currency
+	ErrCurrency = errors.New("coupon is not valid for this currency")
+)
+
+// Coupon is a percentage or fixed amount discount code
+type Coupon struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Code string
+	// Kind is KindPercent or KindFixed
+	Kind string
+	// Value is the percentage off, or the amount off in the smallest currency unit of Currency
+	Value    int64
+	Currency string
+	// ProductID is the only product the coupon can be used for, 0 for all products
+	ProductID int64
+	// DurationMonths is the number of months a subscription is discounted for, 0 for every month
+	DurationMonths int64
+	// MaxRedemptions is the number of payments the coupon can be used for, 0 for unlimited
+	MaxRedemptions int64
+	Redemptions    int64
+	// ExpiresAt is zero for coupons which don't expire
+	ExpiresAt time.Time
+	Status    string
+}
+
+// Check returns an error if the coupon can't be used for the product
+func (c *Coupon) Check(productID int64) error {
+	if c.Status != StatusActive {
+		return ErrDisabled
+	}
+	if !c.ExpiresAt.IsZero() && time.Now().After(c.ExpiresAt) {
+		return ErrExpired
+	}
+	if c.MaxRedemptions > 0 && c.Redemptions >= c.MaxRedemptions {
+		return ErrLimitReached
+	}
+	if c.ProductID > 0 && c.ProductID != productID {
+		return ErrProduct
+	}
+	return nil
+}
+
+// Discount returns the discount on the amount, both in the smallest currency unit,
+// the discount is never more than the amount.
+func (c *Coupon) Discount(amount int64, currency string) (int64, error) {
+	var discount int64
+
+	switch c.Kind {
+	case KindPercent:
+		discount = int64(math.Round(float64(amount) * float64(c.Value) / 100))
+	case KindFixed:
+		if !strings.EqualFold(c.Currency, currency) {
+			return 0, ErrCurrency
+		}
+		discount = c.Value
+	}
+
+	if discount > amount {
+		discount = amount
+	}
+
+	return discount, nil
+}
+
+// Label returns the discount shown to the customer e.g. 20% off for the first 3 months
+func (c *Coupon) Label() string {
+	label := strconv.FormatInt(c.Value, 10) + "% off"
+	if c.Kind == KindFixed {
+		label = fmt.Sprintf("%.2f %s off", float64(c.Value)/100, strings.ToUpper(c.Currency))
+	}
+
+	if c.DurationMonths > 0 {
+		label += fmt.Sprintf(" for the first %d month(s) of a subscription", c.DurationMonths)
+	}
+
+	return label
+}
+
+// Active reports whether the coupon can still be used
+func (c *Coupon) Active() bool {
+	return c.Status == StatusActive
+}
+
+// Percent reports whether the coupon is a percentage discount
+func (c *Coupon) Percent() bool {
+	return c.Kind == KindPercent
+}
+
+// NormaliseCode returns the code in the form it is stored, codes are not case sensitive
+func NormaliseCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
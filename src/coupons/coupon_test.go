@@ -0,0 +1,77 @@
+// Tests for coupons
+package coupons
+
+import (
+	"testing"
+	"time"
+)
+
+// Test coupons are refused once disabled, expired, used up or for another product
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		status      string
+		expiresAt   time.Time
+		redemptions int64
+		productID   int64
+		err         error
+	}{
+		{StatusActive, time.Time{}, 0, 1, nil},
+		{StatusActive, time.Now().Add(time.Hour), 9, 1, nil},
+		{StatusActive, time.Now().Add(time.Hour), 10, 1, ErrLimitReached},
+		{StatusActive, time.Now().Add(-time.Hour), 0, 1, ErrExpired},
+		{StatusDisabled, time.Time{}, 0, 1, ErrDisabled},
+		{StatusActive, time.Time{}, 0, 2, ErrProduct},
+	}
+
+	for _, test := range tests {
+		coupon := New()
+		coupon.Status = test.status
+		coupon.ExpiresAt = test.expiresAt
+		coupon.MaxRedemptions = 10
+		coupon.Redemptions = test.redemptions
+		coupon.ProductID = 1
+
+		err := coupon.Check(test.productID)
+		if err != test.err {
+			t.Fatalf("coupons: expected %v for %s coupon with %d redemptions got:%v", test.err, test.status, test.redemptions, err)
+		}
+	}
+}
+
+// Test discounts are rounded, limited to the amount and fixed amounts only apply in their currency
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		kind     string
+		value    int64
+		amount   int64
+		currency string
+		discount int64
+		err      error
+	}{
+		{KindPercent, 20, 1000, "usd", 200, nil},
+		{KindPercent, 15, 999, "inr", 150, nil},
+		{KindPercent, 100, 1000, "usd", 1000, nil},
+		{KindFixed, 500, 1000, "usd", 500, nil},
+		{KindFixed, 1500, 1000, "USD", 1000, nil},
+		{KindFixed, 500, 1000, "eur", 0, ErrCurrency},
+	}
+
+	for _, test := range tests {
+		coupon := New()
+		coupon.Kind = test.kind
+		coupon.Value = test.value
+		coupon.Currency = "USD"
+
+		discount, err := coupon.Discount(test.amount, test.currency)
+		if err != test.err || discount != test.discount {
+			t.Fatalf("coupons: expected %d %v for %d %s off %d got:%d %v", test.discount, test.err, test.value, test.kind, test.amount, discount, err)
+		}
+	}
+}
+
+// Test codes are matched whatever their case
+func TestNormaliseCode(t *testing.T) {
+	if code := NormaliseCode(" launch20 "); code != "LAUNCH20" {
+		t.Fatalf("coupons: expected LAUNCH20 got:%s", code)
+	}
+}
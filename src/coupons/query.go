@@ -0,0 +1,209 @@
+package coupons
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "coupons"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "id desc"
+
+	// KindPercent is a coupon which takes a percentage off the price
+	KindPercent = "percent"
+	// KindFixed is a coupon which takes a fixed amount off the price
+	KindFixed = "fixed"
+
+	// StatusActive is the status of a coupon which can be used
+	StatusActive = "active"
+	// StatusDisabled is the status of a coupon which has been switched off by the admin
+	StatusDisabled = "disabled"
+)
+
+// AllowedParams returns an array of acceptable params in create
+func AllowedParams() []string {
+	return []string{"code", "kind", "value", "currency", "product_id", "duration_months", "max_redemptions", "expires_at"}
+}
+
+// codePattern is the format of a coupon code after it is normalised
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{1,32}$`)
+
+// CreateParams validates the coupon submitted by the admin and returns the params to create it with,
+// the value of a fixed amount coupon is entered as a decimal amount like 10.50.
+func CreateParams(params map[string]string) (map[string]string, error) {
+	params = New().ValidateParams(params, AllowedParams())
+
+	couponParams := make(map[string]string)
+
+	code := NormaliseCode(params["code"])
+	if !codePattern.MatchString(code) {
+		return nil, errors.New("code should be up to 32 letters, numbers, dashes or underscores")
+	}
+	if _, err := FindCode(code); err == nil {
+		return nil, errors.New("a coupon with this code already exists")
+	}
+	couponParams["code"] = code
+
+	switch params["kind"] {
+	case KindPercent:
+		percent, err := strconv.ParseInt(params["value"], 10, 64)
+		if err != nil || percent < 1 || percent > 100 {
+			return nil, errors.New("percentage off should be a whole number from 1 to 100")
+		}
+		couponParams["value"] = strconv.FormatInt(percent, 10)
+	case KindFixed:
+		amount, err := strconv.ParseFloat(params["value"], 64)
+		if err != nil || amount <= 0 {
+			return nil, errors.New("amount off should be more than 0")
+		}
+		currency := strings.ToUpper(strings.TrimSpace(params["currency"]))
+		if len(currency) != 3 {
+			return nil, errors.New("currency of the amount off should be a 3 letter code like USD")
+		}
+		couponParams["value"] = strconv.FormatInt(int64(math.Round(amount*100)), 10)
+		couponParams["currency"] = currency
+	default:
+		return nil, errors.New("kind should be percent or fixed")
+	}
+	couponParams["kind"] = params["kind"]
+
+	for _, key := range []string{"product_id", "duration_months", "max_redemptions"} {
+		value := int64(0)
+		if params[key] != "" {
+			var err error
+			value, err = strconv.ParseInt(params[key], 10, 64)
+			if err != nil || value < 0 {
+				return nil, errors.New(strings.Replace(key, "_", " ", -1) + " should be a whole number of 0 or more")
+			}
+		}
+		couponParams[key] = strconv.FormatInt(value, 10)
+	}
+
+	// Coupons expire at the end of the day in UTC
+	if params["expires_at"] != "" {
+		expiresAt, err := time.Parse("2006-01-02", params["expires_at"])
+		if err != nil {
+			return nil, errors.New("expiry date should be in the format 2006-01-02")
+		}
+		couponParams["expires_at"] = query.TimeString(expiresAt.Add(24*time.Hour - time.Millisecond))
+	}
+
+	couponParams["redemptions"] = "0"
+	couponParams["status"] = StatusActive
+
+	return couponParams, nil
+}
+
+// NewWithColumns creates a new coupon instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Coupon {
+	coupon := New()
+	coupon.ID = resource.ValidateInt(cols["id"])
+	coupon.CreatedAt = resource.ValidateTime(cols["created_at"])
+	coupon.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	coupon.Code = resource.ValidateString(cols["code"])
+	coupon.Kind = resource.ValidateString(cols["kind"])
+	coupon.Value = resource.ValidateInt(cols["value"])
+	coupon.Currency = resource.ValidateString(cols["currency"])
+	coupon.ProductID = resource.ValidateInt(cols["product_id"])
+	coupon.DurationMonths = resource.ValidateInt(cols["duration_months"])
+	coupon.MaxRedemptions = resource.ValidateInt(cols["max_redemptions"])
+	coupon.Redemptions = resource.ValidateInt(cols["redemptions"])
+	coupon.ExpiresAt = resource.ValidateTime(cols["expires_at"])
+	coupon.Status = resource.ValidateString(cols["status"])
+	return coupon
+}
+
+// New creates and initialises a new coupon instance.
+func New() *Coupon {
+	coupon := &Coupon{}
+	coupon.CreatedAt = time.Now()
+	coupon.UpdatedAt = time.Now()
+	coupon.TableName = TableName
+	coupon.KeyName = KeyName
+	return coupon
+}
+
+// Disable switches the coupon off so it can't be used anymore
+func (c *Coupon) Disable() error {
+	return c.setStatus(StatusDisabled)
+}
+
+// Enable switches the coupon back on
+func (c *Coupon) Enable() error {
+	return c.setStatus(StatusActive)
+}
+
+func (c *Coupon) setStatus(status string) error {
+	err := c.Update(map[string]string{"status": status})
+	if err != nil {
+		return err
+	}
+
+	c.Status = status
+	return nil
+}
+
+// countRedemption adds a payment to the number of times the coupon has been used
+func (c *Coupon) countRedemption(tx *query.Tx) error {
+	c.Redemptions++
+	return c.UpdateTx(tx, map[string]string{"redemptions": strconv.FormatInt(c.Redemptions, 10)})
+}
+
+// Find fetches a single coupon record from the database by id.
+func Find(id int64) (*Coupon, error) {
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single coupon record by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*Coupon, error) {
+	result, err := QueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindCode fetches the coupon with the code, codes are not case sensitive.
+func FindCode(code string) (*Coupon, error) {
+	result, err := Query().Where("code=?", NormaliseCode(code)).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAll fetches all coupon records matching this query from the database.
+func FindAll(q *query.Query) ([]*Coupon, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var coupons []*Coupon
+	for _, cols := range results {
+		coupons = append(coupons, NewWithColumns(cols))
+	}
+
+	return coupons, nil
+}
+
+// Query returns a new query for coupons with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for coupons with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
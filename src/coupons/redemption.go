@@ -0,0 +1,217 @@
+package coupons
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// RedemptionsTableName is the database table for redemptions
+	RedemptionsTableName = "coupon_redemptions"
+
+	// RedemptionPending is the status of a redemption whose checkout hasn't been paid yet
+	RedemptionPending = "pending"
+	// RedemptionRedeemed is the status of a redemption whose payment has been recorded
+	RedemptionRedeemed = "redeemed"
+	// RedemptionReleased is the status of a redemption whose checkout failed
+	RedemptionReleased = "released"
+
+	// RedemptionHold is how long a pending redemption holds one of the uses of a coupon with a limit,
+	// a checkout left unpaid longer than this doesn't stop others using the coupon
+	RedemptionHold = 24 * time.Hour
+)
+
+// Redemption is a coupon applied to a checkout at a payment gateway, it is redeemed
+// when the gateway's webhook for the payment is recorded.
+type Redemption struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	CouponID  int64
+	Code      string
+	ProductID int64
+	// Gateway and Reference identify the checkout at the gateway e.g. the Stripe checkout session
+	Gateway   string
+	Reference string
+	// Discount is in the smallest currency unit, it is 0 when the gateway calculates the discount
+	Discount      int64
+	Currency      string
+	TransactionID int64
+	Status        string
+}
+
+// NewRedemptionWithColumns creates a new redemption instance and fills it with data from the database cols provided.
+func NewRedemptionWithColumns(cols map[string]interface{}) *Redemption {
+	redemption := NewRedemption()
+	redemption.ID = resource.ValidateInt(cols["id"])
+	redemption.CreatedAt = resource.ValidateTime(cols["created_at"])
+	redemption.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	redemption.CouponID = resource.ValidateInt(cols["coupon_id"])
+	redemption.Code = resource.ValidateString(cols["code"])
+	redemption.ProductID = resource.ValidateInt(cols["product_id"])
+	redemption.Gateway = resource.ValidateString(cols["pg"])
+	redemption.Reference = resource.ValidateString(cols["reference"])
+	redemption.Discount = resource.ValidateInt(cols["discount"])
+	redemption.Currency = resource.ValidateString(cols["currency"])
+	redemption.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	redemption.Status = resource.ValidateString(cols["status"])
+	return redemption
+}
+
+// NewRedemption creates and initialises a new redemption instance.
+func NewRedemption() *Redemption {
+	redemption := &Redemption{}
+	redemption.CreatedAt = time.Now()
+	redemption.UpdatedAt = time.Now()
+	redemption.TableName = RedemptionsTableName
+	redemption.KeyName = KeyName
+	return redemption
+}
+
+// Apply records the coupon as applied to the checkout with the reference at the gateway in the transaction.
+// Each checkout which hasn't been paid holds one of the uses of a coupon with a limit for RedemptionHold,
+// so checkouts made at the same time can't use the coupon more times than allowed.
+func (c *Coupon) Apply(tx *query.Tx, productID int64, gateway string, reference string, discount int64, currency string) (*Redemption, error) {
+	if c.MaxRedemptions > 0 {
+		coupon, err := FindTx(tx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		pending, err := RedemptionsQueryTx(tx).Where("coupon_id=?", c.ID).Where("status=?", RedemptionPending).
+			Where("created_at>?", query.TimeString(time.Now().UTC().Add(-RedemptionHold))).Count()
+		if err != nil {
+			return nil, err
+		}
+
+		if coupon.Redemptions+pending >= c.MaxRedemptions {
+			return nil, ErrLimitReached
+		}
+	}
+
+	redemptionParams := make(map[string]string)
+	redemptionParams["coupon_id"] = strconv.FormatInt(c.ID, 10)
+	redemptionParams["code"] = c.Code
+	redemptionParams["product_id"] = strconv.FormatInt(productID, 10)
+	redemptionParams["pg"] = gateway
+	redemptionParams["reference"] = reference
+	redemptionParams["discount"] = strconv.FormatInt(discount, 10)
+	redemptionParams["currency"] = currency
+	redemptionParams["status"] = RedemptionPending
+
+	id, err := NewRedemption().CreateTx(tx, redemptionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindRedemptionTx(tx, id)
+}
+
+// Redeem records the redemption against the payment or subscription in the subscriptions table
+// and counts it towards the coupon's limit in the transaction.
+func (r *Redemption) Redeem(tx *query.Tx, transactionID int64) error {
+	err := r.UpdateTx(tx, map[string]string{
+		"transaction_id": strconv.FormatInt(transactionID, 10),
+		"status":         RedemptionRedeemed,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.TransactionID = transactionID
+	r.Status = RedemptionRedeemed
+
+	// The coupon may have been deleted since it was applied to the checkout
+	coupon, err := FindTx(tx, r.CouponID)
+	if err != nil {
+		return nil
+	}
+
+	return coupon.countRedemption(tx)
+}
+
+// Attach moves the pending redemption to the reference the gateway gave the checkout once it was paid, in the transaction.
+func (r *Redemption) Attach(tx *query.Tx, reference string) error {
+	err := r.UpdateTx(tx, map[string]string{"reference": reference})
+	if err != nil {
+		return err
+	}
+
+	r.Reference = reference
+	return nil
+}
+
+// Release gives back the use of the coupon held by the pending redemption of a checkout which failed.
+func (r *Redemption) Release() error {
+	if r.Status != RedemptionPending {
+		return nil
+	}
+
+	err := r.Update(map[string]string{"status": RedemptionReleased})
+	if err != nil {
+		return err
+	}
+
+	r.Status = RedemptionReleased
+	return nil
+}
+
+// FindRedemption fetches a single redemption record from the database by id.
+func FindRedemption(id int64) (*Redemption, error) {
+	return FindRedemptionTx(nil, id)
+}
+
+// FindRedemptionTx fetches a single redemption record by id in the transaction.
+func FindRedemptionTx(tx *query.Tx, id int64) (*Redemption, error) {
+	result, err := RedemptionsQueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewRedemptionWithColumns(result), nil
+}
+
+// FindPendingRedemption fetches the pending redemption for the checkout at the gateway with any of the references
+// in the transaction.
+func FindPendingRedemption(tx *query.Tx, gateway string, references ...string) (*Redemption, error) {
+	for _, reference := range references {
+		if reference == "" {
+			continue
+		}
+
+		result, err := RedemptionsQueryTx(tx).Where("pg=?", gateway).Where("reference=?", reference).Where("status=?", RedemptionPending).FirstResult()
+		if err == nil {
+			return NewRedemptionWithColumns(result), nil
+		}
+	}
+
+	return nil, errors.New("no pending redemption for the checkout")
+}
+
+// FindAllRedemptions fetches all redemption records matching this query from the database.
+func FindAllRedemptions(q *query.Query) ([]*Redemption, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var redemptions []*Redemption
+	for _, cols := range results {
+		redemptions = append(redemptions, NewRedemptionWithColumns(cols))
+	}
+
+	return redemptions, nil
+}
+
+// RedemptionsQuery returns a new query for redemptions with a default order.
+func RedemptionsQuery() *query.Query {
+	return RedemptionsQueryTx(nil)
+}
+
+// RedemptionsQueryTx returns a new query for redemptions with a default order in the transaction.
+func RedemptionsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(RedemptionsTableName, KeyName).Order(Order)
+}
@@ -0,0 +1,159 @@
+package actions
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/customers"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mail"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// HandleLoginShow responds to GET /customers/login by asking for the email the purchases were made with
+func HandleLoginShow(w http.ResponseWriter, r *http.Request) error {
+
+	// Signed in customers go straight to their purchases
+	if customers.CurrentEmail(w, r) != "" {
+		return server.Redirect(w, r, "/customers")
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("error", params.Get("error"))
+	view.AddKey("meta_title", "Customer Login")
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("customers/views/login.html.got")
+
+	return view.Render()
+}
+
+// HandleLogin responds to POST /customers/login by emailing a login link if the email has purchases,
+// the same page and limit on links apply either way so the emails of customers can't be found out.
+func HandleLogin(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	email := customers.NormaliseEmail(params.Get("email"))
+	if email == "" {
+		return server.Redirect(w, r, "/customers/login?error=email_required")
+	}
+
+	// A link is issued for every email so the limit on links applies to customers and others alike,
+	// it is only emailed to customers
+	token, err := customers.IssueLogin(email)
+	if err == customers.ErrTooManyLogins {
+		log.Info(log.V{"msg": "Customer login, too many login links", "email": email})
+		return server.Redirect(w, r, "/customers/login?error=too_many_logins")
+	} else if err != nil {
+		log.Error(log.V{"Customer login, error issuing login link": err})
+		return server.InternalError(err)
+	}
+
+	purchases, err := subscriptions.FindAll(subscriptions.Query().Where("lower(payer_email)=?", email).Limit(1))
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if len(purchases) > 0 {
+		sendLogin(email, token)
+	} else {
+		log.Info(log.V{"msg": "Customer login, no purchases for the email", "email": email})
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("meta_title", "Customer Login")
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("customers/views/login_sent.html.got")
+
+	return view.Render()
+}
+
+// HandleLoginLink responds to GET /customers/login/token by signing the customer in
+// with the login link emailed to them.
+func HandleLoginLink(w http.ResponseWriter, r *http.Request) error {
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	login, err := customers.UseLogin(params.Get("token"))
+	if err != nil {
+		log.Info(log.V{"msg": "Customer login, invalid login link", "error": err})
+		return server.Redirect(w, r, "/customers/login?error=invalid_link")
+	}
+
+	err = customers.SignIn(w, r, login.Email)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	log.Info(log.V{"msg": "Customer login", "email": login.Email})
+
+	return server.Redirect(w, r, "/customers")
+}
+
+// HandleLogout responds to POST /customers/logout by signing the customer out
+func HandleLogout(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	err = customers.SignOut(w, r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/customers/login")
+}
+
+// sendLogin emails the login link to the customer
+func sendLogin(email string, token string) {
+	message := mail.New(email)
+	message.ReplyTo = config.Get("mail_from")
+	message.Subject = "Your login link for " + config.Get("name")
+	message.Template = "customers/views/mail/login.html.got"
+
+	context := mail.Context{
+		"name":     config.Get("name"),
+		"loginURL": customers.LoginURL(token),
+		"minutes":  int(customers.LoginExpiry.Minutes()),
+	}
+
+	go func() {
+		err := mail.Send(message, context)
+		if err != nil {
+			log.Error(log.V{"Customer login, error sending login link": err})
+		}
+	}()
+}
@@ -0,0 +1,389 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/customers"
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// purchase is a payment or subscription of the customer shown in the customer area
+type purchase struct {
+	Transaction *subscriptions.Subscription
+	Product     *products.Story
+	License     *licenses.License
+	// Invoices are those of each payment, a subscription has one for each charge
+	Invoices []*invoices.Invoice
+	// Items are the products of the order of a cart or of the bundle paid by the payment
+	Items []*purchaseItem
+	// Plans are the products the subscription can be changed to
+	Plans []*products.Story
+}
+
+// purchaseItem is a product of an order or a bundle with the license key issued for it
+type purchaseItem struct {
+	Product      *products.Story
+	License      *licenses.License
+	Downloadable bool
+}
+
+// Downloadable reports whether the customer can download the product's file
+func (p *purchase) Downloadable() bool {
+	return p.Product != nil && p.Product.S3Bucket != "" && p.Product.S3Key != "" &&
+		!p.Transaction.Reversed() && !p.Transaction.Ended() && !p.Transaction.Paused() && !p.Transaction.Unpaid()
+}
+
+// Cancellable reports whether the customer can cancel the subscription
+func (p *purchase) Cancellable() bool {
+	return p.Transaction.SubscriptionId != "" && !p.Transaction.Ended()
+}
+
+// HandleShow responds to GET /customers by listing the payments and subscriptions
+// made with the signed in customer's email, from every gateway.
+func HandleShow(w http.ResponseWriter, r *http.Request) error {
+
+	email := customers.CurrentEmail(w, r)
+	if email == "" {
+		return server.Redirect(w, r, "/customers/login")
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	transactions, err := subscriptions.FindAll(subscriptions.Query().Where("lower(payer_email)=?", email))
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	var purchases []*purchase
+	found := make(map[int64]*products.Story)
+	for _, transaction := range transactions {
+		p := &purchase{Transaction: transaction}
+
+		product, ok := found[transaction.ProductId]
+		if !ok {
+			product, err = products.Find(transaction.ProductId)
+			if err != nil {
+				product = nil
+			}
+			found[transaction.ProductId] = product
+		}
+		p.Product = product
+
+		license, err := licenses.FindTransactionProduct(transaction.ID, transaction.ProductId)
+		if err == nil {
+			p.License = license
+		}
+
+		// The products of an order or a bundle are listed with the payment, each with its license key
+		for _, delivered := range subscriptions.TransactionProducts(transaction) {
+			if delivered.ID == transaction.ProductId {
+				continue
+			}
+
+			purchaseItem := &purchaseItem{Product: delivered}
+			purchaseItem.License, _ = licenses.FindTransactionProduct(transaction.ID, delivered.ID)
+			purchaseItem.Downloadable = (&purchase{Transaction: transaction, Product: delivered}).Downloadable()
+			p.Items = append(p.Items, purchaseItem)
+		}
+
+		p.Invoices, err = invoices.FindTransactionAll(transaction.ID)
+		if err != nil {
+			log.Error(log.V{"Customer purchases, error finding invoices": err, "id": transaction.ID})
+		}
+
+		p.Plans, err = subscriptions.ChangeablePlans(transaction, product)
+		if err != nil {
+			log.Error(log.V{"Customer purchases, error finding plans": err, "id": transaction.ID})
+		}
+
+		purchases = append(purchases, p)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("email", email)
+	view.AddKey("purchases", purchases)
+	view.AddKey("notice", params.Get("notice"))
+	view.AddKey("meta_title", "Your Purchases")
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("customers/views/show.html.got")
+
+	return view.Render()
+}
+
+// HandleDownload responds to POST /customers/purchases/n/download by downloading the product's file,
+// a new download link is issued when the one of the payment has expired or been used up.
+func HandleDownload(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	if !p.Downloadable() {
+		return server.NotFoundError(errors.New("purchase has no file to download"), "Download Not Found", "This purchase has no file to download.")
+	}
+
+	download, err := downloads.FindTransactionProduct(p.Transaction.ID, p.Product.ID)
+	if err != nil || download.Check() != nil {
+		download, err = downloads.Issue(p.Product.ID, p.Transaction.ID, p.Transaction.CustomerEmail)
+		if err != nil {
+			log.Error(log.V{"Customer download, error issuing download link": err, "id": p.Transaction.ID})
+			return server.InternalError(err)
+		}
+		log.Info(log.V{"msg": "Customer download, download link issued", "id": p.Transaction.ID, "download_id": download.ID})
+	}
+
+	return server.Redirect(w, r, "/downloads/"+download.Token)
+}
+
+// HandleCancel responds to POST /customers/purchases/n/cancel by cancelling the subscription at its gateway at the end
+// of its billing period or immediately with the cancel_at param, the subscription is updated once the gateway's webhook
+// confirms the cancellation.
+func HandleCancel(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	if !p.Cancellable() {
+		return server.BadRequestError(errors.New("purchase is not an active subscription"), "Cancel Failed", "This subscription has already ended.")
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	timing, err := subscriptions.CancelSubscription(p.Transaction, params.Get("cancel_at"))
+	if err == subscriptions.ErrCancelTiming {
+		return server.BadRequestError(err, "Cancel Failed", "This subscription can't be cancelled at this time.")
+	}
+	if err != nil {
+		log.Error(log.V{"Customer cancel, error cancelling subscription": err, "pg": p.Transaction.PaymentGateway})
+		return server.InternalError(err, "Cancel Failed", "Sorry, the subscription could not be cancelled, please try again later.")
+	}
+
+	log.Info(log.V{"msg": "Customer cancel, subscription cancelled", "id": p.Transaction.ID, "pg": p.Transaction.PaymentGateway, "timing": timing})
+
+	if timing == subscriptions.CancelAtPeriodEnd {
+		return server.Redirect(w, r, "/customers?notice=cancel_pending")
+	}
+
+	return server.Redirect(w, r, "/customers?notice=cancelled")
+}
+
+// HandlePaymentUpdate responds to POST /customers/purchases/n/payment by sending the customer to the page of the
+// gateway where they update the payment method of their past due subscription.
+func HandlePaymentUpdate(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	if !p.Transaction.PaymentUpdatable() {
+		return server.BadRequestError(errors.New("purchase is not a past due subscription"), "Update Failed", "The payment method of this subscription can't be updated here.")
+	}
+
+	url, err := subscriptions.PaymentUpdateURL(p.Transaction, config.Get("root_url")+"/customers")
+	if err != nil {
+		log.Error(log.V{"Customer payment update, error finding payment update page": err, "id": p.Transaction.ID, "pg": p.Transaction.PaymentGateway})
+		return server.InternalError(err, "Update Failed", "Sorry, the payment method could not be updated, please try again later.")
+	}
+
+	return server.RedirectExternal(w, r, url)
+}
+
+// HandlePlanChange responds to POST /customers/purchases/n/plan by changing the subscription to the plan of the product
+// with the plan_id param at its gateway, which prorates the change. PayPal sends the customer to approve the change first.
+func HandlePlanChange(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	plan, err := products.Find(params.GetInt("plan_id"))
+	if err != nil {
+		return server.NotFoundError(err, "Plan Not Found", "This plan is no longer available.")
+	}
+
+	approveURL, err := subscriptions.ChangePlan(p.Transaction, plan, config.Get("root_url")+"/customers?notice=plan_pending")
+	if err == subscriptions.ErrPlanChange {
+		return server.BadRequestError(err, "Change Failed", "This subscription can't be changed to this plan.")
+	}
+	if err != nil {
+		log.Error(log.V{"Customer plan change, error changing plan": err, "id": p.Transaction.ID, "pg": p.Transaction.PaymentGateway})
+		return server.InternalError(err, "Change Failed", "Sorry, the plan could not be changed, please try again later.")
+	}
+
+	if approveURL != "" {
+		return server.RedirectExternal(w, r, approveURL)
+	}
+
+	return server.Redirect(w, r, "/customers?notice=plan_changed")
+}
+
+// HandlePause responds to POST /customers/purchases/n/pause by pausing the subscription at its gateway until it is resumed,
+// or until the date of the resumes_at param. Square pauses it from its next billing cycle once its webhook confirms it.
+func HandlePause(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	resumesAt, err := subscriptions.ParseResumeDate(params.Get("resumes_at"))
+	if err != nil {
+		return server.BadRequestError(err, "Invalid date", "The resume date should be in the format 2006-01-02.")
+	}
+
+	if !p.Transaction.Pausable() {
+		return server.BadRequestError(errors.New("purchase is not an active subscription"), "Pause Failed", "This subscription can't be paused.")
+	}
+
+	err = subscriptions.PauseSubscription(p.Transaction, resumesAt)
+	if err != nil {
+		log.Error(log.V{"Customer pause, error pausing subscription": err, "id": p.Transaction.ID, "pg": p.Transaction.PaymentGateway})
+		return server.InternalError(err, "Pause Failed", "Sorry, the subscription could not be paused, please try again later.")
+	}
+
+	if !p.Transaction.Paused() {
+		return server.Redirect(w, r, "/customers?notice=pause_pending")
+	}
+
+	return server.Redirect(w, r, "/customers?notice=paused")
+}
+
+// HandleResume responds to POST /customers/purchases/n/resume by resuming the paused subscription at its gateway,
+// Square resumes it once its webhook confirms it.
+func HandleResume(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPurchase(w, r)
+	if err != nil {
+		return err
+	}
+
+	if !p.Transaction.Resumable() {
+		return server.BadRequestError(errors.New("purchase is not a paused subscription"), "Resume Failed", "This subscription isn't paused.")
+	}
+
+	err = subscriptions.ResumeSubscription(p.Transaction)
+	if err != nil {
+		log.Error(log.V{"Customer resume, error resuming subscription": err, "id": p.Transaction.ID, "pg": p.Transaction.PaymentGateway})
+		return server.InternalError(err, "Resume Failed", "Sorry, the subscription could not be resumed, please try again later.")
+	}
+
+	if p.Transaction.Paused() {
+		return server.Redirect(w, r, "/customers?notice=resume_pending")
+	}
+
+	return server.Redirect(w, r, "/customers?notice=resumed")
+}
+
+// findPurchase returns the purchase of the request if it was made by the signed in customer
+func findPurchase(w http.ResponseWriter, r *http.Request) (*purchase, error) {
+	email := customers.CurrentEmail(w, r)
+	if email == "" {
+		return nil, server.NotAuthorizedError(errors.New("customer is not signed in"), "Not Signed In", "Please sign in to the customer area again.")
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return nil, server.InternalError(err)
+	}
+
+	transaction, err := subscriptions.FindFirst("id=?", params.GetInt("id"))
+	if err != nil {
+		return nil, server.NotFoundError(err)
+	}
+
+	if customers.NormaliseEmail(transaction.CustomerEmail) != email {
+		return nil, server.NotAuthorizedError(errors.New("purchase was made by another customer"))
+	}
+
+	productID := transaction.ProductId
+
+	// A product of an order or a bundle is chosen with the product_id param
+	if params.GetInt("product_id") > 0 {
+		for _, delivered := range subscriptions.TransactionProducts(transaction) {
+			if delivered.ID == params.GetInt("product_id") {
+				productID = delivered.ID
+			}
+		}
+	}
+
+	p := &purchase{Transaction: transaction}
+	p.Product, err = products.Find(productID)
+	if err != nil {
+		p.Product = nil
+	}
+
+	return p, nil
+}
@@ -0,0 +1,157 @@
+// Package customers represents the buyers of products, who sign in to the customer area
+// with one-time links emailed to them instead of a password
+package customers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+const (
+	// LoginsTableName is the database table for login links
+	LoginsTableName = "customer_logins"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+
+	// LoginExpiry is how long a login link can be used for
+	LoginExpiry = 15 * time.Minute
+	// MaxLoginsPerHour is the number of login links which can be sent to an email in an hour
+	MaxLoginsPerHour = 5
+
+	// tokenLength is the number of random bytes in a login token
+	tokenLength = 32
+)
+
+var (
+	// ErrLoginInvalid is returned when signing in with a link which is unknown, used or expired
+	ErrLoginInvalid = errors.New("login link is not valid or has expired")
+	// ErrTooManyLogins is returned when too many login links have been sent to an email
+	ErrTooManyLogins = errors.New("too many login links have been sent, please try again later")
+)
+
+// Login is a one-time login link sent to a customer, only a hash of its token is stored
+type Login struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+// NewLogin creates and initialises a new login instance.
+func NewLogin() *Login {
+	login := &Login{}
+	login.CreatedAt = time.Now()
+	login.UpdatedAt = time.Now()
+	login.TableName = LoginsTableName
+	login.KeyName = KeyName
+	return login
+}
+
+// NewLoginWithColumns creates a new login instance and fills it with data from the database cols provided.
+func NewLoginWithColumns(cols map[string]interface{}) *Login {
+	login := NewLogin()
+	login.ID = resource.ValidateInt(cols["id"])
+	login.CreatedAt = resource.ValidateTime(cols["created_at"])
+	login.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	login.Email = resource.ValidateString(cols["email"])
+	login.TokenHash = resource.ValidateString(cols["token_hash"])
+	login.ExpiresAt = resource.ValidateTime(cols["expires_at"])
+	login.UsedAt = resource.ValidateTime(cols["used_at"])
+	return login
+}
+
+// IssueLogin creates a login link for the email and returns its token,
+// which is only known to the customer it is emailed to.
+func IssueLogin(email string) (string, error) {
+	email = NormaliseEmail(email)
+
+	sent, err := LoginsQuery().Where("email=?", email).Where("created_at>?", query.TimeString(time.Now().UTC().Add(-time.Hour))).Results()
+	if err != nil {
+		return "", err
+	}
+	if len(sent) >= MaxLoginsPerHour {
+		return "", ErrTooManyLogins
+	}
+
+	b := make([]byte, tokenLength)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	loginParams := make(map[string]string)
+	loginParams["email"] = email
+	loginParams["token_hash"] = hashToken(token)
+	loginParams["expires_at"] = query.TimeString(time.Now().UTC().Add(LoginExpiry))
+
+	_, err = NewLogin().Create(loginParams)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// UseLogin marks the login link of the token as used and returns it,
+// a link can only be used once and before it expires.
+func UseLogin(token string) (*Login, error) {
+	var login *Login
+
+	err := query.Transaction(func(tx *query.Tx) error {
+		result, err := LoginsQueryTx(tx).Where("token_hash=?", hashToken(token)).FirstResult()
+		if err != nil {
+			return ErrLoginInvalid
+		}
+
+		login = NewLoginWithColumns(result)
+		if !login.UsedAt.IsZero() || time.Now().After(login.ExpiresAt) {
+			return ErrLoginInvalid
+		}
+
+		login.UsedAt = time.Now().UTC()
+		return login.UpdateTx(tx, map[string]string{"used_at": query.TimeString(login.UsedAt)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+// LoginURL returns the link the customer signs in with
+func LoginURL(token string) string {
+	return config.Get("root_url") + "/customers/login/" + token
+}
+
+// NormaliseEmail returns the email as it is compared, gateways and customers may use different cases
+func NormaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginsQuery returns a new query for logins with a default order.
+func LoginsQuery() *query.Query {
+	return LoginsQueryTx(nil)
+}
+
+// LoginsQueryTx returns a new query for logins with a default order in the transaction.
+func LoginsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(LoginsTableName, KeyName).Order("id desc")
+}
+
+// hashToken returns the hash of the token which is stored in place of it
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
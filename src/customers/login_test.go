@@ -0,0 +1,32 @@
+// Tests for customer login links
+package customers
+
+import (
+	"testing"
+)
+
+// Test emails are compared whatever case the gateway or customer used
+func TestNormaliseEmail(t *testing.T) {
+	tests := map[string]string{
+		"buyer@example.com":     "buyer@example.com",
+		" Buyer@Example.COM \n": "buyer@example.com",
+		"":                      "",
+	}
+
+	for email, expected := range tests {
+		if NormaliseEmail(email) != expected {
+			t.Fatalf("customers: expected %q for %q got:%q", expected, email, NormaliseEmail(email))
+		}
+	}
+}
+
+// Test only the hash of a login token is stored
+func TestHashToken(t *testing.T) {
+	hash := hashToken("token")
+	if hash == "token" || len(hash) != 64 {
+		t.Fatalf("customers: expected sha256 hash of token got:%s", hash)
+	}
+	if hashToken("token") != hash || hashToken("other") == hash {
+		t.Fatalf("customers: expected hash to depend only on the token")
+	}
+}
@@ -0,0 +1,59 @@
+package customers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/auth"
+)
+
+const (
+	// SessionEmailKey is the session key of the signed in customer's email
+	SessionEmailKey = "customer_email"
+	// SessionSignedInKey is the session key of the time the customer signed in
+	SessionSignedInKey = "customer_signed_in"
+
+	// SessionExpiry is how long a customer stays signed in
+	SessionExpiry = 7 * 24 * time.Hour
+)
+
+// CurrentEmail returns the email of the customer signed in to the customer area,
+// or an empty string if no customer is signed in.
+func CurrentEmail(w http.ResponseWriter, r *http.Request) string {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return ""
+	}
+
+	signedIn, err := strconv.ParseInt(session.Get(SessionSignedInKey), 10, 64)
+	if err != nil || time.Since(time.Unix(signedIn, 0)) > SessionExpiry {
+		return ""
+	}
+
+	return session.Get(SessionEmailKey)
+}
+
+// SignIn signs the customer with the email in to the customer area
+func SignIn(w http.ResponseWriter, r *http.Request, email string) error {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	session.Set(SessionEmailKey, NormaliseEmail(email))
+	session.Set(SessionSignedInKey, strconv.FormatInt(time.Now().Unix(), 10))
+	return session.Save(w)
+}
+
+// SignOut signs the customer out of the customer area, an admin stays logged in
+func SignOut(w http.ResponseWriter, r *http.Request) error {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	session.Set(SessionEmailKey, "")
+	session.Set(SessionSignedInKey, "")
+	return session.Save(w)
+}
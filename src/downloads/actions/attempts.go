@@ -0,0 +1,70 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// attemptListLimit is the number of download attempts shown on a page
+const attemptListLimit = 50
+
+// HandleAttemptIndex responds to GET /products/n/downloads by listing the attempts to download the product's file
+// so links shared with others can be spotted.
+func HandleAttemptIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view downloads"))
+	}
+
+	q := downloads.AttemptsQuery().Where("product_id=?", product.ID).Limit(attemptListLimit)
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(attemptListLimit * page)
+	}
+
+	attempts, err := downloads.FindAllAttempts(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("story", product)
+	view.AddKey("attempts", attempts)
+	view.AddKey("page", page)
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", fmt.Sprintf("Downloads for %s", product.Name))
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("downloads/views/attempts.html.got")
+
+	return view.Render()
+}
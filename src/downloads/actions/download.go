@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/s3"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// storageURLExpiry is how long the storage url the customer is redirected to lasts,
+// it only needs to last until the download starts
+const storageURLExpiry = time.Minute
+
+// HandleDownload responds to GET /downloads/token by checking the download link and
+// redirecting to the product's file in the storage.
+func HandleDownload(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	ip := remoteIP(r)
+
+	download, err := downloads.FindToken(params.Get("token"))
+	if err != nil {
+		log.Info(log.V{"msg": "Download, unknown token", "ip": ip})
+		return server.NotFoundError(err, "Download Not Found", "This download link is not valid.")
+	}
+
+	product, err := products.Find(download.ProductID)
+	if err != nil || product.S3Bucket == "" || product.S3Key == "" {
+		return server.NotFoundError(errors.New("product has no file to download"), "Download Not Found", "This product has no file to download.")
+	}
+
+	err = download.Use(ip, r.UserAgent())
+	switch err {
+	case nil:
+	case downloads.ErrRevoked, downloads.ErrExpired, downloads.ErrLimitReached:
+		log.Info(log.V{"msg": "Download, link refused", "download_id": download.ID, "ip": ip, "reason": err})
+		return server.Error(err, http.StatusGone, "Download Unavailable", "Sorry, this "+err.Error()+".")
+	case downloads.ErrSuspended:
+		log.Info(log.V{"msg": "Download, link refused", "download_id": download.ID, "ip": ip, "reason": err})
+		return server.Error(err, http.StatusForbidden, "Download Unavailable", "Sorry, this "+err.Error()+".")
+	default:
+		log.Error(log.V{"Download, error counting download": err, "download_id": download.ID})
+		return server.InternalError(err)
+	}
+
+	url, err := s3.GeneratePresignedUrl(product.S3Bucket, product.S3Key, storageURLExpiry)
+	if err != nil {
+		return server.InternalError(err, "Download Failed", "Sorry, the file could not be downloaded, please try again.")
+	}
+
+	log.Info(log.V{"msg": "Download, link used", "download_id": download.ID, "downloads": download.Downloads, "ip": ip})
+
+	return server.RedirectExternal(w, r, url)
+}
+
+// remoteIP returns the ip of the client, behind cloudflare or a proxy when there is one
+func remoteIP(r *http.Request) string {
+	ip := r.Header.Get("CF-Connecting-IP")
+	if ip == "" {
+		ip = r.Header.Get("X-Forwarded-For")
+	}
+	if ip == "" {
+		ip = r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,91 @@
+package downloads
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// AttemptsTableName is the database table for the attempts to download with a link
+	AttemptsTableName = "download_attempts"
+
+	// ResultAllowed is the result of an attempt which downloaded the file
+	ResultAllowed = "allowed"
+)
+
+// Attempt is a request to download a file with a link, kept to spot links being shared
+type Attempt struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	DownloadID int64
+	ProductID  int64
+	IP         string
+	UserAgent  string
+	Result     string
+}
+
+// Allowed reports whether the file was downloaded
+func (a *Attempt) Allowed() bool {
+	return a.Result == ResultAllowed
+}
+
+// NewAttempt creates and initialises a new attempt instance.
+func NewAttempt() *Attempt {
+	attempt := &Attempt{}
+	attempt.CreatedAt = time.Now()
+	attempt.UpdatedAt = time.Now()
+	attempt.TableName = AttemptsTableName
+	attempt.KeyName = KeyName
+	return attempt
+}
+
+// NewAttemptWithColumns creates a new attempt instance and fills it with data from the database cols provided.
+func NewAttemptWithColumns(cols map[string]interface{}) *Attempt {
+	attempt := NewAttempt()
+	attempt.ID = resource.ValidateInt(cols["id"])
+	attempt.CreatedAt = resource.ValidateTime(cols["created_at"])
+	attempt.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	attempt.DownloadID = resource.ValidateInt(cols["download_id"])
+	attempt.ProductID = resource.ValidateInt(cols["product_id"])
+	attempt.IP = resource.ValidateString(cols["ip"])
+	attempt.UserAgent = resource.ValidateString(cols["user_agent"])
+	attempt.Result = resource.ValidateString(cols["result"])
+	return attempt
+}
+
+// RecordAttempt records a request to download with a link and its result.
+func RecordAttempt(downloadID int64, productID int64, ip string, userAgent string, result string) error {
+	attemptParams := make(map[string]string)
+	attemptParams["download_id"] = strconv.FormatInt(downloadID, 10)
+	attemptParams["product_id"] = strconv.FormatInt(productID, 10)
+	attemptParams["ip"] = ip
+	attemptParams["user_agent"] = userAgent
+	attemptParams["result"] = result
+
+	_, err := NewAttempt().Create(attemptParams)
+	return err
+}
+
+// FindAllAttempts fetches all attempt records matching this query from the database.
+func FindAllAttempts(q *query.Query) ([]*Attempt, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []*Attempt
+	for _, cols := range results {
+		attempts = append(attempts, NewAttemptWithColumns(cols))
+	}
+
+	return attempts, nil
+}
+
+// AttemptsQuery returns a new query for attempts with a default order.
+func AttemptsQuery() *query.Query {
+	return query.New(AttemptsTableName, KeyName).Order(Order)
+}
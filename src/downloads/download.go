@@ -0,0 +1,129 @@
+// Package downloads represents the download links issued for the payments of products with a file
+package downloads
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+// tokenLength is the number of random bytes in a download token
+const tokenLength = 32
+
+var (
+	// ErrRevoked is returned when downloading with a link which has been revoked
+	ErrRevoked = errors.New("download link has been revoked")
+	// ErrSuspended is returned when downloading with a link whose subscription is paused
+	ErrSuspended = errors.New("download link is suspended while its subscription is paused")
+	// ErrExpired is returned when downloading with a link after it has expired
+	ErrExpired = errors.New("download link has expired")
+	// ErrLimitReached is returned when downloading with a link more times than allowed
+	ErrLimitReached = errors.New("download link has been used the maximum number of times")
+)
+
+// Download is a download link issued for a payment or subscription
+type Download struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Token         string
+	ProductID     int64
+	TransactionID int64
+	Email         string
+	ExpiresAt     time.Time
+	MaxDownloads  int64
+	Downloads     int64
+	Status        string
+}
+
+// URL returns the link the customer downloads the file with
+func (d *Download) URL() string {
+	return config.Get("root_url") + "/downloads/" + d.Token
+}
+
+// Check returns an error if the link can no longer be used to download the file
+func (d *Download) Check() error {
+	if d.Status == StatusSuspended {
+		return ErrSuspended
+	}
+	if d.Status != StatusActive {
+		return ErrRevoked
+	}
+	if time.Now().After(d.ExpiresAt) {
+		return ErrExpired
+	}
+	if d.MaxDownloads > 0 && d.Downloads >= d.MaxDownloads {
+		return ErrLimitReached
+	}
+	return nil
+}
+
+// Revoke revokes the link in the transaction so the file can't be downloaded with it anymore
+func (d *Download) Revoke(tx *query.Tx) error {
+	if d.Status == StatusRevoked {
+		return nil
+	}
+
+	err := d.UpdateTx(tx, map[string]string{"status": StatusRevoked})
+	if err != nil {
+		return err
+	}
+
+	d.Status = StatusRevoked
+	return nil
+}
+
+// Use counts a download with the link if it can still be used, the attempt is recorded
+// with the ip and user agent of the request whether or not the download is allowed.
+func (d *Download) Use(ip string, userAgent string) error {
+
+	// Downloads are counted in a transaction so the limit can't be exceeded by parallel requests
+	err := query.Transaction(func(tx *query.Tx) error {
+		current, err := FindTx(tx, d.ID)
+		if err != nil {
+			return err
+		}
+
+		err = current.Check()
+		if err != nil {
+			return err
+		}
+
+		current.Downloads++
+		err = current.UpdateTx(tx, map[string]string{"downloads": strconv.FormatInt(current.Downloads, 10)})
+		if err != nil {
+			return err
+		}
+
+		d.Downloads = current.Downloads
+		return nil
+	})
+
+	result := ResultAllowed
+	if err != nil {
+		result = err.Error()
+	}
+
+	attemptErr := RecordAttempt(d.ID, d.ProductID, ip, userAgent, result)
+	if err == nil {
+		err = attemptErr
+	}
+
+	return err
+}
+
+// generateToken returns a new random token for a download link
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,58 @@
+// Tests for download links
+package downloads
+
+import (
+	"testing"
+	"time"
+)
+
+// Test links are refused once revoked, suspended, expired or used up
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		status    string
+		expiresAt time.Time
+		downloads int64
+		err       error
+	}{
+		{StatusActive, time.Now().Add(time.Hour), 0, nil},
+		{StatusActive, time.Now().Add(time.Hour), 4, nil},
+		{StatusActive, time.Now().Add(time.Hour), 5, ErrLimitReached},
+		{StatusActive, time.Now().Add(-time.Hour), 0, ErrExpired},
+		{StatusRevoked, time.Now().Add(time.Hour), 0, ErrRevoked},
+		{StatusSuspended, time.Now().Add(time.Hour), 0, ErrSuspended},
+	}
+
+	for _, test := range tests {
+		download := New()
+		download.Status = test.status
+		download.ExpiresAt = test.expiresAt
+		download.MaxDownloads = 5
+		download.Downloads = test.downloads
+
+		err := download.Check()
+		if err != test.err {
+			t.Fatalf("downloads: expected %v for %s link with %d downloads got:%v", test.err, test.status, test.downloads, err)
+		}
+	}
+}
+
+// Test tokens are unique and only use the characters of the download route
+func TestGenerateToken(t *testing.T) {
+	token, err := generateToken()
+	if err != nil {
+		t.Fatalf("downloads: error generating token %s", err)
+	}
+	if len(token) != tokenLength*2 {
+		t.Fatalf("downloads: expected token of %d characters got:%s", tokenLength*2, token)
+	}
+	for _, c := range token {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			t.Fatalf("downloads: expected hex token got:%s", token)
+		}
+	}
+
+	other, err := generateToken()
+	if err != nil || other == token {
+		t.Fatalf("downloads: expected a new token got:%s %v", other, err)
+	}
+}
@@ -0,0 +1,229 @@
+package downloads
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "downloads"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "id desc"
+
+	// StatusActive is the status of a download link which can be used
+	StatusActive = "active"
+	// StatusRevoked is the status of a download link whose payment was refunded or subscription has ended
+	StatusRevoked = "revoked"
+	// StatusSuspended is the status of a download link whose subscription is paused, it is active again once it is resumed
+	StatusSuspended = "suspended"
+
+	// DefaultExpiryHours is how long a download link lasts when download_expiry_hours is not set
+	DefaultExpiryHours = 72
+	// DefaultMaxDownloads is how many times a download link can be used when download_limit is not set
+	DefaultMaxDownloads = 5
+)
+
+// NewWithColumns creates a new download instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Download {
+	download := New()
+	download.ID = resource.ValidateInt(cols["id"])
+	download.CreatedAt = resource.ValidateTime(cols["created_at"])
+	download.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	download.Token = resource.ValidateString(cols["token"])
+	download.ProductID = resource.ValidateInt(cols["product_id"])
+	download.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	download.Email = resource.ValidateString(cols["email"])
+	download.ExpiresAt = resource.ValidateTime(cols["expires_at"])
+	download.MaxDownloads = resource.ValidateInt(cols["max_downloads"])
+	download.Downloads = resource.ValidateInt(cols["downloads"])
+	download.Status = resource.ValidateString(cols["status"])
+	return download
+}
+
+// New creates and initialises a new download instance.
+func New() *Download {
+	download := &Download{}
+	download.CreatedAt = time.Now()
+	download.UpdatedAt = time.Now()
+	download.TableName = TableName
+	download.KeyName = KeyName
+	return download
+}
+
+// Issue creates a download link with a new token for the payment or subscription in the subscriptions table,
+// it expires after download_expiry_hours and can be used download_limit times.
+func Issue(productID int64, transactionID int64, email string) (*Download, error) {
+	return IssueTx(nil, productID, transactionID, email)
+}
+
+// IssueTx creates a download link with a new token for the payment or subscription in the transaction.
+func IssueTx(tx *query.Tx, productID int64, transactionID int64, email string) (*Download, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiryHours := config.GetInt("download_expiry_hours")
+	if expiryHours <= 0 {
+		expiryHours = DefaultExpiryHours
+	}
+
+	maxDownloads := config.GetInt("download_limit")
+	if maxDownloads <= 0 {
+		maxDownloads = DefaultMaxDownloads
+	}
+
+	downloadParams := make(map[string]string)
+	downloadParams["token"] = token
+	downloadParams["product_id"] = strconv.FormatInt(productID, 10)
+	downloadParams["transaction_id"] = strconv.FormatInt(transactionID, 10)
+	downloadParams["email"] = email
+	downloadParams["expires_at"] = query.TimeString(time.Now().UTC().Add(time.Duration(expiryHours) * time.Hour))
+	downloadParams["max_downloads"] = strconv.FormatInt(maxDownloads, 10)
+	downloadParams["downloads"] = "0"
+	downloadParams["status"] = StatusActive
+
+	id, err := New().CreateTx(tx, downloadParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindTx(tx, id)
+}
+
+// RevokeTransaction revokes the download links of the payment or subscription in the subscriptions table in the transaction,
+// including those suspended while it was paused.
+func RevokeTransaction(tx *query.Tx, transactionID int64) error {
+	downloads, err := FindAll(QueryTx(tx).Where("transaction_id=?", transactionID).Where("status IN (?,?)", StatusActive, StatusSuspended))
+	if err != nil {
+		return err
+	}
+
+	for _, download := range downloads {
+		err = download.Revoke(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SuspendTransaction suspends the active download links of the subscription in the subscriptions table in the transaction while it is paused.
+func SuspendTransaction(tx *query.Tx, transactionID int64) error {
+	return changeTransactionStatus(tx, transactionID, StatusActive, StatusSuspended)
+}
+
+// ReinstateTransaction makes the suspended download links of the subscription active again in the transaction once it is resumed.
+func ReinstateTransaction(tx *query.Tx, transactionID int64) error {
+	return changeTransactionStatus(tx, transactionID, StatusSuspended, StatusActive)
+}
+
+// changeTransactionStatus changes the download links of the subscription with the status from to the status to
+func changeTransactionStatus(tx *query.Tx, transactionID int64, from string, to string) error {
+	downloads, err := FindAll(QueryTx(tx).Where("transaction_id=?", transactionID).Where("status=?", from))
+	if err != nil {
+		return err
+	}
+
+	for _, download := range downloads {
+		err = download.UpdateTx(tx, map[string]string{"status": to})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ChangeTransactionProduct moves the active download links of the subscription in the subscriptions table to the product
+// in the transaction when the subscriber changes plan, their tokens are kept. It returns the links moved.
+func ChangeTransactionProduct(tx *query.Tx, transactionID int64, productID int64) ([]*Download, error) {
+	downloads, err := FindAll(QueryTx(tx).Where("transaction_id=?", transactionID).Where("status=?", StatusActive))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, download := range downloads {
+		err = download.UpdateTx(tx, map[string]string{"product_id": strconv.FormatInt(productID, 10)})
+		if err != nil {
+			return nil, err
+		}
+		download.ProductID = productID
+	}
+
+	return downloads, nil
+}
+
+// Find fetches a single download record from the database by id.
+func Find(id int64) (*Download, error) {
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single download record by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*Download, error) {
+	result, err := QueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindToken fetches the download with the token.
+func FindToken(token string) (*Download, error) {
+	result, err := Query().Where("token=?", token).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindTransaction fetches the latest download issued for the payment or subscription in the subscriptions table.
+func FindTransaction(transactionID int64) (*Download, error) {
+	result, err := Query().Where("transaction_id=?", transactionID).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindTransactionProduct fetches the latest download issued for the product of an order paid by the transaction.
+func FindTransactionProduct(transactionID int64, productID int64) (*Download, error) {
+	result, err := Query().Where("transaction_id=?", transactionID).Where("product_id=?", productID).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAll fetches all download records matching this query from the database.
+func FindAll(q *query.Query) ([]*Download, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var downloads []*Download
+	for _, cols := range results {
+		downloads = append(downloads, NewWithColumns(cols))
+	}
+
+	return downloads, nil
+}
+
+// Query returns a new query for downloads with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for downloads with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
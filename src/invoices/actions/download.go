@@ -0,0 +1,34 @@
+package actions
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+)
+
+// HandleDownload responds to GET /invoices/token with the PDF of the invoice, the link is
+// shown on the success page, emailed to the customer and listed for the admin.
+func HandleDownload(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	invoice, err := invoices.FindToken(params.Get("token"))
+	if err != nil {
+		return server.NotFoundError(err, "Invoice Not Found", "This invoice link is not valid.")
+	}
+
+	b := invoice.PDF()
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename="+invoice.Filename())
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	_, err = w.Write(b)
+	return err
+}
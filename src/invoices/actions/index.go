@@ -0,0 +1,60 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+)
+
+// invoiceListLimit is the number of invoices shown on a page
+const invoiceListLimit = 50
+
+// HandleIndex responds to GET /invoices by listing the invoices issued, the latest first.
+func HandleIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view invoices"))
+	}
+
+	q := invoices.Query().Limit(invoiceListLimit)
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(invoiceListLimit * page)
+	}
+
+	list, err := invoices.FindAll(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("invoices", list)
+	view.AddKey("page", page)
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Invoices")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("invoices/views/index.html.got")
+
+	return view.Render()
+}
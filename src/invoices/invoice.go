@@ -0,0 +1,115 @@
+// Package invoices represents the invoices issued for the payments and subscriptions in the subscriptions table
+package invoices
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+// tokenLength is the number of random bytes in an invoice token
+const tokenLength = 32
+
+// Invoice is the invoice of a payment or subscription, the seller and buyer details are those
+// at the time it was issued so the invoice never changes once issued.
+type Invoice struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// Number is the sequential number of the invoice and Code the number with the invoice_prefix e.g. INV-000042
+	Number int64
+	Code   string
+	// Token is the random token of the invoice's download link
+	Token         string
+	TransactionID int64
+	ProductID     int64
+	Email         string
+	SellerName    string
+	SellerAddress string
+	SellerTaxID   string
+	BuyerName     string
+	BuyerAddress  string
+	BuyerTaxID    string
+	Currency      string
+	CouponCode    string
+	// Discount, Tax and Total are in the smallest currency unit, Total is the amount paid including the tax
+	Discount int64
+	TaxLabel string
+	Tax      int64
+	Total    int64
+	// Gateway and Reference identify the payment at the payment gateway
+	Gateway   string
+	Reference string
+	PaidAt    time.Time
+
+	Lines []*Line
+}
+
+// Line is an item of an invoice
+type Line struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	InvoiceID   int64
+	Description string
+	Quantity    int64
+	// Amount is the total of the line before the discount and tax in the smallest currency unit
+	Amount int64
+}
+
+// SetReference records the reference at the gateway of the payment the invoice was issued for in the transaction,
+// the invoice of the first payment of a subscription is issued before the gateway reports the payment.
+func (i *Invoice) SetReference(tx *query.Tx, reference string) error {
+	err := i.UpdateTx(tx, map[string]string{"reference": reference})
+	if err != nil {
+		return err
+	}
+
+	i.Reference = reference
+	return nil
+}
+
+// URL returns the link the invoice is downloaded with
+func (i *Invoice) URL() string {
+	return config.Get("root_url") + "/invoices/" + i.Token
+}
+
+// Filename returns the name of the invoice's PDF file
+func (i *Invoice) Filename() string {
+	return i.Code + ".pdf"
+}
+
+// Subtotal returns the total of the lines before the discount and tax
+func (i *Invoice) Subtotal() int64 {
+	var subtotal int64
+	for _, line := range i.Lines {
+		subtotal += line.Amount
+	}
+	return subtotal
+}
+
+// Net returns the amount paid without the tax
+func (i *Invoice) Net() int64 {
+	return i.Total - i.Tax
+}
+
+// Money formats the amount in the smallest currency unit in the currency of the invoice like 10.50 EUR
+func (i *Invoice) Money(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/100, 'f', 2, 64) + " " + strings.ToUpper(i.Currency)
+}
+
+// generateToken returns a new random token for an invoice
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
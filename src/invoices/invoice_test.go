@@ -0,0 +1,61 @@
+// Tests for invoices
+package invoices
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// Test the invoice is written with its seller, buyer, lines and totals
+func TestPDF(t *testing.T) {
+	invoice := New()
+	invoice.Code = "INV-000042"
+	invoice.SellerName = "Example Ltd"
+	invoice.SellerAddress = "1 High Street, London"
+	invoice.SellerTaxID = "GB123456789"
+	invoice.BuyerName = "Jane Doe"
+	invoice.BuyerAddress = "Hauptstraße 1\nBerlin"
+	invoice.BuyerTaxID = "DE123456789"
+	invoice.Email = "jane@example.com"
+	invoice.Currency = "eur"
+	invoice.CouponCode = "LAUNCH"
+	invoice.Discount = 200
+	invoice.TaxLabel = "VAT reverse charged to DE123456789"
+	invoice.Total = 800
+	invoice.Gateway = "paypal"
+	invoice.Reference = "5O190127TN364715T"
+	invoice.PaidAt = time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	invoice.Lines = []*Line{{Description: "Example Product (Monthly)", Quantity: 1, Amount: 1000}}
+
+	if invoice.Subtotal() != 1000 || invoice.Net() != 800 {
+		t.Fatalf("invoices: expected subtotal 1000 and net 800 got:%d %d", invoice.Subtotal(), invoice.Net())
+	}
+	if invoice.Money(1050) != "10.50 EUR" {
+		t.Fatalf("invoices: expected 10.50 EUR got:%s", invoice.Money(1050))
+	}
+
+	b := invoice.PDF()
+	for _, want := range []string{"(Invoice number: INV-000042)", "(Example Ltd)", "(London)", "(Tax ID: GB123456789)",
+		"(Hauptstra\\337e 1)", "(Example Product \\(Monthly\\))", "(Discount \\(LAUNCH\\))", "(-2.00 EUR)",
+		"(VAT reverse charged to DE123456789)", "(8.00 EUR)", "(Date: 2 January 2026)", "via PayPal."} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("invoices: expected %q in the invoice", want)
+		}
+	}
+}
+
+// Test the lines of an invoice continue on a new page when they don't fit on one
+func TestPDFPages(t *testing.T) {
+	invoice := New()
+	invoice.Code = "INV-000001"
+	invoice.Currency = "usd"
+	for i := 0; i < 60; i++ {
+		invoice.Lines = append(invoice.Lines, &Line{Description: "Product", Quantity: 1, Amount: 100})
+	}
+
+	b := invoice.PDF()
+	if !bytes.Contains(b, []byte("/Count 2")) {
+		t.Fatalf("invoices: expected 2 pages for 60 lines")
+	}
+}
@@ -0,0 +1,154 @@
+package invoices
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/pdf"
+)
+
+// The layout of the invoice in points
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	marginTop    = pdf.PageHeight - 60
+	marginBottom = 80.0
+	quantityX    = 400.0
+	fontSize     = 10.0
+	lineHeight   = 14.0
+)
+
+// PDF returns the invoice as a PDF document
+func (i *Invoice) PDF() []byte {
+	d := pdf.New("Invoice " + i.Code)
+	page := d.AddPage()
+
+	// The seller on the left and the invoice on the right
+	page.Text(marginLeft, marginTop, 16, true, i.SellerName)
+	y := marginTop - 20
+	for _, line := range addressLines(i.SellerAddress) {
+		page.Text(marginLeft, y, fontSize, false, line)
+		y -= lineHeight
+	}
+	if i.SellerTaxID != "" {
+		page.Text(marginLeft, y, fontSize, false, "Tax ID: "+i.SellerTaxID)
+		y -= lineHeight
+	}
+
+	page.TextRight(marginRight, marginTop, 20, true, "INVOICE")
+	page.TextRight(marginRight, marginTop-20, fontSize, false, "Invoice number: "+i.Code)
+	page.TextRight(marginRight, marginTop-20-lineHeight, fontSize, false, "Date: "+i.PaidAt.Format("2 January 2006"))
+
+	// The buyer
+	y -= lineHeight
+	page.Text(marginLeft, y, fontSize, true, "Bill to")
+	y -= lineHeight
+	for _, line := range append([]string{i.BuyerName}, addressLines(i.BuyerAddress)...) {
+		if line != "" {
+			page.Text(marginLeft, y, fontSize, false, line)
+			y -= lineHeight
+		}
+	}
+	page.Text(marginLeft, y, fontSize, false, i.Email)
+	y -= lineHeight
+	if i.BuyerTaxID != "" {
+		page.Text(marginLeft, y, fontSize, false, "Tax ID: "+i.BuyerTaxID)
+		y -= lineHeight
+	}
+
+	// The lines, continued on a new page when they don't fit
+	y -= lineHeight * 2
+	lineHeader(page, y)
+	y -= lineHeight * 1.5
+	for _, line := range i.Lines {
+		description := pdf.Wrap(line.Description, quantityX-marginLeft-20, fontSize, false)
+		if y-float64(len(description))*lineHeight < marginBottom {
+			page = d.AddPage()
+			y = marginTop
+			lineHeader(page, y)
+			y -= lineHeight * 1.5
+		}
+
+		page.TextRight(quantityX, y, fontSize, false, strconv.FormatInt(line.Quantity, 10))
+		page.TextRight(marginRight, y, fontSize, false, i.Money(line.Amount))
+		for _, text := range description {
+			page.Text(marginLeft, y, fontSize, false, text)
+			y -= lineHeight
+		}
+	}
+	page.Line(marginLeft, y+lineHeight*0.5, marginRight, y+lineHeight*0.5, 0.5)
+
+	// The totals, with the space they need kept on the same page
+	if y-lineHeight*7 < marginBottom {
+		page = d.AddPage()
+		y = marginTop
+	}
+	y -= lineHeight
+	total := func(label string, amount string, bold bool) {
+		page.TextRight(quantityX, y, fontSize, bold, label)
+		page.TextRight(marginRight, y, fontSize, bold, amount)
+		y -= lineHeight
+	}
+	total("Subtotal", i.Money(i.Subtotal()), false)
+	if i.Discount > 0 {
+		label := "Discount"
+		if i.CouponCode != "" {
+			label += " (" + i.CouponCode + ")"
+		}
+		total(label, "-"+i.Money(i.Discount), false)
+	}
+	if i.TaxLabel != "" || i.Tax > 0 {
+		total("Net", i.Money(i.Net()), false)
+		label := i.TaxLabel
+		if label == "" {
+			label = "Tax"
+		}
+		total(label, i.Money(i.Tax), false)
+	}
+	total("Total", i.Money(i.Total), true)
+
+	// The payment
+	y -= lineHeight
+	payment := "Paid in full on " + i.PaidAt.Format("2 January 2006") + " via " + gatewayName(i.Gateway) + "."
+	if i.Reference != "" {
+		payment += " Payment reference: " + i.Reference
+	}
+	for _, line := range pdf.Wrap(payment, marginRight-marginLeft, fontSize, false) {
+		page.Text(marginLeft, y, fontSize, false, line)
+		y -= lineHeight
+	}
+
+	return d.Bytes()
+}
+
+// lineHeader writes the headings of the lines at y on the page
+func lineHeader(page *pdf.Page, y float64) {
+	page.Text(marginLeft, y, fontSize, true, "Description")
+	page.TextRight(quantityX, y, fontSize, true, "Qty")
+	page.TextRight(marginRight, y, fontSize, true, "Amount")
+	page.Line(marginLeft, y-lineHeight*0.5, marginRight, y-lineHeight*0.5, 0.5)
+}
+
+// addressLines splits an address into its lines, the lines of an address in config can be
+// separated by new lines or commas
+func addressLines(address string) []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(address, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// gatewayName returns the name of the payment gateway as it is written
+func gatewayName(gateway string) string {
+	switch gateway {
+	case "paypal":
+		return "PayPal"
+	case "":
+		return "card"
+	}
+	return strings.ToUpper(gateway[:1]) + gateway[1:]
+}
@@ -0,0 +1,253 @@
+package invoices
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "invoices"
+	// LinesTableName is the database table for the lines of invoices
+	LinesTableName = "invoice_lines"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "number desc"
+
+	// DefaultPrefix is the prefix of the invoice numbers when invoice_prefix is not set
+	DefaultPrefix = "INV-"
+)
+
+// NewWithColumns creates a new invoice instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Invoice {
+	invoice := New()
+	invoice.ID = resource.ValidateInt(cols["id"])
+	invoice.CreatedAt = resource.ValidateTime(cols["created_at"])
+	invoice.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	invoice.Number = resource.ValidateInt(cols["number"])
+	invoice.Code = resource.ValidateString(cols["code"])
+	invoice.Token = resource.ValidateString(cols["token"])
+	invoice.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	invoice.ProductID = resource.ValidateInt(cols["product_id"])
+	invoice.Email = resource.ValidateString(cols["email"])
+	invoice.SellerName = resource.ValidateString(cols["seller_name"])
+	invoice.SellerAddress = resource.ValidateString(cols["seller_address"])
+	invoice.SellerTaxID = resource.ValidateString(cols["seller_tax_id"])
+	invoice.BuyerName = resource.ValidateString(cols["buyer_name"])
+	invoice.BuyerAddress = resource.ValidateString(cols["buyer_address"])
+	invoice.BuyerTaxID = resource.ValidateString(cols["buyer_tax_id"])
+	invoice.Currency = resource.ValidateString(cols["currency"])
+	invoice.CouponCode = resource.ValidateString(cols["coupon_code"])
+	invoice.Discount = resource.ValidateInt(cols["discount"])
+	invoice.TaxLabel = resource.ValidateString(cols["tax_label"])
+	invoice.Tax = resource.ValidateInt(cols["tax"])
+	invoice.Total = resource.ValidateInt(cols["total"])
+	invoice.Gateway = resource.ValidateString(cols["pg"])
+	invoice.Reference = resource.ValidateString(cols["reference"])
+	invoice.PaidAt = resource.ValidateTime(cols["paid_at"])
+	return invoice
+}
+
+// New creates and initialises a new invoice instance.
+func New() *Invoice {
+	invoice := &Invoice{}
+	invoice.CreatedAt = time.Now()
+	invoice.UpdatedAt = time.Now()
+	invoice.TableName = TableName
+	invoice.KeyName = KeyName
+	return invoice
+}
+
+// NewLineWithColumns creates a new line instance and fills it with data from the database cols provided.
+func NewLineWithColumns(cols map[string]interface{}) *Line {
+	line := NewLine()
+	line.ID = resource.ValidateInt(cols["id"])
+	line.CreatedAt = resource.ValidateTime(cols["created_at"])
+	line.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	line.InvoiceID = resource.ValidateInt(cols["invoice_id"])
+	line.Description = resource.ValidateString(cols["description"])
+	line.Quantity = resource.ValidateInt(cols["quantity"])
+	line.Amount = resource.ValidateInt(cols["amount"])
+	return line
+}
+
+// NewLine creates and initialises a new line instance.
+func NewLine() *Line {
+	line := &Line{}
+	line.CreatedAt = time.Now()
+	line.UpdatedAt = time.Now()
+	line.TableName = LinesTableName
+	line.KeyName = KeyName
+	return line
+}
+
+// Issue gives the invoice the next number in sequence and saves it with its lines and the seller details
+// from config. It should be called in the transaction which records the payment, so that a number is
+// only used once the payment is saved and the numbers have no gaps, the unique number stops two
+// transactions using the same one.
+func Issue(tx *query.Tx, invoice *Invoice) (*Invoice, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := tx.New(TableName, KeyName).Select("SELECT MAX(number) AS number FROM " + TableName).ResultInt64("number")
+	if err != nil {
+		return nil, err
+	}
+	number := last + 1
+
+	prefix := config.Get("invoice_prefix")
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	sellerName := config.Get("invoice_seller_name")
+	if sellerName == "" {
+		sellerName = config.Get("name")
+	}
+
+	invoiceParams := make(map[string]string)
+	invoiceParams["number"] = strconv.FormatInt(number, 10)
+	invoiceParams["code"] = fmt.Sprintf("%s%06d", prefix, number)
+	invoiceParams["token"] = token
+	invoiceParams["transaction_id"] = strconv.FormatInt(invoice.TransactionID, 10)
+	invoiceParams["product_id"] = strconv.FormatInt(invoice.ProductID, 10)
+	invoiceParams["email"] = invoice.Email
+	invoiceParams["seller_name"] = sellerName
+	invoiceParams["seller_address"] = config.Get("invoice_seller_address")
+	invoiceParams["seller_tax_id"] = config.Get("invoice_seller_tax_id")
+	invoiceParams["buyer_name"] = invoice.BuyerName
+	invoiceParams["buyer_address"] = invoice.BuyerAddress
+	invoiceParams["buyer_tax_id"] = invoice.BuyerTaxID
+	invoiceParams["currency"] = invoice.Currency
+	invoiceParams["coupon_code"] = invoice.CouponCode
+	invoiceParams["discount"] = strconv.FormatInt(invoice.Discount, 10)
+	invoiceParams["tax_label"] = invoice.TaxLabel
+	invoiceParams["tax"] = strconv.FormatInt(invoice.Tax, 10)
+	invoiceParams["total"] = strconv.FormatInt(invoice.Total, 10)
+	invoiceParams["pg"] = invoice.Gateway
+	invoiceParams["reference"] = invoice.Reference
+	invoiceParams["paid_at"] = query.TimeString(invoice.PaidAt.UTC())
+
+	id, err := New().CreateTx(tx, invoiceParams)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range invoice.Lines {
+		lineParams := make(map[string]string)
+		lineParams["invoice_id"] = strconv.FormatInt(id, 10)
+		lineParams["description"] = line.Description
+		lineParams["quantity"] = strconv.FormatInt(line.Quantity, 10)
+		lineParams["amount"] = strconv.FormatInt(line.Amount, 10)
+
+		_, err = NewLine().CreateTx(tx, lineParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return FindTx(tx, id)
+}
+
+// Find fetches a single invoice record with its lines from the database by id.
+func Find(id int64) (*Invoice, error) {
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single invoice record with its lines by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*Invoice, error) {
+	return findFirst(tx, QueryTx(tx).Where("id=?", id))
+}
+
+// FindToken fetches the invoice with the token.
+func FindToken(token string) (*Invoice, error) {
+	return findFirst(nil, Query().Where("token=?", token))
+}
+
+// FindTransaction fetches the first invoice issued for the payment or subscription in the subscriptions table.
+func FindTransaction(transactionID int64) (*Invoice, error) {
+	return findFirst(nil, Query().Where("transaction_id=?", transactionID).Order("number asc"))
+}
+
+// FindTransactionAll fetches every invoice issued for the payment or subscription in the subscriptions table,
+// a subscription has one for each payment, without their lines.
+func FindTransactionAll(transactionID int64) ([]*Invoice, error) {
+	return FindAll(Query().Where("transaction_id=?", transactionID).Order("number asc"))
+}
+
+// FindReferenceTx fetches the invoice of the payment with the reference at the gateway in the transaction.
+func FindReferenceTx(tx *query.Tx, gateway string, reference string) (*Invoice, error) {
+	return findFirst(tx, QueryTx(tx).Where("pg=?", gateway).Where("reference=?", reference))
+}
+
+// FindTransactions fetches the first invoice of each of the payments and subscriptions by their id in the
+// subscriptions table, without their lines.
+func FindTransactions(transactionIDs []int64) (map[int64]*Invoice, error) {
+	found := make(map[int64]*Invoice)
+	if len(transactionIDs) == 0 {
+		return found, nil
+	}
+
+	invoices, err := FindAll(Query().WhereIn("transaction_id", transactionIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, invoice := range invoices {
+		found[invoice.TransactionID] = invoice
+	}
+
+	return found, nil
+}
+
+// findFirst fetches the first invoice of the query with its lines in the transaction.
+func findFirst(tx *query.Tx, q *query.Query) (*Invoice, error) {
+	result, err := q.FirstResult()
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := NewWithColumns(result)
+
+	results, err := tx.New(LinesTableName, KeyName).Where("invoice_id=?", invoice.ID).Order("id asc").Results()
+	if err != nil {
+		return nil, err
+	}
+	for _, cols := range results {
+		invoice.Lines = append(invoice.Lines, NewLineWithColumns(cols))
+	}
+
+	return invoice, nil
+}
+
+// FindAll fetches all invoice records matching this query from the database, without their lines.
+func FindAll(q *query.Query) ([]*Invoice, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var invoices []*Invoice
+	for _, cols := range results {
+		invoices = append(invoices, NewWithColumns(cols))
+	}
+
+	return invoices, nil
+}
+
+// Query returns a new query for invoices with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for invoices with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
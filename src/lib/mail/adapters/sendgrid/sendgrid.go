@@ -1,6 +1,7 @@
 package sendgrid
 
 import (
+	"encoding/base64"
 	"errors"
 
 	"github.com/sendgrid/sendgrid-go"
@@ -59,6 +60,14 @@ func (s *Service) Send(email *m.Email) error {
 	p.AddTos(sendgridRecipients...)
 	message.AddPersonalizations(p)
 	message.AddContent(sendgridContent)
+	for _, a := range email.Attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(a.Content))
+		attachment.SetType(a.ContentType)
+		attachment.SetFilename(a.Filename)
+		attachment.SetDisposition("attachment")
+		message.AddAttachment(attachment)
+	}
 
 	request := sendgrid.GetRequest(s.secret, "/v3/mail/send", "https://api.sendgrid.com")
 	request.Method = "POST"
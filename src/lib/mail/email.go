@@ -12,6 +12,15 @@ type Email struct {
 	Body       string
 	Template   string
 	Layout     string
+	// Attachments are the files sent with the email
+	Attachments []*Attachment
+}
+
+// Attachment is a file sent with an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
 }
 
 // New returns a new email with the default tenplates and the given recipient.
@@ -29,6 +38,11 @@ func (e *Email) String() string {
 	return fmt.Sprintf("email to:%v from:%s subject:%s\n\n%s", e.Recipients, e.ReplyTo, e.Subject, e.Body)
 }
 
+// Attach adds a file with the filename and content type to the email.
+func (e *Email) Attach(filename string, contentType string, content []byte) {
+	e.Attachments = append(e.Attachments, &Attachment{Filename: filename, ContentType: contentType, Content: content})
+}
+
 // Invalid returns true if this email is not ready to send.
 func (e *Email) Invalid() bool {
 	return e.ReplyTo == "" || e.Subject == "" || e.Body == ""
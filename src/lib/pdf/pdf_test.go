@@ -0,0 +1,66 @@
+// Tests for the pdf package
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestBytes tests the cross reference table points at each object of the document
+func TestBytes(t *testing.T) {
+	d := New("Invoice (1)")
+	page := d.AddPage()
+	page.Text(50, 800, 12, true, "Invoice INV-000001")
+	page.TextRight(545, 780, 10, false, "€10.00")
+	page.Line(50, 770, 545, 770, 0.5)
+	d.AddPage().Text(50, 800, 10, false, "Page 2")
+
+	b := d.Bytes()
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("pdf: expected a pdf header and trailer")
+	}
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(b)
+	if startxref == nil {
+		t.Fatalf("pdf: expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("pdf: expected xref of 10 entries at %d", xref)
+	}
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(b[xref:], -1)
+	if len(offsets) != 9 {
+		t.Fatalf("pdf: expected 9 objects got:%d", len(offsets))
+	}
+	for i, offset := range offsets {
+		o, _ := strconv.Atoi(string(offset[1]))
+		if !bytes.HasPrefix(b[o:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Fatalf("pdf: expected object %d at %d", i+1, o)
+		}
+	}
+
+	for _, want := range []string{"/Title (Invoice \\(1\\))", "/Count 2", "(\\20010.00) Tj", "0.5 w 50 770 m 545 770 l S"} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("pdf: expected %q in document", want)
+		}
+	}
+}
+
+// TestWidth tests the width of text and wrapping it into lines
+func TestWidth(t *testing.T) {
+	if w := Width("Hi", 10, false); w != 9.44 {
+		t.Fatalf("pdf: expected width 9.44 got:%v", w)
+	}
+	if w := Width("Hi", 10, true); w != 10 {
+		t.Fatalf("pdf: expected bold width 10 got:%v", w)
+	}
+
+	lines := Wrap("one two three\nfour", Width("one two", 10, false), 10, false)
+	if len(lines) != 3 || lines[0] != "one two" || lines[1] != "three" || lines[2] != "four" {
+		t.Fatalf("pdf: expected 3 wrapped lines got:%q", lines)
+	}
+}
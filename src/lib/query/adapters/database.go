@@ -22,6 +22,11 @@ type Database interface {
 	// Insert a record, returning id
 	Insert(sql string, args ...interface{}) (id int64, err error)
 
+	// Execute queries and insert records in a transaction begun on SQLDB
+	TxExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error)
+	TxQuery(tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error)
+	TxInsert(tx *sql.Tx, sql string, args ...interface{}) (id int64, err error)
+
 	// Return extra SQL for insert statement (see psql)
 	InsertSQL(pk string) string
 
@@ -150,3 +155,33 @@ func (db *Adapter) performExec(sqlDB *sql.DB, debug bool, query string, args ...
 	// Caller is responsible for closing rows with defer rows.Close()
 	return result, err
 }
+
+// performTxQuery executes Query SQL in the given transaction and return the rows.
+// NB caller must call use defer rows.Close() with rows returned
+func (db *Adapter) performTxQuery(tx *sql.Tx, debug bool, query string, args ...interface{}) (*sql.Rows, error) {
+
+	if tx == nil {
+		return nil, fmt.Errorf("No transaction available.")
+	}
+
+	if debug {
+		fmt.Println("QUERY:", query, "ARGS", args)
+	}
+
+	// Statements prepared in a transaction are closed with it, so the query is made directly
+	return tx.Query(query, args...)
+}
+
+// performTxExec executes Query SQL in the given transaction with no rows returned, just result
+func (db *Adapter) performTxExec(tx *sql.Tx, debug bool, query string, args ...interface{}) (sql.Result, error) {
+
+	if tx == nil {
+		return nil, fmt.Errorf("No transaction available.")
+	}
+
+	if debug {
+		fmt.Println("QUERY:", query, "ARGS", args)
+	}
+
+	return tx.Exec(query, args...)
+}
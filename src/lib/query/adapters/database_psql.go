@@ -123,3 +123,24 @@ func (db *PostgresqlAdapter) Insert(sql string, args ...interface{}) (id int64,
 	err = row.Scan(&id)
 	return id, err
 }
+
+// TxExec executes non-select statements in the transaction
+func (db *PostgresqlAdapter) TxExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return db.performTxExec(tx, db.debug, query, args...)
+}
+
+// TxQuery executes Query SQL in the transaction - NB caller must call use defer rows.Close() with rows returned
+func (db *PostgresqlAdapter) TxQuery(tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.performTxQuery(tx, db.debug, query, args...)
+}
+
+// TxInsert inserts a record with params in the transaction and returns the id
+func (db *PostgresqlAdapter) TxInsert(tx *sql.Tx, sql string, args ...interface{}) (id int64, err error) {
+	if tx == nil {
+		return 0, fmt.Errorf("No transaction available.")
+	}
+
+	row := tx.QueryRow(sql, args...)
+	err = row.Scan(&id)
+	return id, err
+}
@@ -105,3 +105,24 @@ func (db *SqliteAdapter) Insert(query string, args ...interface{}) (id int64, er
 	return id, nil
 
 }
+
+// TxExec executes non-select statements in the transaction, the transaction holds the database's write lock
+// so the adapter's mutex isn't taken
+func (db *SqliteAdapter) TxExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return db.performTxExec(tx, db.debug, query, args...)
+}
+
+// TxQuery executes Query SQL in the transaction - NB caller must call use defer rows.Close() with rows returned
+func (db *SqliteAdapter) TxQuery(tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.performTxQuery(tx, db.debug, query, args...)
+}
+
+// TxInsert inserts a record with params in the transaction and returns the id
+func (db *SqliteAdapter) TxInsert(tx *sql.Tx, query string, args ...interface{}) (id int64, err error) {
+	result, err := db.TxExec(tx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
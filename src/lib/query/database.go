@@ -1,6 +1,7 @@
 package query
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -153,6 +154,74 @@ func ExecSQL(query string, args ...interface{}) (sql.Result, error) {
 	return results, err
 }
 
+// TransactionTimeout is how long a transaction may stay open before it is rolled back. With sqlite the transaction
+// holds the only connection, so a query built with the package New while it is open waits for it to end, and
+// one made by the function the transaction executes would otherwise wait forever.
+var TransactionTimeout = time.Minute
+
+// Tx is a database transaction begun by Transaction, the queries built with its New method are executed in it
+// and those built with the package New are not. A nil Tx builds queries executed outside any transaction.
+type Tx struct {
+	tx *sql.Tx
+}
+
+// Transaction executes f in a new database transaction, committing it if f returns nil and rolling it back otherwise.
+// Only the queries f builds from tx are part of the transaction, so tx should be passed down to every function
+// which reads or writes the records f works with, and f should leave slow calls to other services until it returns.
+// Transactions aren't nested, a function given a tx uses it rather than beginning another.
+// f must not make queries outside tx, with sqlite they wait for the transaction which is rolled back after TransactionTimeout.
+func Transaction(f func(tx *Tx) error) (err error) {
+	if database == nil {
+		return fmt.Errorf("query: Transaction called with nil database")
+	}
+
+	// The transaction is rolled back by database/sql once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), TransactionTimeout)
+	defer cancel()
+
+	sqlTx, err := database.SQLDB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{tx: sqlTx}
+
+	// Rollback if f fails or panics
+	committed := false
+	defer func() {
+		if !committed {
+			rollbackErr := sqlTx.Rollback()
+			if rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+				log.Error(log.V{"Database transaction, error rolling back": rollbackErr})
+			}
+		}
+	}()
+
+	err = f(tx)
+	if ctx.Err() != nil {
+		return fmt.Errorf("query: transaction rolled back after %s, its queries must all be made with its tx", TransactionTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	committed = true
+	return sqlTx.Commit()
+}
+
+// New builds a new Query executed in the transaction, given the table and primary key
+func (tx *Tx) New(t string, pk string) *Query {
+	q := New(t, pk)
+	if q != nil && tx != nil {
+		q.tx = tx.tx
+	}
+	return q
+}
+
+// Exec the given sql and args in the transaction directly
+func (tx *Tx) Exec(sql string, args ...interface{}) (sql.Result, error) {
+	return tx.New("", "").exec(sql, args...)
+}
+
 // TimeString returns a string formatted as a time for this db
 // if the database is nil, an empty string is returned.
 func TimeString(t time.Time) string {
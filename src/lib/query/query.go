@@ -48,6 +48,9 @@ type Query struct {
 
 	// Extra args to be substituted in the *where* clause
 	args []interface{}
+
+	// The transaction the query is executed in, set with Tx.New()
+	tx *sql.Tx
 }
 
 // New builds a new Query, given the table and primary key
@@ -95,6 +98,7 @@ func (q *Query) Copy() *Query {
 		limit:      q.limit,
 		offset:     q.offset,
 		args:       q.args,
+		tx:         q.tx,
 	}
 }
 
@@ -133,7 +137,7 @@ func (q *Query) InsertJoins(a []int64, b []int64) error {
 		fmt.Printf("JOINS SQL:%s\n", sql)
 	}
 
-	_, err := database.Exec(sql)
+	_, err := q.exec(sql)
 	return err
 }
 
@@ -174,7 +178,13 @@ func (q *Query) Insert(params map[string]string) (int64, error) {
 		fmt.Printf("INSERT SQL:%s %v\n", sql, valuesFromParams(params))
 	}
 
-	id, err := database.Insert(sql, valuesFromParams(params)...)
+	var id int64
+	var err error
+	if q.tx != nil {
+		id, err = database.TxInsert(q.tx, sql, valuesFromParams(params)...)
+	} else {
+		id, err = database.Insert(sql, valuesFromParams(params)...)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -211,6 +221,12 @@ func (q *Query) Delete() error {
 
 // UpdateAll updates all models specified in this relation
 func (q *Query) UpdateAll(params map[string]string) error {
+	_, err := q.UpdateAllCount(params)
+	return err
+}
+
+// UpdateAllCount updates all models specified in this relation and returns how many were updated
+func (q *Query) UpdateAllCount(params map[string]string) (int64, error) {
 
 	// Build query SQL, allowing for null fields
 	var output []string
@@ -242,9 +258,12 @@ func (q *Query) UpdateAll(params map[string]string) error {
 		fmt.Printf("UPDATE SQL:%s\n%v\n", q.QueryString(), values)
 	}
 
-	// Return the result of execution
-	_, err := q.Result()
-	return err
+	// Return the number of rows updated
+	result, err := q.Result()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // DeleteAll delets *all* models specified in this relation
@@ -305,17 +324,27 @@ func (q *Query) Count() (int64, error) {
 // Result executes the query against the database, returning sql.Result, and error (no rows)
 // (Executes SQL)
 func (q *Query) Result() (sql.Result, error) {
-	results, err := database.Exec(q.QueryString(), q.args...)
-	return results, err
+	return q.exec(q.QueryString(), q.args...)
 }
 
 // Rows executes the query against the database, and return the sql rows result for this query
 // (Executes SQL)
 func (q *Query) Rows() (*sql.Rows, error) {
+	if q.tx != nil {
+		return database.TxQuery(q.tx, q.QueryString(), q.args...)
+	}
 	results, err := database.Query(q.QueryString(), q.args...)
 	return results, err
 }
 
+// exec executes the sql in the transaction of the query if it has one or against the database
+func (q *Query) exec(sql string, args ...interface{}) (sql.Result, error) {
+	if q.tx != nil {
+		return database.TxExec(q.tx, sql, args...)
+	}
+	return database.Exec(sql, args...)
+}
+
 // FirstResult executes the SQL and returrns the first result
 func (q *Query) FirstResult() (Result, error) {
 
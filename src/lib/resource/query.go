@@ -8,7 +8,12 @@ import (
 
 // Query creates a new query relation referencing this specific resource by id.
 func (r *Base) Query() *query.Query {
-	return query.New(r.Table(), r.PrimaryKey()).Where("id=?", r.ID)
+	return r.QueryTx(nil)
+}
+
+// QueryTx creates a new query relation referencing this specific resource by id in the transaction.
+func (r *Base) QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(r.Table(), r.PrimaryKey()).Where("id=?", r.ID)
 }
 
 // ValidateParams allows only those params by AllowedParams()
@@ -31,6 +36,11 @@ func (r *Base) ValidateParams(params map[string]string, allowed []string) map[st
 
 // Create inserts a new database record and returns the id or an error
 func (r *Base) Create(params map[string]string) (int64, error) {
+	return r.CreateTx(nil, params)
+}
+
+// CreateTx inserts a new database record in the transaction and returns the id or an error
+func (r *Base) CreateTx(tx *query.Tx, params map[string]string) (int64, error) {
 
 	// Make sure updated_at and created_at are set to the current time
 	now := query.TimeString(time.Now().UTC())
@@ -38,18 +48,23 @@ func (r *Base) Create(params map[string]string) (int64, error) {
 	params["updated_at"] = now
 
 	// Insert a record into the database
-	id, err := query.New(r.Table(), r.PrimaryKey()).Insert(params)
+	id, err := tx.New(r.Table(), r.PrimaryKey()).Insert(params)
 	return id, err
 }
 
 // Update the database record for this resource with the given params.
 func (r *Base) Update(params map[string]string) error {
+	return r.UpdateTx(nil, params)
+}
+
+// UpdateTx updates the database record for this resource with the given params in the transaction.
+func (r *Base) UpdateTx(tx *query.Tx, params map[string]string) error {
 
 	// Make sure updated_at is set to the current time
 	now := query.TimeString(time.Now().UTC())
 	params["updated_at"] = now
 
-	return r.Query().Update(params)
+	return r.QueryTx(tx).Update(params)
 }
 
 // Destroy deletes this resource by removing the database record.
@@ -11,13 +11,34 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// GeneratePresignedUrl generates the url for download from the S3
-func GeneratePresignedUrl(s3bucket string, s3key string) (string, error) {
+// DefaultRegion is the region of the bucket when s3_region is not set
+const DefaultRegion = "us-east-1"
 
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String("us-east-1"),
+// GeneratePresignedUrl generates the url for download from the S3 which lasts for expiry,
+// the url is not logged as anyone with it can download the file
+func GeneratePresignedUrl(s3bucket string, s3key string, expiry time.Duration) (string, error) {
+
+	region := config.Get("s3_region")
+	if region == "" {
+		region = DefaultRegion
+	}
+
+	awsConfig := &aws.Config{
+		Region:      aws.String(region),
 		Credentials: credentials.NewStaticCredentials(config.Get("s3_access_key"), config.Get("s3_secret_key"), ""),
-	})
+	}
+
+	// S3 compatible storage is used through its endpoint
+	if config.Get("s3_endpoint") != "" {
+		awsConfig.Endpoint = aws.String(config.Get("s3_endpoint"))
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		log.Println("Failed to create session", err)
+		return "", err
+	}
 
 	// Create S3 service client
 	svc := s3.New(sess)
@@ -26,13 +47,11 @@ func GeneratePresignedUrl(s3bucket string, s3key string) (string, error) {
 		Bucket: aws.String(s3bucket),
 		Key:    aws.String(s3key),
 	})
-	urlStr, err := req.Presign(15 * time.Minute)
+	urlStr, err := req.Presign(expiry)
 
 	if err != nil {
 		log.Println("Failed to sign request", err)
 	}
 
-	log.Println("The URL is", urlStr)
-
 	return urlStr, err
 }
@@ -11,7 +11,8 @@ import (
 )
 
 // Middleware sets a token on every GET request so that it can be
-// inserted into the view. It currently ignores requests for files and assets.
+// inserted into the view, and the referral cookie when the link has the code
+// of an affiliate. It currently ignores requests for files and assets.
 func Middleware(h http.HandlerFunc) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +30,11 @@ func Middleware(h http.HandlerFunc) http.HandlerFunc {
 				ctx = context.WithValue(ctx, view.AuthenticityContext, token)
 				r = r.WithContext(ctx)
 			}
+
+			// A link with the referral code of an affiliate attributes the purchases of the buyer to them
+			if r.URL.Query().Get("ref") != "" {
+				setReferral(w, r)
+			}
 		}
 
 		h(w, r)
@@ -0,0 +1,46 @@
+package session
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/auth"
+)
+
+// ReferralCookie is the name of the cookie with the code of the affiliate whose link the buyer followed
+const ReferralCookie = "referral"
+
+// ReferralMaxAge is how long purchases are attributed to the affiliate after the buyer followed their link, in seconds
+const ReferralMaxAge = 30 * 24 * 60 * 60
+
+// referralPattern is the format of the referral code of an affiliate
+var referralPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// setReferral sets the referral cookie to the code in the ref param of the link,
+// the last link followed by the buyer is the one the purchase is attributed to.
+func setReferral(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("ref")))
+	if !referralPattern.MatchString(code) {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ReferralCookie,
+		Value:    code,
+		HttpOnly: true,
+		Secure:   auth.SecureCookies,
+		Path:     "/",
+		MaxAge:   ReferralMaxAge,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Referral returns the code of the affiliate whose link the buyer followed, or an empty string if there is none.
+func Referral(r *http.Request) string {
+	cookie, err := r.Cookie(ReferralCookie)
+	if err != nil || !referralPattern.MatchString(cookie.Value) {
+		return ""
+	}
+	return cookie.Value
+}
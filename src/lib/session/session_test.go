@@ -56,3 +56,27 @@ func TestAuthenticate(t *testing.T) {
 	}
 
 }
+
+// TestReferral tests the referral code of a link is kept in its cookie and invalid codes are ignored.
+func TestReferral(t *testing.T) {
+	tests := []struct {
+		url  string
+		code string
+	}{
+		{"/products/1?ref=Jane-1", "jane-1"},
+		{"/?ref=jane%20doe", ""},
+		{"/", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+		setReferral(w, r)
+
+		r = httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", strings.Join(w.HeaderMap["Set-Cookie"], ""))
+		if code := Referral(r); code != test.code {
+			t.Fatalf("session: expected referral %q for %s got:%q", test.code, test.url, code)
+		}
+	}
+}
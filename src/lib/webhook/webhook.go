@@ -0,0 +1,101 @@
+// Package webhook signs and verifies the webhooks sent to a product's webhook URL.
+//
+// Each webhook carries an X-OPH-Signature header of the form t=<unix time>,v1=<hex hmac>
+// where the HMAC-SHA256 is computed with the product's webhook secret over "<unix time>.<body>".
+// Receivers written in Go can validate a request with:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	err := webhook.Verify(body, r.Header.Get(webhook.SignatureHeader), secret, webhook.DefaultTolerance)
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the request header carrying the signature
+const SignatureHeader = "X-OPH-Signature"
+
+// DefaultTolerance is the maximum age of a signature accepted by receivers
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidHeader is returned when the signature header can't be parsed
+	ErrInvalidHeader = errors.New("webhook: invalid signature header")
+	// ErrNoValidSignature is returned when none of the signatures match the payload
+	ErrNoValidSignature = errors.New("webhook: no valid signature found")
+	// ErrTooOld is returned when the timestamp is outside the tolerance
+	ErrTooOld = errors.New("webhook: timestamp outside the tolerance")
+)
+
+// Sign returns the signature header value for the payload signed with secret at time t.
+func Sign(payload []byte, secret string, t time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), ComputeSignature(payload, secret, t.Unix()))
+}
+
+// ComputeSignature returns the hex HMAC-SHA256 of "<timestamp>.<payload>" with the secret.
+func ComputeSignature(payload []byte, secret string, timestamp int64) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks the signature header against the payload and secret,
+// rejecting signatures older than tolerance, a tolerance of 0 skips the check.
+func Verify(payload []byte, header string, secret string, tolerance time.Duration) error {
+	timestamp, signatures, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrTooOld
+	}
+
+	expected := []byte(ComputeSignature(payload, secret, timestamp))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+
+	return ErrNoValidSignature
+}
+
+// parseHeader returns the timestamp and v1 signatures in the header.
+func parseHeader(header string) (int64, []string, error) {
+	var timestamp int64
+	var signatures []string
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return 0, nil, ErrInvalidHeader
+		}
+
+		switch parts[0] {
+		case "t":
+			t, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return 0, nil, ErrInvalidHeader
+			}
+			timestamp = t
+		case "v1":
+			signatures = append(signatures, parts[1])
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return 0, nil, ErrInvalidHeader
+	}
+
+	return timestamp, signatures, nil
+}
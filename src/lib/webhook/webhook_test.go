@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+// TestVerify tests signatures made by Sign are verified
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.succeeded"}`)
+
+	header := Sign(payload, "secret", time.Now())
+
+	err := Verify(payload, header, "secret", DefaultTolerance)
+	if err != nil {
+		t.Errorf("webhook: failed to verify signature %s: %s", header, err)
+	}
+
+	err = Verify(payload, header, "other", DefaultTolerance)
+	if err != ErrNoValidSignature {
+		t.Errorf("webhook: verified signature with the wrong secret, got:%v", err)
+	}
+
+	err = Verify([]byte(`{"id":"evt_2"}`), header, "secret", DefaultTolerance)
+	if err != ErrNoValidSignature {
+		t.Errorf("webhook: verified signature for a different payload, got:%v", err)
+	}
+}
+
+// TestVerifyTolerance tests old signatures are rejected
+func TestVerifyTolerance(t *testing.T) {
+	payload := []byte(`{}`)
+
+	header := Sign(payload, "secret", time.Now().Add(-time.Hour))
+
+	err := Verify(payload, header, "secret", DefaultTolerance)
+	if err != ErrTooOld {
+		t.Errorf("webhook: accepted an old signature, got:%v", err)
+	}
+
+	err = Verify(payload, header, "secret", 0)
+	if err != nil {
+		t.Errorf("webhook: failed to verify signature without tolerance: %s", err)
+	}
+}
+
+// TestVerifyInvalidHeader tests malformed headers are rejected
+func TestVerifyInvalidHeader(t *testing.T) {
+	for _, header := range []string{"", "abc", "t=abc,v1=00", "t=123", "v1=00"} {
+		err := Verify([]byte(`{}`), header, "secret", 0)
+		if err != ErrInvalidHeader {
+			t.Errorf("webhook: accepted header %q, got:%v", header, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+)
+
+// licenseResponse is the JSON response of the license endpoints
+type licenseResponse struct {
+	Valid       bool   `json:"valid"`
+	Status      string `json:"status,omitempty"`
+	ProductID   int64  `json:"product_id,omitempty"`
+	Seats       int64  `json:"seats,omitempty"`
+	Activations int    `json:"activations"`
+	Instance    string `json:"instance,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// HandleValidate responds to POST /licenses/validate with whether the license_key is valid,
+// when an instance is given the key is only valid if it is activated on the instance.
+func HandleValidate(w http.ResponseWriter, r *http.Request) error {
+	params, err := mux.ParamsJSON(r)
+	if err != nil {
+		return renderLicense(w, http.StatusBadRequest, licenseResponse{Error: err.Error()})
+	}
+
+	license, status, err := findLicense(params.Get("license_key"))
+	if err != nil {
+		return renderLicense(w, status, licenseResponse{Error: err.Error()})
+	}
+
+	response, err := licenseStatus(license)
+	if err != nil {
+		return renderLicense(w, http.StatusInternalServerError, licenseResponse{Error: "error fetching activations"})
+	}
+
+	instance := params.Get("instance")
+	if instance != "" {
+		response.Instance = instance
+		_, err = licenses.FindActivationInstance(license.ID, instance)
+		if err != nil {
+			response.Valid = false
+			response.Error = "license key is not activated on this instance"
+		}
+	}
+
+	return renderLicense(w, http.StatusOK, response)
+}
+
+// HandleActivate responds to POST /licenses/activate by activating the license_key on the instance,
+// as long as the key has a seat left.
+func HandleActivate(w http.ResponseWriter, r *http.Request) error {
+	params, err := mux.ParamsJSON(r)
+	if err != nil {
+		return renderLicense(w, http.StatusBadRequest, licenseResponse{Error: err.Error()})
+	}
+
+	license, status, err := findLicense(params.Get("license_key"))
+	if err != nil {
+		return renderLicense(w, status, licenseResponse{Error: err.Error()})
+	}
+
+	instance := params.Get("instance")
+	if instance == "" {
+		return renderLicense(w, http.StatusBadRequest, licenseResponse{Error: "instance is required"})
+	}
+
+	_, err = license.Activate(instance)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case licenses.ErrRevoked, licenses.ErrSuspended:
+			status = http.StatusForbidden
+		case licenses.ErrSeatsUsed:
+			status = http.StatusConflict
+		default:
+			log.Error(log.V{"License, error activating license": err, "license_id": license.ID})
+			err = errors.New("error activating license key")
+		}
+		response, _ := licenseStatus(license)
+		response.Valid = false
+		response.Instance = instance
+		response.Error = err.Error()
+		return renderLicense(w, status, response)
+	}
+
+	log.Info(log.V{"msg": "License activated", "license_id": license.ID})
+
+	response, err := licenseStatus(license)
+	if err != nil {
+		return renderLicense(w, http.StatusInternalServerError, licenseResponse{Error: "error fetching activations"})
+	}
+	response.Instance = instance
+
+	return renderLicense(w, http.StatusOK, response)
+}
+
+// HandleDeactivate responds to POST /licenses/deactivate by removing the activation of the license_key
+// on the instance, freeing its seat.
+func HandleDeactivate(w http.ResponseWriter, r *http.Request) error {
+	params, err := mux.ParamsJSON(r)
+	if err != nil {
+		return renderLicense(w, http.StatusBadRequest, licenseResponse{Error: err.Error()})
+	}
+
+	license, status, err := findLicense(params.Get("license_key"))
+	if err != nil {
+		return renderLicense(w, status, licenseResponse{Error: err.Error()})
+	}
+
+	instance := params.Get("instance")
+	err = license.Deactivate(instance)
+	if err != nil {
+		return renderLicense(w, http.StatusNotFound, licenseResponse{Error: "license key is not activated on this instance"})
+	}
+
+	log.Info(log.V{"msg": "License deactivated", "license_id": license.ID})
+
+	response, err := licenseStatus(license)
+	if err != nil {
+		return renderLicense(w, http.StatusInternalServerError, licenseResponse{Error: "error fetching activations"})
+	}
+
+	return renderLicense(w, http.StatusOK, response)
+}
+
+// findLicense returns the license with the key and the status code to respond with if it is not found
+func findLicense(key string) (*licenses.License, int, error) {
+	if key == "" {
+		return nil, http.StatusBadRequest, errors.New("license_key is required")
+	}
+
+	// Forged keys are rejected without looking them up
+	if !licenses.VerifyKey(key) {
+		return nil, http.StatusNotFound, errors.New("license key not found")
+	}
+
+	license, err := licenses.FindKey(key)
+	if err != nil {
+		return nil, http.StatusNotFound, errors.New("license key not found")
+	}
+
+	return license, http.StatusOK, nil
+}
+
+// licenseStatus returns the response describing the license and its activations
+func licenseStatus(license *licenses.License) (licenseResponse, error) {
+	response := licenseResponse{
+		Valid:     license.Active(),
+		Status:    license.Status,
+		ProductID: license.ProductID,
+		Seats:     license.Seats,
+	}
+
+	activations, err := license.Activations()
+	if err != nil {
+		return response, err
+	}
+	response.Activations = len(activations)
+
+	return response, nil
+}
+
+// renderLicense writes the response as JSON with the status code
+func renderLicense(w http.ResponseWriter, status int, response licenseResponse) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(response)
+}
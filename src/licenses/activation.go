@@ -0,0 +1,89 @@
+package licenses
+
+import (
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+// ActivationsTableName is the database table for license activations
+const ActivationsTableName = "license_activations"
+
+// Activation is a license activated on an instance e.g. a machine or installation
+type Activation struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	LicenseID int64
+	Instance  string
+}
+
+// NewActivation creates and initialises a new activation instance.
+func NewActivation() *Activation {
+	activation := &Activation{}
+	activation.CreatedAt = time.Now()
+	activation.UpdatedAt = time.Now()
+	activation.TableName = ActivationsTableName
+	activation.KeyName = KeyName
+	return activation
+}
+
+// NewActivationWithColumns creates a new activation instance and fills it with data from the database cols provided.
+func NewActivationWithColumns(cols map[string]interface{}) *Activation {
+	activation := NewActivation()
+	activation.ID = resource.ValidateInt(cols["id"])
+	activation.CreatedAt = resource.ValidateTime(cols["created_at"])
+	activation.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	activation.LicenseID = resource.ValidateInt(cols["license_id"])
+	activation.Instance = resource.ValidateString(cols["instance"])
+	return activation
+}
+
+// FindActivation fetches a single activation record from the database by id.
+func FindActivation(id int64) (*Activation, error) {
+	return FindActivationTx(nil, id)
+}
+
+// FindActivationTx fetches a single activation record by id in the transaction.
+func FindActivationTx(tx *query.Tx, id int64) (*Activation, error) {
+	result, err := ActivationsQueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewActivationWithColumns(result), nil
+}
+
+// FindActivationInstance fetches the activation of the license on the instance.
+func FindActivationInstance(licenseID int64, instance string) (*Activation, error) {
+	result, err := ActivationsQuery().Where("license_id=?", licenseID).Where("instance=?", instance).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewActivationWithColumns(result), nil
+}
+
+// FindAllActivations fetches all activation records matching this query from the database.
+func FindAllActivations(q *query.Query) ([]*Activation, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var activations []*Activation
+	for _, cols := range results {
+		activations = append(activations, NewActivationWithColumns(cols))
+	}
+
+	return activations, nil
+}
+
+// ActivationsQuery returns a new query for activations with a default order.
+func ActivationsQuery() *query.Query {
+	return ActivationsQueryTx(nil)
+}
+
+// ActivationsQueryTx returns a new query for activations with a default order in the transaction.
+func ActivationsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(ActivationsTableName, KeyName).Order("id asc")
+}
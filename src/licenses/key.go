@@ -0,0 +1,78 @@
+package licenses
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+const (
+	// keyRandomLength is the number of random bytes in a key
+	keyRandomLength = 10
+	// keySignatureLength is the number of bytes of the signature kept in a key
+	keySignatureLength = 10
+	// keyGroupLength is the number of characters between the dashes of a key
+	keyGroupLength = 4
+)
+
+// keyEncoding is used for keys as it has no characters which are easily confused
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateKey returns a new random license key signed with the license secret,
+// e.g. ABCD-EFGH-IJKL-MNOP-QRST-UVWX-YZ23-4567
+func GenerateKey() (string, error) {
+	b := make([]byte, keyRandomLength, keyRandomLength+keySignatureLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := keyEncoding.EncodeToString(append(b, sign(b)...))
+
+	var groups []string
+	for i := 0; i < len(encoded); i += keyGroupLength {
+		end := i + keyGroupLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		groups = append(groups, encoded[i:end])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// VerifyKey reports whether the key was signed with the license secret,
+// so forged keys are rejected without looking them up.
+func VerifyKey(key string) bool {
+	b, err := keyEncoding.DecodeString(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(key), "-", "")))
+	if err != nil || len(b) != keyRandomLength+keySignatureLength {
+		return false
+	}
+
+	return hmac.Equal(b[keyRandomLength:], sign(b[:keyRandomLength]))
+}
+
+// NormaliseKey returns the key as it is stored, customers may paste keys in lower case or with spaces
+func NormaliseKey(key string) string {
+	return strings.ToUpper(strings.TrimSpace(key))
+}
+
+// sign returns the truncated HMAC of b using the license secret
+func sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write(b)
+	return mac.Sum(nil)[:keySignatureLength]
+}
+
+// secret returns the license secret, configs created before license keys use the hmac key
+func secret() []byte {
+	s := config.Get("license_secret")
+	if s == "" {
+		s = config.Get("hmac_key")
+	}
+	return []byte(s)
+}
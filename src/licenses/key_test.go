@@ -0,0 +1,65 @@
+// Tests for license keys
+package licenses
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test generated keys are unique, grouped and verify
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("licenses: error generating key %s", err)
+	}
+
+	groups := strings.Split(key, "-")
+	if len(groups) != 8 {
+		t.Fatalf("licenses: expected 8 groups in key got:%s", key)
+	}
+	for _, group := range groups {
+		if len(group) != keyGroupLength {
+			t.Fatalf("licenses: expected groups of %d in key got:%s", keyGroupLength, key)
+		}
+	}
+
+	if !VerifyKey(key) {
+		t.Fatalf("licenses: expected generated key to verify got:%s", key)
+	}
+
+	other, err := GenerateKey()
+	if err != nil || other == key {
+		t.Fatalf("licenses: expected a new key got:%s %v", other, err)
+	}
+}
+
+// Test keys are verified as customers may type them and forged keys are rejected
+func TestVerifyKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("licenses: error generating key %s", err)
+	}
+
+	if !VerifyKey(" " + strings.ToLower(key) + "\n") {
+		t.Fatalf("licenses: expected key in lower case with spaces to verify got:%s", key)
+	}
+
+	if NormaliseKey(" "+strings.ToLower(key)) != key {
+		t.Fatalf("licenses: expected normalised key to be %s", key)
+	}
+
+	// Change a character of the random part of the key
+	tampered := []byte(key)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+
+	invalid := []string{"", "ABCD-EFGH", string(tampered), key + "-ABCD", "not a key"}
+	for _, k := range invalid {
+		if VerifyKey(k) {
+			t.Fatalf("licenses: expected key %q to be rejected", k)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package licenses represents the license keys issued for the payments of products
+package licenses
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+var (
+	// ErrRevoked is returned when activating a license which has been revoked
+	ErrRevoked = errors.New("license key has been revoked")
+	// ErrSuspended is returned when activating a license whose subscription is paused
+	ErrSuspended = errors.New("license key is suspended while its subscription is paused")
+	// ErrSeatsUsed is returned when activating a license on more instances than its seats
+	ErrSeatsUsed = errors.New("license key has no seats left")
+)
+
+// License is a license key issued for a payment or subscription
+type License struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Key            string
+	ProductID      int64
+	TransactionID  int64
+	SubscriptionID string
+	Email          string
+	Seats          int64
+	Status         string
+	RevokedAt      time.Time
+}
+
+// Active reports whether the license has not been revoked or suspended
+func (l *License) Active() bool {
+	return l.Status == StatusActive
+}
+
+// Revoke revokes the license in the transaction, its activations are kept so they can be seen later
+func (l *License) Revoke(tx *query.Tx) error {
+	if l.Status == StatusRevoked {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	err := l.UpdateTx(tx, map[string]string{"status": StatusRevoked, "revoked_at": query.TimeString(now)})
+	if err != nil {
+		return err
+	}
+
+	l.Status = StatusRevoked
+	l.RevokedAt = now
+	return nil
+}
+
+// Activations returns the instances the license is activated on
+func (l *License) Activations() ([]*Activation, error) {
+	return l.ActivationsTx(nil)
+}
+
+// ActivationsTx returns the instances the license is activated on in the transaction
+func (l *License) ActivationsTx(tx *query.Tx) ([]*Activation, error) {
+	return FindAllActivations(ActivationsQueryTx(tx).Where("license_id=?", l.ID))
+}
+
+// Activate activates the license on the instance e.g. a machine id, activating
+// an instance again returns its existing activation without using another seat.
+func (l *License) Activate(instance string) (*Activation, error) {
+	var activation *Activation
+
+	if l.Status == StatusSuspended {
+		return nil, ErrSuspended
+	}
+	if !l.Active() {
+		return nil, ErrRevoked
+	}
+
+	// Seats are counted and taken in a transaction so they can't be oversold
+	err := query.Transaction(func(tx *query.Tx) error {
+		activations, err := l.ActivationsTx(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range activations {
+			if a.Instance == instance {
+				activation = a
+				return nil
+			}
+		}
+
+		if int64(len(activations)) >= l.Seats {
+			return ErrSeatsUsed
+		}
+
+		activationParams := map[string]string{
+			"license_id": strconv.FormatInt(l.ID, 10),
+			"instance":   instance,
+		}
+
+		id, err := NewActivation().CreateTx(tx, activationParams)
+		if err != nil {
+			return err
+		}
+
+		activation, err = FindActivationTx(tx, id)
+		return err
+	})
+
+	return activation, err
+}
+
+// Deactivate removes the activation of the instance, freeing its seat
+func (l *License) Deactivate(instance string) error {
+	activation, err := FindActivationInstance(l.ID, instance)
+	if err != nil {
+		return err
+	}
+	return activation.Destroy()
+}
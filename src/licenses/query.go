@@ -0,0 +1,221 @@
+package licenses
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "licenses"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "id desc"
+
+	// StatusActive is the status of a license which can be activated
+	StatusActive = "active"
+	// StatusRevoked is the status of a license whose subscription has ended
+	StatusRevoked = "revoked"
+	// StatusSuspended is the status of a license whose subscription is paused, it is active again once it is resumed
+	StatusSuspended = "suspended"
+)
+
+// NewWithColumns creates a new license instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *License {
+	license := New()
+	license.ID = resource.ValidateInt(cols["id"])
+	license.CreatedAt = resource.ValidateTime(cols["created_at"])
+	license.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	license.Key = resource.ValidateString(cols["license_key"])
+	license.ProductID = resource.ValidateInt(cols["product_id"])
+	license.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	license.SubscriptionID = resource.ValidateString(cols["subscr_id"])
+	license.Email = resource.ValidateString(cols["email"])
+	license.Seats = resource.ValidateInt(cols["seats"])
+	license.Status = resource.ValidateString(cols["status"])
+	license.RevokedAt = resource.ValidateTime(cols["revoked_at"])
+	return license
+}
+
+// New creates and initialises a new license instance.
+func New() *License {
+	license := &License{}
+	license.CreatedAt = time.Now()
+	license.UpdatedAt = time.Now()
+	license.TableName = TableName
+	license.KeyName = KeyName
+	return license
+}
+
+// Issue creates a license with a new key in the transaction for the payment or subscription in the subscriptions table.
+func Issue(tx *query.Tx, productID int64, transactionID int64, subscriptionID string, email string, seats int64) (*License, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	licenseParams := make(map[string]string)
+	licenseParams["license_key"] = key
+	licenseParams["product_id"] = strconv.FormatInt(productID, 10)
+	licenseParams["transaction_id"] = strconv.FormatInt(transactionID, 10)
+	licenseParams["subscr_id"] = subscriptionID
+	licenseParams["email"] = email
+	licenseParams["seats"] = strconv.FormatInt(seats, 10)
+	licenseParams["status"] = StatusActive
+
+	id, err := New().CreateTx(tx, licenseParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindTx(tx, id)
+}
+
+// RevokeSubscription revokes the licenses of the subscription in the transaction, including those suspended while it was paused.
+func RevokeSubscription(tx *query.Tx, subscriptionID string) error {
+	if subscriptionID == "" {
+		return nil
+	}
+
+	licenses, err := FindAll(QueryTx(tx).Where("subscr_id=?", subscriptionID).Where("status IN (?,?)", StatusActive, StatusSuspended))
+	if err != nil {
+		return err
+	}
+
+	for _, license := range licenses {
+		err = license.Revoke(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ChangeSubscriptionProduct moves the licenses of the subscription which haven't been revoked to the product with its seats
+// in the transaction when the subscriber changes plan, their keys and activations are kept. It returns the licenses moved.
+func ChangeSubscriptionProduct(tx *query.Tx, subscriptionID string, productID int64, seats int64) ([]*License, error) {
+	if subscriptionID == "" {
+		return nil, nil
+	}
+
+	licenses, err := FindAll(QueryTx(tx).Where("subscr_id=?", subscriptionID).Where("status IN (?,?)", StatusActive, StatusSuspended))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, license := range licenses {
+		err = license.UpdateTx(tx, map[string]string{
+			"product_id": strconv.FormatInt(productID, 10),
+			"seats":      strconv.FormatInt(seats, 10),
+		})
+		if err != nil {
+			return nil, err
+		}
+		license.ProductID = productID
+		license.Seats = seats
+	}
+
+	return licenses, nil
+}
+
+// SuspendSubscription suspends the active licenses of the subscription in the transaction while it is paused.
+func SuspendSubscription(tx *query.Tx, subscriptionID string) error {
+	return changeSubscriptionStatus(tx, subscriptionID, StatusActive, StatusSuspended)
+}
+
+// ReinstateSubscription makes the suspended licenses of the subscription active again in the transaction once it is resumed.
+func ReinstateSubscription(tx *query.Tx, subscriptionID string) error {
+	return changeSubscriptionStatus(tx, subscriptionID, StatusSuspended, StatusActive)
+}
+
+// changeSubscriptionStatus changes the licenses of the subscription with the status from to the status to
+func changeSubscriptionStatus(tx *query.Tx, subscriptionID string, from string, to string) error {
+	if subscriptionID == "" {
+		return nil
+	}
+
+	licenses, err := FindAll(QueryTx(tx).Where("subscr_id=?", subscriptionID).Where("status=?", from))
+	if err != nil {
+		return err
+	}
+
+	for _, license := range licenses {
+		err = license.UpdateTx(tx, map[string]string{"status": to})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Find fetches a single license record from the database by id.
+func Find(id int64) (*License, error) {
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single license record by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*License, error) {
+	result, err := QueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindKey fetches a single license record from the database by license key.
+func FindKey(key string) (*License, error) {
+	result, err := Query().Where("license_key=?", NormaliseKey(key)).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindTransaction fetches the license issued for the transaction in the subscriptions table.
+func FindTransaction(transactionID int64) (*License, error) {
+	result, err := Query().Where("transaction_id=?", transactionID).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindTransactionProduct fetches the license issued for the product of an order paid by the transaction.
+func FindTransactionProduct(transactionID int64, productID int64) (*License, error) {
+	result, err := Query().Where("transaction_id=?", transactionID).Where("product_id=?", productID).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAll fetches all license records matching this query from the database.
+func FindAll(q *query.Query) ([]*License, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var licenses []*License
+	for _, cols := range results {
+		licenses = append(licenses, NewWithColumns(cols))
+	}
+
+	return licenses, nil
+}
+
+// Query returns a new query for licenses with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for licenses with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
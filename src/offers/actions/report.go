@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/offers"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// reportDateFormat is the format of the from and to dates of the report
+const reportDateFormat = "2006-01-02"
+
+// HandleReport responds to GET /offers/report by counting the bumps and upsells offered from the from date until
+// the end of the to date in UTC with how many were accepted and paid, the report is downloaded as CSV from
+// /offers/report.csv. The period is the current month when no dates are given.
+func HandleReport(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view the offer report"))
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if params.Get("from") != "" {
+		from, err = time.Parse(reportDateFormat, params.Get("from"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The from date should be in the format 2006-01-02.")
+		}
+	}
+	if params.Get("to") != "" {
+		to, err = time.Parse(reportDateFormat, params.Get("to"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The to date should be in the format 2006-01-02.")
+		}
+	}
+
+	// The to date is included in the period
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	report, err := offers.Report(from, end)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// The products are shown by name, a deleted product by its id
+	names := make(map[int64]string)
+	for _, row := range report {
+		for _, id := range []int64{row.ProductID, row.OfferProductID} {
+			if _, ok := names[id]; ok {
+				continue
+			}
+			names[id] = "#" + strconv.FormatInt(id, 10)
+			product, err := products.Find(id)
+			if err == nil {
+				names[id] = product.Name
+			}
+		}
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=offer-report-"+from.Format(reportDateFormat)+"-"+to.Format(reportDateFormat)+".csv")
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"kind", "product", "offered_product", "offered", "accepted", "paid", "conversion", "revenue"})
+		for _, row := range report {
+			writer.Write([]string{row.Kind, names[row.ProductID], names[row.OfferProductID], strconv.FormatInt(row.Offered, 10),
+				strconv.FormatInt(row.Accepted, 10), strconv.FormatInt(row.Paid, 10), row.Conversion(), row.RevenueDisplay()})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("report", report)
+	view.AddKey("names", names)
+	view.AddKey("from", from.Format(reportDateFormat))
+	view.AddKey("to", to.Format(reportDateFormat))
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Offer Report")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("offers/views/report.html.got")
+
+	return view.Render()
+}
@@ -0,0 +1,91 @@
+// Package offers represents the order bumps and upsells offered to buyers
+package offers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+// tokenLength is the number of random bytes in an offer token
+const tokenLength = 16
+
+// Duration is how long after the purchase an upsell can be paid with the saved payment method
+const Duration = time.Hour
+
+const (
+	// KindBump is an add-on offered with the product at its checkout
+	KindBump = "bump"
+	// KindUpsell is a product offered once the product has been bought
+	KindUpsell = "upsell"
+)
+
+const (
+	// StatusOffered is the status of an offer shown to the buyer
+	StatusOffered = "offered"
+	// StatusAccepted is the status of an offer the buyer has accepted whose payment hasn't been recorded yet
+	StatusAccepted = "accepted"
+	// StatusDeclined is the status of an upsell the buyer has declined
+	StatusDeclined = "declined"
+	// StatusPaid is the status of an offer whose payment has been recorded
+	StatusPaid = "paid"
+)
+
+// Offer is an order bump or upsell of a product offered to the buyer of another product
+type Offer struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// Token identifies the offer to the buyer it is made to
+	Token          string
+	Kind           string
+	ProductID      int64
+	OfferProductID int64
+	// Gateway and PurchaseReference identify the purchase an upsell follows, CustomerID and PaymentMethod
+	// are the customer and saved payment method at the gateway with which it is paid with one click
+	Gateway           string
+	PurchaseReference string
+	CustomerID        string
+	PaymentMethod     string
+	// Reference identifies the payment of the offer at the gateway, OrderID the order it is paid with instead
+	Reference     string
+	OrderID       int64
+	TransactionID int64
+	Currency      string
+	// Amount is the price of the offered product before the tax in the smallest currency unit
+	Amount int64
+	Status string
+}
+
+// Open reports whether the upsell can still be accepted or declined by the buyer
+func (o *Offer) Open() bool {
+	return o.Status == StatusOffered && time.Since(o.CreatedAt) < Duration
+}
+
+// OneClick reports whether the upsell can be paid with the payment method saved with the purchase
+func (o *Offer) OneClick() bool {
+	switch o.Gateway {
+	case "stripe":
+		return o.PurchaseReference != ""
+	case "square":
+		return o.CustomerID != "" && o.PaymentMethod != ""
+	}
+	return false
+}
+
+// Accepted reports whether the buyer accepted the offer
+func (o *Offer) Accepted() bool {
+	return o.Status == StatusAccepted || o.Status == StatusPaid
+}
+
+// generateToken returns a new random token for an offer
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
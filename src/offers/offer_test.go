@@ -0,0 +1,63 @@
+// Tests for offers
+package offers
+
+import (
+	"testing"
+	"time"
+)
+
+// Test upsells can only be accepted while they are open and paid with one click when a payment method was saved
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		status    string
+		createdAt time.Time
+		gateway   string
+		customer  string
+		method    string
+		reference string
+		open      bool
+		oneClick  bool
+	}{
+		{StatusOffered, time.Now(), "stripe", "", "", "cs_1", true, true},
+		{StatusOffered, time.Now(), "square", "cus_1", "card_1", "pay_1", true, true},
+		{StatusOffered, time.Now(), "square", "", "", "pay_1", true, false},
+		{StatusOffered, time.Now(), "paypal", "", "", "ord_1", true, false},
+		{StatusOffered, time.Now().Add(-2 * Duration), "stripe", "", "", "cs_1", false, true},
+		{StatusDeclined, time.Now(), "stripe", "", "", "cs_1", false, true},
+		{StatusAccepted, time.Now(), "stripe", "", "", "cs_1", false, true},
+	}
+
+	for _, test := range tests {
+		offer := New()
+		offer.Kind = KindUpsell
+		offer.Status = test.status
+		offer.CreatedAt = test.createdAt
+		offer.Gateway = test.gateway
+		offer.CustomerID = test.customer
+		offer.PaymentMethod = test.method
+		offer.PurchaseReference = test.reference
+
+		if offer.Open() != test.open {
+			t.Fatalf("offers: expected open %t for %s offer created at %s", test.open, test.status, test.createdAt)
+		}
+		if offer.OneClick() != test.oneClick {
+			t.Fatalf("offers: expected one click %t for %s offer", test.oneClick, test.gateway)
+		}
+	}
+}
+
+// Test the conversion and revenue of the report
+func TestReportRow(t *testing.T) {
+	row := &ReportRow{Offered: 8, Accepted: 2, Paid: 1, Revenue: map[string]int64{"USD": 500, "EUR": 1050}}
+	if row.Conversion() != "12.5%" {
+		t.Fatalf("offers: wrong conversion %s", row.Conversion())
+	}
+	if row.RevenueDisplay() != "10.50 EUR, 5.00 USD" {
+		t.Fatalf("offers: wrong revenue %s", row.RevenueDisplay())
+	}
+
+	row = &ReportRow{}
+	if row.Conversion() != "0%" || row.RevenueDisplay() != "" {
+		t.Fatalf("offers: wrong empty row %s %s", row.Conversion(), row.RevenueDisplay())
+	}
+}
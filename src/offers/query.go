@@ -0,0 +1,256 @@
+package offers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "offers"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "id desc"
+)
+
+// ErrClaimed is returned when the upsell has already been accepted or declined, e.g. by another request of the buyer
+var ErrClaimed = errors.New("offer has already been accepted or declined")
+
+// NewWithColumns creates a new offer instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Offer {
+	offer := New()
+	offer.ID = resource.ValidateInt(cols["id"])
+	offer.CreatedAt = resource.ValidateTime(cols["created_at"])
+	offer.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	offer.Token = resource.ValidateString(cols["token"])
+	offer.Kind = resource.ValidateString(cols["kind"])
+	offer.ProductID = resource.ValidateInt(cols["product_id"])
+	offer.OfferProductID = resource.ValidateInt(cols["offer_product_id"])
+	offer.Gateway = resource.ValidateString(cols["pg"])
+	offer.PurchaseReference = resource.ValidateString(cols["purchase_reference"])
+	offer.CustomerID = resource.ValidateString(cols["customer_id"])
+	offer.PaymentMethod = resource.ValidateString(cols["payment_method"])
+	offer.Reference = resource.ValidateString(cols["reference"])
+	offer.OrderID = resource.ValidateInt(cols["order_id"])
+	offer.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	offer.Currency = resource.ValidateString(cols["currency"])
+	offer.Amount = resource.ValidateInt(cols["amount"])
+	offer.Status = resource.ValidateString(cols["status"])
+	return offer
+}
+
+// New creates and initialises a new offer instance.
+func New() *Offer {
+	offer := &Offer{}
+	offer.CreatedAt = time.Now()
+	offer.UpdatedAt = time.Now()
+	offer.TableName = TableName
+	offer.KeyName = KeyName
+	return offer
+}
+
+// Make saves the offer made to the buyer with a new token.
+func Make(offer *Offer) (*Offer, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	offerParams := make(map[string]string)
+	offerParams["token"] = token
+	offerParams["kind"] = offer.Kind
+	offerParams["product_id"] = strconv.FormatInt(offer.ProductID, 10)
+	offerParams["offer_product_id"] = strconv.FormatInt(offer.OfferProductID, 10)
+	offerParams["pg"] = offer.Gateway
+	offerParams["purchase_reference"] = offer.PurchaseReference
+	offerParams["customer_id"] = offer.CustomerID
+	offerParams["payment_method"] = offer.PaymentMethod
+	offerParams["currency"] = offer.Currency
+	offerParams["amount"] = strconv.FormatInt(offer.Amount, 10)
+	offerParams["status"] = offer.Status
+	if offer.Status == "" {
+		offerParams["status"] = StatusOffered
+	}
+
+	id, err := New().Create(offerParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return Find(id)
+}
+
+// Claim records the open upsell as accepted by the buyer before it is paid, so that it is paid once however many
+// requests accept it. Only the first request claims the offer, the others are returned ErrClaimed.
+func (o *Offer) Claim() error {
+	count, err := query.New(TableName, KeyName).Where("token=?", o.Token).Where("status=?", StatusOffered).UpdateAllCount(map[string]string{
+		"status":     StatusAccepted,
+		"updated_at": query.TimeString(time.Now().UTC()),
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrClaimed
+	}
+
+	o.Status = StatusAccepted
+	return nil
+}
+
+// Release reopens the upsell claimed by the buyer when it can't be paid, so that the buyer can accept it again.
+func (o *Offer) Release() error {
+	err := o.Update(map[string]string{"status": StatusOffered})
+	if err != nil {
+		return err
+	}
+	o.Status = StatusOffered
+	return nil
+}
+
+// Accept records the offer as accepted for the payment with the reference at the gateway of the offer, the reference
+// is empty when it is paid with an order. The amount is the price of the offered product before the tax in the smallest currency unit.
+func (o *Offer) Accept(reference string, amount int64, currency string) error {
+	return o.AcceptTx(nil, reference, amount, currency)
+}
+
+// AcceptTx records the offer as accepted for the payment with the reference in the transaction.
+func (o *Offer) AcceptTx(tx *query.Tx, reference string, amount int64, currency string) error {
+	offerParams := map[string]string{
+		"reference": reference,
+		"amount":    strconv.FormatInt(amount, 10),
+		"currency":  currency,
+		"status":    StatusAccepted,
+	}
+
+	err := o.UpdateTx(tx, offerParams)
+	if err != nil {
+		return err
+	}
+
+	o.Reference = reference
+	o.Amount = amount
+	o.Currency = currency
+	o.Status = StatusAccepted
+	return nil
+}
+
+// PlaceOrder records the order the offer is paid with, the offered product is an item of the order.
+func (o *Offer) PlaceOrder(orderID int64) error {
+	err := o.Update(map[string]string{"order_id": strconv.FormatInt(orderID, 10)})
+	if err != nil {
+		return err
+	}
+	o.OrderID = orderID
+	return nil
+}
+
+// Decline records the upsell as declined by the buyer.
+func (o *Offer) Decline() error {
+	err := o.Update(map[string]string{"status": StatusDeclined})
+	if err != nil {
+		return err
+	}
+	o.Status = StatusDeclined
+	return nil
+}
+
+// Pay records the accepted offer as paid by the payment in the subscriptions table in the transaction.
+func (o *Offer) Pay(tx *query.Tx, transactionID int64) error {
+	err := o.UpdateTx(tx, map[string]string{
+		"transaction_id": strconv.FormatInt(transactionID, 10),
+		"status":         StatusPaid,
+	})
+	if err != nil {
+		return err
+	}
+	o.TransactionID = transactionID
+	o.Status = StatusPaid
+	return nil
+}
+
+// Find fetches a single offer record from the database by id.
+func Find(id int64) (*Offer, error) {
+	result, err := Query().Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindToken fetches the offer with the token.
+func FindToken(token string) (*Offer, error) {
+	if token == "" {
+		return nil, errors.New("no token for the offer")
+	}
+
+	result, err := Query().Where("token=?", token).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindPurchase fetches the upsell offered after the purchase with the reference.
+func FindPurchase(reference string) (*Offer, error) {
+	if reference == "" {
+		return nil, errors.New("no reference for the purchase")
+	}
+
+	result, err := Query().Where("kind=?", KindUpsell).Where("purchase_reference=?", reference).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAccepted fetches the accepted offer paid by the payment at the gateway with any of the references in the transaction.
+func FindAccepted(tx *query.Tx, gateway string, references ...string) (*Offer, error) {
+	for _, reference := range references {
+		if reference == "" {
+			continue
+		}
+
+		result, err := QueryTx(tx).Where("pg=?", gateway).Where("reference=?", reference).Where("status=?", StatusAccepted).FirstResult()
+		if err == nil {
+			return NewWithColumns(result), nil
+		}
+	}
+
+	return nil, errors.New("no accepted offer for the payment")
+}
+
+// FindOrder fetches the accepted offers paid with the order in the transaction.
+func FindOrder(tx *query.Tx, orderID int64) ([]*Offer, error) {
+	return FindAll(QueryTx(tx).Where("order_id=?", orderID).Where("status=?", StatusAccepted))
+}
+
+// FindAll fetches all offer records matching this query from the database.
+func FindAll(q *query.Query) ([]*Offer, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var offers []*Offer
+	for _, cols := range results {
+		offers = append(offers, NewWithColumns(cols))
+	}
+
+	return offers, nil
+}
+
+// Query returns a new query for offers with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for offers with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
+}
@@ -0,0 +1,89 @@
+package offers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+)
+
+// ReportRow is the conversion of the bump or upsell of a product in a period
+type ReportRow struct {
+	Kind           string
+	ProductID      int64
+	OfferProductID int64
+	Offered        int64
+	Accepted       int64
+	Paid           int64
+	// Revenue is the amount paid for the offered product before the tax by currency in the smallest currency unit
+	Revenue map[string]int64
+}
+
+// Conversion returns the percentage of the offers made which were paid e.g. 12.5%
+func (r *ReportRow) Conversion() string {
+	if r.Offered == 0 {
+		return "0%"
+	}
+	return strconv.FormatFloat(float64(r.Paid)*100/float64(r.Offered), 'f', 1, 64) + "%"
+}
+
+// RevenueDisplay returns the revenue in each currency like 10.50 EUR, 5.00 USD
+func (r *ReportRow) RevenueDisplay() string {
+	var currencies []string
+	for currency := range r.Revenue {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	var amounts []string
+	for _, currency := range currencies {
+		amounts = append(amounts, strconv.FormatFloat(float64(r.Revenue[currency])/100, 'f', 2, 64)+" "+currency)
+	}
+	return strings.Join(amounts, ", ")
+}
+
+// Report counts the offers made from the start of the period until its end by kind, product and offered product.
+func Report(from time.Time, to time.Time) ([]*ReportRow, error) {
+	q := Query().Where("created_at >= ?", query.TimeString(from.UTC())).Where("created_at < ?", query.TimeString(to.UTC()))
+	offers, err := FindAll(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[string]*ReportRow)
+	for _, offer := range offers {
+		key := offer.Kind + "/" + strconv.FormatInt(offer.ProductID, 10) + "/" + strconv.FormatInt(offer.OfferProductID, 10)
+		row, ok := rows[key]
+		if !ok {
+			row = &ReportRow{Kind: offer.Kind, ProductID: offer.ProductID, OfferProductID: offer.OfferProductID, Revenue: make(map[string]int64)}
+			rows[key] = row
+		}
+
+		row.Offered++
+		if offer.Accepted() {
+			row.Accepted++
+		}
+		if offer.Status == StatusPaid {
+			row.Paid++
+			row.Revenue[strings.ToUpper(offer.Currency)] += offer.Amount
+		}
+	}
+
+	var report []*ReportRow
+	for _, row := range rows {
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Kind != report[j].Kind {
+			return report[i].Kind < report[j].Kind
+		}
+		if report[i].ProductID != report[j].ProductID {
+			return report[i].ProductID < report[j].ProductID
+		}
+		return report[i].OfferProductID < report[j].OfferProductID
+	})
+
+	return report, nil
+}
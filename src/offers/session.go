@@ -0,0 +1,31 @@
+package offers
+
+import (
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/auth"
+)
+
+// SessionOfferKey is the session key of the token of the upsell offered to the buyer
+const SessionOfferKey = "offer"
+
+// Remember stores the token of the upsell offered to the buyer in their session, only the buyer it is offered to can accept it.
+func Remember(w http.ResponseWriter, r *http.Request, token string) error {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	session.Set(SessionOfferKey, token)
+	return session.Save(w)
+}
+
+// Remembered reports whether the upsell with the token was offered to the buyer.
+func Remembered(w http.ResponseWriter, r *http.Request, token string) bool {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return false
+	}
+
+	return token != "" && session.Get(SessionOfferKey) == token
+}
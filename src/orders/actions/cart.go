@@ -0,0 +1,102 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// HandleCartShow responds to GET /cart by showing the products in the buyer's cart priced on the gateway
+// they are paid with in one checkout.
+func HandleCartShow(w http.ResponseWriter, r *http.Request) error {
+
+	cartProducts := subscriptions.CartProducts(w, r)
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("products", cartProducts)
+
+	cart, err := subscriptions.PriceCart(cartProducts, subscriptions.RequestCountry(r))
+	if err == nil {
+		view.AddKey("cart", cart)
+	} else if err != subscriptions.ErrCartEmpty {
+		log.Info(log.V{"msg": "Cart, products can't be checked out together", "error": err})
+		view.AddKey("cartError", err.Error())
+	}
+
+	view.AddKey("meta_title", "Cart")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("orders/views/cart.html.got")
+
+	return view.Render()
+}
+
+// HandleCartAdd responds to POST /cart/add by adding the product to the buyer's cart.
+func HandleCartAdd(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	product, err := products.Find(params.GetInt("product_id"))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if !subscriptions.CartProduct(product) {
+		return server.BadRequestError(errors.New("product can't be added to the cart"), "Add to Cart Failed", "Subscriptions and pay what you want products are bought on their own.")
+	}
+
+	err = orders.AddToCart(w, r, product.ID)
+	if err == orders.ErrCartFull {
+		return server.BadRequestError(err, "Add to Cart Failed", "The cart is full, please check out the products in it first.")
+	}
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/cart")
+}
+
+// HandleCartRemove responds to POST /cart/remove by removing the product from the buyer's cart.
+func HandleCartRemove(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	err = orders.RemoveFromCart(w, r, params.GetInt("product_id"))
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/cart")
+}
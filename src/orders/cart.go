@@ -0,0 +1,88 @@
+package orders
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/auth"
+)
+
+const (
+	// SessionCartKey is the session key of the ids of the products in the cart
+	SessionCartKey = "cart"
+
+	// MaxCartItems is the most products a cart can hold, the cart is kept in the session cookie
+	MaxCartItems = 20
+)
+
+// ErrCartFull is returned when adding a product to a cart which holds MaxCartItems products
+var ErrCartFull = errors.New("cart is full")
+
+// Cart returns the ids of the products in the buyer's cart in the order they were added.
+func Cart(w http.ResponseWriter, r *http.Request) []int64 {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return nil
+	}
+
+	var productIDs []int64
+	for _, value := range strings.Split(session.Get(SessionCartKey), ",") {
+		productID, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && productID > 0 {
+			productIDs = append(productIDs, productID)
+		}
+	}
+
+	return productIDs
+}
+
+// AddToCart adds the product to the buyer's cart, a product is only added once.
+func AddToCart(w http.ResponseWriter, r *http.Request, productID int64) error {
+	productIDs := Cart(w, r)
+	for _, id := range productIDs {
+		if id == productID {
+			return nil
+		}
+	}
+
+	if len(productIDs) >= MaxCartItems {
+		return ErrCartFull
+	}
+
+	return saveCart(w, r, append(productIDs, productID))
+}
+
+// RemoveFromCart removes the product from the buyer's cart.
+func RemoveFromCart(w http.ResponseWriter, r *http.Request, productID int64) error {
+	var productIDs []int64
+	for _, id := range Cart(w, r) {
+		if id != productID {
+			productIDs = append(productIDs, id)
+		}
+	}
+
+	return saveCart(w, r, productIDs)
+}
+
+// EmptyCart removes every product from the buyer's cart.
+func EmptyCart(w http.ResponseWriter, r *http.Request) error {
+	return saveCart(w, r, nil)
+}
+
+// saveCart stores the ids of the products in the buyer's session
+func saveCart(w http.ResponseWriter, r *http.Request, productIDs []int64) error {
+	session, err := auth.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	var values []string
+	for _, id := range productIDs {
+		values = append(values, strconv.FormatInt(id, 10))
+	}
+
+	session.Set(SessionCartKey, strings.Join(values, ","))
+	return session.Save(w)
+}
@@ -0,0 +1,94 @@
+// Package orders represents the orders of carts of products paid in one checkout
+package orders
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+// tokenLength is the number of random bytes in an order token
+const tokenLength = 16
+
+const (
+	// StatusPending is the status of an order whose checkout hasn't been paid yet
+	StatusPending = "pending"
+	// StatusPaid is the status of an order whose payment has been recorded
+	StatusPaid = "paid"
+)
+
+// Order is a cart of products paid in one checkout at a payment gateway, the payment is recorded
+// in the subscriptions table and each product is delivered as if it had been bought on its own.
+type Order struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// Token identifies the order before the gateway has a reference for it
+	Token string
+	// Gateway and Reference identify the checkout at the gateway e.g. the Stripe checkout session
+	Gateway       string
+	Reference     string
+	TransactionID int64
+	Email         string
+	Currency      string
+	// Amount and Tax are in the smallest currency unit, Amount is the total of the checkout
+	// until the payment is recorded and then the amount paid including the tax
+	Amount int64
+	Tax    int64
+	Status string
+
+	Items []*Item
+}
+
+// Item is a product of an order
+type Item struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	OrderID   int64
+	ProductID int64
+	Name      string
+	// Amount is the price of the product before the tax in the smallest currency unit
+	Amount int64
+}
+
+// Paid reports whether the payment of the order has been recorded
+func (o *Order) Paid() bool {
+	return o.Status == StatusPaid
+}
+
+// Subtotal returns the total of the items before the tax
+func (o *Order) Subtotal() int64 {
+	var subtotal int64
+	for _, item := range o.Items {
+		subtotal += item.Amount
+	}
+	return subtotal
+}
+
+// Description returns the names of the products of the order e.g. Book, Course
+func (o *Order) Description() string {
+	var names []string
+	for _, item := range o.Items {
+		names = append(names, item.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Money formats the amount in the smallest currency unit in the currency of the order like 10.50 EUR
+func (o *Order) Money(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/100, 'f', 2, 64) + " " + strings.ToUpper(o.Currency)
+}
+
+// generateToken returns a new random token for an order
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
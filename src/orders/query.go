@@ -0,0 +1,284 @@
+package orders
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "orders"
+	// ItemsTableName is the database table for the items of orders
+	ItemsTableName = "order_items"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// DefaultOrder defines the default sort order in sql for this resource
+	DefaultOrder = "id desc"
+)
+
+// NewWithColumns creates a new order instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Order {
+	order := New()
+	order.ID = resource.ValidateInt(cols["id"])
+	order.CreatedAt = resource.ValidateTime(cols["created_at"])
+	order.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	order.Token = resource.ValidateString(cols["token"])
+	order.Gateway = resource.ValidateString(cols["pg"])
+	order.Reference = resource.ValidateString(cols["reference"])
+	order.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	order.Email = resource.ValidateString(cols["email"])
+	order.Currency = resource.ValidateString(cols["currency"])
+	order.Amount = resource.ValidateInt(cols["amount"])
+	order.Tax = resource.ValidateInt(cols["tax"])
+	order.Status = resource.ValidateString(cols["status"])
+	return order
+}
+
+// New creates and initialises a new order instance.
+func New() *Order {
+	order := &Order{}
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = time.Now()
+	order.TableName = TableName
+	order.KeyName = KeyName
+	return order
+}
+
+// NewItemWithColumns creates a new item instance and fills it with data from the database cols provided.
+func NewItemWithColumns(cols map[string]interface{}) *Item {
+	item := NewItem()
+	item.ID = resource.ValidateInt(cols["id"])
+	item.CreatedAt = resource.ValidateTime(cols["created_at"])
+	item.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	item.OrderID = resource.ValidateInt(cols["order_id"])
+	item.ProductID = resource.ValidateInt(cols["product_id"])
+	item.Name = resource.ValidateString(cols["name"])
+	item.Amount = resource.ValidateInt(cols["amount"])
+	return item
+}
+
+// NewItem creates and initialises a new item instance.
+func NewItem() *Item {
+	item := &Item{}
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = time.Now()
+	item.TableName = ItemsTableName
+	item.KeyName = KeyName
+	return item
+}
+
+// Place saves the order with its items as pending until the gateway's webhook for its payment is recorded,
+// the reference is empty when the gateway has no reference for the checkout until it is paid.
+func Place(order *Order) (*Order, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	orderParams := make(map[string]string)
+	orderParams["token"] = token
+	orderParams["pg"] = order.Gateway
+	orderParams["reference"] = order.Reference
+	orderParams["currency"] = order.Currency
+	orderParams["amount"] = strconv.FormatInt(order.Amount, 10)
+	orderParams["tax"] = strconv.FormatInt(order.Tax, 10)
+	orderParams["status"] = StatusPending
+
+	id, err := New().Create(orderParams)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range order.Items {
+		itemParams := make(map[string]string)
+		itemParams["order_id"] = strconv.FormatInt(id, 10)
+		itemParams["product_id"] = strconv.FormatInt(item.ProductID, 10)
+		itemParams["name"] = item.Name
+		itemParams["amount"] = strconv.FormatInt(item.Amount, 10)
+
+		_, err = NewItem().Create(itemParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Find(id)
+}
+
+// Attach records the reference of the checkout at the gateway once it is known in the transaction.
+func (o *Order) Attach(tx *query.Tx, reference string) error {
+	err := o.UpdateTx(tx, map[string]string{"reference": reference})
+	if err != nil {
+		return err
+	}
+	o.Reference = reference
+	return nil
+}
+
+// Pay records the order as paid by the payment or subscription in the subscriptions table,
+// the amount and tax are those reported by the gateway in the smallest currency unit, in the transaction.
+func (o *Order) Pay(tx *query.Tx, transactionID int64, email string, amount int64, tax int64) error {
+	orderParams := map[string]string{
+		"transaction_id": strconv.FormatInt(transactionID, 10),
+		"email":          email,
+		"amount":         strconv.FormatInt(amount, 10),
+		"tax":            strconv.FormatInt(tax, 10),
+		"status":         StatusPaid,
+	}
+
+	err := o.UpdateTx(tx, orderParams)
+	if err != nil {
+		return err
+	}
+
+	o.TransactionID = transactionID
+	o.Email = email
+	o.Amount = amount
+	o.Tax = tax
+	o.Status = StatusPaid
+	return nil
+}
+
+// Find fetches a single order record with its items from the database by id.
+func Find(id int64) (*Order, error) {
+	return findFirst(nil, Query().Where("id=?", id))
+}
+
+// FindToken fetches the order with the token.
+func FindToken(token string) (*Order, error) {
+	return findFirst(nil, Query().Where("token=?", token))
+}
+
+// FindReference fetches the order for the checkout with the reference at any gateway.
+func FindReference(reference string) (*Order, error) {
+	if reference == "" {
+		return nil, errors.New("no reference for the order")
+	}
+	return findFirst(nil, Query().Where("reference=?", reference))
+}
+
+// FindPending fetches the pending order for the checkout at the gateway with any of the references.
+func FindPending(gateway string, references ...string) (*Order, error) {
+	return FindPendingTx(nil, gateway, references...)
+}
+
+// FindPendingTx fetches the pending order for the checkout at the gateway with any of the references in the transaction.
+func FindPendingTx(tx *query.Tx, gateway string, references ...string) (*Order, error) {
+	for _, reference := range references {
+		if reference == "" {
+			continue
+		}
+
+		order, err := findFirst(tx, QueryTx(tx).Where("pg=?", gateway).Where("reference=?", reference).Where("status=?", StatusPending))
+		if err == nil {
+			return order, nil
+		}
+	}
+
+	return nil, errors.New("no pending order for the checkout")
+}
+
+// FindTransaction fetches the order paid by the payment in the subscriptions table.
+func FindTransaction(transactionID int64) (*Order, error) {
+	return FindTransactionTx(nil, transactionID)
+}
+
+// FindTransactionTx fetches the order paid by the payment in the subscriptions table in the transaction.
+func FindTransactionTx(tx *query.Tx, transactionID int64) (*Order, error) {
+	return findFirst(tx, QueryTx(tx).Where("transaction_id=?", transactionID))
+}
+
+// FindTransactions fetches the orders of the payments by their id in the subscriptions table.
+func FindTransactions(transactionIDs []int64) (map[int64]*Order, error) {
+	found := make(map[int64]*Order)
+	if len(transactionIDs) == 0 {
+		return found, nil
+	}
+
+	orders, err := FindAll(Query().WhereIn("transaction_id", transactionIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		found[order.TransactionID] = order
+	}
+
+	return found, nil
+}
+
+// findFirst fetches the first order of the query with its items in the transaction.
+func findFirst(tx *query.Tx, q *query.Query) (*Order, error) {
+	result, err := q.FirstResult()
+	if err != nil {
+		return nil, err
+	}
+
+	order := NewWithColumns(result)
+	err = findItems(tx, []*Order{order})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// FindAll fetches all order records matching this query from the database with their items.
+func FindAll(q *query.Query) ([]*Order, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*Order
+	for _, cols := range results {
+		orders = append(orders, NewWithColumns(cols))
+	}
+
+	err = findItems(nil, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// findItems fetches the items of the orders in the transaction.
+func findItems(tx *query.Tx, orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	found := make(map[int64]*Order)
+	var ids []int64
+	for _, order := range orders {
+		found[order.ID] = order
+		ids = append(ids, order.ID)
+	}
+
+	results, err := tx.New(ItemsTableName, KeyName).WhereIn("order_id", ids).Order("id asc").Results()
+	if err != nil {
+		return err
+	}
+	for _, cols := range results {
+		item := NewItemWithColumns(cols)
+		if order, ok := found[item.OrderID]; ok {
+			order.Items = append(order.Items, item)
+		}
+	}
+
+	return nil
+}
+
+// Query returns a new query for orders with a default order.
+func Query() *query.Query {
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for orders with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(DefaultOrder)
+}
@@ -113,6 +113,12 @@ func HandleCreate(w http.ResponseWriter, r *http.Request) error {
 		accepted = products.AllowedParamsAdmin()
 	}
 	storyParams := story.ValidateParams(params.Map(), accepted)
+	products.ValidatePriceMode(storyParams)
+	products.ValidateTrialDays(storyParams)
+	products.ValidateBundle(storyParams, 0)
+	products.ValidateOffers(storyParams, 0)
+	products.ValidateAffiliateRate(storyParams)
+	products.ValidatePlans(storyParams, 0)
 
 	// Set a few params to known good values
 	storyParams["points"] = "1"
@@ -477,6 +483,7 @@ func CreateSubscriptionPlan(productId int64, amount int64, currency string) (str
 	}
 	type Phases struct {
 		Cadence             string              `json:"cadence"`
+		Periods             int64               `json:"periods,omitempty"`
 		RecurringPriceMoney RecurringPriceMoney `json:"recurring_price_money"`
 	}
 	type SubscriptionPlanData struct {
@@ -503,22 +510,37 @@ func CreateSubscriptionPlan(productId int64, amount int64, currency string) (str
 		// Handle error
 	}
 
+	phases := []Phases{
+		Phases{
+			Cadence: "MONTHLY",
+			RecurringPriceMoney: RecurringPriceMoney{
+				Amount:   amount,
+				Currency: currency,
+			},
+		},
+	}
+
+	// The free trial is a first phase of a day for each day of the trial at no charge
+	if product.Trial() {
+		trial := Phases{
+			Cadence: "DAILY",
+			Periods: product.TrialDays,
+			RecurringPriceMoney: RecurringPriceMoney{
+				Amount:   0,
+				Currency: currency,
+			},
+		}
+		phases = append([]Phases{trial}, phases...)
+	}
+
 	data := Payload{
 		IdempotencyKey: u.String(),
 		Object: Object{
 			ID:   fmt.Sprintf("#product%d", productId),
 			Type: "SUBSCRIPTION_PLAN",
 			SubscriptionPlanData: SubscriptionPlanData{
-				Name: fmt.Sprintf("Subscription for %s", product.Name),
-				Phases: []Phases{
-					Phases{
-						Cadence: "MONTHLY",
-						RecurringPriceMoney: RecurringPriceMoney{
-							Amount:   amount,
-							Currency: currency,
-						},
-					},
-				},
+				Name:   fmt.Sprintf("Subscription for %s", product.Name),
+				Phases: phases,
 			},
 		},
 	}
@@ -1,15 +1,12 @@
 package storyactions
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
-	"github.com/razorpay/razorpay-go"
 
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
@@ -19,11 +16,10 @@ import (
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/status"
 	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
 
 	"github.com/kennygrant/sanitize"
-
-	"github.com/stripe/stripe-go/v72"
-	"github.com/stripe/stripe-go/v72/price"
 )
 
 // HandleShow displays a single story.
@@ -100,333 +96,108 @@ func HandleShow(w http.ResponseWriter, r *http.Request) error {
 	view.AddKey("name", config.Get("name"))
 	view.AddKey("year", time.Now().Year())
 
-	// Set subscribe button if price is set for Payment Gateways
-	if len(story.SquarePrice) != 0 || len(story.StripePrice) != 0 || len(story.PaypalPrice) != 0 || len(story.RazorpayPrice) != 0 {
-
-		// Get the country from IP
-		clientCountry := r.Header.Get("CF-IPCountry")
-		if !config.Production() {
-			// There will be no CF request header in the development/test
-			clientCountry = config.Get("subscription_client_country")
-		}
-
-		log.Info(log.V{"Subscription, Client Country": clientCountry})
-
-		// Find which price has the clientCountry
-
-		var pg string
-		if story.StripePrice != nil && story.StripePrice[clientCountry] != "" {
-			pg = "stripe"
-			log.Info(log.V{"msg": "Show, Using Stripe Price as client country was found"})
-		} else if story.SquarePrice != nil && story.SquarePrice[clientCountry] != nil && story.SquarePrice[clientCountry]["amount"] != nil {
-			pg = "square"
-			log.Info(log.V{"msg": "Show, Using Square Price as client country was found"})
-		} else if story.PaypalPrice != nil && story.PaypalPrice[clientCountry] != nil && (story.PaypalPrice[clientCountry]["amount"] != nil || story.PaypalPrice[clientCountry]["plan_id"] != nil) {
-			pg = "paypal"
-			log.Info(log.V{"msg": "Show, Using PayPal Price as client country was found"})
-		} else if story.RazorpayPrice != nil && story.RazorpayPrice[clientCountry] != nil && (story.RazorpayPrice[clientCountry]["amount"] != nil || story.RazorpayPrice[clientCountry]["plan_id"] != nil) {
-			pg = "razorpay"
-			log.Info(log.V{"msg": "Show, Using Razorpay Price as client country was found"})
-		} else if story.StripePrice != nil && story.StripePrice["DF"] != "" {
-			pg = "stripe"
-			clientCountry = "DF"
-			log.Info(log.V{"msg": "Show, Using Stripe Price as default country was found"})
-		} else if story.SquarePrice != nil && story.SquarePrice["DF"] != nil && story.SquarePrice["DF"]["amount"] != nil {
-			pg = "square"
-			clientCountry = "DF"
-			log.Info(log.V{"msg": "Show, Using Square Price as default country was found"})
-
-		} else if story.PaypalPrice != nil && story.PaypalPrice["DF"] != nil && (story.PaypalPrice["DF"]["amount"] != nil || story.PaypalPrice["DF"]["plan_id"] != nil) {
-			pg = "paypal"
-			clientCountry = "DF"
-			log.Info(log.V{"msg": "Show, Using PayPal Price as default country was found"})
-
-		} else if story.RazorpayPrice != nil && story.RazorpayPrice["DF"] != nil && (story.RazorpayPrice["DF"]["amount"] != nil || story.RazorpayPrice["DF"]["plan_id"] != nil) {
-			pg = "razorpay"
-			clientCountry = "DF"
-			log.Info(log.V{"msg": "Show, Using Razorpay Price as default country was found"})
-		} else {
-			// No payment gateway configured for this country
-			log.Error(log.V{"Show, No payment gateway configured for country": clientCountry})
-			view.Template("products/views/show.html.got")
-			return view.Render()
-		}
-
-		switch pg {
-		case "stripe":
-			// Code for Stripe
-			priceId := story.StripePrice[clientCountry]
-
-			if priceId == "" {
-				return errors.New("Invalid price details for client country: " + clientCountry)
-			}
-
-			log.Info(log.V{"Price ID: ": priceId})
-
-			stripe.Key = config.Get("stripe_secret")
-
-			p, err := price.Get(priceId, nil)
-
-			if err == nil {
+	// A bundle lists the products included in it
+	bundled, err := products.FindBundle(story)
+	if err != nil {
+		log.Error(log.V{"Show, error finding products of bundle": err})
+	}
+	view.AddKey("bundled", bundled)
 
-				log.Info(log.V{"Currency:": p.Currency})
+	// Get the country from IP
+	clientCountry := r.Header.Get("CF-IPCountry")
+	if !config.Production() {
+		// There will be no CF request header in the development/test
+		clientCountry = config.Get("subscription_client_country")
+	}
 
-				view.AddKey("priceId", priceId)
+	log.Info(log.V{"Subscription, Client Country": clientCountry})
 
-				if p.Type == "recurring" {
-					view.AddKey("price", strconv.FormatInt(p.UnitAmount/100, 10)+" "+string(p.Currency)+"/"+string(p.Recurring.Interval))
-				} else if p.Type == "one_time" {
-					view.AddKey("price", strconv.FormatInt(p.UnitAmount/100, 10)+" "+string(p.Currency)+"/"+"One Time")
-				}
-			}
-			view.AddKey("stripe", config.GetBool("stripe"))
-		case "square":
-			// Code for Square
-			amount := story.SquarePrice[clientCountry]["amount"]
-			currency := story.SquarePrice[clientCountry]["currency"]
-
-			if amount != nil && currency != nil {
-				if story.Schedule == "onetime" {
-					view.AddKey("price", strconv.FormatFloat(amount.(float64)/1000, 'g', 5, 64)+" "+currency.(string)+"/"+"One Time")
-					view.AddKey("type", "onetime")
-				} else if story.Schedule == "monthly" || story.Schedule == "yearly" {
-					scheduleLabel := "Monthly"
-					if story.Schedule == "yearly" {
-						scheduleLabel = "Year"
-					}
-					view.AddKey("price", strconv.FormatFloat(amount.(float64)/1000, 'g', 5, 64)+" "+currency.(string)+"/"+scheduleLabel)
-					view.AddKey("type", "subscription")
-				}
-			} else {
-				return errors.New("Invalid price details for client country: " + clientCountry)
+	// Set subscribe button if a payment gateway has a price for the client country or a default price
+	gateway, country := subscriptions.GatewayForProduct(story, clientCountry)
+	if gateway == nil {
+		log.Info(log.V{"Show, No payment gateway configured for country": clientCountry})
+		view.AddKey("showSubscribe", false)
+		return view.Render()
+	}
 
-			}
+	checkout, err := gateway.Checkout(story, country, redirectUri, customId)
+	if err != nil {
+		log.Error(log.V{"Show, Error creating checkout": err, "pg": gateway.Name(), "country": country})
+		return server.InternalError(err)
+	}
 
-			view.AddKey("amount", amount)
-			view.AddKey("currency", currency)
-			view.AddKey("square", config.GetBool("square"))
-		case "paypal":
-			// Code for PayPal
-			amount := story.PaypalPrice[clientCountry]["amount"]
-			currency := story.PaypalPrice[clientCountry]["currency"]
-			planId := story.PaypalPrice[clientCountry]["plan_id"]
-
-			if amount != nil && currency != nil {
-				if story.Schedule == "onetime" {
-					view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+"One Time")
-					view.AddKey("type", "onetime")
-					view.AddKey("paypal_payment_link", "/subscriptions/paypal?"+fmt.Sprintf("type=%s&product_id=%d", "onetime", story.ID))
-				} else if story.Schedule == "monthly" || story.Schedule == "yearly" {
-					scheduleLabel := "Monthly"
-					if story.Schedule == "yearly" {
-						scheduleLabel = "Year"
-					}
-					view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+scheduleLabel)
-					view.AddKey("type", "subscription")
-					view.AddKey("paypal_payment_link", "/subscriptions/paypal?"+fmt.Sprintf("type=%s&product_id=%d&plan_id=%s&redirect_uri=%s&custom_id=%s", "subscription", story.ID, planId.(string), redirectUri, customId))
-				}
-			} else {
-				return errors.New("Invalid price details for client country: " + clientCountry)
-			}
+	// Buyers of pay what you want products choose the amount, the price is the least they can pay
+	if story.PayWhatYouWant() {
+		view.AddKey("payWhatYouWant", true)
+		view.AddKey("minimumPrice", checkout.MinimumPrice())
 
-			view.AddKey("amount", amount)
-			view.AddKey("currency", currency)
-			view.AddKey("paypal", config.GetBool("paypal"))
-		case "razorpay":
-			// Code for Razorpay
-			amount := story.RazorpayPrice[clientCountry]["amount"]
-			currency := story.RazorpayPrice[clientCountry]["currency"]
-			planId := story.RazorpayPrice[clientCountry]["plan_id"]
-			if (amount != nil && currency != nil) || planId != nil {
-				if story.Schedule == "onetime" {
-					view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+"One Time")
-					view.AddKey("type", "onetime")
-					view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d&redirect_uri=%s&custom_id=%s", "onetime", story.ID, redirectUri, customId))
-					view.AddKey("amount", amount)
-					view.AddKey("currency", currency)
-				} else if story.Schedule == "monthly" || story.Schedule == "yearly" {
-					// Create a subscription using the plan id
-
-					razorpayClient := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
-
-					// Set total_count based on schedule: 120 for monthly (10 years), 30 for yearly (30 years)
-					// Razorpay UPI payment method requires expire_at to be max 30 years
-					totalCount := 120
-					if story.Schedule == "yearly" {
-						totalCount = 30
-					}
-
-					data := map[string]interface{}{
-						"plan_id":     planId,
-						"total_count": totalCount,
-					}
-
-					subscription, err := razorpayClient.Subscription.Create(data, nil)
-
-					if err != nil {
-						log.Error(log.V{"Show product, Error creating Razorpay subscription": err})
-						return server.InternalError(err)
-					}
-
-					subscriptionId := subscription["id"].(string)
-
-					if subscriptionId != "" {
-						view.AddKey("type", "subscription")
-						view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d&subscription_id=%s&redirect_uri=%s&custom_id=%s", "subscription", story.ID, subscriptionId, redirectUri, customId))
-						razorpaySubscription, err := razorpayClient.Subscription.Fetch(subscriptionId, nil, nil)
-
-						if err != nil {
-							return errors.New("Error fetching Razorpay subscription: " + err.Error())
-						}
-
-						razorpayPlanId := razorpaySubscription["plan_id"]
-
-						razorpayPlan, err := razorpayClient.Plan.Fetch(razorpayPlanId.(string), nil, nil)
-
-						if err == nil {
-							razorpayItem := razorpayPlan["item"].(map[string]interface{})
-
-							razorpayAmount := razorpayItem["amount"]
-
-							razorpayCurrency := razorpayItem["currency"]
-
-							scheduleLabel := "Monthly"
-							if story.Schedule == "yearly" {
-								scheduleLabel = "Year"
-							}
-							view.AddKey("price", strconv.FormatFloat(razorpayAmount.(float64)/100, 'g', 5, 64)+" "+razorpayCurrency.(string)+"/"+scheduleLabel)
-						} else {
-							log.Error(log.V{"Product show, Error fetching razorpay amount": err})
-						}
-
-					}
-				}
-				view.AddKey("razorpay", config.GetBool("razorpay"))
-			} else {
-				return errors.New("Invalid price details for client country: " + clientCountry)
+		payCheckout, err := checkout.PayWhatYouWant(story, params.Get("pay"))
+		if err != nil {
+			view.AddKey("payError", err.Error())
+			payCheckout, err = checkout.PayWhatYouWant(story, "")
+			if err != nil {
+				log.Error(log.V{"Show, Error with pay what you want price": err, "pg": gateway.Name(), "country": country})
+				return server.InternalError(err)
 			}
-
-		default:
-			log.Error(log.V{"Show, Invalid payment gateway selected": pg, "country": clientCountry})
-			return errors.New("invalid payment gateway: " + pg + " for country: " + clientCountry)
 		}
+		checkout = payCheckout
+		view.AddKey("pay", checkout.PayAmount())
+	}
 
-		// Check which payment gateway has the price for this country and use it
-		/* 		if story.StripePrice != nil && (story.StripePrice[clientCountry] != "" || story.StripePrice["DF"] != "") {
-
-		   		} else if story.SquarePrice != nil && (story.SquarePrice[clientCountry]["amount"] != nil || story.SquarePrice["DF"]["amount"] != nil) {
-
-		   		} else if story.PaypalPrice != nil && ((story.PaypalPrice[clientCountry]["amount"] != nil || story.PaypalPrice[clientCountry]["plan_id"] != nil) || (story.PaypalPrice["DF"]["amount"] != nil || story.PaypalPrice["DF"]["plan_id"] != nil)) {
-
-		   		} else if story.RazorpayPrice != nil && ((story.RazorpayPrice[clientCountry]["amount"] != nil || story.RazorpayPrice[clientCountry]["plan_id"] != nil) || (story.RazorpayPrice["DF"]["amount"] != nil || story.RazorpayPrice["DF"]["plan_id"] != nil)) {
-		   			if story.Schedule == "onetime" {
-		   				amount := story.RazorpayPrice[clientCountry]["amount"]
-		   				currency := story.RazorpayPrice[clientCountry]["currency"]
-		   				if amount != nil && currency != nil {
-
-		   					view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+"One Time")
-		   					view.AddKey("type", "onetime")
-		   					view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d", "onetime", story.ID))
-
-		   				} else {
-		   					if len(story.RazorpayPrice) > 0 {
-		   						clientCountry := "DF"
-		   						amount := story.RazorpayPrice[clientCountry]["amount"]
-		   						currency := story.RazorpayPrice[clientCountry]["currency"]
-		   						if amount == nil || currency == nil {
-		   							return errors.New("Invalid price details for client country: " + clientCountry)
-		   						}
-		   						view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+"One Time")
-		   						view.AddKey("type", "onetime")
-		   						view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d", "onetime", story.ID))
-		   					}
-		   				}
-		   				view.AddKey("amount", amount)
-		   				view.AddKey("currency", currency)
-		   			} else if story.Schedule == "monthly" {
-		   				planId := story.RazorpayPrice[clientCountry]["plan_id"]
-		   				// Create a subscription using the plan id
-
-		   				razorpayClient := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
-
-		   				data := map[string]interface{}{
-		   					"plan_id":     planId,
-		   					"total_count": 120,
-		   				}
-
-		   				subscription, err := razorpayClient.Subscription.Create(data, nil)
-
-		   				if err != nil {
-		   					log.Error(log.V{"Show product, Error creating Razorpay subscription": err})
-		   					return server.InternalError(err)
-		   				}
-
-		   				subscriptionId := subscription["id"].(string)
-
-		   				if subscriptionId != "" {
-		   					// view.AddKey("price", strconv.FormatFloat(amount.(float64), 'g', 5, 64)+" "+currency.(string)+"/"+"Monthly")
-		   					view.AddKey("type", "subscription")
-		   					view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d&subscription_id=%s", "subscription", story.ID, subscriptionId))
-		   				} else {
-		   					if len(story.RazorpayPrice) > 0 {
-		   						clientCountry := "DF"
-		   						planId := story.RazorpayPrice[clientCountry]["plan_id"]
-		   						// Create a subscription using the plan id
-
-		   						razorpayClient := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
-
-		   						data := map[string]interface{}{
-		   							"plan_id":     planId,
-		   							"total_count": 1,
-		   						}
-
-		   						subscription, err := razorpayClient.Subscription.Create(data, nil)
-
-		   						if err != nil {
-		   							log.Error(log.V{"Show product, Error creating Razorpay subscription": err})
-		   							return server.InternalError(err)
-		   						}
-
-		   						subscriptionId := subscription["id"].(string)
-		   						if subscriptionId == "" {
-		   							return errors.New("Invalid subscription ID for client country: " + clientCountry)
-		   						}
-
-		   						view.AddKey("type", "subscription")
-		   						view.AddKey("razorpay_payment_link", "/subscriptions/razorpay?"+fmt.Sprintf("type=%s&product_id=%d&subscription_id=%s", "subscription", story.ID, subscriptionId))
-		   					}
-		   				}
-
-		   				razorpaySubscription, err := razorpayClient.Subscription.Fetch(subscriptionId, nil, nil)
-
-		   				if err != nil {
-		   					return errors.New("Error fetching Razorpay subscription: " + err.Error())
-		   				}
-
-		   				razorpayPlanId := razorpaySubscription["plan_id"]
-
-		   				razorpayPlan, err := razorpayClient.Plan.Fetch(razorpayPlanId.(string), nil, nil)
-
-		   				if err == nil {
-		   					razorpayItem := razorpayPlan["item"].(map[string]interface{})
-
-		   					razorpayAmount := razorpayItem["amount"]
+	view.AddKey("price", checkout.Price)
+	view.AddKey("type", checkout.Type)
+	view.AddKey("priceId", checkout.PriceID)
+	view.AddKey("amount", checkout.Amount)
+	view.AddKey("currency", checkout.Currency)
+	view.AddKey(gateway.Name()+"_payment_link", checkout.Link)
+	view.AddKey(gateway.Name(), gateway.Enabled())
+	view.AddKey("showSubscribe", true)
+
+	// One time products can be bought together with others from the cart
+	view.AddKey("cartAllowed", subscriptions.CartProduct(story))
+
+	// The order bump is offered as an add-on the buyer ticks at the checkout of the product
+	bump, err := subscriptions.BumpProduct(story)
+	if err == nil {
+		cart, err := subscriptions.PriceCart([]*products.Story{story, bump}, clientCountry)
+		if err == nil {
+			view.AddKey("bump", bump)
+			view.AddKey("bumpPrice", cart.Lines[1].Price())
+		}
+	}
 
-		   					razorpayCurrency := razorpayItem["currency"]
+	// Sign the price so the checkout can refuse a price changed in the browser
+	quote, err := subscriptions.NewQuote(story, gateway.Name(), country, checkout.Pay)
+	if err != nil {
+		log.Error(log.V{"Show, Error signing price quote": err, "pg": gateway.Name(), "country": country})
+	}
+	view.AddKey("quote", quote)
+
+	// Check the discount code entered by the customer, it is applied again by the gateway's checkout
+	view.AddKey("redirectUri", redirectUri)
+	view.AddKey("customId", customId)
+	if code := params.Get("coupon"); code != "" {
+		coupon, err := subscriptions.FindCoupon(code, story, gateway.Name())
+		if currency, ok := checkout.Currency.(string); ok && err == nil {
+			_, err = coupon.Discount(0, currency)
+		}
+		if err != nil {
+			view.AddKey("couponError", err.Error())
+		} else {
+			view.AddKey("coupon", coupon.Code)
+			view.AddKey("couponLabel", coupon.Label())
+		}
+	}
 
-		   					view.AddKey("price", strconv.FormatFloat(razorpayAmount.(float64)/100, 'g', 5, 64)+" "+razorpayCurrency.(string)+"/"+"Monthly")
-		   				} else {
-		   					log.Error(log.V{"Product show, Error fetching razorpay amount": err})
-		   				}
-		   			}
-		   			view.AddKey("razorpay", config.GetBool("razorpay"))
-
-		   		} */
-
-		view.AddKey("showSubscribe", true)
-
-	} else {
-		view.AddKey("showSubscribe", false)
+	// Show the tax of the buyer's country, the price of a subscription plan on gateways other than Stripe is fixed so its tax is included
+	inclusive := taxes.Inclusive() || (story.Schedule != "onetime" && gateway.Name() != "stripe")
+	tax := taxes.Calculate(0, clientCountry, params.Get("tax_id"), inclusive)
+	view.AddKey("taxLabel", tax.Label())
+	view.AddKey("taxIdAllowed", tax.ReverseChargeAllowed)
+	if tax.ReverseCharge {
+		view.AddKey("taxId", tax.TaxID)
+	} else if params.Get("tax_id") != "" && tax.ReverseChargeAllowed {
+		view.AddKey("taxIdError", "it isn't a valid "+tax.Name+" ID for "+tax.Country)
 	}
 
 	return view.Render()
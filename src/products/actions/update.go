@@ -258,6 +258,12 @@ func HandleUpdate(w http.ResponseWriter, r *http.Request) error {
 		accepted = products.AllowedParamsAdmin()
 	}
 	storyParams := story.ValidateParams(params.Map(), accepted)
+	products.ValidatePriceMode(storyParams)
+	products.ValidateTrialDays(storyParams)
+	products.ValidateBundle(storyParams, story.ID)
+	products.ValidateOffers(storyParams, story.ID)
+	products.ValidateAffiliateRate(storyParams)
+	products.ValidatePlans(storyParams, story.ID)
 
 	// Featured Image
 	for _, fh := range params.Files {
@@ -389,7 +395,11 @@ func HandleUpdate(w http.ResponseWriter, r *http.Request) error {
 
 		err = json.Unmarshal([]byte(storyParams["square_price"]), &squarePrice)
 
-		if err == nil && !reflect.DeepEqual(story.SquarePrice, squarePrice) {
+		// A new plan is created for a new price or trial, the plan has the trial as its first phase
+		_, trialUpdated := storyParams["trial_days"]
+		trialChanged := trialUpdated && storyParams["trial_days"] != strconv.FormatInt(story.TrialDays, 10)
+
+		if err == nil && (!reflect.DeepEqual(story.SquarePrice, squarePrice) || trialChanged) {
 			if len(squarePrice) != 0 {
 				for clientCountry, data := range squarePrice {
 					amount := data["amount"]
@@ -1,6 +1,8 @@
 package products
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/abishekmuthian/open-payment-host/src/lib/query"
@@ -18,6 +20,14 @@ const (
 	Order = "name asc, id desc"
 	// SubscriberColumnName holds the column name of the subscribers
 	SubscriberColumnName = "subscribers"
+
+	// PriceModeFixed is the price mode of products sold at their price
+	PriceModeFixed = "fixed"
+	// PriceModePayWhatYouWant is the price mode of products where the buyer pays what they want above the price
+	PriceModePayWhatYouWant = "pwyw"
+
+	// maxTrialDays is the longest free trial of a subscription
+	maxTrialDays = 730
 )
 
 // AllowedParams returns the cols editable by everyone
@@ -27,7 +37,146 @@ func AllowedParams() []string {
 
 // AllowedParamsAdmin returns the cols editable by admins
 func AllowedParamsAdmin() []string {
-	return []string{"status", "comment_count", "name", "points", "rank", "summary", "description", "url", "s3_bucket", "s3_key", "user_id", "user_name", "mailchimp_audience_id", "stripe_price", "square_price", "schedule", "square_subscription_plan_Id", "paypal_price", "razorpay_price", "total_subscribers", "total_onetime_payments", "webhook_url", "webhook_secret"}
+	return []string{"status", "comment_count", "name", "points", "rank", "summary", "description", "url", "s3_bucket", "s3_key", "user_id", "user_name", "mailchimp_audience_id", "stripe_price", "square_price", "schedule", "square_subscription_plan_Id", "paypal_price", "razorpay_price", "total_subscribers", "total_onetime_payments", "webhook_url", "webhook_secret", "license_seats", "price_mode", "suggested_price", "trial_days", "bundle_product_ids", "bump_product_id", "upsell_product_id", "affiliate_rate", "plan_product_ids"}
+}
+
+// ValidatePriceMode sets the price mode in the params to fixed unless pay what you want was chosen for
+// a one time payment, and removes a suggested price which isn't a positive amount.
+func ValidatePriceMode(params map[string]string) {
+	if _, ok := params["price_mode"]; ok {
+		if params["price_mode"] != PriceModePayWhatYouWant || params["schedule"] != "onetime" {
+			params["price_mode"] = PriceModeFixed
+		}
+	}
+
+	if _, ok := params["suggested_price"]; ok {
+		suggested, err := strconv.ParseFloat(params["suggested_price"], 64)
+		if err != nil || suggested < 0 {
+			params["suggested_price"] = "0"
+		}
+	}
+}
+
+// ValidateTrialDays removes a trial from the params unless it is for a subscription,
+// the trial is limited to maxTrialDays which is the longest trial Stripe allows.
+func ValidateTrialDays(params map[string]string) {
+	if _, ok := params["trial_days"]; !ok {
+		return
+	}
+
+	days, err := strconv.ParseInt(params["trial_days"], 10, 64)
+	if err != nil || days < 0 || params["schedule"] == "onetime" {
+		days = 0
+	}
+	if days > maxTrialDays {
+		days = maxTrialDays
+	}
+	params["trial_days"] = strconv.FormatInt(days, 10)
+}
+
+// ValidateAffiliateRate sets the commission rate in the params to a percentage from 0 to 100, 0 for products which earn affiliates no commission.
+func ValidateAffiliateRate(params map[string]string) {
+	if _, ok := params["affiliate_rate"]; !ok {
+		return
+	}
+
+	rate, err := strconv.ParseFloat(params["affiliate_rate"], 64)
+	if err != nil || rate < 0 {
+		rate = 0
+	}
+	if rate > 100 {
+		rate = 100
+	}
+	params["affiliate_rate"] = strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+// ValidateBundle keeps the products of a bundle in the params which exist and are one time products other than bundles,
+// only a one time payment can be a bundle and the product with the id can't be included in itself.
+func ValidateBundle(params map[string]string, id int64) {
+	value, ok := params["bundle_product_ids"]
+	if !ok {
+		return
+	}
+
+	var productIDs []string
+	included := make(map[int64]bool)
+	if params["schedule"] == "onetime" {
+		for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			productID, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || productID == id || included[productID] {
+				continue
+			}
+
+			product, err := Find(productID)
+			if err != nil || product.Schedule != "onetime" || product.Bundle() {
+				continue
+			}
+
+			included[productID] = true
+			productIDs = append(productIDs, strconv.FormatInt(productID, 10))
+		}
+	}
+
+	params["bundle_product_ids"] = strings.Join(productIDs, ",")
+}
+
+// ValidateOffers keeps the order bump and upsell in the params when they are other one time products with a fixed price,
+// only one time products can have an order bump as it is paid in the same checkout.
+func ValidateOffers(params map[string]string, id int64) {
+	for _, key := range []string{"bump_product_id", "upsell_product_id"} {
+		value, ok := params[key]
+		if !ok {
+			continue
+		}
+
+		productID, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && productID > 0 && productID != id {
+			product, err := Find(productID)
+			if err != nil || product.Schedule != "onetime" || product.PayWhatYouWant() {
+				productID = 0
+			}
+		} else {
+			productID = 0
+		}
+
+		params[key] = strconv.FormatInt(productID, 10)
+	}
+
+	if params["schedule"] != "onetime" || params["price_mode"] == PriceModePayWhatYouWant {
+		if _, ok := params["bump_product_id"]; ok {
+			params["bump_product_id"] = "0"
+		}
+	}
+}
+
+// ValidatePlans keeps the plans in the params which exist and are subscriptions other than the product with the id,
+// only subscribers can change their plan.
+func ValidatePlans(params map[string]string, id int64) {
+	value, ok := params["plan_product_ids"]
+	if !ok {
+		return
+	}
+
+	var productIDs []string
+	included := make(map[int64]bool)
+	if params["schedule"] != "onetime" {
+		for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			productID, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || productID == id || included[productID] {
+				continue
+			}
+
+			product, err := Find(productID)
+			if err != nil || product.Schedule == "onetime" {
+				continue
+			}
+
+			included[productID] = true
+			productIDs = append(productIDs, strconv.FormatInt(productID, 10))
+		}
+	}
+
+	params["plan_product_ids"] = strings.Join(productIDs, ",")
 }
 
 // NewWithColumns creates a new story instance and fills it with data from the database cols provided.
@@ -70,6 +219,15 @@ func NewWithColumns(cols map[string]interface{}) *Story {
 	story.RazorpayPrice = resource.ValidateNestedMap(cols["razorpay_price"])
 	story.WebhookURL = resource.ValidateString(cols["webhook_url"])
 	story.WebhookSecret = resource.ValidateString(cols["webhook_secret"])
+	story.LicenseSeats = resource.ValidateInt(cols["license_seats"])
+	story.PriceMode = resource.ValidateString(cols["price_mode"])
+	story.SuggestedPrice = resource.ValidateFloat(cols["suggested_price"])
+	story.TrialDays = resource.ValidateInt(cols["trial_days"])
+	story.BundleProductIDs = validateProductIDs(cols["bundle_product_ids"])
+	story.BumpProductID = resource.ValidateInt(cols["bump_product_id"])
+	story.UpsellProductID = resource.ValidateInt(cols["upsell_product_id"])
+	story.AffiliateRate = resource.ValidateFloat(cols["affiliate_rate"])
+	story.PlanProductIDs = validateProductIDs(cols["plan_product_ids"])
 
 	//Flair
 	// FIXME - Create and join the flair column
@@ -87,6 +245,17 @@ func NewWithColumns(cols map[string]interface{}) *Story {
 	return story
 }
 
+// validateProductIDs returns the product ids stored in the column as a comma separated list
+func validateProductIDs(param interface{}) []int64 {
+	var ids []int64
+	for _, id := range resource.ValidateInt64Array(param) {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // New creates and initialises a new story instance.
 func New() *Story {
 	story := &Story{}
@@ -110,13 +279,63 @@ func FindFirst(format string, args ...interface{}) (*Story, error) {
 
 // Find fetches a single story record from the database by id.
 func Find(id int64) (*Story, error) {
-	result, err := Query().Where("id=?", id).FirstResult()
+	return FindTx(nil, id)
+}
+
+// FindTx fetches a single story record by id in the transaction.
+func FindTx(tx *query.Tx, id int64) (*Story, error) {
+	result, err := QueryTx(tx).Where("id=?", id).FirstResult()
 	if err != nil {
 		return nil, err
 	}
 	return NewWithColumns(result), nil
 }
 
+// FindBundle fetches the products included in the bundle, a product which has since become a bundle itself is left out
+func FindBundle(bundle *Story) ([]*Story, error) {
+	return FindBundleTx(nil, bundle)
+}
+
+// FindBundleTx fetches the products included in the bundle in the transaction
+func FindBundleTx(tx *query.Tx, bundle *Story) ([]*Story, error) {
+	if !bundle.Bundle() {
+		return nil, nil
+	}
+
+	stories, err := FindAll(QueryTx(tx).WhereIn("id", bundle.BundleProductIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	var bundled []*Story
+	for _, story := range stories {
+		if !story.Bundle() {
+			bundled = append(bundled, story)
+		}
+	}
+	return bundled, nil
+}
+
+// FindPlans fetches the subscriptions the subscribers of the product can change their plan to
+func FindPlans(product *Story) ([]*Story, error) {
+	if !product.Plans() {
+		return nil, nil
+	}
+
+	stories, err := FindAll(Query().WhereIn("id", product.PlanProductIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*Story
+	for _, story := range stories {
+		if story.ID != product.ID && story.Schedule != "onetime" {
+			plans = append(plans, story)
+		}
+	}
+	return plans, nil
+}
+
 // FindPaypalPlanId fetches a single story record from the database by paypal plan id
 func FindPaypalPlanId(planId string) (*Story, error) {
 	q := Query().Limit(1)
@@ -139,6 +358,22 @@ func FindSquarePlanId(planId string) (*Story, error) {
 	return result[0], nil
 }
 
+// FindPlanId fetches a single story record from the database by the plan id of any payment gateway
+func FindPlanId(planId string) (*Story, error) {
+	return FindPlanIdTx(nil, planId)
+}
+
+// FindPlanIdTx fetches a single story record by the plan id of any payment gateway in the transaction
+func FindPlanIdTx(tx *query.Tx, planId string) (*Story, error) {
+	q := QueryTx(tx).Limit(1)
+	q.Where(`paypal_price LIKE ? OR razorpay_price LIKE ? OR square_subscription_plan_Id LIKE ?`, "%"+planId+"%", "%"+planId+"%", "%"+planId+"%")
+	result, err := FindAll(q)
+	if result == nil || err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
+
 // FindAll fetches all story records matching this query from the database.
 func FindAll(q *query.Query) ([]*Story, error) {
 
@@ -165,7 +400,12 @@ func Popular() *query.Query {
 
 // Query returns a new query for products with a default order.
 func Query() *query.Query {
-	return query.New(TableName, KeyName).Order(Order)
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for products with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
 }
 
 // Where returns a new query for products with the format and arguments supplied.
@@ -73,6 +73,49 @@ type Story struct {
 	//API
 	WebhookURL    string
 	WebhookSecret string
+
+	// License
+	LicenseSeats int64
+
+	// PriceMode is fixed or pay what you want, where the price is the minimum the buyer can pay
+	PriceMode      string
+	SuggestedPrice float64
+
+	// TrialDays is the length of the free trial of a subscription before its first charge
+	TrialDays int64
+
+	// BundleProductIDs are the products included in a bundle, each is delivered as if it had been bought on its own
+	BundleProductIDs []int64
+
+	// BumpProductID is the add-on offered at the checkout of a one time product, UpsellProductID is offered once it is bought
+	BumpProductID   int64
+	UpsellProductID int64
+
+	// AffiliateRate is the percentage of the payment before tax earned as commission by the affiliate who referred the buyer
+	AffiliateRate float64
+
+	// PlanProductIDs are the subscriptions the subscribers of this product can change their plan to e.g. yearly or a higher tier
+	PlanProductIDs []int64
+}
+
+// PayWhatYouWant reports whether the buyer chooses the amount they pay, only one time payments can be pay what you want
+func (s *Story) PayWhatYouWant() bool {
+	return s.PriceMode == PriceModePayWhatYouWant && s.Schedule == "onetime"
+}
+
+// Trial reports whether subscribers get a free trial before they are charged, only subscriptions can have a trial
+func (s *Story) Trial() bool {
+	return s.TrialDays > 0 && s.Schedule != "onetime"
+}
+
+// Bundle reports whether the product is a bundle of other products, only one time payments can be bundles
+func (s *Story) Bundle() bool {
+	return len(s.BundleProductIDs) > 0 && s.Schedule == "onetime"
+}
+
+// Plans reports whether the subscribers of the product can change their plan to other products, only subscriptions have plans
+func (s *Story) Plans() bool {
+	return len(s.PlanProductIDs) > 0 && s.Schedule != "onetime"
 }
 
 // Domain returns the domain of the story URL
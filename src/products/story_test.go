@@ -138,3 +138,34 @@ func TestAllowedParams(t *testing.T) {
 		t.Fatalf("projects: no allowed params")
 	}
 }
+
+// Test only one time products with included products are bundles
+func TestBundle(t *testing.T) {
+	story := NewWithColumns(map[string]interface{}{"schedule": "onetime", "bundle_product_ids": "2,0,5"})
+	if !story.Bundle() || len(story.BundleProductIDs) != 2 {
+		t.Fatalf("projects: expected bundle of 2 products got:%v", story.BundleProductIDs)
+	}
+
+	story = NewWithColumns(map[string]interface{}{"schedule": "onetime", "bundle_product_ids": ""})
+	if story.Bundle() {
+		t.Fatalf("projects: expected product without included products not to be a bundle")
+	}
+
+	story = NewWithColumns(map[string]interface{}{"schedule": "monthly", "bundle_product_ids": "2"})
+	if story.Bundle() {
+		t.Fatalf("projects: expected subscription not to be a bundle")
+	}
+}
+
+// Test only subscriptions with other products to change to have plans
+func TestPlans(t *testing.T) {
+	story := NewWithColumns(map[string]interface{}{"schedule": "monthly", "plan_product_ids": "4,0,7"})
+	if !story.Plans() || len(story.PlanProductIDs) != 2 {
+		t.Fatalf("projects: expected 2 plans got:%v", story.PlanProductIDs)
+	}
+
+	story = NewWithColumns(map[string]interface{}{"schedule": "onetime", "plan_product_ids": "4"})
+	if story.Plans() {
+		t.Fatalf("projects: expected one time product not to have plans")
+	}
+}
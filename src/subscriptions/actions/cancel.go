@@ -5,21 +5,19 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/customers"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/view"
-	"github.com/abishekmuthian/open-payment-host/src/products"
 	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
 )
 
-// HandlePaymentCancel handles the success routine of the payment
-func HandlePaymentCancel(w http.ResponseWriter, r *http.Request) error {
-
-	// Authorise
-	currentUser := session.CurrentUser(w, r)
+// HandlePaymentCancelShow responds to GET /subscriptions/cancel by asking the subscriber to confirm the cancellation,
+// the confirmation is posted to /subscriptions/cancel with the params of the request.
+func HandlePaymentCancelShow(w http.ResponseWriter, r *http.Request) error {
 
 	// Fetch the  params
 	params, err := mux.Params(r)
@@ -27,78 +25,74 @@ func HandlePaymentCancel(w http.ResponseWriter, r *http.Request) error {
 		return server.InternalError(err)
 	}
 
-	// Get the subscription ID from the request
-	subscriptionId := params.Get("subscription_id")
-	log.Info(log.V{"Subscription ID: ": subscriptionId})
+	_, err = findCancelSubscription(w, r, params)
+	if err != nil {
+		return err
+	}
 
-	redirectURI := params.Get("redirect_uri")
-	customId := params.Get("custom_id")
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("subscriptionID", params.Get("subscription_id"))
+	view.AddKey("customID", params.Get("custom_id"))
+	view.AddKey("redirectURI", params.Get("redirect_uri"))
+	view.AddKey("cancelAt", params.Get("cancel_at"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
 
-	// Find the subscription in the database
-	subscription, err := subscriptions.FindSubscription(subscriptionId)
+	view.Template("subscriptions/views/payment_cancel_confirm.html.got")
 
-	if err != nil || subscription == nil {
-		log.Error(log.V{"Error finding subscription": err})
-		return server.InternalError(err)
+	return view.Render()
+}
+
+// HandlePaymentCancel responds to POST /subscriptions/cancel by cancelling the subscription at its gateway
+func HandlePaymentCancel(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
 	}
 
-	// Validate custom_id matches the subscription's UserId
-	// Compare as strings since UserId is now TEXT in database
-	if customId != "" && customId != subscription.UserId {
-		log.Error(log.V{"Invalid custom_id for the subscription - Expected": subscription.UserId, "Got": customId})
-		return server.InternalError(errors.New("Invalid custom_id for the subscription"))
+	// Authorise
+	currentUser := session.CurrentUser(w, r)
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
 	}
 
-	pg := subscription.PaymentGateway
-	log.Info(log.V{"Payment Gateway: ": pg})
-	switch pg {
-	case "paypal":
-		// Handle PayPal subscription cancellation
-		err := subscriptions.CancelPaypalSubscription(subscriptionId)
-		if err != nil {
-			log.Error(log.V{"Error cancelling PayPal subscription": err})
-			return server.InternalError(err)
-		}
-	case "razorpay":
-		// Handle Razorpay subscription cancellation
-		err := subscriptions.CancelRazorpaySubscription(subscriptionId)
-		if err != nil {
-			log.Error(log.V{"Error cancelling Razorpay subscription": err})
-			return server.InternalError(err)
-		}
-
-	default:
-		log.Error(log.V{"Error unknown payment gateway": err})
+	subscription, err := findCancelSubscription(w, r, params)
+	if err != nil {
+		return err
 	}
 
-	product, err := products.Find(subscription.ProductId)
+	redirectURI := params.Get("redirect_uri")
+	// The subscription is cancelled at the end of its billing period or immediately, if its gateway supports the choice
+	cancelAt := params.Get("cancel_at")
+
+	log.Info(log.V{"Payment Gateway: ": subscription.PaymentGateway})
 
+	cancelAt, err = subscriptions.CancelSubscription(subscription, cancelAt)
+	if err == subscriptions.ErrCancelTiming {
+		return server.BadRequestError(err, "Cancel Failed", "This subscription can't be cancelled at this time at its payment gateway.")
+	}
 	if err != nil {
-		log.Error(log.V{"Error finding product": err})
-	} else {
-		if product.WebhookURL != "" && product.WebhookSecret != "" {
-			params := map[string]interface{}{
-				"subscription_id": subscriptionId,
-				"custom_id":       subscription.UserId,
-				"status":          "cancelled",
-				"email":           "",
-			}
-
-			go func() {
-				err := subscriptions.SendWebhook(product.WebhookURL, product.WebhookSecret, params)
-				if err != nil {
-					log.Error(log.V{"Cancel, Error sending webhook to product's URL": err})
-				} else {
-					log.Info(log.V{"msg": "Successfully sent webhook to product's URL"})
-				}
-			}()
-		}
+		log.Error(log.V{"Error cancelling subscription": err, "pg": subscription.PaymentGateway})
+		return server.InternalError(err)
+	}
+
+	// The subscription is updated and the product webhook is sent once the gateway confirms the cancellation
+	if redirectURI != "" {
 		return server.RedirectExternal(w, r, redirectURI)
 	}
 
 	// Render the template
 	view := view.NewRenderer(w, r)
 	view.AddKey("currentUser", currentUser)
+	view.AddKey("cancelAt", cancelAt)
 	// Set the name and year
 	view.AddKey("name", config.Get("name"))
 	view.AddKey("year", time.Now().Year())
@@ -107,3 +101,37 @@ func HandlePaymentCancel(w http.ResponseWriter, r *http.Request) error {
 
 	return view.Render()
 }
+
+// findCancelSubscription returns the subscription of the subscription_id param if the request may cancel it,
+// the request must carry the custom_id the subscription was created with or come from the customer who
+// paid for it signed in to the customer area.
+func findCancelSubscription(w http.ResponseWriter, r *http.Request, params *mux.RequestParams) (*subscriptions.Subscription, error) {
+	// Get the subscription ID from the request
+	subscriptionId := params.Get("subscription_id")
+	log.Info(log.V{"Subscription ID: ": subscriptionId})
+
+	if subscriptionId == "" {
+		return nil, server.NotFoundError(errors.New("subscription_id is required"))
+	}
+
+	// Find the subscription in the database
+	subscription, err := subscriptions.FindSubscription(subscriptionId)
+	if err != nil {
+		log.Error(log.V{"Error finding subscription": err})
+		return nil, server.NotFoundError(err)
+	}
+
+	// Compare as strings since UserId is now TEXT in database
+	customId := params.Get("custom_id")
+	if customId != "" && customId == subscription.UserId {
+		return subscription, nil
+	}
+
+	email := customers.CurrentEmail(w, r)
+	if email != "" && customers.NormaliseEmail(subscription.CustomerEmail) == email {
+		return subscription, nil
+	}
+
+	log.Error(log.V{"Invalid custom_id for the subscription - Expected": subscription.UserId, "Got": customId})
+	return nil, server.NotAuthorizedError(errors.New("Invalid custom_id for the subscription"), "Cancel Failed", "This subscription can't be cancelled from here, sign in to your purchases to cancel it.")
+}
@@ -0,0 +1,92 @@
+package actions
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// reportDateFormat is the format of the from and to dates of the report
+const reportDateFormat = "2006-01-02"
+
+// HandleDunningReport responds to GET /dunning/report by totalling the failed subscription payments from the from date
+// until the end of the to date in UTC by currency with the revenue recovered and lost, the report is downloaded
+// as CSV from /dunning/report.csv. The period is the current month when no dates are given.
+func HandleDunningReport(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view the dunning report"))
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if params.Get("from") != "" {
+		from, err = time.Parse(reportDateFormat, params.Get("from"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The from date should be in the format 2006-01-02.")
+		}
+	}
+	if params.Get("to") != "" {
+		to, err = time.Parse(reportDateFormat, params.Get("to"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The to date should be in the format 2006-01-02.")
+		}
+	}
+
+	// The to date is included in the period
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	report, err := subscriptions.DunningReport(from, end)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=dunning-report-"+from.Format(reportDateFormat)+"-"+to.Format(reportDateFormat)+".csv")
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"currency", "failed", "open", "recovered", "lost", "open_amount", "recovered_amount", "lost_amount", "recovery_rate"})
+		for _, row := range report {
+			record := []string{row.Currency, strconv.FormatInt(row.Failed, 10), strconv.FormatInt(row.Open, 10), strconv.FormatInt(row.Recovered, 10), strconv.FormatInt(row.Lost, 10)}
+			record = append(record, row.Amounts()...)
+			writer.Write(append(record, row.RecoveryRate()))
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("report", report)
+	view.AddKey("from", from.Format(reportDateFormat))
+	view.AddKey("to", to.Format(reportDateFormat))
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Dunning Report")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("subscriptions/views/dunning_report.html.got")
+
+	return view.Render()
+}
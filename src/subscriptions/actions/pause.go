@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// HandlePause responds to POST /products/n/payments/n/pause by pausing the subscription at its gateway until it is resumed,
+// or until the date of the resumes_at param.
+func HandlePause(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	product, transaction, err := findProductSubscription(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	resumesAt, err := subscriptions.ParseResumeDate(params.Get("resumes_at"))
+	if err != nil {
+		return server.BadRequestError(err, "Invalid date", "The resume date should be in the format 2006-01-02.")
+	}
+
+	err = subscriptions.PauseSubscription(transaction, resumesAt)
+	if err != nil {
+		log.Error(log.V{"Pause, error pausing subscription": err, "id": transaction.ID, "pg": transaction.PaymentGateway})
+		return server.InternalError(err, "Pause Failed", "Sorry, the subscription could not be paused, please try again later.")
+	}
+
+	log.Info(log.V{"msg": "Pause requested", "id": transaction.ID, "pg": transaction.PaymentGateway, "resumes_at": params.Get("resumes_at")})
+
+	return server.Redirect(w, r, fmt.Sprintf("/products/%d/payments", product.ID))
+}
+
+// HandleResume responds to POST /products/n/payments/n/resume by resuming the paused subscription at its gateway
+func HandleResume(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	product, transaction, err := findProductSubscription(w, r)
+	if err != nil {
+		return err
+	}
+
+	err = subscriptions.ResumeSubscription(transaction)
+	if err != nil {
+		log.Error(log.V{"Resume, error resuming subscription": err, "id": transaction.ID, "pg": transaction.PaymentGateway})
+		return server.InternalError(err, "Resume Failed", "Sorry, the subscription could not be resumed, please try again later.")
+	}
+
+	log.Info(log.V{"msg": "Resume requested", "id": transaction.ID, "pg": transaction.PaymentGateway})
+
+	return server.Redirect(w, r, fmt.Sprintf("/products/%d/payments", product.ID))
+}
+
+// findProductSubscription returns the product and the subscription of the request for the admin
+func findProductSubscription(w http.ResponseWriter, r *http.Request) (*products.Story, *subscriptions.Subscription, error) {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return nil, nil, server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return nil, nil, server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return nil, nil, server.NotAuthorizedError(errors.New("only admin can pause and resume subscriptions"))
+	}
+
+	transaction, err := subscriptions.FindFirst("id=?", params.GetInt("transaction_id"))
+	if err != nil {
+		return nil, nil, server.NotFoundError(err)
+	}
+
+	if transaction.ProductId != product.ID || transaction.SubscriptionId == "" {
+		return nil, nil, server.NotFoundError(errors.New("subscription does not belong to the product"))
+	}
+
+	return product, transaction, nil
+}
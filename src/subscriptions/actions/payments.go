@@ -0,0 +1,156 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// paymentListLimit is the number of payments shown on a page
+const paymentListLimit = 50
+
+// HandlePaymentIndex responds to GET /products/n/payments by listing the payments and subscriptions of the product
+// along with their refunds, disputes and the history of their states, optionally only those in a state.
+func HandlePaymentIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view payments"))
+	}
+
+	q := subscriptions.Query().Where("item_number=?", product.ID).Limit(paymentListLimit)
+
+	// Filter by the state of the payment or subscription if we have one
+	state := params.Get("state")
+	if state != "" {
+		q.Where("state=?", state)
+	}
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(paymentListLimit * page)
+	}
+
+	transactions, err := subscriptions.FindAll(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	refunds, err := subscriptions.FindTransactionRefunds(transactions)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	states, err := subscriptions.FindTransactionStateChanges(transactions)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	stateCounts, err := subscriptions.CountStates(product.ID)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	var transactionIDs []int64
+	for _, transaction := range transactions {
+		transactionIDs = append(transactionIDs, transaction.ID)
+	}
+	transactionInvoices, err := invoices.FindTransactions(transactionIDs)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("story", product)
+	view.AddKey("transactions", transactions)
+	view.AddKey("refunds", refunds)
+	view.AddKey("invoices", transactionInvoices)
+	view.AddKey("states", states)
+	view.AddKey("state", state)
+	view.AddKey("stateNames", subscriptions.States)
+	view.AddKey("stateCounts", stateCounts)
+	view.AddKey("page", page)
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", fmt.Sprintf("Payments for %s", product.Name))
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("subscriptions/views/payments.html.got")
+
+	return view.Render()
+}
+
+// HandleRefund responds to POST /products/n/payments/n/refund by refunding the payment in full,
+// or in part when an amount is given, through its payment gateway.
+func HandleRefund(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can refund payments"))
+	}
+
+	transaction, err := subscriptions.FindFirst("id=?", params.GetInt("transaction_id"))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if transaction.ProductId != product.ID {
+		return server.NotFoundError(errors.New("payment does not belong to the product"))
+	}
+
+	err = subscriptions.RefundPayment(transaction, params.Get("amount"))
+	if err != nil {
+		log.Error(log.V{"Refund, error refunding payment": err, "id": transaction.ID, "pg": transaction.PaymentGateway})
+		return server.BadRequestError(err, "Refund Failed", err.Error())
+	}
+
+	log.Info(log.V{"msg": "Refund requested", "id": transaction.ID, "pg": transaction.PaymentGateway, "amount": params.Get("amount")})
+
+	return server.Redirect(w, r, fmt.Sprintf("/products/%d/payments", product.ID))
+}
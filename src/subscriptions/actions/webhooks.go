@@ -0,0 +1,127 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// webhookListLimit is the number of deliveries shown on a page
+const webhookListLimit = 50
+
+// HandleWebhookIndex responds to GET /products/n/webhooks by listing the webhook deliveries of the product.
+func HandleWebhookIndex(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view webhook deliveries"))
+	}
+
+	q := subscriptions.WebhookDeliveriesQuery().Where("product_id=?", product.ID).Limit(webhookListLimit)
+
+	// Set the offset in pages if we have one
+	page := int(params.GetInt("page"))
+	if page > 0 {
+		q.Offset(webhookListLimit * page)
+	}
+
+	deliveries, err := subscriptions.FindAllWebhookDeliveries(q)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	attempts, err := subscriptions.FindWebhookAttempts(deliveries)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("story", product)
+	view.AddKey("deliveries", deliveries)
+	view.AddKey("attempts", attempts)
+	view.AddKey("page", page)
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", fmt.Sprintf("Webhooks for %s", product.Name))
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("subscriptions/views/webhooks.html.got")
+
+	return view.Render()
+}
+
+// HandleWebhookReplay responds to POST /products/n/webhooks/n/replay by queuing the delivery again,
+// signed with the current secret of the product.
+func HandleWebhookReplay(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Find the product
+	product, err := products.Find(params.GetInt(products.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can replay webhook deliveries"))
+	}
+
+	delivery, err := subscriptions.FindWebhookDelivery(params.GetInt("delivery_id"))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	if delivery.ProductID != product.ID {
+		return server.NotFoundError(errors.New("webhook delivery does not belong to the product"))
+	}
+
+	if product.WebhookURL == "" || product.WebhookSecret == "" {
+		return server.BadRequestError(errors.New("product has no webhook URL or secret"))
+	}
+
+	err = delivery.Replay(product.WebhookURL, product.WebhookSecret)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	log.Info(log.V{"msg": "Replayed webhook delivery", "delivery_id": delivery.ID, "product_id": product.ID})
+
+	return server.Redirect(w, r, fmt.Sprintf("/products/%d/webhooks", product.ID))
+}
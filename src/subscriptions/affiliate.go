@@ -0,0 +1,108 @@
+package subscriptions
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// paypalAffiliateSeparator separates the affiliate from the custom id of the integrator in the custom_id of PayPal
+const paypalAffiliateSeparator = "|affiliate:"
+
+// squareAffiliateFormat is the note of a Square payment made by a buyer referred by an affiliate
+const squareAffiliateFormat = "Affiliate Id: %d"
+
+// referrer returns the id of the active affiliate whose referral link the buyer followed, 0 if there is none
+func referrer(r *http.Request) int64 {
+	affiliate, err := affiliates.FindReferral(session.Referral(r))
+	if err != nil {
+		return 0
+	}
+	return affiliate.ID
+}
+
+// withAffiliate adds the affiliate to the custom id sent to PayPal, which has no other metadata
+func withAffiliate(customID string, affiliateID int64) string {
+	if affiliateID == 0 {
+		return customID
+	}
+	return customID + paypalAffiliateSeparator + strconv.FormatInt(affiliateID, 10)
+}
+
+// splitAffiliate returns the custom id of the integrator and the affiliate sent to PayPal with withAffiliate
+func splitAffiliate(customID string) (string, int64) {
+	i := strings.LastIndex(customID, paypalAffiliateSeparator)
+	if i < 0 {
+		return customID, 0
+	}
+
+	affiliateID, err := strconv.ParseInt(customID[i+len(paypalAffiliateSeparator):], 10, 64)
+	if err != nil {
+		return customID, 0
+	}
+	return customID[:i], affiliateID
+}
+
+// squareAffiliateNote returns the note of a Square payment with the affiliate who referred the buyer
+func squareAffiliateNote(affiliateID int64) string {
+	if affiliateID == 0 {
+		return ""
+	}
+	return fmt.Sprintf(squareAffiliateFormat, affiliateID)
+}
+
+// earnCommission records the commission of the affiliate who referred the buyer on the first payment of the amount and tax,
+// each product earns its rate on its share of the payment before tax
+func earnCommission(tx *query.Tx, transaction *Subscription, order *orders.Order, product *products.Story, amount int64, tax int64) error {
+	if transaction.AffiliateID == 0 || amount <= 0 {
+		return nil
+	}
+
+	affiliate, err := affiliates.FindTx(tx, transaction.AffiliateID)
+	if err != nil || !affiliate.Active() {
+		log.Info(log.V{"msg": "Payment event, no active affiliate for the commission", "id": transaction.ID, "affiliate_id": transaction.AffiliateID})
+		return nil
+	}
+
+	var paidProducts []*products.Story
+	var amounts []int64
+	if order != nil {
+		for _, item := range order.Items {
+			itemProduct, err := products.FindTx(tx, item.ProductID)
+			if err != nil {
+				continue
+			}
+			paidProducts = append(paidProducts, itemProduct)
+			amounts = append(amounts, item.Amount)
+		}
+	} else if product != nil {
+		paidProducts = append(paidProducts, product)
+		amounts = append(amounts, 1)
+	}
+
+	net := amount - tax
+	var commission int64
+	for i, share := range splitAmount(amounts, net) {
+		commission += affiliates.Rate(share, paidProducts[i].AffiliateRate)
+	}
+	if commission <= 0 {
+		return nil
+	}
+
+	err = affiliates.Earn(tx, affiliate.ID, transaction.ID, transaction.ProductId, transaction.Currency, amount, commission)
+	if err != nil {
+		return err
+	}
+
+	log.Info(log.V{"msg": "Payment event, commission earned", "id": transaction.ID, "affiliate_id": affiliate.ID, "commission": commission})
+
+	return nil
+}
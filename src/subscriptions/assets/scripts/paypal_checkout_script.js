@@ -8,6 +8,9 @@ document.addEventListener("DOMContentLoaded", async function () {
   const productId = decodeURIComponent(urlParams.get("product_id"));
   const customId = decodeURIComponent(urlParams.get("custom_id"));
   const redirectURI = decodeURIComponent(urlParams.get("redirect_uri"));
+  const coupon = urlParams.get("coupon") || "";
+  const quote = urlParams.get("quote") || "";
+  const taxId = urlParams.get("tax_id") || "";
   paypal
     .Buttons({
       style: {
@@ -35,7 +38,13 @@ document.addEventListener("DOMContentLoaded", async function () {
               "&product_id=" +
               productID() +
               "&custom_id=" +
-              customId,
+              customId +
+              "&coupon=" +
+              encodeURIComponent(coupon) +
+              "&quote=" +
+              encodeURIComponent(quote) +
+              "&tax_id=" +
+              encodeURIComponent(taxId),
           });
 
           const orderData = await response.json();
@@ -90,6 +90,19 @@ function createSubscriptionObject(planId, customId) {
     subscriptionObject.custom_id = customId;
   }
 
+  // The affiliate who referred the buyer is sent in the custom id, which is the only metadata of a subscription
+  const affiliate = affiliateID();
+  if (affiliate !== null && affiliate !== "") {
+    const custom = customId !== null && customId !== "null" ? customId : "";
+    subscriptionObject.custom_id = custom + "|affiliate:" + affiliate;
+  }
+
+  // Billing of a subscription with a free trial starts when the trial ends
+  const startTime = subscriptionStartTime();
+  if (startTime !== null && startTime !== "") {
+    subscriptionObject.start_time = startTime;
+  }
+
   /*   subscriber: {
             email_address: "user@example.com",
             name: {
@@ -132,6 +132,7 @@ document.addEventListener("DOMContentLoaded", async function () {
         notes: {
           custom_id: customId !== "null" ? customId : "",
           product_id: productId,
+          affiliate_id: affiliateID(),
           name: document.querySelector(".razorpay-input-name").value,
           email: document.querySelector(".razorpay-input-email").value,
           phone: phoneField ? phoneField.value : "",
@@ -39,6 +39,21 @@ func HandleBillingShow(w http.ResponseWriter, r *http.Request) error {
 	currency := params.Get("currency")
 	paymentType := params.Get("type")
 	productId := params.Get("productId")
+	coupon := params.Get("coupon")
+	quote := params.Get("quote")
+	taxID := params.Get("tax_id")
+
+	order := params.Get("order")
+
+	// The price must be the one signed on the product page, or the total of the order of the cart
+	if order != "" {
+		_, err = checkSquareOrder(order, params.GetInt("amount"), currency)
+	} else {
+		err = checkSquareQuote(quote, params.GetInt("productId"), params.GetInt("amount"), currency, paymentType)
+	}
+	if err != nil {
+		return server.Redirect(w, r, quoteFailure(err))
+	}
 
 	// Render the template
 	view := view.NewRenderer(w, r)
@@ -55,6 +70,10 @@ func HandleBillingShow(w http.ResponseWriter, r *http.Request) error {
 	view.AddKey("currency", currency)
 	view.AddKey("type", paymentType)
 	view.AddKey("productId", productId)
+	view.AddKey("coupon", coupon)
+	view.AddKey("quote", quote)
+	view.AddKey("taxId", taxID)
+	view.AddKey("order", order)
 
 	// Set Cloudflare turnstile site key
 	view.AddKey("turnstile_site_key", config.Get("turnstile_site_key"))
@@ -105,6 +124,21 @@ func HandleBilling(w http.ResponseWriter, r *http.Request) error {
 	currency := params.Get("currency")
 	paymentType := params.Get("type")
 	productId := params.Get("productId")
+	coupon := url.QueryEscape(params.Get("coupon"))
+	quote := url.QueryEscape(params.Get("quote"))
+	taxID := url.QueryEscape(params.Get("tax_id"))
+
+	order := url.QueryEscape(params.Get("order"))
+
+	// The price must be the one signed on the product page, or the total of the order of the cart
+	if order != "" {
+		_, err = checkSquareOrder(params.Get("order"), params.GetInt("amount"), currency)
+	} else {
+		err = checkSquareQuote(params.Get("quote"), params.GetInt("productId"), params.GetInt("amount"), currency, paymentType)
+	}
+	if err != nil {
+		return server.Redirect(w, r, quoteFailure(err))
+	}
 
 	var intent string
 
@@ -166,16 +200,16 @@ func HandleBilling(w http.ResponseWriter, r *http.Request) error {
 			if !siteVerify.Success {
 				// Security challenge failed
 				log.Error(log.V{"Upload, Security challenge failed": siteVerify.ErrorCodes[0]})
-				return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_failed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s", amount, currency, paymentType, productId))
+				return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_failed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s&coupon=%s&quote=%s&tax_id=%s&order=%s", amount, currency, paymentType, productId, coupon, quote, taxID, order))
 			}
 		} else {
 			log.Error(log.V{"Upload, Security challenge unable to process": "response not received from user"})
-			return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_not_completed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s", amount, currency, paymentType, productId))
+			return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_not_completed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s&coupon=%s&quote=%s&tax_id=%s&order=%s", amount, currency, paymentType, productId, coupon, quote, taxID, order))
 		}
 	} else {
 		// Security challenge not completed
-		return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_not_completed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s", amount, currency, paymentType, productId))
+		return server.Redirect(w, r, "/subscriptions/billing?error=security_challenge_not_completed_login"+fmt.Sprintf("&amount=%s&currency=%s&type=%s&productId=%s&coupon=%s&quote=%s&tax_id=%s&order=%s", amount, currency, paymentType, productId, coupon, quote, taxID, order))
 	}
 
-	return server.Redirect(w, r, fmt.Sprintf("/subscriptions/square?amount=%s&currency=%s&type=%s&addressLine1=%s&addressLine2=%s&givenName=%s&email=%s&country=%s&city=%s&state=%s&postalcode=%s&intent=%s&productId=%s", amount, currency, paymentType, addressLine1, addressLine2, name, email, country, locality, state, postalcode, intent, productId))
+	return server.Redirect(w, r, fmt.Sprintf("/subscriptions/square?amount=%s&currency=%s&type=%s&addressLine1=%s&addressLine2=%s&givenName=%s&email=%s&country=%s&city=%s&state=%s&postalcode=%s&intent=%s&productId=%s&coupon=%s&quote=%s&tax_id=%s&order=%s", amount, currency, paymentType, addressLine1, addressLine2, name, email, country, locality, state, postalcode, intent, productId, coupon, quote, taxID, order))
 }
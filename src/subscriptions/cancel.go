@@ -0,0 +1,88 @@
+package subscriptions
+
+import (
+	"errors"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/sub"
+)
+
+// When a subscription is cancelled at its gateway, the subscription is cancelled and the product's webhook sent
+// once the gateway's webhook confirms it
+const (
+	// CancelAtPeriodEnd cancels the subscription at the end of the billing period it has been paid for
+	CancelAtPeriodEnd = "period_end"
+	// CancelImmediately cancels the subscription now
+	CancelImmediately = "immediately"
+)
+
+// ErrCancelTiming is returned when the gateway of the subscription can't cancel it at the time asked for
+var ErrCancelTiming = errors.New("subscription can't be cancelled at this time at its payment gateway")
+
+// CancelTimings returns the times the subscription can be cancelled at by its gateway, the first is the default.
+// The gateways which aren't listed cancel the subscription at the time they always do.
+func (s *Subscription) CancelTimings() []string {
+	switch s.PaymentGateway {
+	case "stripe":
+		return []string{CancelAtPeriodEnd, CancelImmediately}
+	case "square":
+		// Square only cancels a subscription at the end of its billing period
+		return []string{CancelAtPeriodEnd}
+	}
+	return nil
+}
+
+// CancelSubscription cancels the subscription at its gateway at the end of its billing period or immediately,
+// an empty timing cancels it at the default time of the gateway. It returns the timing the subscription was cancelled at,
+// an empty string for gateways which cancel it at the time they always do.
+func CancelSubscription(subscription *Subscription, timing string) (string, error) {
+	timings := subscription.CancelTimings()
+	if timing == "" && len(timings) > 0 {
+		timing = timings[0]
+	}
+
+	if timing != "" {
+		var supported bool
+		for _, t := range timings {
+			if t == timing {
+				supported = true
+			}
+		}
+		if !supported {
+			return "", ErrCancelTiming
+		}
+	}
+
+	var err error
+	if subscription.PaymentGateway == "stripe" && timing == CancelAtPeriodEnd {
+		err = cancelStripeSubscriptionAtPeriodEnd(subscription.SubscriptionId)
+	} else {
+		var gateway Gateway
+		gateway, err = FindGateway(subscription.PaymentGateway)
+		if err == nil {
+			err = gateway.Cancel(subscription.SubscriptionId)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	log.Info(log.V{"msg": "Subscription cancel, subscription cancelled at the gateway", "id": subscription.ID, "pg": subscription.PaymentGateway, "timing": timing})
+
+	return timing, nil
+}
+
+// cancelStripeSubscriptionAtPeriodEnd cancels the Stripe subscription at the end of its current period,
+// Stripe deletes the subscription then
+func cancelStripeSubscriptionAtPeriodEnd(subscriptionID string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	}
+
+	_, err := sub.Update(subscriptionID, params)
+	return err
+}
@@ -0,0 +1,37 @@
+// Tests for cancelling subscriptions at their gateway
+package subscriptions
+
+import (
+	"testing"
+)
+
+// Test subscriptions are cancelled only at the times their gateway supports
+func TestCancelSubscription(t *testing.T) {
+	subscription := New()
+	subscription.SubscriptionId = "sub_1"
+	subscription.PaymentGateway = "stripe"
+	if timings := subscription.CancelTimings(); len(timings) != 2 || timings[0] != CancelAtPeriodEnd {
+		t.Fatalf("cancel: expected stripe subscription to be cancelled at period end by default got:%v", timings)
+	}
+
+	subscription.PaymentGateway = "square"
+	if _, err := CancelSubscription(subscription, CancelImmediately); err != ErrCancelTiming {
+		t.Fatalf("cancel: expected square subscription not to be cancelled immediately got:%v", err)
+	}
+
+	fake := NewFakeGateway("secret")
+	RegisterGateway(fake)
+
+	subscription.PaymentGateway = fake.Name()
+	if _, err := CancelSubscription(subscription, CancelAtPeriodEnd); err != ErrCancelTiming {
+		t.Fatalf("cancel: expected fake subscription not to be cancelled at a chosen time got:%v", err)
+	}
+
+	timing, err := CancelSubscription(subscription, "")
+	if err != nil || timing != "" {
+		t.Fatalf("cancel: expected fake subscription to be cancelled at the gateway's time got:%q %v", timing, err)
+	}
+	if cancelled := fake.Cancelled(); len(cancelled) != 1 || cancelled[0] != "sub_1" {
+		t.Fatalf("cancel: expected subscription to be cancelled at the gateway got:%v", cancelled)
+	}
+}
@@ -0,0 +1,671 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/offers"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+	razorpay "github.com/razorpay/razorpay-go"
+	"github.com/stripe/stripe-go/v72"
+	stripesession "github.com/stripe/stripe-go/v72/checkout/session"
+)
+
+// ErrCartEmpty is returned when checking out a cart without products
+var ErrCartEmpty = errors.New("the cart is empty")
+
+// errCartGateway is returned when no gateway has a price in one currency for every product in the cart
+var errCartGateway = errors.New("no payment gateway has a price in one currency for every product in the cart")
+
+// Cart is the buyer's cart priced on the gateway it is paid with
+type Cart struct {
+	Gateway  Gateway
+	Currency string
+	Lines    []*CartLine
+	// ReturnPath is the page the buyer returns to when the checkout is cancelled, the cart unless it is set
+	ReturnPath string
+	// Offers are the bumps and upsells accepted by the buyer which are paid with the order of the cart
+	Offers []*offers.Offer
+}
+
+// CartLine is a product of the cart with its price for the country
+type CartLine struct {
+	Product  *products.Story
+	Country  string
+	Checkout *Checkout
+}
+
+// Total returns the total of the cart before the tax in the smallest currency unit
+func (c *Cart) Total() int64 {
+	var total int64
+	for _, line := range c.Lines {
+		total += line.Checkout.UnitAmount
+	}
+	return total
+}
+
+// returnURL returns the url of the page the buyer returns to when the checkout is cancelled
+func (c *Cart) returnURL(domain string) string {
+	if c.ReturnPath != "" {
+		return domain + c.ReturnPath
+	}
+	return domain + "/cart"
+}
+
+// Price returns the total of the cart as it is shown to the buyer e.g. 25.00 EUR
+func (c *Cart) Price() string {
+	return majorUnits(c.Total()) + " " + strings.ToUpper(c.Currency)
+}
+
+// Price returns the price of the product as it is shown to the buyer e.g. 10.00 EUR
+func (l *CartLine) Price() string {
+	return majorUnits(l.Checkout.UnitAmount) + " " + strings.ToUpper(quoteValue(l.Checkout.Currency))
+}
+
+// CartProduct reports whether the product can be bought in a cart, subscriptions and pay what you want
+// products are bought on their own
+func CartProduct(product *products.Story) bool {
+	return checkoutType(product.Schedule) == "onetime" && !product.PayWhatYouWant()
+}
+
+// CartProducts returns the products in the buyer's cart which can still be bought in a cart
+func CartProducts(w http.ResponseWriter, r *http.Request) []*products.Story {
+	var cartProducts []*products.Story
+	for _, productID := range orders.Cart(w, r) {
+		product, err := products.Find(productID)
+		if err != nil || !CartProduct(product) {
+			continue
+		}
+		cartProducts = append(cartProducts, product)
+	}
+	return cartProducts
+}
+
+// PriceCart prices the products on the first gateway, in order of preference, with a one time price in the same
+// currency for every product, the price of the country is used and otherwise the default price.
+func PriceCart(cartProducts []*products.Story, country string) (*Cart, error) {
+	if len(cartProducts) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	for _, g := range Gateways() {
+		if !g.Enabled() {
+			continue
+		}
+
+		cart, err := priceCartOnGateway(g, cartProducts, country)
+		if err != nil {
+			log.Info(log.V{"msg": "Cart, gateway can't be used for the cart", "pg": g.Name(), "error": err})
+			continue
+		}
+		return cart, nil
+	}
+
+	return nil, errCartGateway
+}
+
+// priceCartOnGateway prices every product of the cart on the gateway
+func priceCartOnGateway(g Gateway, cartProducts []*products.Story, country string) (*Cart, error) {
+	cart := &Cart{Gateway: g}
+
+	for _, product := range cartProducts {
+		priceCountry := country
+		if !g.HasPrice(product, priceCountry) {
+			priceCountry = DefaultCountry
+		}
+		if !g.HasPrice(product, priceCountry) {
+			return nil, fmt.Errorf("no price for %s", product.Name)
+		}
+
+		checkout, err := g.Checkout(product, priceCountry, "", "")
+		if err != nil {
+			return nil, err
+		}
+
+		currency := quoteValue(checkout.Currency)
+		if checkout.Type != "onetime" || checkout.UnitAmount <= 0 || currency == "" {
+			return nil, fmt.Errorf("no one time price for %s", product.Name)
+		}
+		if cart.Currency == "" {
+			cart.Currency = currency
+		} else if !strings.EqualFold(cart.Currency, currency) {
+			return nil, fmt.Errorf("the price of %s is in %s", product.Name, currency)
+		}
+
+		cart.Lines = append(cart.Lines, &CartLine{Product: product, Country: priceCountry, Checkout: checkout})
+	}
+
+	return cart, nil
+}
+
+// HandleCartCheckout pays for the products in the buyer's cart in one checkout, it responds to POST /cart/checkout
+func HandleCartCheckout(w http.ResponseWriter, r *http.Request) error {
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	ipCountry := RequestCountry(r)
+
+	cart, err := PriceCart(CartProducts(w, r), ipCountry)
+	if err != nil {
+		return server.Redirect(w, r, cartFailure(err))
+	}
+
+	return checkoutCart(w, r, cart, ipCountry, params.Get("tax_id"))
+}
+
+// checkoutCart sends the buyer to the checkout of the gateway the cart is priced on
+func checkoutCart(w http.ResponseWriter, r *http.Request, cart *Cart, ipCountry string, taxID string) error {
+	log.Info(log.V{"msg": "Cart checkout", "pg": cart.Gateway.Name(), "products": len(cart.Lines), "total": cart.Total()})
+
+	switch cart.Gateway.Name() {
+	case "stripe":
+		return cartStripeCheckout(w, r, cart, ipCountry, taxID)
+	case "paypal":
+		return cartPaypalCheckout(w, r, cart, ipCountry, taxID)
+	case "razorpay":
+		return cartRazorpayCheckout(w, r, cart, ipCountry, taxID)
+	case "square":
+		return cartSquareCheckout(w, r, cart, taxID)
+	}
+
+	return server.Redirect(w, r, cartFailure(errCartGateway))
+}
+
+// cartStripeCheckout creates a Stripe checkout session with a line for each product of the cart
+func cartStripeCheckout(w http.ResponseWriter, r *http.Request, cart *Cart, ipCountry string, taxID string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	var taxRates []*string
+	if config.Get(fmt.Sprintf("stripe_tax_rate_%s", ipCountry)) != "" {
+		taxRates = stripe.StringSlice([]string{config.Get(fmt.Sprintf("stripe_tax_rate_%s", ipCountry))})
+	}
+
+	// The rate of the buyer's country replaces the stripe_tax_rate of the country, businesses which
+	// are reverse charged pay no tax
+	tax := checkoutTax(cart.Total(), ipCountry, "", taxID, taxes.Inclusive())
+	if tax.Name != "" {
+		taxRates = nil
+		if !tax.ReverseCharge {
+			stripeTaxRateId, err := stripeTaxRate(tax)
+			if err != nil {
+				return server.InternalError(err)
+			}
+			taxRates = stripe.StringSlice([]string{stripeTaxRateId})
+		}
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		BillingAddressCollection: stripe.String("required"),
+		SuccessURL:               stripe.String(config.Get("stripe_callback_domain") + "/subscriptions/success?session_id={CHECKOUT_SESSION_ID}"),
+		CancelURL:                stripe.String(cart.returnURL(config.Get("stripe_callback_domain"))),
+		PaymentMethodTypes: stripe.StringSlice([]string{
+			"card",
+		}),
+		Mode: stripe.String(string(stripe.CheckoutSessionModePayment)),
+	}
+	for _, line := range cart.Lines {
+		params.LineItems = append(params.LineItems, &stripe.CheckoutSessionLineItemParams{
+			Price:    stripe.String(line.Checkout.PriceID),
+			Quantity: stripe.Int64(1),
+			TaxRates: taxRates,
+		})
+	}
+	if affiliateID := referrer(r); affiliateID > 0 {
+		params.AddMetadata("affiliate_id", strconv.FormatInt(affiliateID, 10))
+	}
+
+	s, err := stripesession.New(params)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	_, err = placeOrder(cart, s.ID, tax.Gross, tax.Tax)
+	if err != nil {
+		log.Error(log.V{"Stripe cart checkout, error placing order": err})
+		return server.InternalError(err)
+	}
+
+	// Stripe calculates the tax, the evidence of the buyer's location is recorded
+	err = recordTax(tax, 0, 0, "stripe", s.ID, ipCountry, "", cart.Currency)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	http.Redirect(w, r, s.URL, http.StatusSeeOther)
+	return nil
+}
+
+// cartPaypalCheckout creates a PayPal order with an item for each product of the cart and sends the buyer
+// to PayPal to approve it, the buyer returns to /cart/paypal where the payment is captured
+func cartPaypalCheckout(w http.ResponseWriter, r *http.Request, cart *Cart, ipCountry string, taxID string) error {
+	itemTotal := cart.Total()
+
+	// The tax of each price is used unless the rate of the buyer's country replaces it,
+	// an inclusive tax is part of the item total
+	var taxTotal int64
+	for _, line := range cart.Lines {
+		taxTotal += minorUnits(fmt.Sprintf("%.2f", line.Product.PaypalPrice[line.Country]["tax"]))
+	}
+	tax := checkoutTax(itemTotal, ipCountry, "", taxID, taxes.Inclusive())
+	if tax.Name != "" {
+		taxTotal = tax.Tax
+		if tax.Inclusive {
+			itemTotal -= tax.Tax
+		}
+	}
+
+	var amounts []int64
+	for _, line := range cart.Lines {
+		amounts = append(amounts, line.Checkout.UnitAmount)
+	}
+	amounts = splitAmount(amounts, itemTotal)
+
+	var items []Items
+	for i, line := range cart.Lines {
+		items = append(items, Items{
+			Name:     line.Product.Name,
+			Quantity: 1,
+			Sku:      strconv.FormatInt(line.Product.ID, 10),
+			UnitAmount: UnitAmount{
+				CurrencyCode: cart.Currency,
+				Value:        majorUnits(amounts[i]),
+			},
+		})
+	}
+
+	data := PaypalCreateOrder{
+		Intent: "CAPTURE",
+		PaymentSource: PaymentSource{
+			Paypal: Paypal{
+				ExperienceContext: ExperienceContext{
+					ShippingPreference: "NO_SHIPPING",
+					UserAction:         "PAY_NOW",
+					ReturnURL:          config.Get("root_url") + "/cart/paypal",
+					CancelURL:          cart.returnURL(config.Get("root_url")),
+				},
+			},
+		},
+		PurchaseUnits: []PurchaseUnits{
+			{
+				CustomID: withAffiliate("", referrer(r)),
+				Amount: Amount{
+					CurrencyCode: cart.Currency,
+					Value:        majorUnits(itemTotal + taxTotal),
+					Breakdown: Breakdown{
+						ItemTotal: ItemTotal{
+							CurrencyCode: cart.Currency,
+							Value:        majorUnits(itemTotal),
+						},
+						TaxTotal: TaxTotal{
+							CurrencyCode: cart.Currency,
+							Value:        majorUnits(taxTotal),
+						},
+					},
+				},
+				Items: items,
+			},
+		},
+	}
+
+	result, err := createPaypalOrder(data)
+	if err != nil {
+		return server.InternalError(err)
+	}
+	if result.ID == "" {
+		return server.InternalError(errors.New("paypal order not created for the cart"))
+	}
+
+	_, err = placeOrder(cart, result.ID, itemTotal+taxTotal, taxTotal)
+	if err != nil {
+		log.Error(log.V{"Paypal cart checkout, error placing order": err})
+		return server.InternalError(err)
+	}
+
+	err = recordTax(tax, taxTotal, 0, "paypal", result.ID, ipCountry, "", cart.Currency)
+	if err != nil {
+		log.Error(log.V{"Paypal cart checkout, error recording tax evidence": err})
+		return server.InternalError(err)
+	}
+
+	for _, link := range result.Links {
+		if link.Rel == "payer-action" || link.Rel == "approve" {
+			return server.RedirectExternal(w, r, link.Href)
+		}
+	}
+
+	return server.InternalError(errors.New("paypal order has no link for the buyer to approve it"))
+}
+
+// HandleCartPaypalReturn captures the payment of the cart's PayPal order approved by the buyer,
+// it responds to GET /cart/paypal
+func HandleCartPaypalReturn(w http.ResponseWriter, r *http.Request) error {
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// PayPal returns the id of the order as the token
+	orderId := params.Get("token")
+
+	_, err = orders.FindPending("paypal", orderId)
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	result, err := capturePaypalOrder(orderId)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if result.Status != "COMPLETED" {
+		log.Error(log.V{"Paypal cart checkout, order not captured": orderId, "status": result.Status})
+		return server.Redirect(w, r, "/subscriptions/failure?errorDetail="+url.QueryEscape("The payment wasn't completed, please try again."))
+	}
+
+	// The order is paid once PayPal's webhook for the payment is processed
+	return server.Redirect(w, r, "/subscriptions/success?paypal_orderid="+url.QueryEscape(orderId))
+}
+
+// cartRazorpayCheckout creates a Razorpay order for the total of the cart and shows the Razorpay checkout for it
+func cartRazorpayCheckout(w http.ResponseWriter, r *http.Request, cart *Cart, ipCountry string, taxID string) error {
+	// The tax is added to the amount of the order unless prices include it
+	tax := checkoutTax(cart.Total(), ipCountry, "", taxID, taxes.Inclusive())
+
+	client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	data := map[string]interface{}{
+		"amount":   tax.Gross,
+		"currency": cart.Currency,
+	}
+	razorpayOrder, err := client.Order.Create(data, nil)
+	if err != nil {
+		log.Error(log.V{"Error creating Razorpay order": err})
+		return server.InternalError(err)
+	}
+
+	orderId, _ := razorpayOrder["id"].(string)
+	if orderId == "" {
+		return server.InternalError(errors.New("razorpay order not created for the cart"))
+	}
+
+	order, err := placeOrder(cart, orderId, tax.Gross, tax.Tax)
+	if err != nil {
+		log.Error(log.V{"Razorpay cart checkout, error placing order": err})
+		return server.InternalError(err)
+	}
+
+	err = recordTax(tax, tax.Tax, 0, "razorpay", orderId, ipCountry, "", cart.Currency)
+	if err != nil {
+		log.Error(log.V{"Razorpay cart checkout, error recording tax evidence": err})
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/subscriptions/razorpay?order="+order.Token)
+}
+
+// cartSquareCheckout places the order and sends the buyer to the billing details for the Square payment,
+// the order gets the reference of the payment once it is completed
+func cartSquareCheckout(w http.ResponseWriter, r *http.Request, cart *Cart, taxID string) error {
+	order, err := placeOrder(cart, "", cart.Total(), 0)
+	if err != nil {
+		log.Error(log.V{"Square cart checkout, error placing order": err})
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, fmt.Sprintf("/subscriptions/billing?amount=%d&currency=%s&type=onetime&order=%s&tax_id=%s",
+		cart.Total(), url.QueryEscape(cart.Currency), order.Token, url.QueryEscape(taxID)))
+}
+
+// checkSquareOrder checks the amount and currency sent back by the browser are the total of the pending Square order,
+// the amount is in the smallest currency unit.
+func checkSquareOrder(token string, amount int64, currency string) (*orders.Order, error) {
+	order, err := orders.FindToken(token)
+	if err != nil {
+		return nil, ErrQuoteInvalid
+	}
+
+	if order.Gateway != "square" || order.Paid() || order.Reference != "" {
+		return nil, ErrQuoteInvalid
+	}
+
+	if amount != order.Subtotal() || !strings.EqualFold(currency, order.Currency) {
+		return nil, ErrQuoteMismatch
+	}
+
+	return order, nil
+}
+
+// placeOrder saves the products of the cart as an order pending the payment of the checkout with the reference,
+// the amount and tax are in the smallest currency unit
+func placeOrder(cart *Cart, reference string, amount int64, tax int64) (*orders.Order, error) {
+	order := orders.New()
+	order.Gateway = cart.Gateway.Name()
+	order.Reference = reference
+	order.Currency = cart.Currency
+	order.Amount = amount
+	order.Tax = tax
+	for _, line := range cart.Lines {
+		item := orders.NewItem()
+		item.ProductID = line.Product.ID
+		item.Name = line.Product.Name
+		item.Amount = line.Checkout.UnitAmount
+		order.Items = append(order.Items, item)
+	}
+
+	order, err := orders.Place(order)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, offer := range cart.Offers {
+		err = offer.PlaceOrder(order.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// attachOrder records the reference of the payment of an order at a gateway which only has one once the order is paid,
+// if the payment was already recorded from the gateway's webhook the order is paid at once.
+func attachOrder(order *orders.Order, reference string) error {
+	var effects []func()
+
+	// The order is attached and paid by a payment recorded already in one transaction
+	err := query.Transaction(func(tx *query.Tx) error {
+		err := order.Attach(tx, reference)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := FindTransactionReferenceTx(tx, reference)
+		if err != nil {
+			return nil
+		}
+
+		effects, err = orderPaid(tx, transactionEvent(transaction), transaction, order)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, effect := range effects {
+		effect()
+	}
+
+	return nil
+}
+
+// orderPaid records the order as paid by the payment and delivers each of its products as if it had been bought
+// on its own, the customer gets one receipt and invoice for the order
+func orderPaid(tx *query.Tx, event *PaymentEvent, transaction *Subscription, order *orders.Order) ([]func(), error) {
+	err := order.Pay(tx, transaction.ID, transaction.CustomerEmail, int64(math.Round(transaction.Amount*100)), int64(math.Round(transaction.Tax*100)))
+	if err != nil {
+		log.Error(log.V{"Payment event, error paying order": err, "order": order.ID})
+		return nil, err
+	}
+
+	description := order.Description()
+	err = transaction.UpdateTx(tx, map[string]string{"item_name": description})
+	if err != nil {
+		log.Error(log.V{"Payment event, error updating transaction": err})
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, order paid", "order": order.ID, "id": transaction.ID, "pg": transaction.PaymentGateway})
+
+	var effects []func()
+	for _, item := range order.Items {
+		product, err := products.FindTx(tx, item.ProductID)
+		if err != nil {
+			log.Error(log.V{"Payment event, error finding product of order": err, "product_id": item.ProductID})
+			continue
+		}
+
+		productEffects, err := productPaid(tx, event, transaction, product)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, productEffects...)
+	}
+
+	orderOffers, err := offers.FindOrder(tx, order.ID)
+	if err != nil {
+		log.Error(log.V{"Payment event, error finding offers of order": err, "order": order.ID})
+		return nil, err
+	}
+	for _, offer := range orderOffers {
+		err = offer.Pay(tx, transaction.ID)
+		if err != nil {
+			log.Error(log.V{"Payment event, error paying offer": err, "offer": offer.ID})
+			return nil, err
+		}
+	}
+
+	invoice, err := issueOrderInvoice(tx, transaction, order)
+	if err != nil {
+		log.Error(log.V{"Payment event, error issuing invoice": err, "id": transaction.ID})
+		return nil, err
+	}
+
+	effects = append(effects, func() { sendReceipt(event, description, "onetime") })
+	if invoice != nil {
+		effects = append(effects, func() { sendInvoice(invoice, description) })
+	}
+
+	return effects, nil
+}
+
+// TransactionProducts returns every product delivered by the payment, the product of the payment or
+// the products of its order, each followed by the products included in it if it is a bundle
+func TransactionProducts(transaction *Subscription) []*products.Story {
+	product, err := products.Find(transaction.ProductId)
+	if err != nil {
+		product = nil
+	}
+	return transactionProducts(nil, transaction, product)
+}
+
+// transactionProducts returns every product delivered by the payment with the product of the payment if it is known
+func transactionProducts(tx *query.Tx, transaction *Subscription, product *products.Story) []*products.Story {
+	var paidProducts []*products.Story
+	if product != nil {
+		paidProducts = append(paidProducts, product)
+	} else {
+		order, err := orders.FindTransactionTx(tx, transaction.ID)
+		if err != nil {
+			return nil
+		}
+		for _, item := range order.Items {
+			product, err := products.FindTx(tx, item.ProductID)
+			if err == nil {
+				paidProducts = append(paidProducts, product)
+			}
+		}
+	}
+
+	var delivered []*products.Story
+	for _, product := range paidProducts {
+		delivered = append(delivered, product)
+		bundled, err := products.FindBundleTx(tx, product)
+		if err != nil {
+			log.Error(log.V{"Payment event, error finding products of bundle": err, "product_id": product.ID})
+			continue
+		}
+		delivered = append(delivered, bundled...)
+	}
+	return delivered
+}
+
+// transactionEvent returns a payment event for the payment recorded in the ledger,
+// for the receipt of a payment whose webhook was processed earlier
+func transactionEvent(transaction *Subscription) *PaymentEvent {
+	return &PaymentEvent{
+		Gateway:        transaction.PaymentGateway,
+		Type:           WebhookPaymentSucceeded,
+		SubscriptionID: transaction.SubscriptionId,
+		PaymentID:      transaction.PaymentId,
+		CustomerID:     transaction.CustomerId,
+		CustomerEmail:  transaction.CustomerEmail,
+		CustomerName:   transaction.FirstName,
+		CustomID:       transaction.UserId,
+		Amount:         int64(math.Round(transaction.Amount * 100)),
+		Tax:            int64(math.Round(transaction.Tax * 100)),
+		Currency:       transaction.Currency,
+		Status:         transaction.PaymentStaus,
+		Created:        transaction.Created,
+	}
+}
+
+// splitAmount divides the total between the lines in proportion to their amounts, the remainder of the
+// rounding is added to the last line so that the lines add up to the total
+func splitAmount(amounts []int64, total int64) []int64 {
+	var sum int64
+	for _, amount := range amounts {
+		sum += amount
+	}
+
+	split := make([]int64, len(amounts))
+	if sum == 0 {
+		return split
+	}
+
+	remaining := total
+	for i, amount := range amounts {
+		if i == len(amounts)-1 {
+			split[i] = remaining
+			break
+		}
+		split[i] = int64(math.Round(float64(amount) * float64(total) / float64(sum)))
+		remaining -= split[i]
+	}
+	return split
+}
+
+// cartFailure returns the failure page explaining why the cart couldn't be checked out
+func cartFailure(err error) string {
+	return "/subscriptions/failure?errorDetail=" + url.QueryEscape("The cart can't be checked out, "+err.Error()+".")
+}
@@ -0,0 +1,56 @@
+// Tests for the cart
+package subscriptions
+
+import (
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test only one time products with a fixed price can be added to the cart
+func TestCartProduct(t *testing.T) {
+	product := products.New()
+	product.Schedule = "onetime"
+	if !CartProduct(product) {
+		t.Fatalf("cart: expected one time product to be allowed")
+	}
+
+	product.PriceMode = products.PriceModePayWhatYouWant
+	if CartProduct(product) {
+		t.Fatalf("cart: expected pay what you want product to be refused")
+	}
+
+	product = products.New()
+	product.Schedule = "monthly"
+	if CartProduct(product) {
+		t.Fatalf("cart: expected subscription to be refused")
+	}
+}
+
+// Test an amount is split across the lines in proportion to their prices without losing a cent
+func TestSplitAmount(t *testing.T) {
+	tests := []struct {
+		amounts []int64
+		total   int64
+		split   []int64
+	}{
+		{[]int64{1000, 2000}, 600, []int64{200, 400}},
+		{[]int64{1000, 1000, 1000}, 100, []int64{33, 33, 34}},
+		{[]int64{999}, 120, []int64{120}},
+		{[]int64{0, 0}, 100, []int64{0, 0}},
+	}
+
+	for _, test := range tests {
+		split := splitAmount(test.amounts, test.total)
+		var sum int64
+		for i := range split {
+			if split[i] != test.split[i] {
+				t.Fatalf("split: expected %v for %v of %d got:%v", test.split, test.amounts, test.total, split)
+			}
+			sum += split[i]
+		}
+		if test.split[0] != 0 && sum != test.total {
+			t.Fatalf("split: expected total %d got:%d", test.total, sum)
+		}
+	}
+}
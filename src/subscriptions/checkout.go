@@ -9,13 +9,14 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
-	s3 "github.com/abishekmuthian/open-payment-host/src/lib/s3"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
 	"github.com/stripe/stripe-go/v72"
 	stripesession "github.com/stripe/stripe-go/v72/checkout/session"
 	"github.com/stripe/stripe-go/v72/price"
@@ -36,6 +37,9 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 		Price             string `json:"priceId"`
 		AuthenticityToken string `json:"authenticityToken"`
 		Product           string `json:"productId"`
+		Coupon            string `json:"coupon"`
+		Quote             string `json:"quote"`
+		TaxID             string `json:"taxId"`
 	}
 
 	params, err := mux.Params(r)
@@ -45,6 +49,10 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 
 	req.Price = params.Get("priceId")
 	req.Product = params.Get("productId")
+	req.Coupon = params.Get("coupon")
+	req.Quote = params.Get("quote")
+	req.TaxID = params.Get("tax_id")
+	affiliateID := referrer(r)
 
 	var successURL *string
 
@@ -54,18 +62,8 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 		product, err := products.Find(productID)
 
 		if err == nil {
-
-			if product.S3Bucket != "" && product.S3Key != "" {
-				downloadUrl, err := s3.GeneratePresignedUrl(product.S3Bucket, product.S3Key)
-
-				if err == nil {
-					return server.RedirectExternal(w, r, downloadUrl)
-				}
-				successURL = stripe.String(downloadUrl)
-			} else {
-				successURL = stripe.String(config.Get("stripe_callback_domain") + "/subscriptions/success?session_id={CHECKOUT_SESSION_ID}")
-			}
-
+			// The download link of the product's file is shown on the success page once the payment is recorded
+			successURL = stripe.String(config.Get("stripe_callback_domain") + "/subscriptions/success?session_id={CHECKOUT_SESSION_ID}&product_id=" + strconv.FormatInt(product.ID, 10))
 		}
 	}
 
@@ -152,6 +150,113 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 		return server.InternalError(err)
 	}
 
+	// The price must be the one signed on the product page
+	quote, err := VerifyQuote(req.Quote, story, "stripe")
+	if err == nil && quote.PriceID != req.Price {
+		err = ErrQuoteMismatch
+	}
+	if err != nil {
+		log.Error(log.V{"Stripe checkout, price refused": err, "product_id": story.ID, "price_id": req.Price})
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
+	// Subscribers of a product with a free trial are charged once the trial ends
+	if story.Trial() && mode != nil && *mode == string(stripe.CheckoutSessionModeSubscription) {
+		if subscriptionData == nil {
+			subscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{}
+		}
+		subscriptionData.TrialPeriodDays = stripe.Int64(story.TrialDays)
+	}
+
+	// The buyer of a pay what you want product pays the amount they chose for the product of the price
+	linePrice := stripe.String(req.Price)
+	var linePriceData *stripe.CheckoutSessionLineItemPriceDataParams
+	var unitAmount int64
+	if p != nil {
+		unitAmount = p.UnitAmount
+	}
+	if quote.Pay > 0 {
+		if p == nil || p.ID == "" || p.Product == nil {
+			return server.InternalError(errors.New("stripe price not found for the amount chosen"))
+		}
+
+		linePrice = nil
+		linePriceData = &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency:   stripe.String(string(p.Currency)),
+			Product:    stripe.String(p.Product.ID),
+			UnitAmount: stripe.Int64(quote.Pay),
+		}
+		unitAmount = quote.Pay
+	}
+
+	// The coupon entered on the product page is applied with a Stripe coupon for the session
+	var coupon *coupons.Coupon
+	var discount int64
+	var discounts []*stripe.CheckoutSessionDiscountParams
+	if req.Coupon != "" {
+		if p == nil || p.ID == "" {
+			return server.InternalError(errors.New("stripe price not found for the coupon"))
+		}
+
+		coupon, err = FindCoupon(req.Coupon, story, "stripe")
+		if err == nil {
+			discount, err = coupon.Discount(unitAmount, string(p.Currency))
+		}
+		if err != nil {
+			return server.Redirect(w, r, couponFailure(err))
+		}
+
+		stripeCouponId, err := stripeCoupon(coupon, p)
+		if err != nil {
+			return server.InternalError(err)
+		}
+
+		discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(stripeCouponId)},
+		}
+	}
+
+	// The rate of the buyer's country replaces the stripe_tax_rate of the country, businesses which
+	// are reverse charged pay no tax
+	tax := checkoutTax(unitAmount-discount, clientCountry, "", req.TaxID, taxes.Inclusive())
+	if tax.Name != "" {
+		taxRate = nil
+		if subscriptionData != nil {
+			subscriptionData.DefaultTaxRates = nil
+		}
+
+		if !tax.ReverseCharge {
+			stripeTaxRateId, err := stripeTaxRate(tax)
+			if err != nil {
+				return server.InternalError(err)
+			}
+
+			if mode != nil && *mode == string(stripe.CheckoutSessionModeSubscription) {
+				if subscriptionData == nil {
+					subscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{}
+				}
+				subscriptionData.DefaultTaxRates = stripe.StringSlice([]string{stripeTaxRateId})
+			} else {
+				taxRate = stripe.StringSlice([]string{stripeTaxRateId})
+			}
+		}
+	}
+
+	var currency string
+	if p != nil {
+		currency = string(p.Currency)
+	}
+
+	// The card of a buyer who is offered an upsell after the purchase is saved so that the upsell is paid with one click
+	var paymentIntentData *stripe.CheckoutSessionPaymentIntentDataParams
+	var customerCreation *string
+	if story.UpsellProductID > 0 && mode != nil && *mode == string(stripe.CheckoutSessionModePayment) {
+		paymentIntentData = &stripe.CheckoutSessionPaymentIntentDataParams{
+			SetupFutureUsage: stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession)),
+		}
+		customerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
+	}
+
 	if config.Get(fmt.Sprintf("stripe_tax_rate_%s", clientCountry)) != "" {
 		// If India, add tax ID
 		params := &stripe.CheckoutSessionParams{
@@ -159,7 +264,8 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 			CancelURL:                stripe.String(config.Get("stripe_callback_domain") + "/subscriptions/cancel"),
 			LineItems: []*stripe.CheckoutSessionLineItemParams{
 				{
-					Price: stripe.String(req.Price),
+					Price:     linePrice,
+					PriceData: linePriceData,
 					// For metered billing, do not pass quantity
 					Quantity: stripe.Int64(1),
 					TaxRates: taxRate,
@@ -169,7 +275,10 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 			PaymentMethodTypes: stripe.StringSlice([]string{
 				"card",
 			}),
-			SubscriptionData: subscriptionData,
+			SubscriptionData:  subscriptionData,
+			Discounts:         discounts,
+			PaymentIntentData: paymentIntentData,
+			CustomerCreation:  customerCreation,
 
 			SuccessURL: successURL,
 		}
@@ -180,6 +289,11 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 			params.AddMetadata("product_id", req.Product)
 		}
 
+		// The affiliate who referred the buyer is recorded with the payment
+		if affiliateID > 0 {
+			params.AddMetadata("affiliate_id", strconv.FormatInt(affiliateID, 10))
+		}
+
 		s, err := stripesession.New(params)
 		if err != nil {
 			// Needed when using stripe JS
@@ -188,6 +302,22 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 						return nil*/
 			return server.InternalError(err)
 		}
+
+		if coupon != nil {
+			_, err = applyCoupon(coupon, story, "stripe", s.ID, discount, string(p.Currency))
+			if err == coupons.ErrLimitReached {
+				return server.Redirect(w, r, couponFailure(err))
+			} else if err != nil {
+				return server.InternalError(err)
+			}
+		}
+
+		// Stripe calculates the tax, the evidence of the buyer's location is recorded
+		err = recordTax(tax, 0, story.ID, "stripe", s.ID, clientCountry, "", currency)
+		if err != nil {
+			return server.InternalError(err)
+		}
+
 		// Needed when using stripe JS
 		/*		writeJSON(w, struct {
 					SessionID string `json:"sessionId"`
@@ -209,11 +339,17 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 			Mode: mode,
 			LineItems: []*stripe.CheckoutSessionLineItemParams{
 				{
-					Price: stripe.String(req.Price),
+					Price:     linePrice,
+					PriceData: linePriceData,
 					// For metered billing, do not pass quantity
 					Quantity: stripe.Int64(1),
+					TaxRates: taxRate,
 				},
 			},
+			SubscriptionData:  subscriptionData,
+			Discounts:         discounts,
+			PaymentIntentData: paymentIntentData,
+			CustomerCreation:  customerCreation,
 		}
 
 		params.AddMetadata("plan", story.NameDisplay())
@@ -222,6 +358,11 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 			params.AddMetadata("product_id", req.Product)
 		}
 
+		// The affiliate who referred the buyer is recorded with the payment
+		if affiliateID > 0 {
+			params.AddMetadata("affiliate_id", strconv.FormatInt(affiliateID, 10))
+		}
+
 		s, err := stripesession.New(params)
 		if err != nil {
 			// Needed when using stripe JS
@@ -230,6 +371,22 @@ func HandleCreateCheckoutSession(w http.ResponseWriter, r *http.Request) error {
 						return nil*/
 			return server.InternalError(err)
 		}
+
+		if coupon != nil {
+			_, err = applyCoupon(coupon, story, "stripe", s.ID, discount, string(p.Currency))
+			if err == coupons.ErrLimitReached {
+				return server.Redirect(w, r, couponFailure(err))
+			} else if err != nil {
+				return server.InternalError(err)
+			}
+		}
+
+		// Stripe calculates the tax, the evidence of the buyer's location is recorded
+		err = recordTax(tax, 0, story.ID, "stripe", s.ID, clientCountry, "", currency)
+		if err != nil {
+			return server.InternalError(err)
+		}
+
 		// Needed when using stripe JS
 		/*		writeJSON(w, struct {
 					SessionID string `json:"sessionId"`
@@ -0,0 +1,100 @@
+package subscriptions
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// errCouponSubscription is returned when using a coupon for a subscription on a gateway whose plans can't be discounted
+var errCouponSubscription = errors.New("coupon can only be used for one time payments with this payment gateway")
+
+// FindCoupon returns the coupon with the code if it can be used for the product on the gateway,
+// subscriptions are discounted only on Stripe as the plans of the other gateways have a fixed price.
+func FindCoupon(code string, product *products.Story, gateway string) (*coupons.Coupon, error) {
+	coupon, err := coupons.FindCode(code)
+	if err != nil {
+		return nil, coupons.ErrNotFound
+	}
+
+	err = coupon.Check(product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkoutType(product.Schedule) == "subscription" && gateway != "stripe" {
+		return nil, errCouponSubscription
+	}
+
+	return coupon, nil
+}
+
+// applyCoupon records the coupon as applied to the checkout with the reference at the gateway, if the payment
+// was already recorded from the gateway's webhook the coupon is redeemed for it at once.
+// coupons.ErrLimitReached is returned when the coupon's uses are taken by payments and other checkouts.
+func applyCoupon(coupon *coupons.Coupon, product *products.Story, gateway string, reference string, discount int64, currency string) (*coupons.Redemption, error) {
+	var redemption *coupons.Redemption
+
+	// The coupon is applied and redeemed for a payment recorded already in one transaction
+	err := query.Transaction(func(tx *query.Tx) error {
+		var err error
+		redemption, err = coupon.Apply(tx, product.ID, gateway, reference, discount, currency)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := FindTransactionReferenceTx(tx, reference)
+		if err != nil {
+			return nil
+		}
+
+		return redeemCoupon(tx, redemption, transaction)
+	})
+
+	return redemption, err
+}
+
+// attachCoupon moves the coupon applied to a checkout before it was paid to the reference of its payment,
+// if the payment was already recorded from the gateway's webhook the coupon is redeemed for it at once.
+func attachCoupon(redemption *coupons.Redemption, reference string) error {
+	return query.Transaction(func(tx *query.Tx) error {
+		err := redemption.Attach(tx, reference)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := FindTransactionReferenceTx(tx, reference)
+		if err != nil {
+			return nil
+		}
+
+		return redeemCoupon(tx, redemption, transaction)
+	})
+}
+
+// redeemCoupon records the coupon code and discount on the payment or subscription
+func redeemCoupon(tx *query.Tx, redemption *coupons.Redemption, transaction *Subscription) error {
+	err := transaction.UpdateTx(tx, map[string]string{
+		"coupon_code": redemption.Code,
+		"discount":    majorUnits(redemption.Discount),
+	})
+	if err != nil {
+		return err
+	}
+
+	transaction.CouponCode = redemption.Code
+	transaction.Discount = float64(redemption.Discount) / 100
+
+	log.Info(log.V{"msg": "Coupon redeemed", "code": redemption.Code, "id": transaction.ID, "pg": redemption.Gateway})
+
+	return redemption.Redeem(tx, transaction.ID)
+}
+
+// couponFailure returns the failure page explaining why the coupon couldn't be used
+func couponFailure(err error) string {
+	return "/subscriptions/failure?errorDetail=" + url.QueryEscape("The discount code can't be used, "+err.Error()+".")
+}
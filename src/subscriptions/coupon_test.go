@@ -0,0 +1,64 @@
+// Tests for coupons applied to checkouts
+package subscriptions
+
+import (
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test checkouts which haven't been paid hold the uses of a coupon with a limit until they are released
+func TestApplyCoupon(t *testing.T) {
+	openTestDatabase(t)
+
+	productID, err := products.New().Create(map[string]string{"name": "App", "license_seats": "1", "s3_bucket": "files", "s3_key": "app.zip"})
+	if err != nil {
+		t.Fatalf("coupons: error creating product %s", err)
+	}
+	product, err := products.Find(productID)
+	if err != nil {
+		t.Fatalf("coupons: error finding product %s", err)
+	}
+
+	couponParams, err := coupons.CreateParams(map[string]string{"code": "launch", "kind": "percent", "value": "10", "max_redemptions": "2"})
+	if err != nil {
+		t.Fatalf("coupons: error validating coupon %s", err)
+	}
+	couponID, err := coupons.New().Create(couponParams)
+	if err != nil {
+		t.Fatalf("coupons: error creating coupon %s", err)
+	}
+	coupon, err := coupons.Find(couponID)
+	if err != nil {
+		t.Fatalf("coupons: error finding coupon %s", err)
+	}
+
+	checkouts := []struct {
+		reference string
+		release   string
+		err       error
+	}{
+		{"sq-1", "", nil},
+		{"sq-2", "", nil},
+		{"sq-3", "", coupons.ErrLimitReached},
+		{"sq-3", "sq-1", nil},
+		{"sq-4", "", coupons.ErrLimitReached},
+	}
+
+	applied := make(map[string]*coupons.Redemption)
+	for _, c := range checkouts {
+		if c.release != "" {
+			err = applied[c.release].Release()
+			if err != nil {
+				t.Fatalf("coupons: error releasing %s %s", c.release, err)
+			}
+		}
+
+		redemption, err := applyCoupon(coupon, product, "square", c.reference, 100, "usd")
+		if err != c.err {
+			t.Fatalf("coupons: expected %v applying to %s got:%v", c.err, c.reference, err)
+		}
+		applied[c.reference] = redemption
+	}
+}
@@ -0,0 +1,85 @@
+// Helpers for the tests which need a database or config
+package subscriptions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+// openTestDatabase opens a new sqlite database with the tables and the migrations of the db folder at the root of the repo,
+// the migrations adding columns the tables have already are skipped. The database is closed when the test ends.
+func openTestDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("database: error getting working directory %s", err)
+	}
+	err = os.Chdir(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatalf("database: error changing to root directory %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("database: error opening database %s", err)
+	}
+	defer db.Close()
+
+	files, err := filepath.Glob(filepath.Join("db", "migrate", "*.up.sql"))
+	if err != nil {
+		t.Fatalf("database: error finding migrations %s", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range append([]string{filepath.Join("db", "Create-Tables.sql")}, files...) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("database: error reading %s %s", file, err)
+		}
+		_, err = db.Exec(string(b))
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			t.Fatalf("database: error migrating %s %s", file, err)
+		}
+	}
+
+	err = query.OpenDatabase(map[string]string{"adapter": "sqlite3", "db": path}, &sync.RWMutex{})
+	if err != nil {
+		t.Fatalf("database: error opening database %s", err)
+	}
+	t.Cleanup(func() { query.CloseDatabase() })
+}
+
+// setTestConfig makes the values the current config until the test ends
+func setTestConfig(t *testing.T, values map[string]string) {
+	b, err := json.Marshal(map[string]map[string]string{"development": values, "production": values, "test": values})
+	if err != nil {
+		t.Fatalf("config: error writing config %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fragmenta.json")
+	err = os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatalf("config: error writing config %s", err)
+	}
+
+	c := config.New()
+	err = c.Load(path)
+	if err != nil {
+		t.Fatalf("config: error loading config %s", err)
+	}
+
+	current := config.Current
+	config.Current = c
+	t.Cleanup(func() { config.Current = current })
+}
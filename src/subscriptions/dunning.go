@@ -0,0 +1,470 @@
+package subscriptions
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mail"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/razorpay/razorpay-go"
+	"github.com/stripe/stripe-go/v72"
+	portalsession "github.com/stripe/stripe-go/v72/billingportal/session"
+)
+
+const (
+	// DunningsTableName is the database table of the failed payments of subscriptions being recovered
+	DunningsTableName = "dunnings"
+
+	// DunningOpen is a failed payment which is being retried by the gateway while the customer is reminded
+	DunningOpen = "open"
+	// DunningRecovered is a failed payment recovered by a later charge
+	DunningRecovered = "recovered"
+	// DunningLost is a failed payment which wasn't recovered, the subscription ended or its grace period ran out
+	DunningLost = "lost"
+
+	// DefaultDunningReminderDays are the days after a payment failed the customer is reminded on
+	// when dunning_reminder_days is not set
+	DefaultDunningReminderDays = "0,3,6"
+	// DefaultDunningGraceDays is how many days after a payment failed the subscriber keeps access
+	// when dunning_grace_days is not set
+	DefaultDunningGraceDays = 7
+)
+
+// dunningWorker makes sure only one worker is reminding customers at a time
+var dunningWorker sync.Mutex
+
+// Dunning is a failed payment of a subscription, it is open while the customer is reminded to update their
+// payment method and closed as recovered when a later charge succeeds or as lost when the grace period ends
+type Dunning struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// TransactionID is the subscription in the subscriptions table
+	TransactionID int64
+	ProductID     int64
+	Gateway       string
+	Status        string
+	// Amount is the payment which failed in the smallest currency unit
+	Amount      int64
+	Currency    string
+	Reminders   int64
+	RemindedAt  time.Time
+	GraceEndsAt time.Time
+	ClosedAt    time.Time
+}
+
+// NewDunning creates and initialises a new dunning instance.
+func NewDunning() *Dunning {
+	dunning := &Dunning{}
+	dunning.CreatedAt = time.Now()
+	dunning.UpdatedAt = time.Now()
+	dunning.TableName = DunningsTableName
+	dunning.KeyName = KeyName
+	return dunning
+}
+
+// NewDunningWithColumns creates a new dunning instance and fills it with data from the database cols provided.
+func NewDunningWithColumns(cols map[string]interface{}) *Dunning {
+	dunning := NewDunning()
+	dunning.ID = resource.ValidateInt(cols["id"])
+	dunning.CreatedAt = resource.ValidateTime(cols["created_at"])
+	dunning.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	dunning.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	dunning.ProductID = resource.ValidateInt(cols["product_id"])
+	dunning.Gateway = resource.ValidateString(cols["pg"])
+	dunning.Status = resource.ValidateString(cols["status"])
+	dunning.Amount = resource.ValidateInt(cols["amount"])
+	dunning.Currency = resource.ValidateString(cols["currency"])
+	dunning.Reminders = resource.ValidateInt(cols["reminders"])
+	dunning.RemindedAt = resource.ValidateTime(cols["reminded_at"])
+	dunning.GraceEndsAt = resource.ValidateTime(cols["grace_ends_at"])
+	dunning.ClosedAt = resource.ValidateTime(cols["closed_at"])
+	return dunning
+}
+
+// AmountDisplay returns the payment which failed with its currency like 10.50 USD
+func (d *Dunning) AmountDisplay() string {
+	return majorUnits(d.Amount) + " " + strings.ToUpper(d.Currency)
+}
+
+// FindOpenDunning fetches the open dunning of the subscription in the subscriptions table in the transaction.
+func FindOpenDunning(tx *query.Tx, transactionID int64) (*Dunning, error) {
+	result, err := DunningsQueryTx(tx).Where("transaction_id=?", transactionID).Where("status=?", DunningOpen).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewDunningWithColumns(result), nil
+}
+
+// FindAllDunnings fetches all dunning records matching this query from the database.
+func FindAllDunnings(q *query.Query) ([]*Dunning, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var dunnings []*Dunning
+	for _, cols := range results {
+		dunnings = append(dunnings, NewDunningWithColumns(cols))
+	}
+
+	return dunnings, nil
+}
+
+// DunningsQuery returns a new query for dunnings with a default order.
+func DunningsQuery() *query.Query {
+	return DunningsQueryTx(nil)
+}
+
+// DunningsQueryTx returns a new query for dunnings with a default order in the transaction.
+func DunningsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(DunningsTableName, KeyName).Order("id desc")
+}
+
+// dunningReminderDays returns the days after a payment failed the customer is reminded on in order
+func dunningReminderDays() []int {
+	value := config.Get("dunning_reminder_days")
+	if value == "" {
+		value = DefaultDunningReminderDays
+	}
+
+	var days []int
+	for _, day := range strings.Split(value, ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(day))
+		if err != nil || d < 0 {
+			continue
+		}
+		if len(days) > 0 && d <= days[len(days)-1] {
+			continue
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+// dunningGraceDays returns how many days after a payment failed the subscriber keeps access
+func dunningGraceDays() int {
+	days := config.GetInt("dunning_grace_days")
+	if days <= 0 {
+		return DefaultDunningGraceDays
+	}
+	return int(days)
+}
+
+// reminderDue reports whether the next reminder of the dunning is due at the given time
+func (d *Dunning) reminderDue(days []int, now time.Time) bool {
+	if d.Reminders >= int64(len(days)) {
+		return false
+	}
+	return !now.Before(d.CreatedAt.AddDate(0, 0, days[d.Reminders]))
+}
+
+// dunningChanged opens a dunning when a payment of the subscription failed and closes it when the subscription
+// leaves past due, as recovered when a later charge succeeded and as lost otherwise. It returns the product's webhook.
+func dunningChanged(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story, from string) ([]func(), error) {
+	if subscription.SubscriptionId == "" {
+		return nil, nil
+	}
+
+	data := WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Status:         subscription.State,
+		Email:          subscription.CustomerEmail,
+	}
+
+	var eventType string
+	switch {
+	case subscription.State == StatePastDue:
+		err := startDunning(tx, event, subscription)
+		if err != nil {
+			return nil, err
+		}
+		eventType = WebhookPaymentFailed
+	case from == StatePastDue:
+		status := DunningLost
+		if subscription.State == StateActive {
+			status = DunningRecovered
+			eventType = WebhookSubscriptionUpdated
+		}
+		err := closeDunning(tx, subscription, status)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if eventType == "" || product == nil {
+		return nil, nil
+	}
+
+	return []func(){
+		func() { sendProductWebhook(product, eventType, data) },
+	}, nil
+}
+
+// startDunning records the failed payment of the subscription with the end of its grace period
+func startDunning(tx *query.Tx, event *PaymentEvent, subscription *Subscription) error {
+	_, err := FindOpenDunning(tx, subscription.ID)
+	if err == nil {
+		return nil
+	}
+
+	// Not every gateway reports the amount which failed, the subscription is charged its first payment again
+	amount := event.Amount
+	if amount <= 0 {
+		amount = int64(math.Round(subscription.Amount * 100))
+	}
+	currency := event.Currency
+	if currency == "" {
+		currency = subscription.Currency
+	}
+
+	dunningParams := make(map[string]string)
+	dunningParams["transaction_id"] = strconv.FormatInt(subscription.ID, 10)
+	dunningParams["product_id"] = strconv.FormatInt(subscription.ProductId, 10)
+	dunningParams["pg"] = subscription.PaymentGateway
+	dunningParams["status"] = DunningOpen
+	dunningParams["amount"] = strconv.FormatInt(amount, 10)
+	dunningParams["currency"] = strings.ToUpper(currency)
+	dunningParams["grace_ends_at"] = query.TimeString(time.Now().UTC().AddDate(0, 0, dunningGraceDays()))
+
+	_, err = NewDunning().CreateTx(tx, dunningParams)
+	if err != nil {
+		log.Error(log.V{"Payment event, error recording failed payment": err, "id": subscription.ID})
+		return err
+	}
+
+	log.Info(log.V{"msg": "Payment event, dunning started", "id": subscription.ID, "amount": amount})
+
+	return nil
+}
+
+// closeDunning closes the open dunning of the subscription with the status in the transaction, if it has one
+func closeDunning(tx *query.Tx, subscription *Subscription, status string) error {
+	dunning, err := FindOpenDunning(tx, subscription.ID)
+	if err != nil {
+		return nil
+	}
+
+	err = dunning.UpdateTx(tx, map[string]string{
+		"status":    status,
+		"closed_at": query.TimeString(time.Now().UTC()),
+	})
+	if err != nil {
+		log.Error(log.V{"Dunning, error closing dunning": err, "id": subscription.ID})
+		return err
+	}
+
+	log.Info(log.V{"msg": "Dunning closed", "id": subscription.ID, "status": status})
+
+	return nil
+}
+
+// RemindDunning emails the customers whose subscription payment failed on each of dunning_reminder_days
+// after the failure and ends the subscriptions whose grace period of dunning_grace_days ran out,
+// it is run by the scheduler.
+func RemindDunning() {
+	if !dunningWorker.TryLock() {
+		return
+	}
+	defer dunningWorker.Unlock()
+
+	dunnings, err := FindAllDunnings(DunningsQuery().Where("status=?", DunningOpen).Order("id asc"))
+	if err != nil {
+		log.Error(log.V{"RemindDunning, Error fetching dunnings": err})
+		return
+	}
+
+	days := dunningReminderDays()
+	now := time.Now().UTC()
+	for _, dunning := range dunnings {
+		subscription, err := FindFirst("id=?", dunning.TransactionID)
+		if err != nil {
+			log.Error(log.V{"RemindDunning, Error finding subscription": err, "id": dunning.TransactionID})
+			continue
+		}
+
+		product, err := products.Find(subscription.ProductId)
+		if err != nil {
+			log.Error(log.V{"RemindDunning, Error finding product": err, "id": subscription.ID})
+			continue
+		}
+
+		// A dunning left open by a subscription which isn't past due any more is closed
+		if subscription.State != StatePastDue {
+			status := DunningLost
+			if subscription.State == StateActive {
+				status = DunningRecovered
+			}
+			closeDunning(nil, subscription, status)
+			continue
+		}
+
+		if !now.Before(dunning.GraceEndsAt) {
+			expireDunning(subscription, product)
+			continue
+		}
+
+		if !dunning.reminderDue(days, now) {
+			continue
+		}
+
+		// The reminder is recorded first so a customer is never emailed twice
+		err = dunning.Update(map[string]string{
+			"reminders":   strconv.FormatInt(dunning.Reminders+1, 10),
+			"reminded_at": query.TimeString(now),
+		})
+		if err != nil {
+			log.Error(log.V{"RemindDunning, Error recording reminder": err, "id": subscription.ID})
+			continue
+		}
+
+		sendDunningReminder(dunning, subscription, product)
+	}
+}
+
+// expireDunning moves the subscription whose grace period ran out without the payment being recovered to unpaid,
+// the subscriber loses access until a later charge succeeds while the gateway keeps retrying or ends the subscription
+// by its own rules. The subscription is also cancelled at the gateway when dunning_cancel_at_gateway is set.
+func expireDunning(subscription *Subscription, product *products.Story) {
+	var effects []func()
+	err := query.Transaction(func(tx *query.Tx) error {
+		// The gateway may have recovered or ended the subscription already
+		current, err := FindFirstTx(tx, "id=?", subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		previousState := current.State
+		unpaid, err := current.Transition(tx, StateUnpaid, nil)
+		if err != nil {
+			return err
+		}
+
+		err = closeDunning(tx, current, DunningLost)
+		if err != nil {
+			return err
+		}
+
+		if unpaid {
+			effects, err = pauseChanged(tx, current, product, previousState)
+		}
+		return err
+	})
+	if err != nil {
+		log.Error(log.V{"RemindDunning, Error suspending subscription": err, "id": subscription.ID})
+		return
+	}
+
+	log.Info(log.V{"msg": "RemindDunning, grace period ended", "id": subscription.ID, "pg": subscription.PaymentGateway})
+
+	for _, effect := range effects {
+		effect()
+	}
+
+	if !config.GetBool("dunning_cancel_at_gateway") {
+		return
+	}
+
+	// The subscription ends once the gateway's webhook reports it cancelled
+	gateway, err := FindGateway(subscription.PaymentGateway)
+	if err != nil {
+		log.Error(log.V{"RemindDunning, Error finding payment gateway": err, "id": subscription.ID})
+		return
+	}
+
+	err = gateway.Cancel(subscription.SubscriptionId)
+	if err != nil {
+		log.Error(log.V{"RemindDunning, Error cancelling subscription": err, "id": subscription.ID, "pg": gateway.Name()})
+	}
+}
+
+// sendDunningReminder emails the customer to update their payment method before the grace period ends
+func sendDunningReminder(dunning *Dunning, subscription *Subscription, product *products.Story) {
+	if subscription.CustomerEmail == "" {
+		return
+	}
+
+	email := mail.New(subscription.CustomerEmail)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your payment for " + product.Name + " failed"
+	email.Template = "subscriptions/views/dunning.html.got"
+
+	context := mail.Context{
+		"name":      config.Get("name"),
+		"product":   product.Name,
+		"firstName": subscription.FirstName,
+		"amount":    dunning.AmountDisplay(),
+		"graceEnds": dunning.GraceEndsAt.Format(time.RFC1123),
+		"portalURL": config.Get("root_url") + "/customers",
+	}
+
+	err := mail.Send(email, context)
+	if err != nil {
+		log.Error(log.V{"RemindDunning, Error sending reminder": err, "id": subscription.ID})
+	}
+}
+
+// Unpaid reports whether this is a subscription whose grace period ran out without its failed payment being recovered
+func (s *Subscription) Unpaid() bool {
+	return s.State == StateUnpaid
+}
+
+// PaymentUpdatable reports whether the customer can update the payment method of the past due or unpaid subscription
+// at its gateway, Square has no page for the customer to do it
+func (s *Subscription) PaymentUpdatable() bool {
+	if s.SubscriptionId == "" || (s.State != StatePastDue && !s.Unpaid()) {
+		return false
+	}
+	switch s.PaymentGateway {
+	case "stripe", "paypal", "razorpay":
+		return true
+	}
+	return false
+}
+
+// PaymentUpdateURL returns the page of the gateway where the customer updates the payment method of the subscription,
+// the customer comes back to returnURL from Stripe
+func PaymentUpdateURL(subscription *Subscription, returnURL string) (string, error) {
+	switch subscription.PaymentGateway {
+	case "stripe":
+		stripe.Key = config.Get("stripe_secret")
+
+		params := &stripe.BillingPortalSessionParams{
+			Customer:  stripe.String(subscription.CustomerId),
+			ReturnURL: stripe.String(returnURL),
+		}
+		ps, err := portalsession.New(params)
+		if err != nil {
+			return "", err
+		}
+		return ps.URL, nil
+	case "paypal":
+		// PayPal subscribers change the funding of their subscriptions in their account
+		if strings.Contains(config.Get("paypal_api_domain"), "sandbox") {
+			return "https://www.sandbox.paypal.com/myaccount/autopay/", nil
+		}
+		return "https://www.paypal.com/myaccount/autopay/", nil
+	case "razorpay":
+		client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+		body, err := client.Subscription.Fetch(subscription.SubscriptionId, nil, nil)
+		if err != nil {
+			return "", err
+		}
+		shortURL, _ := body["short_url"].(string)
+		if shortURL == "" {
+			return "", errors.New("razorpay subscription has no link to update the payment method")
+		}
+		return shortURL, nil
+	}
+
+	return "", errors.New("the payment method can't be updated at " + subscription.PaymentGateway)
+}
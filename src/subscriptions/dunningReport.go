@@ -0,0 +1,82 @@
+package subscriptions
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+)
+
+// DunningReportRow is the total of the failed payments of subscriptions in a period for a currency,
+// the amounts are in the smallest currency unit
+type DunningReportRow struct {
+	Currency  string
+	Failed    int64
+	Open      int64
+	Recovered int64
+	Lost      int64
+	// The amounts of the failed payments still being recovered, recovered by a later charge and lost
+	OpenAmount      int64
+	RecoveredAmount int64
+	LostAmount      int64
+}
+
+// Amounts returns the open, recovered and lost amounts as decimal amounts like 10.50
+func (r *DunningReportRow) Amounts() []string {
+	return []string{majorUnits(r.OpenAmount), majorUnits(r.RecoveredAmount), majorUnits(r.LostAmount)}
+}
+
+// RecoveryRate returns the percentage of the closed failed payments which were recovered like 75%
+func (r *DunningReportRow) RecoveryRate() string {
+	closed := r.Recovered + r.Lost
+	if closed == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(r.Recovered*100/closed, 10) + "%"
+}
+
+// DunningReport totals the payments of subscriptions which failed from the start of the period until its end
+// by currency, with the revenue recovered by later charges and lost when the subscriptions ended.
+func DunningReport(from time.Time, to time.Time) ([]*DunningReportRow, error) {
+	q := DunningsQuery().Where("created_at >= ?", query.TimeString(from.UTC())).Where("created_at < ?", query.TimeString(to.UTC()))
+	dunnings, err := FindAllDunnings(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[string]*DunningReportRow)
+	for _, dunning := range dunnings {
+		currency := strings.ToUpper(dunning.Currency)
+
+		row, ok := rows[currency]
+		if !ok {
+			row = &DunningReportRow{Currency: currency}
+			rows[currency] = row
+		}
+
+		row.Failed++
+		switch dunning.Status {
+		case DunningOpen:
+			row.Open++
+			row.OpenAmount += dunning.Amount
+		case DunningRecovered:
+			row.Recovered++
+			row.RecoveredAmount += dunning.Amount
+		case DunningLost:
+			row.Lost++
+			row.LostAmount += dunning.Amount
+		}
+	}
+
+	var report []*DunningReportRow
+	for _, row := range rows {
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Currency < report[j].Currency
+	})
+
+	return report, nil
+}
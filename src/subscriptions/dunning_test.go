@@ -0,0 +1,146 @@
+// Tests for the dunning of the failed payments of subscriptions
+package subscriptions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test the reminder days are read in order from the default when none are configured
+func TestDunningReminderDays(t *testing.T) {
+	days := dunningReminderDays()
+	if !reflect.DeepEqual(days, []int{0, 3, 6}) {
+		t.Fatalf("dunning: expected default reminder days got:%v", days)
+	}
+
+	if grace := dunningGraceDays(); grace != DefaultDunningGraceDays {
+		t.Fatalf("dunning: expected default grace days got:%d", grace)
+	}
+}
+
+// Test each reminder is due on its day after the payment failed and none after the last
+func TestDunningReminderDue(t *testing.T) {
+	days := []int{0, 3, 6}
+	failed := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	dunning := NewDunning()
+	dunning.CreatedAt = failed
+
+	if !dunning.reminderDue(days, failed) {
+		t.Fatalf("dunning: expected first reminder due when the payment failed")
+	}
+
+	dunning.Reminders = 1
+	if dunning.reminderDue(days, failed.AddDate(0, 0, 2)) {
+		t.Fatalf("dunning: expected second reminder not due before its day")
+	}
+	if !dunning.reminderDue(days, failed.AddDate(0, 0, 3)) {
+		t.Fatalf("dunning: expected second reminder due on its day")
+	}
+
+	dunning.Reminders = 3
+	if dunning.reminderDue(days, failed.AddDate(0, 0, 30)) {
+		t.Fatalf("dunning: expected no reminder after the last")
+	}
+}
+
+// Test the recovery rate is of the closed failed payments only
+func TestDunningRecoveryRate(t *testing.T) {
+	row := &DunningReportRow{Currency: "USD", Failed: 5, Open: 1, Recovered: 3, Lost: 1, OpenAmount: 1000, RecoveredAmount: 3050, LostAmount: 1000}
+	if rate := row.RecoveryRate(); rate != "75%" {
+		t.Fatalf("dunning: expected recovery rate 75%% got:%s", rate)
+	}
+	if amounts := row.Amounts(); !reflect.DeepEqual(amounts, []string{"10.00", "30.50", "10.00"}) {
+		t.Fatalf("dunning: expected amounts got:%v", amounts)
+	}
+
+	row = &DunningReportRow{Currency: "USD", Failed: 1, Open: 1}
+	if rate := row.RecoveryRate(); rate != "-" {
+		t.Fatalf("dunning: expected no recovery rate while open got:%s", rate)
+	}
+}
+
+// Test a subscription whose grace period runs out is unpaid with its access suspended and isn't cancelled at the gateway,
+// and that its access is reinstated when a later charge succeeds
+func TestExpireDunning(t *testing.T) {
+	openTestDatabase(t)
+
+	fake := NewFakeGateway("secret")
+	RegisterGateway(fake)
+
+	productID, err := products.New().Create(map[string]string{"name": "Monthly", "schedule": "monthly", "license_seats": "1", "s3_bucket": "files", "s3_key": "app.zip"})
+	if err != nil {
+		t.Fatalf("dunning: error creating product %s", err)
+	}
+
+	for _, event := range []*PaymentEvent{
+		{ID: "evt_1", Gateway: fake.Name(), Type: WebhookSubscriptionActivated, ProductID: productID, SubscriptionID: "sub_dunning", Amount: 1000, Currency: "usd", Status: "active"},
+		{ID: "evt_2", Gateway: fake.Name(), Type: WebhookPaymentFailed, SubscriptionID: "sub_dunning", Amount: 1000, Status: "past_due"},
+	} {
+		event.Created = time.Now()
+		err = ProcessPaymentEvent(event)
+		if err != nil {
+			t.Fatalf("dunning: error processing %s %s", event.ID, err)
+		}
+	}
+
+	subscription, err := FindSubscription("sub_dunning")
+	if err != nil {
+		t.Fatalf("dunning: error finding subscription %s", err)
+	}
+
+	dunning, err := FindOpenDunning(nil, subscription.ID)
+	if err != nil {
+		t.Fatalf("dunning: expected open dunning got:%s", err)
+	}
+	err = dunning.Update(map[string]string{"grace_ends_at": query.TimeString(time.Now().UTC().Add(-time.Hour))})
+	if err != nil {
+		t.Fatalf("dunning: error ending grace period %s", err)
+	}
+
+	RemindDunning()
+
+	subscription, err = FindSubscription("sub_dunning")
+	if err != nil || !subscription.Unpaid() || subscription.Subscribed() {
+		t.Fatalf("dunning: expected unpaid subscription after grace period got:%v %v", subscription, err)
+	}
+	if cancelled := fake.Cancelled(); len(cancelled) != 0 {
+		t.Fatalf("dunning: expected subscription not to be cancelled at the gateway got:%v", cancelled)
+	}
+	if _, err = FindOpenDunning(nil, subscription.ID); err == nil {
+		t.Fatalf("dunning: expected dunning to be closed after grace period")
+	}
+
+	license, err := licenses.FindTransaction(subscription.ID)
+	if err != nil || license.Status != licenses.StatusSuspended {
+		t.Fatalf("dunning: expected suspended license got:%v %v", license, err)
+	}
+	download, err := downloads.FindTransaction(subscription.ID)
+	if err != nil || download.Check() != downloads.ErrSuspended {
+		t.Fatalf("dunning: expected suspended download link got:%v %v", download, err)
+	}
+
+	err = ProcessPaymentEvent(&PaymentEvent{ID: "evt_3", Gateway: fake.Name(), Type: WebhookPaymentSucceeded, SubscriptionID: "sub_dunning", Amount: 1000, Currency: "usd", Status: "active", Created: time.Now()})
+	if err != nil {
+		t.Fatalf("dunning: error processing payment %s", err)
+	}
+
+	subscription, err = FindSubscription("sub_dunning")
+	if err != nil || subscription.State != StateActive {
+		t.Fatalf("dunning: expected active subscription after payment got:%v %v", subscription, err)
+	}
+	license, err = licenses.FindTransaction(subscription.ID)
+	if err != nil || !license.Active() {
+		t.Fatalf("dunning: expected license to be reinstated got:%v %v", license, err)
+	}
+	download, err = downloads.FindTransaction(subscription.ID)
+	if err != nil || download.Check() != nil {
+		t.Fatalf("dunning: expected download link to be reinstated got:%v %v", download, err)
+	}
+}
@@ -0,0 +1,135 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/webhook"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// FakeGateway is an offline Gateway for tests, register it with RegisterGateway.
+// Its webhooks are PaymentEvents as JSON signed with Secret in the X-OPH-Signature header,
+// and it records the subscriptions cancelled and the payments refunded.
+type FakeGateway struct {
+	// Secret signs the webhooks sent to the gateway
+	Secret string
+	// Prices are the product prices by country
+	Prices map[string]int64
+
+	mutex     sync.Mutex
+	cancelled []string
+	refunds   map[string]int64
+}
+
+// NewFakeGateway returns a fake gateway which verifies webhooks with secret.
+func NewFakeGateway(secret string) *FakeGateway {
+	return &FakeGateway{
+		Secret:  secret,
+		Prices:  make(map[string]int64),
+		refunds: make(map[string]int64),
+	}
+}
+
+// Name returns the name of the gateway
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+// Enabled is always true for the fake gateway
+func (g *FakeGateway) Enabled() bool {
+	return true
+}
+
+// HasPrice reports whether a price is set for the country
+func (g *FakeGateway) HasPrice(product *products.Story, country string) bool {
+	_, ok := g.Prices[country]
+	return ok
+}
+
+// Checkout returns the price for the country and a link to the fake checkout
+func (g *FakeGateway) Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error) {
+	amount, ok := g.Prices[country]
+	if !ok {
+		return nil, errors.New("Invalid price details for client country: " + country)
+	}
+
+	return &Checkout{
+		Type:     checkoutType(product.Schedule),
+		Price:    fmt.Sprintf("%d fake/%s", amount, scheduleLabel(product.Schedule)),
+		Amount:   amount,
+		Currency: "fake",
+		Link:     fmt.Sprintf("/subscriptions/fake?product_id=%d&custom_id=%s", product.ID, customID),
+	}, nil
+}
+
+// VerifyWebhook checks the request is signed with the gateway's secret
+func (g *FakeGateway) VerifyWebhook(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = webhook.Verify(b, r.Header.Get(webhook.SignatureHeader), g.Secret, webhook.DefaultTolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// NormaliseEvent unmarshals the PaymentEvent sent to the gateway
+func (g *FakeGateway) NormaliseEvent(body []byte) (*PaymentEvent, error) {
+	var paymentEvent PaymentEvent
+	err := json.Unmarshal(body, &paymentEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	if paymentEvent.Type == "" {
+		return nil, nil
+	}
+
+	paymentEvent.Gateway = g.Name()
+
+	return &paymentEvent, nil
+}
+
+// Cancel records the subscription as cancelled
+func (g *FakeGateway) Cancel(subscriptionID string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.cancelled = append(g.cancelled, subscriptionID)
+	return nil
+}
+
+// Refund records the amount refunded for the payment
+func (g *FakeGateway) Refund(paymentID string, amount int64, currency string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.refunds[paymentID] += amount
+	return nil
+}
+
+// Cancelled returns the subscriptions cancelled at the gateway
+func (g *FakeGateway) Cancelled() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return append([]string(nil), g.cancelled...)
+}
+
+// Refunded returns the amount refunded for the payment, a full refund is recorded as 0
+func (g *FakeGateway) Refunded(paymentID string) (int64, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	amount, ok := g.refunds[paymentID]
+	return amount, ok
+}
@@ -0,0 +1,190 @@
+package subscriptions
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// DefaultCountry is the price used when no price is set for the client's country
+const DefaultCountry = "DF"
+
+// Gateway is implemented by each payment gateway adapter, adding a gateway means
+// implementing this interface and registering it with RegisterGateway.
+type Gateway interface {
+	// Name is the value stored in the pg column of the subscriptions table
+	Name() string
+
+	// Enabled reports whether the gateway is switched on and configured
+	Enabled() bool
+
+	// HasPrice reports whether the product has a price for the country on this gateway
+	HasPrice(product *products.Story, country string) bool
+
+	// Checkout returns the price and payment link shown on the product page
+	Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error)
+
+	// VerifyWebhook checks the request came from the gateway and returns its body
+	VerifyWebhook(r *http.Request) ([]byte, error)
+
+	// NormaliseEvent converts a verified webhook body into a PaymentEvent,
+	// it returns nil for events which are not handled.
+	NormaliseEvent(body []byte) (*PaymentEvent, error)
+
+	// Cancel cancels the subscription at the gateway
+	Cancel(subscriptionID string) error
+
+	// Refund refunds the payment, amount is in the smallest currency unit and 0 refunds in full
+	Refund(paymentID string, amount int64, currency string) error
+}
+
+// Checkout is the price of a product on a gateway for the product page
+type Checkout struct {
+	// Type is onetime or subscription
+	Type string
+	// Price is the label shown to the customer e.g. 10 usd/Monthly
+	Price string
+	// PriceID is the price id at the gateway if it has one
+	PriceID string
+	// Amount and Currency are passed to the checkout form of the gateway
+	Amount   interface{}
+	Currency interface{}
+	// Link is the checkout page of the gateway if it has one
+	Link string
+	// UnitAmount is the price in the smallest currency unit if it is known
+	UnitAmount int64
+	// Pay is the amount chosen by the buyer of a pay what you want product in the smallest currency unit
+	Pay int64
+}
+
+// PaymentEvent is a gateway webhook normalised into a common shape
+type PaymentEvent struct {
+	// ID is the id of the event at the gateway
+	ID string
+	// Gateway is the Name of the gateway which sent the event
+	Gateway string
+	// Type is one of the Webhook event types e.g. WebhookPaymentSucceeded
+	Type string
+
+	ProductID      int64
+	PlanID         string
+	SubscriptionID string
+	PaymentID      string
+	// OrderID is the order the payment was made for, if the gateway has orders
+	OrderID   string
+	ReceiptID string
+	// RefundID is the id of the refund or dispute at the gateway
+	RefundID      string
+	CustomerID    string
+	CustomerEmail string
+	CustomerName  string
+	CustomID      string
+	// AffiliateID is the affiliate who referred the buyer, carried through the metadata of the payment
+	AffiliateID int64
+	// Amount, Tax and Fee are in the smallest currency unit
+	Amount   int64
+	Tax      int64
+	Fee      int64
+	Currency string
+	// AmountRefunded is the total refunded of the payment, for gateways which report it with a refund
+	AmountRefunded int64
+	// Reason is the reason given for a refund or dispute
+	Reason string
+	// Status is the status reported by the gateway
+	Status  string
+	Created time.Time
+
+	// The address is only collected by some gateways
+	AddressStreet string
+	AddressCity   string
+	AddressState  string
+	AddressZip    string
+	// AddressCountry is the ISO 3166-1 alpha-2 code of the billing country
+	AddressCountry string
+}
+
+var (
+	gatewaysMutex sync.RWMutex
+	// gateways is in order of preference when a product has prices on more than one gateway
+	gateways = []Gateway{&StripeGateway{}, &SquareGateway{}, &PaypalGateway{}, &RazorpayGateway{}}
+)
+
+// RegisterGateway adds the gateway to the registry, replacing any gateway with the same name.
+func RegisterGateway(gateway Gateway) {
+	gatewaysMutex.Lock()
+	defer gatewaysMutex.Unlock()
+
+	for i, g := range gateways {
+		if g.Name() == gateway.Name() {
+			gateways[i] = gateway
+			return
+		}
+	}
+	gateways = append(gateways, gateway)
+}
+
+// Gateways returns the registered gateways in order of preference.
+func Gateways() []Gateway {
+	gatewaysMutex.RLock()
+	defer gatewaysMutex.RUnlock()
+
+	return append([]Gateway(nil), gateways...)
+}
+
+// FindGateway returns the registered gateway with the given name.
+func FindGateway(name string) (Gateway, error) {
+	for _, g := range Gateways() {
+		if g.Name() == name {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown payment gateway: %s", name)
+}
+
+// GatewayForProduct returns the first gateway with a price for the country, falling back to
+// the first gateway with a default price, along with the country of the price found.
+func GatewayForProduct(product *products.Story, country string) (Gateway, string) {
+	for _, c := range []string{country, DefaultCountry} {
+		for _, g := range Gateways() {
+			if g.HasPrice(product, c) {
+				log.Info(log.V{"msg": "Using price from payment gateway", "pg": g.Name(), "country": c})
+				return g, c
+			}
+		}
+	}
+	return nil, country
+}
+
+// scheduleLabel returns the label shown after the price for the product's schedule
+func scheduleLabel(schedule string) string {
+	switch schedule {
+	case "monthly":
+		return "Monthly"
+	case "yearly":
+		return "Year"
+	}
+	return "One Time"
+}
+
+// checkoutType returns onetime or subscription for the product's schedule
+func checkoutType(schedule string) string {
+	if schedule == "monthly" || schedule == "yearly" {
+		return "subscription"
+	}
+	return "onetime"
+}
+
+// minorUnits converts a decimal amount like 10.50 into the smallest currency unit
+func minorUnits(amount string) int64 {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(value * 100))
+}
@@ -0,0 +1,173 @@
+// Tests for the payment gateways
+package subscriptions
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/webhook"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test a gateway is chosen by client country before the default price
+func TestGatewayForProduct(t *testing.T) {
+	product := products.New()
+	product.StripePrice = map[string]string{"DF": "price_default"}
+	product.RazorpayPrice = map[string]map[string]interface{}{"IN": {"amount": 100.0, "currency": "INR"}}
+
+	gateway, country := GatewayForProduct(product, "IN")
+	if gateway == nil || gateway.Name() != "razorpay" || country != "IN" {
+		t.Fatalf("gateways: expected razorpay for IN got:%v %s", gateway, country)
+	}
+
+	gateway, country = GatewayForProduct(product, "US")
+	if gateway == nil || gateway.Name() != "stripe" || country != DefaultCountry {
+		t.Fatalf("gateways: expected stripe default price for US got:%v %s", gateway, country)
+	}
+
+	gateway, _ = GatewayForProduct(products.New(), "US")
+	if gateway != nil {
+		t.Fatalf("gateways: expected no gateway for product without prices got:%s", gateway.Name())
+	}
+}
+
+// Test the fake gateway verifies, normalises and records its calls
+func TestFakeGateway(t *testing.T) {
+	fake := NewFakeGateway("secret")
+	RegisterGateway(fake)
+
+	gateway, err := FindGateway("fake")
+	if err != nil {
+		t.Fatalf("gateways: fake gateway not registered: %s", err)
+	}
+
+	body, _ := json.Marshal(PaymentEvent{ID: "evt_1", Type: WebhookPaymentSucceeded, ProductID: 1, PaymentID: "pay_1", Amount: 500})
+
+	r := httptest.NewRequest("POST", "/subscriptions/fake/webhook", bytes.NewReader(body))
+	r.Header.Set(webhook.SignatureHeader, webhook.Sign(body, "secret", time.Now()))
+
+	b, err := gateway.VerifyWebhook(r)
+	if err != nil {
+		t.Fatalf("gateways: fake webhook not verified: %s", err)
+	}
+
+	event, err := gateway.NormaliseEvent(b)
+	if err != nil || event == nil {
+		t.Fatalf("gateways: fake webhook not normalised: %v %s", event, err)
+	}
+	if event.Gateway != "fake" || event.PaymentID != "pay_1" || event.Amount != 500 {
+		t.Fatalf("gateways: fake webhook normalised incorrectly: %+v", event)
+	}
+
+	r = httptest.NewRequest("POST", "/subscriptions/fake/webhook", bytes.NewReader(body))
+	r.Header.Set(webhook.SignatureHeader, webhook.Sign(body, "wrong", time.Now()))
+	if _, err = gateway.VerifyWebhook(r); err == nil {
+		t.Fatalf("gateways: fake webhook verified with wrong secret")
+	}
+
+	gateway.Cancel("sub_1")
+	gateway.Refund("pay_1", 200, "usd")
+
+	if cancelled := fake.Cancelled(); len(cancelled) != 1 || cancelled[0] != "sub_1" {
+		t.Fatalf("gateways: fake cancel not recorded: %v", cancelled)
+	}
+	if amount, ok := fake.Refunded("pay_1"); !ok || amount != 200 {
+		t.Fatalf("gateways: fake refund not recorded: %d", amount)
+	}
+}
+
+// Test gateway events are normalised
+func TestNormaliseEvent(t *testing.T) {
+	stripeBody := []byte(`{"id":"evt_s","type":"checkout.session.completed","data":{"object":{"mode":"subscription","subscription":"sub_s","amount_total":1000,"currency":"usd","customer_details":{"email":"a@example.com","address":{"country":"DE"}},"metadata":{"product_id":"7","user_id":"u1","affiliate_id":"4"}}}}`)
+	event, err := (&StripeGateway{}).NormaliseEvent(stripeBody)
+	if err != nil || event == nil || event.Type != WebhookSubscriptionActivated || event.ProductID != 7 || event.SubscriptionID != "sub_s" || event.CustomID != "u1" || event.Amount != 1000 || event.AddressCountry != "DE" || event.AffiliateID != 4 {
+		t.Fatalf("gateways: stripe event normalised incorrectly: %+v %v", event, err)
+	}
+
+	squareBody := []byte(`{"type":"payment.updated","event_id":"evt_q","data":{"object":{"payment":{"id":"pay_q","status":"COMPLETED","reference_id":"Product Id: 3","note":"Affiliate Id: 5","total_money":{"amount":250,"currency":"USD"},"buyer_email_address":"q@example.com","billing_address":{"first_name":"Q","country":"US"}}}}}`)
+	event, err = (&SquareGateway{}).NormaliseEvent(squareBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentSucceeded || event.ProductID != 3 || event.PaymentID != "pay_q" || event.Amount != 250 ||
+		event.CustomerEmail != "q@example.com" || event.CustomerName != "Q" || event.AddressCountry != "US" || event.AffiliateID != 5 {
+		t.Fatalf("gateways: square event normalised incorrectly: %+v %v", event, err)
+	}
+
+	paypalBody := []byte(`{"id":"evt_p","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"amount":{"value":"10.50","currency_code":"USD"},"links":[{"rel":"self","href":"https://api.paypal.com/v2/payments/refunds/R1"},{"rel":"up","href":"https://api.paypal.com/v2/payments/captures/C1"}]}}`)
+	event, err = (&PaypalGateway{}).NormaliseEvent(paypalBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentRefunded || event.PaymentID != "C1" || event.Amount != 1050 {
+		t.Fatalf("gateways: paypal event normalised incorrectly: %+v %v", event, err)
+	}
+
+	paypalSaleRefundBody := []byte(`{"id":"evt_s","event_type":"PAYMENT.SALE.REFUNDED","resource":{"id":"R2","sale_id":"S1","billing_agreement_id":"I-SUB","amount":{"total":"2.50","currency":"USD"}}}`)
+	event, err = (&PaypalGateway{}).NormaliseEvent(paypalSaleRefundBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentRefunded || event.PaymentID != "S1" || event.RefundID != "R2" || event.SubscriptionID != "I-SUB" || event.Amount != 250 {
+		t.Fatalf("gateways: paypal sale refund normalised incorrectly: %+v %v", event, err)
+	}
+
+	razorpayBody := []byte(`{"event":"subscription.cancelled","created_at":1700000000,"payload":{"subscription":{"entity":{"id":"sub_r","status":"cancelled"}}}}`)
+	event, err = (&RazorpayGateway{}).NormaliseEvent(razorpayBody)
+	if err != nil || event == nil || event.Type != WebhookSubscriptionCancelled || event.SubscriptionID != "sub_r" {
+		t.Fatalf("gateways: razorpay event normalised incorrectly: %+v %v", event, err)
+	}
+
+	stripeRefundBody := []byte(`{"id":"evt_r","type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount_refunded":700,"currency":"usd","refunds":{"data":[{"id":"re_2","amount":200}]}}}}`)
+	event, err = (&StripeGateway{}).NormaliseEvent(stripeRefundBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentRefunded || event.PaymentID != "pi_1" || event.RefundID != "re_2" || event.Amount != 200 || event.AmountRefunded != 700 {
+		t.Fatalf("gateways: stripe refund normalised incorrectly: %+v %v", event, err)
+	}
+
+	stripeUpsellBody := []byte(`{"id":"evt_u","type":"payment_intent.succeeded","data":{"object":{"id":"pi_u","amount":500,"currency":"usd","customer":"cus_1","receipt_email":"a@example.com","metadata":{"product_id":"8","offer":"abc"}}}}`)
+	event, err = (&StripeGateway{}).NormaliseEvent(stripeUpsellBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentSucceeded || event.PaymentID != "pi_u" || event.ProductID != 8 || event.Amount != 500 || event.CustomerEmail != "a@example.com" {
+		t.Fatalf("gateways: stripe upsell payment normalised incorrectly: %+v %v", event, err)
+	}
+
+	event, err = (&StripeGateway{}).NormaliseEvent([]byte(`{"id":"evt_c","type":"payment_intent.succeeded","data":{"object":{"id":"pi_c","amount":500}}}`))
+	if err != nil || event != nil {
+		t.Fatalf("gateways: stripe checkout payment intent normalised: %+v %v", event, err)
+	}
+
+	squareDisputeBody := []byte(`{"type":"dispute.created","event_id":"evt_d","data":{"object":{"dispute":{"id":"dp_1","reason":"NOT_AS_DESCRIBED","amount_money":{"amount":250,"currency":"USD"},"disputed_payment":{"payment_id":"pay_q"}}}}}`)
+	event, err = (&SquareGateway{}).NormaliseEvent(squareDisputeBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentDisputed || event.PaymentID != "pay_q" || event.RefundID != "dp_1" || event.Amount != 250 {
+		t.Fatalf("gateways: square dispute normalised incorrectly: %+v %v", event, err)
+	}
+
+	squareTrialBody := []byte(`{"type":"subscription.created","event_id":"evt_t","data":{"object":{"subscription":{"id":"sq_sub","plan_id":"plan_q","status":"PENDING","start_date":"2026-11-01"}}}}`)
+	event, err = (&SquareGateway{}).NormaliseEvent(squareTrialBody)
+	if err != nil || event == nil || event.Type != WebhookSubscriptionActivated || event.SubscriptionID != "sq_sub" || event.Status != "PENDING" {
+		t.Fatalf("gateways: square subscription in its trial normalised incorrectly: %+v %v", event, err)
+	}
+
+	event, err = (&RazorpayGateway{}).NormaliseEvent([]byte(`{"event":"payment.authorized"}`))
+	if err != nil || event != nil {
+		t.Fatalf("gateways: unhandled razorpay event normalised: %+v %v", event, err)
+	}
+}
+
+// Test the affiliate sent in the custom id of PayPal is split from the custom id of the integrator
+func TestSplitAffiliate(t *testing.T) {
+	tests := []struct {
+		customID    string
+		affiliateID int64
+	}{
+		{"u1", 0},
+		{"u1", 12},
+		{"", 3},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		customID, affiliateID := splitAffiliate(withAffiliate(test.customID, test.affiliateID))
+		if customID != test.customID || affiliateID != test.affiliateID {
+			t.Fatalf("gateways: expected custom id %q and affiliate %d got:%q %d", test.customID, test.affiliateID, customID, affiliateID)
+		}
+	}
+
+	customID, affiliateID := splitAffiliate("u1|affiliate:x")
+	if customID != "u1|affiliate:x" || affiliateID != 0 {
+		t.Fatalf("gateways: invalid affiliate split from custom id got:%q %d", customID, affiliateID)
+	}
+}
@@ -0,0 +1,240 @@
+package subscriptions
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mail"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+)
+
+// firstPaymentWindow is how long after a subscription started the gateway may report the payment it started with
+const firstPaymentWindow = 24 * time.Hour
+
+// issueInvoice issues the invoice of the payment or subscription with the buyer's billing details, coupon and tax,
+// payments of nothing like the start of a free trial get no invoice.
+func issueInvoice(tx *query.Tx, transaction *Subscription, product *products.Story) (*invoices.Invoice, error) {
+	total := int64(math.Round(transaction.Amount * 100))
+	if total <= 0 {
+		return nil, nil
+	}
+
+	tax := int64(math.Round(transaction.Tax * 100))
+	discount := int64(math.Round(transaction.Discount * 100))
+
+	description := product.Name
+	reference := transaction.PaymentId
+	if transaction.SubscriptionId != "" {
+		description += " - " + scheduleLabel(product.Schedule) + " subscription"
+		// Most gateways report the first payment of a subscription after it has started, its invoice
+		// is given the reference of the payment when it is reported
+		if reference == "" {
+			reference = transaction.SubscriptionId
+		}
+	}
+
+	invoice := invoices.New()
+	invoice.TransactionID = transaction.ID
+	invoice.ProductID = product.ID
+	invoice.Email = transaction.CustomerEmail
+	invoice.BuyerName = transaction.FirstName
+	invoice.BuyerAddress = billingAddress(transaction)
+	invoice.BuyerTaxID = transaction.TaxID
+	invoice.Currency = transaction.Currency
+	invoice.CouponCode = transaction.CouponCode
+	invoice.Discount = discount
+	invoice.TaxLabel = invoiceTaxLabel(tx, transaction)
+	invoice.Tax = tax
+	invoice.Total = total
+	invoice.Gateway = transaction.PaymentGateway
+	invoice.Reference = reference
+	invoice.PaidAt = transaction.Created
+	invoice.Lines = []*invoices.Line{{Description: description, Quantity: 1, Amount: total - tax + discount}}
+
+	invoice, err := invoices.Issue(tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, invoice issued", "id": transaction.ID, "invoice": invoice.Code})
+
+	return invoice, nil
+}
+
+// issuePaymentInvoice issues the invoice of a payment of the subscription after it started, like a renewal or
+// the first charge after a free trial, with the reference of the payment at the gateway or the event id.
+// The invoice issued when the subscription started is given the reference of its payment when the payment
+// is reported within firstPaymentWindow, a payment which already has an invoice gets no other.
+func issuePaymentInvoice(tx *query.Tx, event *PaymentEvent, transaction *Subscription, product *products.Story) (*invoices.Invoice, error) {
+	if event.Amount <= 0 {
+		return nil, nil
+	}
+
+	reference := event.PaymentID
+	if reference == "" {
+		reference = event.ID
+	}
+
+	paidAt := event.Created
+	if paidAt.IsZero() {
+		paidAt = time.Now().UTC()
+	}
+
+	_, err := invoices.FindReferenceTx(tx, transaction.PaymentGateway, reference)
+	if err == nil {
+		return nil, nil
+	}
+
+	first, err := invoices.FindReferenceTx(tx, transaction.PaymentGateway, transaction.SubscriptionId)
+	if err == nil && first.TransactionID == transaction.ID && paidAt.Sub(first.PaidAt) < firstPaymentWindow {
+		return nil, first.SetReference(tx, reference)
+	}
+
+	// The amount charged includes the tax at the rate of the subscription unless the gateway reports it
+	tax := event.Tax
+	if tax == 0 && !transaction.ReverseCharge && transaction.TaxRate > 0 {
+		tax = int64(math.Round(float64(event.Amount) * transaction.TaxRate / (100 + transaction.TaxRate)))
+	}
+
+	invoice := invoices.New()
+	invoice.TransactionID = transaction.ID
+	invoice.ProductID = product.ID
+	invoice.Email = transaction.CustomerEmail
+	invoice.BuyerName = transaction.FirstName
+	invoice.BuyerAddress = billingAddress(transaction)
+	invoice.BuyerTaxID = transaction.TaxID
+	invoice.Currency = transaction.Currency
+	invoice.TaxLabel = invoiceTaxLabel(tx, transaction)
+	invoice.Tax = tax
+	invoice.Total = event.Amount
+	invoice.Gateway = transaction.PaymentGateway
+	invoice.Reference = reference
+	invoice.PaidAt = paidAt
+	invoice.Lines = []*invoices.Line{{Description: product.Name + " - " + scheduleLabel(product.Schedule) + " subscription", Quantity: 1, Amount: event.Amount - tax}}
+
+	invoice, err = invoices.Issue(tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, invoice issued", "id": transaction.ID, "invoice": invoice.Code, "reference": reference})
+
+	return invoice, nil
+}
+
+// issueOrderInvoice issues the invoice of the payment of an order with a line for each of its products
+func issueOrderInvoice(tx *query.Tx, transaction *Subscription, order *orders.Order) (*invoices.Invoice, error) {
+	total := int64(math.Round(transaction.Amount * 100))
+	if total <= 0 {
+		return nil, nil
+	}
+
+	tax := int64(math.Round(transaction.Tax * 100))
+
+	// The prices of the products include the tax when prices are tax inclusive
+	var amounts []int64
+	for _, item := range order.Items {
+		amounts = append(amounts, item.Amount)
+	}
+	amounts = splitAmount(amounts, total-tax)
+
+	invoice := invoices.New()
+	invoice.TransactionID = transaction.ID
+	invoice.Email = transaction.CustomerEmail
+	invoice.BuyerName = transaction.FirstName
+	invoice.BuyerAddress = billingAddress(transaction)
+	invoice.BuyerTaxID = transaction.TaxID
+	invoice.Currency = transaction.Currency
+	invoice.TaxLabel = invoiceTaxLabel(tx, transaction)
+	invoice.Tax = tax
+	invoice.Total = total
+	invoice.Gateway = transaction.PaymentGateway
+	invoice.Reference = transaction.PaymentId
+	invoice.PaidAt = transaction.Created
+	for i, item := range order.Items {
+		invoice.Lines = append(invoice.Lines, &invoices.Line{Description: item.Name, Quantity: 1, Amount: amounts[i]})
+	}
+
+	invoice, err := invoices.Issue(tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, invoice issued", "id": transaction.ID, "invoice": invoice.Code, "order": order.ID})
+
+	return invoice, nil
+}
+
+// billingAddress returns the lines of the buyer's billing address reported by the gateway
+func billingAddress(transaction *Subscription) string {
+	var lines []string
+	for _, line := range []string{
+		transaction.AddressStreet,
+		strings.Join(strings.Fields(transaction.AddressCity+" "+transaction.AddressState+" "+transaction.AddressZip), " "),
+		transaction.BillingCountry,
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// invoiceTaxLabel returns the tax of the payment as it is written on the invoice e.g. 19% VAT
+func invoiceTaxLabel(tx *query.Tx, transaction *Subscription) string {
+	name := "Tax"
+	evidence, err := taxes.FindTransactionEvidence(tx, transaction.ID)
+	if err == nil && evidence.TaxName != "" {
+		name = evidence.TaxName
+	}
+
+	switch {
+	case transaction.ReverseCharge:
+		return name + " reverse charged to " + transaction.TaxID
+	case transaction.TaxRate > 0:
+		rate := taxes.New()
+		rate.Name = name
+		rate.Percent = transaction.TaxRate
+		return rate.Label()
+	case transaction.Tax > 0:
+		return name
+	}
+	return ""
+}
+
+// sendInvoice emails the customer the invoice of the payment for the item, the name of the product
+// or the products of an order, as a PDF when email_invoices is enabled
+func sendInvoice(invoice *invoices.Invoice, item string) {
+	if !config.GetBool("email_invoices") || invoice.Email == "" {
+		return
+	}
+
+	email := mail.New(invoice.Email)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your invoice " + invoice.Code + " for " + item
+	email.Template = "invoices/views/invoice.html.got"
+	email.Attach(invoice.Filename(), "application/pdf", invoice.PDF())
+
+	context := mail.Context{
+		"name":       config.Get("name"),
+		"product":    item,
+		"firstName":  invoice.BuyerName,
+		"code":       invoice.Code,
+		"total":      invoice.Money(invoice.Total),
+		"invoiceURL": invoice.URL(),
+	}
+
+	go func() {
+		err := mail.Send(email, context)
+		if err != nil {
+			log.Error(log.V{"Payment event, error sending invoice": err})
+		}
+	}()
+}
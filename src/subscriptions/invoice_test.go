@@ -0,0 +1,59 @@
+// Tests for the invoices of payments
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test each payment of a subscription gets one invoice, the first payment is given the invoice issued when the subscription started
+func TestInvoiceEachPayment(t *testing.T) {
+	openTestDatabase(t)
+
+	productID, err := products.New().Create(map[string]string{"name": "Monthly", "schedule": "monthly", "license_seats": "1", "s3_bucket": "files", "s3_key": "app.zip"})
+	if err != nil {
+		t.Fatalf("invoices: error creating product %s", err)
+	}
+
+	started := time.Now().UTC()
+	events := []struct {
+		event      *PaymentEvent
+		references []string
+	}{
+		{&PaymentEvent{ID: "evt_1", Gateway: "stripe", Type: WebhookSubscriptionActivated, ProductID: productID, SubscriptionID: "sub_inv", Amount: 1000, Currency: "usd", Created: started}, []string{"sub_inv"}},
+		{&PaymentEvent{ID: "evt_2", Gateway: "stripe", Type: WebhookPaymentSucceeded, SubscriptionID: "sub_inv", PaymentID: "pi_1", Amount: 1000, Currency: "usd", Created: started.Add(time.Minute)}, []string{"pi_1"}},
+		{&PaymentEvent{ID: "evt_3", Gateway: "stripe", Type: WebhookPaymentSucceeded, SubscriptionID: "sub_inv", PaymentID: "pi_1", Amount: 1000, Currency: "usd", Created: started.Add(time.Hour)}, []string{"pi_1"}},
+		{&PaymentEvent{ID: "evt_4", Gateway: "stripe", Type: WebhookPaymentSucceeded, SubscriptionID: "sub_inv", PaymentID: "pi_2", Amount: 1200, Currency: "usd", Created: started.AddDate(0, 1, 0)}, []string{"pi_1", "pi_2"}},
+		{&PaymentEvent{ID: "evt_5", Gateway: "stripe", Type: WebhookPaymentSucceeded, SubscriptionID: "sub_inv", Amount: 0, Currency: "usd", Created: started.AddDate(0, 2, 0)}, []string{"pi_1", "pi_2"}},
+	}
+
+	for _, e := range events {
+		err = ProcessPaymentEvent(e.event)
+		if err != nil {
+			t.Fatalf("invoices: error processing %s %s", e.event.ID, err)
+		}
+
+		subscription, err := FindSubscription("sub_inv")
+		if err != nil {
+			t.Fatalf("invoices: error finding subscription after %s %s", e.event.ID, err)
+		}
+
+		issued, err := invoices.FindTransactionAll(subscription.ID)
+		if err != nil || len(issued) != len(e.references) {
+			t.Fatalf("invoices: expected %d invoices after %s got:%v %v", len(e.references), e.event.ID, issued, err)
+		}
+		for i, invoice := range issued {
+			if invoice.Reference != e.references[i] {
+				t.Fatalf("invoices: expected invoice of %s after %s got:%s", e.references[i], e.event.ID, invoice.Reference)
+			}
+		}
+	}
+
+	invoice, err := invoices.FindReferenceTx(nil, "stripe", "pi_2")
+	if err != nil || invoice.Total != 1200 || invoice.Lines[0].Amount != 1200 {
+		t.Fatalf("invoices: expected renewal invoice of 1200 got:%v %v", invoice, err)
+	}
+}
@@ -0,0 +1,496 @@
+package subscriptions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/offers"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+	"github.com/stripe/stripe-go/v72"
+	stripesession "github.com/stripe/stripe-go/v72/checkout/session"
+	"github.com/stripe/stripe-go/v72/paymentintent"
+)
+
+// errNoOffer is returned when the product has no bump or upsell which can be offered
+var errNoOffer = errors.New("no offer for the product")
+
+// upsellSuccessReferences are the params with which the success page is shown for an upsell paid with one click
+var upsellSuccessReferences = map[string]string{"stripe": "payment_intent", "square": "square_payment_id"}
+
+// BumpProduct returns the product offered as an add-on at the checkout of the product, only products which can be
+// bought in a cart have a bump
+func BumpProduct(product *products.Story) (*products.Story, error) {
+	if !CartProduct(product) {
+		return nil, errNoOffer
+	}
+	return offerProduct(product, product.BumpProductID)
+}
+
+// UpsellProduct returns the product offered to the buyer once the product has been bought
+func UpsellProduct(product *products.Story) (*products.Story, error) {
+	return offerProduct(product, product.UpsellProductID)
+}
+
+// offerProduct returns the product with the id offered with the product, it must be another product which can be bought in a cart
+func offerProduct(product *products.Story, offerProductID int64) (*products.Story, error) {
+	if offerProductID <= 0 || offerProductID == product.ID {
+		return nil, errNoOffer
+	}
+
+	offered, err := products.Find(offerProductID)
+	if err != nil {
+		return nil, err
+	}
+	if !CartProduct(offered) {
+		return nil, errNoOffer
+	}
+
+	return offered, nil
+}
+
+// upsellOffered reports whether an upsell is offered to the buyer of the product
+func upsellOffered(productID int64) bool {
+	product, err := products.Find(productID)
+	if err != nil {
+		return false
+	}
+	_, err = UpsellProduct(product)
+	return err == nil
+}
+
+// offerUpsell offers the upsell of the product to the buyer of the purchase with the reference at the gateway, the customer
+// and payment method are those saved at the gateway for the upsell to be paid with one click. No offer is made when the
+// product has no upsell.
+func offerUpsell(product *products.Story, gateway string, reference string, customerID string, paymentMethod string) (*offers.Offer, error) {
+	upsell, err := UpsellProduct(product)
+	if err != nil {
+		return nil, nil
+	}
+
+	offer := offers.New()
+	offer.Kind = offers.KindUpsell
+	offer.ProductID = product.ID
+	offer.OfferProductID = upsell.ID
+	offer.Gateway = gateway
+	offer.PurchaseReference = reference
+	offer.CustomerID = customerID
+	offer.PaymentMethod = paymentMethod
+
+	return offers.Make(offer)
+}
+
+// HandleBumpCheckout pays for the product together with its order bump if the buyer ticked it,
+// it responds to POST /subscriptions/bump
+func HandleBumpCheckout(w http.ResponseWriter, r *http.Request) error {
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	product, err := products.Find(params.GetInt("product_id"))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	bump, err := BumpProduct(product)
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	accepted := params.Get("bump") == "1"
+	bumpProducts := []*products.Story{product}
+	if accepted {
+		bumpProducts = append(bumpProducts, bump)
+	}
+
+	ipCountry := RequestCountry(r)
+
+	cart, err := PriceCart(bumpProducts, ipCountry)
+	if err != nil {
+		return server.Redirect(w, r, cartFailure(err))
+	}
+
+	// Every checkout shown the bump is an offer for the report, the bump is paid with the order of the checkout
+	offer := offers.New()
+	offer.Kind = offers.KindBump
+	offer.ProductID = product.ID
+	offer.OfferProductID = bump.ID
+	offer.Gateway = cart.Gateway.Name()
+	offer.Currency = cart.Currency
+	if accepted {
+		offer.Status = offers.StatusAccepted
+		offer.Amount = cart.Lines[1].Checkout.UnitAmount
+	}
+
+	offer, err = offers.Make(offer)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	cart.ReturnPath = product.ShowURL()
+	if accepted {
+		cart.Offers = []*offers.Offer{offer}
+	}
+
+	return checkoutCart(w, r, cart, ipCountry, params.Get("tax_id"))
+}
+
+// HandleOfferShow shows the upsell offered to the buyer after their purchase, it responds to GET /offers/{token}
+func HandleOfferShow(w http.ResponseWriter, r *http.Request) error {
+	offer, upsell, err := findOpenOffer(w, r)
+	if err != nil {
+		return err
+	}
+
+	ipCountry := RequestCountry(r)
+
+	cart, oneClick, err := priceOffer(offer, upsell, ipCountry)
+	if err != nil {
+		return server.Redirect(w, r, cartFailure(err))
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+	view.AddKey("meta_title", "Special offer - "+upsell.NameDisplay())
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	view.AddKey("offer", offer)
+	view.AddKey("product", upsell)
+	view.AddKey("price", cart.Lines[0].Price())
+	view.AddKey("oneClick", oneClick)
+	view.AddKey("taxLabel", taxes.Calculate(0, ipCountry, "", taxes.Inclusive()).Label())
+
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+
+	view.Template("subscriptions/views/offer.html.got")
+
+	return view.Render()
+}
+
+// HandleOfferAccept pays for the upsell accepted by the buyer, with one click when the payment method of the purchase was saved
+// at the gateway and otherwise with a checkout, it responds to POST /offers/{token}/accept. The offer is claimed before it is
+// charged so that it is paid once when the buyer accepts it more than once.
+func HandleOfferAccept(w http.ResponseWriter, r *http.Request) error {
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	offer, upsell, err := findOpenOffer(w, r)
+	if err != nil {
+		return err
+	}
+
+	ipCountry := RequestCountry(r)
+
+	cart, oneClick, err := priceOffer(offer, upsell, ipCountry)
+	if err != nil {
+		return server.Redirect(w, r, cartFailure(err))
+	}
+	line := cart.Lines[0]
+
+	err = offer.Claim()
+	if err == offers.ErrClaimed {
+		return server.NotFoundError(err, "Offer not found", "This offer has ended.")
+	}
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if oneClick {
+		// The tax is added to the amount charged unless prices include it
+		tax := checkoutTax(cart.Total(), ipCountry, "", "", taxes.Inclusive())
+
+		reference, err := chargeUpsell(offer, upsell, cart, tax)
+		if err == nil {
+			err = recordTax(tax, tax.Tax, upsell.ID, offer.Gateway, reference, ipCountry, "", cart.Currency)
+			if err != nil {
+				log.Error(log.V{"Offer, error recording tax evidence": err, "offer": offer.ID})
+			}
+
+			err = acceptOffer(offer, reference, line.Checkout.UnitAmount, cart.Currency)
+			if err != nil {
+				return server.InternalError(err)
+			}
+
+			// The license key and download link of the upsell are shown once the payment is recorded
+			return server.Redirect(w, r, fmt.Sprintf("/subscriptions/success?product_id=%d&%s=%s", upsell.ID, upsellSuccessReferences[offer.Gateway], url.QueryEscape(reference)))
+		}
+
+		// The buyer pays with a checkout when the saved payment method is refused, e.g. it needs to be authenticated
+		log.Error(log.V{"Offer, error charging saved payment method": err, "offer": offer.ID, "pg": offer.Gateway})
+		cart, err = PriceCart([]*products.Story{upsell}, ipCountry)
+		if err != nil {
+			releaseErr := offer.Release()
+			if releaseErr != nil {
+				log.Error(log.V{"Offer, error releasing offer": releaseErr, "offer": offer.ID})
+			}
+			return server.Redirect(w, r, cartFailure(err))
+		}
+		line = cart.Lines[0]
+	}
+
+	err = offer.Accept("", line.Checkout.UnitAmount, cart.Currency)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	cart.ReturnPath = upsell.ShowURL()
+	cart.Offers = []*offers.Offer{offer}
+
+	return checkoutCart(w, r, cart, ipCountry, "")
+}
+
+// HandleOfferDecline records the upsell as declined by the buyer, it responds to POST /offers/{token}/decline
+func HandleOfferDecline(w http.ResponseWriter, r *http.Request) error {
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	offer, _, err := findOpenOffer(w, r)
+	if err != nil {
+		return err
+	}
+
+	err = offer.Decline()
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/")
+}
+
+// findOpenOffer returns the upsell of the request's token which is still open for the buyer it was offered to, along with its product
+func findOpenOffer(w http.ResponseWriter, r *http.Request) (*offers.Offer, *products.Story, error) {
+	params, err := mux.Params(r)
+	if err != nil {
+		return nil, nil, server.InternalError(err)
+	}
+
+	offer, err := offers.FindToken(params.Get("token"))
+	if err != nil || offer.Kind != offers.KindUpsell || !offers.Remembered(w, r, offer.Token) {
+		return nil, nil, server.NotFoundError(err, "Offer not found", "This offer isn't available.")
+	}
+	if !offer.Open() {
+		return nil, nil, server.NotFoundError(nil, "Offer not found", "This offer has ended.")
+	}
+
+	upsell, err := products.Find(offer.OfferProductID)
+	if err != nil || !CartProduct(upsell) {
+		return nil, nil, server.NotFoundError(err, "Offer not found", "This offer isn't available.")
+	}
+
+	return offer, upsell, nil
+}
+
+// priceOffer prices the upsell on the gateway of the purchase when it can be paid there with one click,
+// and otherwise on the first gateway with a price for it
+func priceOffer(offer *offers.Offer, upsell *products.Story, country string) (*Cart, bool, error) {
+	upsellProducts := []*products.Story{upsell}
+
+	if offer.OneClick() {
+		g, err := FindGateway(offer.Gateway)
+		if err == nil && g.Enabled() {
+			cart, err := priceCartOnGateway(g, upsellProducts, country)
+			if err == nil {
+				return cart, true, nil
+			}
+			log.Info(log.V{"msg": "Offer, upsell can't be paid with one click", "pg": offer.Gateway, "error": err})
+		}
+	}
+
+	cart, err := PriceCart(upsellProducts, country)
+	return cart, false, err
+}
+
+// chargeUpsell charges the upsell including the tax to the payment method saved with the purchase,
+// returning the reference of the payment at the gateway
+func chargeUpsell(offer *offers.Offer, upsell *products.Story, cart *Cart, tax *taxes.Calculation) (string, error) {
+	// The receipt is sent to the buyer of the purchase, and the affiliate who referred the purchase earns on the upsell
+	var email string
+	var affiliateID int64
+	purchase, err := FindTransactionReference(offer.PurchaseReference)
+	if err == nil {
+		email = purchase.CustomerEmail
+		affiliateID = purchase.AffiliateID
+	}
+
+	switch offer.Gateway {
+	case "stripe":
+		return chargeStripeUpsell(offer, upsell, cart.Currency, tax.Gross, email, affiliateID)
+	case "square":
+		return chargeSquareUpsell(offer, upsell, cart.Currency, tax.Gross, email, affiliateID)
+	}
+
+	return "", errNoOffer
+}
+
+// chargeStripeUpsell charges the card saved by the checkout session of the purchase off session, the payment is recorded
+// from Stripe's payment_intent.succeeded webhook. The amount is in the smallest currency unit, the offer's token is the
+// idempotency key so that Stripe charges the offer once.
+func chargeStripeUpsell(offer *offers.Offer, upsell *products.Story, currency string, amount int64, email string, affiliateID int64) (string, error) {
+	stripe.Key = config.Get("stripe_secret")
+
+	sessionParams := &stripe.CheckoutSessionParams{}
+	sessionParams.AddExpand("payment_intent")
+	s, err := stripesession.Get(offer.PurchaseReference, sessionParams)
+	if err != nil {
+		return "", err
+	}
+	if s.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid || s.Customer == nil || s.PaymentIntent == nil || s.PaymentIntent.PaymentMethod == nil {
+		return "", errors.New("no payment method saved with the checkout session")
+	}
+	if email == "" && s.CustomerDetails != nil {
+		email = s.CustomerDetails.Email
+	}
+
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(amount),
+		Currency:      stripe.String(currency),
+		Customer:      stripe.String(s.Customer.ID),
+		PaymentMethod: stripe.String(s.PaymentIntent.PaymentMethod.ID),
+		OffSession:    stripe.Bool(true),
+		Confirm:       stripe.Bool(true),
+	}
+	if email != "" {
+		params.ReceiptEmail = stripe.String(email)
+	}
+	params.AddMetadata("plan", upsell.NameDisplay())
+	params.AddMetadata("product_id", strconv.FormatInt(upsell.ID, 10))
+	params.AddMetadata("offer", offer.Token)
+	if affiliateID > 0 {
+		params.AddMetadata("affiliate_id", strconv.FormatInt(affiliateID, 10))
+	}
+	params.SetIdempotencyKey(offer.Token)
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		return "", err
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		return "", fmt.Errorf("stripe payment intent %s is %s", pi.ID, pi.Status)
+	}
+
+	return pi.ID, nil
+}
+
+// chargeSquareUpsell charges the card saved with the customer of the purchase, the payment is recorded from Square's
+// payment webhook. The amount is in the smallest currency unit, the offer's token is the idempotency key so that Square
+// charges the offer once.
+func chargeSquareUpsell(offer *offers.Offer, upsell *products.Story, currency string, amount int64, email string, affiliateID int64) (string, error) {
+	type AmountMoney struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+
+	type Payload struct {
+		IdempotencyKey    string      `json:"idempotency_key"`
+		AmountMoney       AmountMoney `json:"amount_money"`
+		SourceID          string      `json:"source_id"`
+		CustomerID        string      `json:"customer_id"`
+		ReferenceID       string      `json:"reference_id"`
+		Note              string      `json:"note,omitempty"`
+		BuyerEmailAddress string      `json:"buyer_email_address,omitempty"`
+	}
+
+	data := Payload{
+		IdempotencyKey: offer.Token,
+		AmountMoney: AmountMoney{
+			Amount:   amount,
+			Currency: currency,
+		},
+		SourceID:          offer.PaymentMethod,
+		CustomerID:        offer.CustomerID,
+		ReferenceID:       fmt.Sprintf("Product Id: %d", upsell.ID),
+		Note:              squareAffiliateNote(affiliateID),
+		BuyerEmailAddress: email,
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", config.Get("square_domain")+"/payments", bytes.NewReader(payloadBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Square-Version", "2023-04-19")
+	req.Header.Set("Authorization", "Bearer "+config.Get("square_access_token"))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != 200 {
+		var errorModel ErrorModel
+		err = json.Unmarshal(b, &errorModel)
+		if err != nil || len(errorModel.Errors) == 0 {
+			return "", fmt.Errorf("square payment failed with status %d", resp.StatusCode)
+		}
+		return "", errors.New(errorModel.Errors[0].Detail)
+	}
+
+	var charge Charge
+	err = json.Unmarshal(b, &charge)
+	if err != nil {
+		return "", err
+	}
+	if charge.Payment.Status != "COMPLETED" {
+		return "", fmt.Errorf("square payment %s is %s", charge.Payment.ID, charge.Payment.Status)
+	}
+
+	return charge.Payment.ID, nil
+}
+
+// acceptOffer records the upsell as accepted for the payment with the reference, if the payment was already recorded
+// from the gateway's webhook the offer is paid at once. The amount is before the tax in the smallest currency unit.
+func acceptOffer(offer *offers.Offer, reference string, amount int64, currency string) error {
+	// The offer is accepted and paid by a payment recorded already in one transaction
+	return query.Transaction(func(tx *query.Tx) error {
+		err := offer.AcceptTx(tx, reference, amount, currency)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := FindTransactionReferenceTx(tx, reference)
+		if err != nil {
+			return nil
+		}
+
+		return offer.Pay(tx, transaction.ID)
+	})
+}
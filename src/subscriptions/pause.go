@@ -0,0 +1,350 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/razorpay/razorpay-go"
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/sub"
+)
+
+const (
+	// ResumeDateFormat is the format of the date a paused subscription is resumed on
+	ResumeDateFormat = "2006-01-02"
+
+	// resumeBatchSize is the number of paused subscriptions resumed each time the worker runs
+	resumeBatchSize = 100
+)
+
+// ErrPause is returned when the subscription can't be paused or resumed
+var ErrPause = errors.New("subscription can't be paused or resumed")
+
+// pauseWorker stops a run of the worker from overlapping with a run which is still resuming subscriptions
+var pauseWorker sync.Mutex
+
+// Paused reports whether this is a subscription which isn't charged until it is resumed
+func (s *Subscription) Paused() bool {
+	return s.State == StatePaused
+}
+
+// Pausable reports whether the subscription can be paused at its gateway, a subscription in its free trial
+// or past due is paused once it is paid up
+func (s *Subscription) Pausable() bool {
+	return s.SubscriptionId != "" && s.State == StateActive && pauseGateway(s.PaymentGateway)
+}
+
+// Resumable reports whether the paused subscription can be resumed at its gateway
+func (s *Subscription) Resumable() bool {
+	return s.SubscriptionId != "" && s.Paused() && pauseGateway(s.PaymentGateway)
+}
+
+// PauseSubscription pauses the subscription at its gateway until it is resumed, or until resumesAt if it isn't zero.
+// Square pauses the subscription from its next billing cycle and the subscription is paused once its webhook reports it,
+// the other gateways pause it now.
+func PauseSubscription(subscription *Subscription, resumesAt time.Time) error {
+	if !subscription.Pausable() {
+		return ErrPause
+	}
+	if !resumesAt.IsZero() && !resumesAt.After(time.Now()) {
+		return errors.New("the subscription should be resumed after today")
+	}
+
+	var err error
+	switch subscription.PaymentGateway {
+	case "stripe":
+		err = pauseStripeSubscription(subscription.SubscriptionId, resumesAt)
+	case "paypal":
+		err = paypalSubscriptionAction(subscription.SubscriptionId, "suspend", "Paused by the subscriber")
+	case "razorpay":
+		err = pauseRazorpaySubscription(subscription.SubscriptionId)
+	case "square":
+		err = pauseSquareSubscription(subscription.SubscriptionId, resumesAt)
+	default:
+		err = ErrPause
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info(log.V{"msg": "Subscription pause, subscription paused at the gateway", "id": subscription.ID, "pg": subscription.PaymentGateway, "resumes_at": resumesAt})
+
+	if !resumesAt.IsZero() {
+		err = subscription.Update(map[string]string{"resumes_at": query.TimeString(resumesAt.UTC())})
+		if err != nil {
+			log.Error(log.V{"Subscription pause, error recording resume date": err, "id": subscription.ID})
+			return err
+		}
+		subscription.ResumesAt = resumesAt.UTC()
+	}
+
+	if subscription.PaymentGateway == "square" {
+		return nil
+	}
+
+	return pauseTransition(subscription, StatePaused)
+}
+
+// ParseResumeDate returns the start of the date in UTC a subscription is paused until, zero if the date is empty
+func ParseResumeDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(ResumeDateFormat, value)
+}
+
+// ResumeSubscription resumes the paused subscription at its gateway, which charges it again from its next billing cycle.
+// Square resumes the subscription once its webhook reports it, the other gateways resume it now.
+func ResumeSubscription(subscription *Subscription) error {
+	if !subscription.Resumable() {
+		return ErrPause
+	}
+
+	var err error
+	switch subscription.PaymentGateway {
+	case "stripe":
+		err = resumeStripeSubscription(subscription.SubscriptionId)
+	case "paypal":
+		err = paypalSubscriptionAction(subscription.SubscriptionId, "activate", "Resumed by the subscriber")
+	case "razorpay":
+		err = resumeRazorpaySubscription(subscription.SubscriptionId)
+	case "square":
+		_, err = squareRequest(http.MethodPost, "/subscriptions/"+subscription.SubscriptionId+"/resume", map[string]interface{}{})
+	default:
+		err = ErrPause
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info(log.V{"msg": "Subscription pause, subscription resumed at the gateway", "id": subscription.ID, "pg": subscription.PaymentGateway})
+
+	if subscription.PaymentGateway == "square" {
+		return nil
+	}
+
+	return pauseTransition(subscription, StateActive)
+}
+
+// ResumeSubscriptions resumes the paused subscriptions whose resume date has passed, it is run by the scheduler.
+// Square resumes its subscriptions on their resume date itself.
+func ResumeSubscriptions() {
+	if !pauseWorker.TryLock() {
+		return
+	}
+	defer pauseWorker.Unlock()
+
+	subscriptions, err := FindDueResumes(time.Now().UTC(), resumeBatchSize)
+	if err != nil {
+		log.Error(log.V{"ResumeSubscriptions, Error fetching paused subscriptions": err})
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		err = ResumeSubscription(subscription)
+		if err != nil {
+			log.Error(log.V{"ResumeSubscriptions, Error resuming subscription": err, "id": subscription.ID, "pg": subscription.PaymentGateway})
+			continue
+		}
+	}
+}
+
+// FindDueResumes fetches the paused subscriptions whose resume date is before the given time.
+func FindDueResumes(before time.Time, limit int) ([]*Subscription, error) {
+	q := Where("state=?", StatePaused).Where("pg != ?", "square").Where("resumes_at IS NOT NULL").Where("resumes_at != ''").Where("resumes_at <= ?", query.TimeString(before.UTC())).Order("resumes_at asc").Limit(limit)
+	return FindAll(q)
+}
+
+// pauseTransition moves the subscription paused or resumed at its gateway to the state, the gateway's webhook
+// may have moved it already
+func pauseTransition(subscription *Subscription, state string) error {
+	var effects []func()
+	err := query.Transaction(func(tx *query.Tx) error {
+		current, err := FindFirstTx(tx, "id=?", subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		previousState := current.State
+		changed, err := current.Transition(tx, state, nil)
+		if err != nil || !changed {
+			return err
+		}
+
+		effects, err = pauseChanged(tx, current, findPaymentEventProduct(tx, &PaymentEvent{Gateway: current.PaymentGateway}, current), previousState)
+		return err
+	})
+	if err != nil {
+		log.Error(log.V{"Subscription pause, error recording state": err, "id": subscription.ID})
+		return err
+	}
+	subscription.State = state
+
+	for _, effect := range effects {
+		effect()
+	}
+
+	return nil
+}
+
+// pauseChanged counts the subscribers of the product again when the subscription is paused or resumed, a paused or unpaid
+// subscriber loses access so their license keys and download links are suspended until the subscription is resumed or paid.
+// A paused or unpaid subscription which ends is handled as any other which ends.
+func pauseChanged(tx *query.Tx, subscription *Subscription, product *products.Story, previousState string) ([]func(), error) {
+	suspended := subscription.Paused() || subscription.Unpaid()
+	resumed := (previousState == StatePaused || previousState == StateUnpaid) && subscription.Subscribed()
+	if !suspended && !resumed {
+		return nil, nil
+	}
+
+	if suspended {
+		err := licenses.SuspendSubscription(tx, subscription.SubscriptionId)
+		if err != nil {
+			log.Error(log.V{"Subscription pause, error suspending licenses of the subscription": err})
+			return nil, err
+		}
+
+		err = downloads.SuspendTransaction(tx, subscription.ID)
+		if err != nil {
+			log.Error(log.V{"Subscription pause, error suspending download links of the subscription": err})
+			return nil, err
+		}
+	} else {
+		err := licenses.ReinstateSubscription(tx, subscription.SubscriptionId)
+		if err != nil {
+			log.Error(log.V{"Subscription pause, error reinstating licenses of the subscription": err})
+			return nil, err
+		}
+
+		err = downloads.ReinstateTransaction(tx, subscription.ID)
+		if err != nil {
+			log.Error(log.V{"Subscription pause, error reinstating download links of the subscription": err})
+			return nil, err
+		}
+
+		if !subscription.ResumesAt.IsZero() {
+			err = subscription.UpdateTx(tx, map[string]string{"resumes_at": ""})
+			if err != nil {
+				log.Error(log.V{"Subscription pause, error clearing resume date": err, "id": subscription.ID})
+				return nil, err
+			}
+			subscription.ResumesAt = time.Time{}
+		}
+	}
+
+	if product == nil {
+		log.Error(log.V{"msg": "Subscription pause, no product for the subscription", "id": subscription.ID, "pg": subscription.PaymentGateway})
+		return nil, nil
+	}
+
+	product.TotalSubscribers = int64(CountSubscribersTx(tx, product.ID))
+	err := product.UpdateTx(tx, map[string]string{"total_subscribers": strconv.FormatInt(product.TotalSubscribers, 10)})
+	if err != nil {
+		log.Error(log.V{"Subscription pause, error updating total subscribers for product": err})
+		return nil, err
+	}
+
+	data := WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Status:         subscription.State,
+		Email:          subscription.CustomerEmail,
+	}
+
+	log.Info(log.V{"msg": "Subscription pause, subscription " + subscription.State, "id": subscription.ID})
+
+	return []func(){
+		func() { sendProductWebhook(product, WebhookSubscriptionUpdated, data) },
+	}, nil
+}
+
+// pauseGateway reports whether subscriptions of the gateway can be paused and resumed from OPH
+func pauseGateway(gateway string) bool {
+	switch gateway {
+	case "stripe", "paypal", "razorpay", "square":
+		return true
+	}
+	return false
+}
+
+// pauseStripeSubscription pauses the collection of the payments of the Stripe subscription, its invoices are voided
+// until it is resumed. Stripe resumes it on resumesAt if it isn't zero.
+func pauseStripeSubscription(subscriptionID string, resumesAt time.Time) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.SubscriptionParams{
+		PauseCollection: &stripe.SubscriptionPauseCollectionParams{
+			Behavior: stripe.String(string(stripe.SubscriptionPauseCollectionBehaviorVoid)),
+		},
+	}
+	if !resumesAt.IsZero() {
+		params.PauseCollection.ResumesAt = stripe.Int64(resumesAt.Unix())
+	}
+
+	_, err := sub.Update(subscriptionID, params)
+	return err
+}
+
+// resumeStripeSubscription resumes the collection of the payments of the Stripe subscription
+func resumeStripeSubscription(subscriptionID string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.SubscriptionParams{}
+	params.AddExtra("pause_collection", "")
+
+	_, err := sub.Update(subscriptionID, params)
+	return err
+}
+
+// paypalSubscriptionAction suspends or activates the PayPal subscription with the reason shown to the subscriber
+func paypalSubscriptionAction(subscriptionID string, action string, reason string) error {
+	resp, err := paypalRequest(http.MethodPost, fmt.Sprintf("/v1/billing/subscriptions/%s/%s", subscriptionID, action), map[string]string{"reason": reason})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to %s paypal subscription, status code: %d", action, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// pauseRazorpaySubscription pauses the Razorpay subscription now
+func pauseRazorpaySubscription(subscriptionID string) error {
+	client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	_, err := client.Subscription.Pause(subscriptionID, map[string]interface{}{"pause_at": "now"}, nil)
+	return err
+}
+
+// resumeRazorpaySubscription resumes the Razorpay subscription now
+func resumeRazorpaySubscription(subscriptionID string) error {
+	client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	_, err := client.Subscription.Resume(subscriptionID, map[string]interface{}{"resume_at": "now"}, nil)
+	return err
+}
+
+// pauseSquareSubscription pauses the Square subscription from its next billing cycle, Square resumes it on
+// resumesAt if it isn't zero
+func pauseSquareSubscription(subscriptionID string, resumesAt time.Time) error {
+	data := map[string]interface{}{}
+	if !resumesAt.IsZero() {
+		data["resume_effective_date"] = resumesAt.UTC().Format("2006-01-02")
+	}
+
+	_, err := squareRequest(http.MethodPost, "/subscriptions/"+subscriptionID+"/pause", data)
+	return err
+}
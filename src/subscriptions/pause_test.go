@@ -0,0 +1,113 @@
+// Tests for pausing and resuming subscriptions
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test only active subscriptions are paused and only paused subscriptions are resumed
+func TestPausable(t *testing.T) {
+	subscription := New()
+	subscription.SubscriptionId = "sub_1"
+	subscription.PaymentGateway = "square"
+	subscription.State = StateActive
+	if !subscription.Pausable() || subscription.Resumable() {
+		t.Fatalf("pauses: expected active square subscription to be pausable only")
+	}
+
+	subscription.State = StatePaused
+	if subscription.Pausable() || !subscription.Resumable() || subscription.Subscribed() {
+		t.Fatalf("pauses: expected paused subscription to be resumable only and not counted")
+	}
+
+	subscription.State = StatePastDue
+	if subscription.Pausable() {
+		t.Fatalf("pauses: expected past due subscription not to be pausable")
+	}
+
+	subscription.State = StateActive
+	subscription.PaymentGateway = "fake"
+	if subscription.Pausable() {
+		t.Fatalf("pauses: expected subscription of unsupported gateway not to be pausable")
+	}
+
+	payment := New()
+	payment.PaymentGateway = "stripe"
+	payment.State = StateActive
+	if payment.Pausable() {
+		t.Fatalf("pauses: expected one time payment not to be pausable")
+	}
+}
+
+// Test the resume date is optional and parsed as a day in UTC
+func TestParseResumeDate(t *testing.T) {
+	date, err := ParseResumeDate("")
+	if err != nil || !date.IsZero() {
+		t.Fatalf("pauses: expected empty resume date to be zero got:%s %v", date, err)
+	}
+
+	date, err = ParseResumeDate("2026-03-01")
+	if err != nil || !date.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("pauses: resume date parsed incorrectly got:%s %v", date, err)
+	}
+
+	_, err = ParseResumeDate("01/03/2026")
+	if err == nil {
+		t.Fatalf("pauses: expected resume date in another format to fail")
+	}
+}
+
+// Test the license keys and download links of a subscription are suspended while it is paused and usable again once it is resumed
+func TestPauseResume(t *testing.T) {
+	openTestDatabase(t)
+
+	productID, err := products.New().Create(map[string]string{"name": "Monthly", "schedule": "monthly", "license_seats": "2", "s3_bucket": "files", "s3_key": "app.zip"})
+	if err != nil {
+		t.Fatalf("pauses: error creating product %s", err)
+	}
+
+	events := []struct {
+		event    *PaymentEvent
+		state    string
+		download string
+		license  string
+		err      error
+	}{
+		{&PaymentEvent{ID: "WH-1", Gateway: "paypal", Type: WebhookSubscriptionActivated, ProductID: productID, SubscriptionID: "I-PAUSE", Amount: 1000, Currency: "usd", Status: "ACTIVE"}, StateActive, downloads.StatusActive, licenses.StatusActive, nil},
+		{&PaymentEvent{ID: "WH-2", Gateway: "paypal", Type: WebhookSubscriptionUpdated, SubscriptionID: "I-PAUSE", Status: "SUSPENDED"}, StatePaused, downloads.StatusSuspended, licenses.StatusSuspended, downloads.ErrSuspended},
+		{&PaymentEvent{ID: "WH-3", Gateway: "paypal", Type: WebhookSubscriptionActivated, SubscriptionID: "I-PAUSE", Status: "ACTIVE"}, StateActive, downloads.StatusActive, licenses.StatusActive, nil},
+	}
+
+	var download *downloads.Download
+	for _, e := range events {
+		e.event.Created = time.Now()
+		err = ProcessPaymentEvent(e.event)
+		if err != nil {
+			t.Fatalf("pauses: error processing %s %s", e.event.ID, err)
+		}
+
+		subscription, err := FindSubscription("I-PAUSE")
+		if err != nil || subscription.State != e.state {
+			t.Fatalf("pauses: expected %s subscription after %s got:%v %v", e.state, e.event.ID, subscription, err)
+		}
+
+		current, err := downloads.FindTransaction(subscription.ID)
+		if err != nil || current.Status != e.download || current.Check() != e.err {
+			t.Fatalf("pauses: expected %s download link after %s got:%v %v", e.download, e.event.ID, current, err)
+		}
+		if download != nil && current.Token != download.Token {
+			t.Fatalf("pauses: expected download link to be kept after %s got:%s", e.event.ID, current.Token)
+		}
+		download = current
+
+		license, err := licenses.FindTransaction(subscription.ID)
+		if err != nil || license.Status != e.license {
+			t.Fatalf("pauses: expected %s license after %s got:%v %v", e.license, e.event.ID, license, err)
+		}
+	}
+}
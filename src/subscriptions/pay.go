@@ -0,0 +1,66 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// maxPay is the most a buyer can choose to pay for a pay what you want product, in the smallest currency unit
+const maxPay = 100000000
+
+// errPayAmount is returned when the amount chosen by the buyer isn't a number
+var errPayAmount = errors.New("amount should be a number like 10.50")
+
+// PayWhatYouWant returns the checkout for the amount chosen by the buyer of a pay what you want product,
+// an empty amount is the suggested price and the price of the product is the least the buyer can pay.
+func (c *Checkout) PayWhatYouWant(product *products.Story, amount string) (*Checkout, error) {
+	pay := c.UnitAmount
+	if product.SuggestedPrice > 0 {
+		pay = int64(math.Round(product.SuggestedPrice * 100))
+	}
+
+	if strings.TrimSpace(amount) != "" {
+		value, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if err != nil || math.IsNaN(value) {
+			return nil, errPayAmount
+		}
+		pay = int64(math.Round(value * 100))
+		if pay < c.UnitAmount {
+			return nil, fmt.Errorf("amount should be at least %s %s", majorUnits(c.UnitAmount), quoteValue(c.Currency))
+		}
+	}
+
+	// The suggested price may be below the price if the price was raised later
+	if pay < c.UnitAmount {
+		pay = c.UnitAmount
+	}
+	if pay <= 0 {
+		return nil, errors.New("amount should be more than 0")
+	}
+	if pay > maxPay {
+		return nil, fmt.Errorf("amount should be at most %s %s", majorUnits(maxPay), quoteValue(c.Currency))
+	}
+
+	checkout := *c
+	checkout.Pay = pay
+	checkout.Price = majorUnits(pay) + " " + quoteValue(c.Currency) + "/" + scheduleLabel(product.Schedule)
+	// Square takes the amount from the checkout form in the smallest currency unit
+	checkout.Amount = pay
+
+	return &checkout, nil
+}
+
+// MinimumPrice returns the least the buyer of a pay what you want product can pay e.g. 5.00 usd
+func (c *Checkout) MinimumPrice() string {
+	return majorUnits(c.UnitAmount) + " " + quoteValue(c.Currency)
+}
+
+// PayAmount returns the amount chosen by the buyer in the major currency unit e.g. 10.50
+func (c *Checkout) PayAmount() string {
+	return majorUnits(c.Pay)
+}
@@ -0,0 +1,72 @@
+// Tests for pay what you want products
+package subscriptions
+
+import (
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test the buyer can pay the suggested price or any amount above the price
+func TestPayWhatYouWant(t *testing.T) {
+	product := products.New()
+	product.Schedule = "onetime"
+	product.PriceMode = products.PriceModePayWhatYouWant
+	product.SuggestedPrice = 12.5
+
+	checkout := &Checkout{Type: "onetime", Currency: "USD", UnitAmount: 500}
+
+	tests := []struct {
+		amount string
+		pay    int64
+		ok     bool
+	}{
+		{"", 1250, true},
+		{"5", 500, true},
+		{"20.499", 2050, true},
+		{"4.99", 0, false},
+		{"ten", 0, false},
+		{"100000000", 0, false},
+	}
+
+	for _, test := range tests {
+		c, err := checkout.PayWhatYouWant(product, test.amount)
+		if (err == nil) != test.ok {
+			t.Fatalf("pay: expected ok %t for %q got:%v", test.ok, test.amount, err)
+		}
+		if err == nil && c.Pay != test.pay {
+			t.Fatalf("pay: expected %d for %q got:%d", test.pay, test.amount, c.Pay)
+		}
+	}
+
+	// A suggested price below the price is raised to the price
+	product.SuggestedPrice = 1
+	c, err := checkout.PayWhatYouWant(product, "")
+	if err != nil || c.Pay != 500 || c.Price != "5.00 USD/One Time" {
+		t.Fatalf("pay: expected the price for a low suggested price got:%v %v", c, err)
+	}
+}
+
+// Test a quote with an amount chosen by the buyer is only accepted for pay what you want products
+func TestPayQuote(t *testing.T) {
+	product := products.New()
+	product.ID = 1
+	product.Schedule = "onetime"
+	product.PriceMode = products.PriceModePayWhatYouWant
+	product.PaypalPrice = map[string]map[string]interface{}{"DF": {"amount": 5.0, "currency": "USD"}}
+
+	token, err := NewQuote(product, "paypal", "DF", 2000)
+	if err != nil {
+		t.Fatalf("pay: error signing quote: %s", err)
+	}
+
+	quote, err := VerifyQuote(token, product, "paypal")
+	if err != nil || quote.Pay != 2000 {
+		t.Fatalf("pay: expected quote for 2000 got:%v %v", quote, err)
+	}
+
+	product.PriceMode = products.PriceModeFixed
+	if _, err = VerifyQuote(token, product, "paypal"); err != ErrQuoteMismatch {
+		t.Fatalf("pay: expected quote to be refused for a fixed price product got:%v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
@@ -18,6 +19,7 @@ import (
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/view"
 	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
 	"github.com/google/uuid"
 )
 
@@ -60,6 +62,15 @@ func HandlePaypalShow(w http.ResponseWriter, r *http.Request) error {
 		currency = product.PaypalPrice[clientCountry]["currency"]
 	}
 
+	// The price must be the one signed on the product page
+	quote, err := VerifyQuote(params.Get("quote"), product, "paypal")
+	if err == nil && !quote.Matches(amount, currency) {
+		err = ErrQuoteMismatch
+	}
+	if err != nil {
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
 	// Render the template
 	view := view.NewRenderer(w, r)
 
@@ -85,11 +96,40 @@ func HandlePaypalShow(w http.ResponseWriter, r *http.Request) error {
 		}
 		view.AddKey("price", fmt.Sprintf("%d %s/%s", amount, currency, scheduleLabel))
 		view.AddKey("meta_payment_script_type", "subscription")
+
+		// The subscription of a product with a free trial starts billing when the trial ends
+		if product.Trial() {
+			view.AddKey("meta_subscription_start_time", TrialEnd(product, time.Now()).Format(time.RFC3339))
+		}
 		view.AddKey("loadPaypalSubscriptionScript", true)
+
+		// The affiliate who referred the buyer is added to the custom id of the subscription
+		if affiliateID := referrer(r); affiliateID > 0 {
+			view.AddKey("meta_affiliate_id", affiliateID)
+		}
+	}
+
+	// The buyer of a pay what you want product pays the amount they chose
+	if quote.Pay > 0 {
+		amount = float64(quote.Pay) / 100
+		view.AddKey("price", fmt.Sprintf("%s %s/One Time", majorUnits(quote.Pay), currency))
 	}
 
 	view.AddKey("currency", currency)
 
+	// Show the discount of the coupon entered on the product page, it is taken off when the order is created
+	if params.Get("coupon") != "" {
+		coupon, err := FindCoupon(params.Get("coupon"), product, "paypal")
+		if err != nil {
+			return server.Redirect(w, r, couponFailure(err))
+		}
+		view.AddKey("couponLabel", coupon.Code+": "+coupon.Label())
+	}
+
+	// The price of a subscription plan is fixed so its tax is included
+	tax := checkoutTax(0, RequestCountry(r), "", params.Get("tax_id"), taxes.Inclusive() || product.Schedule != "onetime")
+	view.AddKey("taxLabel", tax.Label())
+
 	if !config.Production() {
 		view.AddKey("sandbox", true)
 		view.AddKey("country", clientCountry)
@@ -157,24 +197,72 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 		tax = product.PaypalPrice["DF"]["tax"]
 	}
 
+	// The price must be the one signed on the product page
+	quote, err := VerifyQuote(params.Get("quote"), product, "paypal")
+	if err == nil && !quote.Matches(amount, currency) {
+		err = ErrQuoteMismatch
+	}
+	if err != nil {
+		log.Error(log.V{"Paypal order, price refused": err, "product_id": productId})
+		return server.BadRequestError(err, "Invalid price", "The "+err.Error()+", please go back to the product page and try again.")
+	}
+
+	// The buyer of a pay what you want product pays the amount they chose
+	if quote.Pay > 0 {
+		amount = float64(quote.Pay) / 100
+	}
+
+	// The coupon entered on the product page is taken off the item total
+	var coupon *coupons.Coupon
+	var discount int64
+	if params.Get("coupon") != "" {
+		coupon, err = FindCoupon(params.Get("coupon"), product, "paypal")
+		if err == nil {
+			discount, err = coupon.Discount(minorUnits(fmt.Sprintf("%.2f", amount)), currency.(string))
+		}
+		if err != nil {
+			log.Error(log.V{"Paypal order, coupon can't be used": err, "code": params.Get("coupon")})
+			return server.BadRequestError(err, "Invalid discount code", "The discount code can't be used, "+err.Error()+".")
+		}
+	}
+
+	// The rate of the buyer's country replaces the tax of the price, an inclusive tax is part of the item total
+	itemTotal := minorUnits(fmt.Sprintf("%.2f", amount))
+	taxTotal := minorUnits(fmt.Sprintf("%.2f", tax))
+	taxCalculation := checkoutTax(itemTotal-discount, RequestCountry(r), "", params.Get("tax_id"), taxes.Inclusive())
+	if taxCalculation.Name != "" {
+		taxTotal = taxCalculation.Tax
+		if taxCalculation.Inclusive {
+			itemTotal -= taxCalculation.Tax
+		}
+	}
+
+	breakdown := Breakdown{
+		ItemTotal: ItemTotal{
+			CurrencyCode: currency.(string),
+			Value:        majorUnits(itemTotal),
+		},
+		TaxTotal: TaxTotal{
+			CurrencyCode: currency.(string),
+			Value:        majorUnits(taxTotal),
+		},
+	}
+	if discount > 0 {
+		breakdown.Discount = Discount{
+			CurrencyCode: currency.(string),
+			Value:        majorUnits(discount),
+		}
+	}
+
 	data := PaypalCreateOrder{
 		Intent: "CAPTURE",
 		PurchaseUnits: []PurchaseUnits{
 			{
-				CustomID: customId,
+				CustomID: withAffiliate(customId, referrer(r)),
 				Amount: Amount{
 					CurrencyCode: currency.(string),
-					Value:        fmt.Sprintf("%.2f", float64(amount.(float64))+float64(tax.(float64))),
-					Breakdown: Breakdown{
-						ItemTotal: ItemTotal{
-							CurrencyCode: currency.(string),
-							Value:        fmt.Sprintf("%.2f", amount),
-						},
-						TaxTotal: TaxTotal{
-							CurrencyCode: currency.(string),
-							Value:        fmt.Sprintf("%.2f", tax),
-						},
-					},
+					Value:        majorUnits(itemTotal + taxTotal - discount),
+					Breakdown:    breakdown,
 				},
 				Items: []Items{
 					{
@@ -184,7 +272,7 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 						Sku:         fmt.Sprintf("%d", product.ID),
 						UnitAmount: UnitAmount{
 							CurrencyCode: currency.(string),
-							Value:        fmt.Sprintf("%.2f", amount),
+							Value:        majorUnits(itemTotal),
 						},
 					},
 				},
@@ -192,6 +280,60 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 		},
 	}
 
+	paypalCreateOrderResult, err := createPaypalOrder(data)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if coupon != nil && paypalCreateOrderResult.ID != "" {
+		_, err = applyCoupon(coupon, product, "paypal", paypalCreateOrderResult.ID, discount, currency.(string))
+		if err == coupons.ErrLimitReached {
+			return server.BadRequestError(err, "Invalid discount code", "The discount code can't be used, "+err.Error()+".")
+		} else if err != nil {
+			log.Error(log.V{"Paypal order, error applying coupon": err, "code": coupon.Code})
+			return server.InternalError(err)
+		}
+	}
+
+	if paypalCreateOrderResult.ID != "" {
+		err = recordTax(taxCalculation, taxTotal, product.ID, "paypal", paypalCreateOrderResult.ID, RequestCountry(r), "", currency.(string))
+		if err != nil {
+			log.Error(log.V{"Paypal order, error recording tax evidence": err})
+			return server.InternalError(err)
+		}
+	}
+
+	// return the order ID in paypalCreateOrderResult as JSON
+	return json.NewEncoder(w).Encode(paypalCreateOrderResult)
+}
+
+// HandlePaypalCaptureOrder creates order and returns order id.
+// It responds to /subscriptions/paypal/orders/{id}/capture
+func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	orderId := params.Get("id")
+
+	paypalCaptureOrderResult, err := capturePaypalOrder(orderId)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// return the order ID in paypalCreateOrderResult as JSON
+	return json.NewEncoder(w).Encode(paypalCaptureOrderResult)
+}
+
+// createPaypalOrder creates the order at PayPal and returns its id and links
+func createPaypalOrder(data PaypalCreateOrder) (*PaypalCreateOrderResult, error) {
 	payloadBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Error(log.V{"Error marshalling data": err})
@@ -201,7 +343,7 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 	req, err := http.NewRequest(http.MethodPost, config.Get("paypal_api_domain")+"/v2/checkout/orders", body)
 	if err != nil {
 		log.Error(log.V{"Error sending request to create paypal order": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	// Generate a new Version 4 UUID
@@ -209,14 +351,14 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 
 	if err != nil {
 		log.Error(log.V{"Error generating UUID": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	accessToken, err := GetPaypalAuthorizationToken()
 
 	if err != nil {
 		log.Error(log.V{"Error getting access token": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -227,7 +369,7 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Error(log.V{"Error sending request for creating paypal order": err})
-
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -236,36 +378,21 @@ func HandlePaypalCreateOrder(w http.ResponseWriter, r *http.Request) error {
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Error(log.V{"Paypal error reading order create response body": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(b, &paypalCreateOrderResult)
 
 	if err != nil {
 		log.Error(log.V{"Paypal error unmarshaling order create response": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
-	// return the order ID in paypalCreateOrderResult as JSON
-	return json.NewEncoder(w).Encode(paypalCreateOrderResult)
+	return &paypalCreateOrderResult, nil
 }
 
-// HandlePaypalCaptureOrder creates order and returns order id.
-// It responds to /subscriptions/paypal/orders/{id}/capture
-func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
-	// Check the authenticity token
-	err := session.CheckAuthenticity(w, r)
-	if err != nil {
-		return err
-	}
-
-	params, err := mux.Params(r)
-	if err != nil {
-		return server.InternalError(err)
-	}
-
-	orderId := params.Get("id")
-
+// capturePaypalOrder captures the payment of the order approved by the buyer
+func capturePaypalOrder(orderId string) (*PaypalCaptureOrderResult, error) {
 	// This request doesn't require payload
 	data := map[string]interface{}{}
 
@@ -277,8 +404,8 @@ func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
 
 	req, err := http.NewRequest(http.MethodPost, config.Get("paypal_api_domain")+"/v2/checkout/orders/"+orderId+"/capture", body)
 	if err != nil {
-		// handle err
 		log.Error(log.V{"Error sending paypal order capture request": err})
+		return nil, err
 	}
 
 	// Generate a new Version 4 UUID
@@ -286,14 +413,14 @@ func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
 
 	if err != nil {
 		log.Error(log.V{"Error generating UUID": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	accessToken, err := GetPaypalAuthorizationToken()
 
 	if err != nil {
 		log.Error(log.V{"Error getting access token": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -304,7 +431,7 @@ func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Error(log.V{"Error sending request for capturing paypal order": err})
-
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -313,18 +440,17 @@ func HandlePaypalCaptureOrder(w http.ResponseWriter, r *http.Request) error {
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Error(log.V{"Paypal error reading order capture response body": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(b, &paypalCaptureOrderResult)
 
 	if err != nil {
 		log.Error(log.V{"Paypal error unmarshaling order capture response": err})
-		return server.InternalError(err)
+		return nil, err
 	}
 
-	// return the order ID in paypalCreateOrderResult as JSON
-	return json.NewEncoder(w).Encode(paypalCaptureOrderResult)
+	return &paypalCaptureOrderResult, nil
 }
 
 // GetPaypalAuthorizationToken fetches the bearer access token and returns it
@@ -605,3 +731,34 @@ func CancelPaypalSubscription(subscriptionId string) error {
 		return fmt.Errorf("failed to cancel subscription, status code: %d", resp.StatusCode)
 	}
 }
+
+// paypalClient sends the requests to PayPal's API, timing out rather than holding up the request or job which sent them
+var paypalClient = &http.Client{Timeout: 30 * time.Second}
+
+// paypalRequest sends the payload as JSON to the path of PayPal's API with a new access token, a nil payload sends no body.
+// The caller closes the body of the response.
+func paypalRequest(method string, path string, payload interface{}) (*http.Response, error) {
+	accessToken, err := GetPaypalAuthorizationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequest(method, config.Get("paypal_api_domain")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	return paypalClient.Do(req)
+}
@@ -0,0 +1,25 @@
+package subscriptions
+
+import "time"
+
+type PaypalEventDispute struct {
+	ID           string    `json:"id,omitempty"`
+	CreateTime   time.Time `json:"create_time,omitempty"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	EventType    string    `json:"event_type,omitempty"`
+	Summary      string    `json:"summary,omitempty"`
+	Resource     struct {
+		DisputeID            string `json:"dispute_id,omitempty"`
+		Reason               string `json:"reason,omitempty"`
+		Status               string `json:"status,omitempty"`
+		DisputedTransactions []struct {
+			SellerTransactionID string `json:"seller_transaction_id,omitempty"`
+			BuyerTransactionID  string `json:"buyer_transaction_id,omitempty"`
+			Custom              string `json:"custom,omitempty"`
+		} `json:"disputed_transactions,omitempty"`
+		DisputeAmount struct {
+			Value        string `json:"value,omitempty"`
+			CurrencyCode string `json:"currency_code,omitempty"`
+		} `json:"dispute_amount,omitempty"`
+	} `json:"resource,omitempty"`
+}
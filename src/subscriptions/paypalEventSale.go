@@ -0,0 +1,26 @@
+package subscriptions
+
+import "time"
+
+// PaypalEventSale is the PAYMENT.SALE.COMPLETED webhook event of PayPal, each payment of a subscription is a sale
+type PaypalEventSale struct {
+	ID           string    `json:"id,omitempty"`
+	CreateTime   time.Time `json:"create_time,omitempty"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	EventType    string    `json:"event_type,omitempty"`
+	Summary      string    `json:"summary,omitempty"`
+	Resource     struct {
+		ID                 string `json:"id,omitempty"`
+		State              string `json:"state,omitempty"`
+		BillingAgreementID string `json:"billing_agreement_id,omitempty"`
+		Custom             string `json:"custom,omitempty"`
+		Amount             struct {
+			Total    string `json:"total,omitempty"`
+			Currency string `json:"currency,omitempty"`
+		} `json:"amount,omitempty"`
+		TransactionFee struct {
+			Value    string `json:"value,omitempty"`
+			Currency string `json:"currency,omitempty"`
+		} `json:"transaction_fee,omitempty"`
+	} `json:"resource,omitempty"`
+}
@@ -0,0 +1,24 @@
+package subscriptions
+
+import "time"
+
+// PaypalEventSaleRefund is the PAYMENT.SALE.REFUNDED webhook event of PayPal, a refund of a payment of a subscription
+type PaypalEventSaleRefund struct {
+	ID           string    `json:"id,omitempty"`
+	CreateTime   time.Time `json:"create_time,omitempty"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	EventType    string    `json:"event_type,omitempty"`
+	Summary      string    `json:"summary,omitempty"`
+	Resource     struct {
+		ID                 string `json:"id,omitempty"`
+		State              string `json:"state,omitempty"`
+		SaleID             string `json:"sale_id,omitempty"`
+		BillingAgreementID string `json:"billing_agreement_id,omitempty"`
+		Custom             string `json:"custom,omitempty"`
+		Reason             string `json:"reason,omitempty"`
+		Amount             struct {
+			Total    string `json:"total,omitempty"`
+			Currency string `json:"currency,omitempty"`
+		} `json:"amount,omitempty"`
+	} `json:"resource,omitempty"`
+}
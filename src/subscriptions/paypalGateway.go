@@ -0,0 +1,352 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/plutov/paypal/v4"
+)
+
+// PaypalGateway is the Gateway adapter for PayPal
+type PaypalGateway struct{}
+
+// Name returns the name of the gateway
+func (g *PaypalGateway) Name() string {
+	return "paypal"
+}
+
+// Enabled reports whether PayPal is switched on
+func (g *PaypalGateway) Enabled() bool {
+	return config.GetBool("paypal")
+}
+
+// HasPrice reports whether the product has a PayPal price or plan for the country
+func (g *PaypalGateway) HasPrice(product *products.Story, country string) bool {
+	return product.PaypalPrice != nil && product.PaypalPrice[country] != nil && (product.PaypalPrice[country]["amount"] != nil || product.PaypalPrice[country]["plan_id"] != nil)
+}
+
+// Checkout returns the PayPal price of the product for the country and the link to the PayPal checkout page
+func (g *PaypalGateway) Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error) {
+	amount := product.PaypalPrice[country]["amount"]
+	currency := product.PaypalPrice[country]["currency"]
+
+	amountValue, ok := amount.(float64)
+	currencyValue, ok2 := currency.(string)
+	if !ok || !ok2 {
+		return nil, errors.New("Invalid price details for client country: " + country)
+	}
+
+	checkout := &Checkout{
+		Type:       checkoutType(product.Schedule),
+		Price:      strconv.FormatFloat(amountValue, 'g', 5, 64) + " " + currencyValue + "/" + scheduleLabel(product.Schedule),
+		Amount:     amount,
+		Currency:   currency,
+		UnitAmount: minorUnits(fmt.Sprintf("%.2f", amountValue)),
+	}
+
+	if checkout.Type == "onetime" {
+		checkout.Link = "/subscriptions/paypal?" + fmt.Sprintf("type=%s&product_id=%d", "onetime", product.ID)
+	} else {
+		planId, ok := product.PaypalPrice[country]["plan_id"].(string)
+		if !ok {
+			return nil, errors.New("Invalid plan details for client country: " + country)
+		}
+		checkout.Link = "/subscriptions/paypal?" + fmt.Sprintf("type=%s&product_id=%d&plan_id=%s&redirect_uri=%s&custom_id=%s", "subscription", product.ID, planId, redirectURI, customID)
+	}
+
+	return checkout, nil
+}
+
+// VerifyWebhook asks PayPal to verify the signature of the request
+func (g *PaypalGateway) VerifyWebhook(r *http.Request) ([]byte, error) {
+	// Determine API base URL based on environment
+	apiBase := paypal.APIBaseLive
+	if !config.Production() {
+		apiBase = paypal.APIBaseSandBox
+	}
+
+	c, err := paypal.NewClient(config.Get("paypal_client_id"), config.Get("paypal_client_secret"), apiBase)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client restores the body after reading it for verification
+	verifyWebhookResponse, err := c.VerifyWebhookSignature(context.Background(), r, config.Get("paypal_webhook_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if verifyWebhookResponse.VerificationStatus != "SUCCESS" {
+		return nil, errors.New("invalid paypal webhook signature")
+	}
+
+	return io.ReadAll(r.Body)
+}
+
+// NormaliseEvent converts a PayPal order or subscription event into a PaymentEvent,
+// the affiliate who referred the buyer is split from the custom id
+func (g *PaypalGateway) NormaliseEvent(body []byte) (*PaymentEvent, error) {
+	paymentEvent, err := g.normaliseEvent(body)
+	if paymentEvent != nil {
+		paymentEvent.CustomID, paymentEvent.AffiliateID = splitAffiliate(paymentEvent.CustomID)
+	}
+	return paymentEvent, err
+}
+
+// normaliseEvent converts the event of PayPal with the custom id as it was sent to PayPal
+func (g *PaypalGateway) normaliseEvent(body []byte) (*PaymentEvent, error) {
+	var paypalWebhookEvent PaypalWebhookEvent
+	err := json.Unmarshal(body, &paypalWebhookEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch paypalWebhookEvent.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		var paypalEventCheckout PaypalEventCheckout
+		err = json.Unmarshal(body, &paypalEventCheckout)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventCheckout.Resource
+		if len(resource.PurchaseUnits) == 0 {
+			return nil, errors.New("paypal order has no purchase units")
+		}
+		purchaseUnit := resource.PurchaseUnits[0]
+
+		paymentEvent := &PaymentEvent{
+			ID:            paypalEventCheckout.ID,
+			Gateway:       g.Name(),
+			Type:          WebhookPaymentSucceeded,
+			PaymentID:     resource.ID,
+			OrderID:       resource.ID,
+			CustomerID:    resource.Payer.PayerID,
+			CustomerEmail: resource.Payer.EmailAddress,
+			CustomerName:  resource.Payer.Name.GivenName,
+			CustomID:      purchaseUnit.CustomID,
+			Amount:        minorUnits(purchaseUnit.Amount.Value),
+			Tax:           minorUnits(purchaseUnit.Amount.Breakdown.TaxTotal.Value),
+			Currency:      purchaseUnit.Amount.CurrencyCode,
+			Status:        resource.Status,
+			Created:       paypalEventCheckout.CreateTime.UTC(),
+		}
+
+		paymentEvent.AddressCountry = resource.Payer.Address.CountryCode
+
+		// Orders are stored by capture id once captured
+		if len(purchaseUnit.Payments.Captures) > 0 {
+			paymentEvent.PaymentID = purchaseUnit.Payments.Captures[0].ID
+		}
+
+		// The sku of the item is the product id
+		if len(purchaseUnit.Items) > 0 {
+			paymentEvent.ProductID, _ = strconv.ParseInt(purchaseUnit.Items[0].Sku, 10, 64)
+		}
+
+		return paymentEvent, nil
+
+	case "PAYMENT.CAPTURE.REFUNDED":
+		var paypalEventCaptureRefund PaypalEventCaptureRefund
+		err = json.Unmarshal(body, &paypalEventCaptureRefund)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventCaptureRefund.Resource
+
+		paymentEvent := &PaymentEvent{
+			ID:            paypalEventCaptureRefund.ID,
+			Gateway:       g.Name(),
+			Type:          WebhookPaymentRefunded,
+			CustomerEmail: resource.Payer.EmailAddress,
+			CustomID:      resource.CustomID,
+			Amount:        minorUnits(resource.Amount.Value),
+			Currency:      resource.Amount.CurrencyCode,
+			Status:        "REFUNDED",
+			Created:       paypalEventCaptureRefund.CreateTime.UTC(),
+		}
+		paymentEvent.RefundID = resource.ID
+		paymentEvent.AmountRefunded = minorUnits(resource.SellerPayableBreakdown.TotalRefundedAmount.Value)
+
+		// The up link of the refund is the refunded capture e.g. https://api.sandbox.paypal.com/v2/payments/captures/2K3372465B542845P
+		for _, link := range resource.Links {
+			if link.Rel == "up" {
+				paymentEvent.PaymentID = link.Href[strings.LastIndex(link.Href, "/")+1:]
+			}
+		}
+
+		return paymentEvent, nil
+
+	case "CUSTOMER.DISPUTE.CREATED":
+		var paypalEventDispute PaypalEventDispute
+		err = json.Unmarshal(body, &paypalEventDispute)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventDispute.Resource
+
+		paymentEvent := &PaymentEvent{
+			ID:       paypalEventDispute.ID,
+			Gateway:  g.Name(),
+			Type:     WebhookPaymentDisputed,
+			RefundID: resource.DisputeID,
+			Amount:   minorUnits(resource.DisputeAmount.Value),
+			Currency: resource.DisputeAmount.CurrencyCode,
+			Reason:   resource.Reason,
+			Status:   resource.Status,
+			Created:  paypalEventDispute.CreateTime.UTC(),
+		}
+
+		// The seller transaction of the dispute is the disputed capture
+		if len(resource.DisputedTransactions) > 0 {
+			paymentEvent.PaymentID = resource.DisputedTransactions[0].SellerTransactionID
+			paymentEvent.CustomID = resource.DisputedTransactions[0].Custom
+		}
+
+		return paymentEvent, nil
+
+	case "PAYMENT.SALE.COMPLETED":
+		var paypalEventSale PaypalEventSale
+		err = json.Unmarshal(body, &paypalEventSale)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventSale.Resource
+
+		// Only the payments of subscriptions are sales, orders are captured
+		if resource.BillingAgreementID == "" {
+			return nil, nil
+		}
+
+		// The state of the sale isn't the status of the subscription
+		return &PaymentEvent{
+			ID:             paypalEventSale.ID,
+			Gateway:        g.Name(),
+			Type:           WebhookPaymentSucceeded,
+			SubscriptionID: resource.BillingAgreementID,
+			PaymentID:      resource.ID,
+			CustomID:       resource.Custom,
+			Amount:         minorUnits(resource.Amount.Total),
+			Fee:            minorUnits(resource.TransactionFee.Value),
+			Currency:       resource.Amount.Currency,
+			Created:        paypalEventSale.CreateTime.UTC(),
+		}, nil
+
+	case "PAYMENT.SALE.REFUNDED":
+		var paypalEventSaleRefund PaypalEventSaleRefund
+		err = json.Unmarshal(body, &paypalEventSaleRefund)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventSaleRefund.Resource
+
+		// The refunded sale is a payment of the subscription, the amount is of this refund
+		return &PaymentEvent{
+			ID:             paypalEventSaleRefund.ID,
+			Gateway:        g.Name(),
+			Type:           WebhookPaymentRefunded,
+			SubscriptionID: resource.BillingAgreementID,
+			PaymentID:      resource.SaleID,
+			RefundID:       resource.ID,
+			CustomID:       resource.Custom,
+			Amount:         minorUnits(resource.Amount.Total),
+			Currency:       resource.Amount.Currency,
+			Reason:         resource.Reason,
+			Status:         "REFUNDED",
+			Created:        paypalEventSaleRefund.CreateTime.UTC(),
+		}, nil
+
+	case "BILLING.SUBSCRIPTION.ACTIVATED", "BILLING.SUBSCRIPTION.CREATED", "BILLING.SUBSCRIPTION.UPDATED",
+		"BILLING.SUBSCRIPTION.EXPIRED", "BILLING.SUBSCRIPTION.CANCELLED", "BILLING.SUBSCRIPTION.SUSPENDED",
+		"BILLING.SUBSCRIPTION.PAYMENT.FAILED":
+		var paypalEventSubscription PaypalEventSubscription
+		err = json.Unmarshal(body, &paypalEventSubscription)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := paypalEventSubscription.Resource
+
+		paymentEvent := &PaymentEvent{
+			ID:             paypalEventSubscription.ID,
+			Gateway:        g.Name(),
+			Type:           WebhookSubscriptionUpdated,
+			PlanID:         resource.PlanID,
+			SubscriptionID: resource.ID,
+			CustomerID:     resource.Subscriber.PayerID,
+			CustomerEmail:  resource.Subscriber.EmailAddress,
+			CustomerName:   resource.Subscriber.Name.GivenName,
+			CustomID:       resource.CustomID,
+			Amount:         minorUnits(resource.BillingInfo.LastPayment.Amount.Value),
+			Currency:       resource.BillingInfo.LastPayment.Amount.CurrencyCode,
+			Status:         resource.Status,
+			Created:        paypalEventSubscription.CreateTime.UTC(),
+		}
+
+		switch paypalWebhookEvent.EventType {
+		case "BILLING.SUBSCRIPTION.ACTIVATED":
+			paymentEvent.Type = WebhookSubscriptionActivated
+		case "BILLING.SUBSCRIPTION.CANCELLED":
+			paymentEvent.Type = WebhookSubscriptionCancelled
+		case "BILLING.SUBSCRIPTION.PAYMENT.FAILED":
+			paymentEvent.Type = WebhookPaymentFailed
+		}
+
+		return paymentEvent, nil
+	}
+
+	return nil, nil
+}
+
+// Cancel cancels the PayPal subscription
+func (g *PaypalGateway) Cancel(subscriptionID string) error {
+	return CancelPaypalSubscription(subscriptionID)
+}
+
+// Refund refunds the PayPal capture of an order, or the sale of a subscription's payment
+func (g *PaypalGateway) Refund(paymentID string, amount int64, currency string) error {
+	value := strconv.FormatFloat(float64(amount)/100, 'f', 2, 64)
+
+	data := map[string]interface{}{}
+	if amount > 0 {
+		data["amount"] = map[string]string{"value": value, "currency_code": strings.ToUpper(currency)}
+	}
+
+	resp, err := paypalRequest(http.MethodPost, fmt.Sprintf("/v2/payments/captures/%s/refund", paymentID), data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// The payments of subscriptions are sales of the v1 API rather than captures
+	if resp.StatusCode == http.StatusNotFound {
+		data = map[string]interface{}{}
+		if amount > 0 {
+			data["amount"] = map[string]string{"total": value, "currency": strings.ToUpper(currency)}
+		}
+
+		resp, err = paypalRequest(http.MethodPost, fmt.Sprintf("/v1/payments/sale/%s/refund", paymentID), data)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to refund paypal payment, status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,793 @@
+package subscriptions
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/affiliates"
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mail"
+	"github.com/abishekmuthian/open-payment-host/src/lib/mailchimp"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/offers"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+)
+
+// ProcessPaymentEvent applies a normalised gateway event, it records the payment or subscription
+// in the ledger and then updates the product counters, the mailing list, the product's webhook
+// and the customer's receipt in the same way whichever gateway sent the event.
+// Each event is processed once, redeliveries by the gateway are ignored.
+func ProcessPaymentEvent(event *PaymentEvent) error {
+	log.Info(log.V{"msg": "Processing payment event", "pg": event.Gateway, "type": event.Type, "event_id": event.ID})
+
+	var duplicate bool
+	var effects []func()
+
+	// The ledger and counters are updated in one transaction so a failed event can be retried by the gateway
+	err := query.Transaction(func(tx *query.Tx) error {
+		if event.ID != "" {
+			_, err := FindProcessedEvent(tx, event.Gateway, event.ID)
+			if err == nil {
+				duplicate = true
+				return nil
+			}
+			if err != ErrEventNotProcessed {
+				return err
+			}
+
+			err = recordProcessedEvent(tx, event)
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		effects, err = applyPaymentEvent(tx, event)
+		return err
+	})
+	if err != nil {
+		log.Error(log.V{"Payment event, error processing event": err, "pg": event.Gateway, "event_id": event.ID})
+		return err
+	}
+
+	if duplicate {
+		log.Info(log.V{"msg": "Payment event already processed", "pg": event.Gateway, "type": event.Type, "event_id": event.ID})
+		return nil
+	}
+
+	// Calls to other services are made once the transaction is committed
+	for _, effect := range effects {
+		effect()
+	}
+
+	return nil
+}
+
+// applyPaymentEvent updates the ledger and product counters for the event,
+// returning the side effects to apply once they are saved
+func applyPaymentEvent(tx *query.Tx, event *PaymentEvent) ([]func(), error) {
+	subscription := findPaymentEventRecord(tx, event)
+	product := findPaymentEventProduct(tx, event, subscription)
+
+	if subscription == nil {
+		if !createsRecord(event) {
+			log.Info(log.V{"msg": "Payment event has no record to update", "pg": event.Gateway, "type": event.Type, "event_id": event.ID})
+			return nil, nil
+		}
+
+		// The products of a cart are recorded on its order rather than the payment
+		order, _ := orders.FindPendingTx(tx, event.Gateway, event.ReceiptID, event.OrderID, event.PaymentID, event.SubscriptionID)
+		if order != nil {
+			product = nil
+		}
+
+		subscription, err := recordPaymentEvent(tx, event, product)
+		if err != nil {
+			log.Error(log.V{"Payment event, error recording transaction": err})
+			return nil, err
+		}
+
+		// A subscription of a product with a free trial starts in its trial
+		state := StateActive
+		if subscription.SubscriptionId != "" && product != nil && product.Trial() {
+			state = StateTrialing
+		}
+		_, err = subscription.Transition(tx, state, event)
+		if err != nil {
+			return nil, err
+		}
+
+		// A coupon applied to the checkout is redeemed for the payment
+		redemption, err := coupons.FindPendingRedemption(tx, event.Gateway, event.ReceiptID, event.OrderID, event.PaymentID, event.SubscriptionID)
+		if err == nil {
+			err = redeemCoupon(tx, redemption, subscription)
+			if err != nil {
+				log.Error(log.V{"Payment event, error redeeming coupon": err, "id": subscription.ID})
+				return nil, err
+			}
+		}
+
+		// The location evidence and tax of the checkout are attached to the payment
+		evidence, err := taxes.FindPendingEvidence(tx, event.Gateway, event.ReceiptID, event.OrderID, event.PaymentID, event.SubscriptionID)
+		if err == nil {
+			err = attachEvidence(tx, evidence, subscription)
+			if err != nil {
+				log.Error(log.V{"Payment event, error attaching tax evidence": err, "id": subscription.ID})
+				return nil, err
+			}
+		}
+
+		// An upsell paid with one click is paid by the payment
+		offer, err := offers.FindAccepted(tx, event.Gateway, event.ReceiptID, event.OrderID, event.PaymentID, event.SubscriptionID)
+		if err == nil {
+			err = offer.Pay(tx, subscription.ID)
+			if err != nil {
+				log.Error(log.V{"Payment event, error paying offer": err, "id": subscription.ID})
+				return nil, err
+			}
+		}
+
+		// The affiliate who referred the buyer earns a commission on the payment
+		err = earnCommission(tx, subscription, order, product, event.Amount, int64(math.Round(subscription.Tax*100)))
+		if err != nil {
+			log.Error(log.V{"Payment event, error recording commission": err, "id": subscription.ID})
+			return nil, err
+		}
+
+		if order != nil {
+			return orderPaid(tx, event, subscription, order)
+		}
+
+		return paymentRecorded(tx, event, subscription, product)
+	}
+
+	if event.Type == WebhookPaymentRefunded || event.Type == WebhookPaymentDisputed {
+		return refundRecorded(tx, event, subscription, product)
+	}
+
+	// The first charge of a subscription in its free trial converts the trial
+	var effects []func()
+	if event.Type == WebhookPaymentSucceeded && event.Amount > 0 && subscription.Trialing() {
+		var err error
+		effects, err = trialConverted(tx, event, subscription, product)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Each payment of a subscription after it started gets an invoice of its own
+	if event.Type == WebhookPaymentSucceeded && subscription.SubscriptionId != "" && product != nil {
+		invoice, err := issuePaymentInvoice(tx, event, subscription, product)
+		if err != nil {
+			log.Error(log.V{"Payment event, error issuing invoice": err, "id": subscription.ID})
+			return nil, err
+		}
+		if invoice != nil {
+			effects = append(effects, func() { sendInvoice(invoice, product.Name) })
+		}
+	}
+
+	if event.Status != "" && event.Status != subscription.PaymentStaus {
+		err := subscription.UpdateTx(tx, map[string]string{"payment_status": event.Status})
+		if err != nil {
+			log.Error(log.V{"Payment event, error updating transaction": err})
+			return nil, err
+		}
+		subscription.PaymentStaus = event.Status
+		log.Info(log.V{"msg": "Payment event, transaction updated", "id": subscription.ID, "status": event.Status})
+	}
+
+	// A plan change the customer approved at the gateway moves the subscription to the product of the new plan
+	planEffects, moved, err := planApproved(tx, event, subscription)
+	if err != nil {
+		return nil, err
+	}
+	effects = append(effects, planEffects...)
+	if moved {
+		product = findPaymentEventProduct(tx, event, subscription)
+	}
+
+	// The status of each gateway is mapped onto the canonical state of the subscription
+	previousState := subscription.State
+	wasEnded := subscription.Ended()
+	changed, err := subscription.Transition(tx, eventState(subscription.State, event), event)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed payment is recovered by reminding the customer until a later charge succeeds
+	if changed {
+		dunningEffects, err := dunningChanged(tx, event, subscription, product, previousState)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, dunningEffects...)
+
+		// A paused or unpaid subscriber loses access until the subscription is resumed or paid
+		pauseEffects, err := pauseChanged(tx, subscription, product, previousState)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, pauseEffects...)
+	}
+
+	if subscription.Ended() && !wasEnded {
+		endedEffects, err := subscriptionEnded(tx, event, subscription, product)
+		return append(effects, endedEffects...), err
+	}
+
+	return effects, nil
+}
+
+// createsRecord reports whether the event starts a new payment or subscription,
+// other events only update a record created earlier
+func createsRecord(event *PaymentEvent) bool {
+	switch event.Type {
+	case WebhookSubscriptionActivated:
+		return event.SubscriptionID != ""
+	case WebhookPaymentSucceeded:
+		// Renewals of a subscription are recorded against the subscription
+		return event.SubscriptionID == "" && event.PaymentID != ""
+	}
+	return false
+}
+
+// findPaymentEventRecord returns the ledger record of the event's subscription, payment or order
+func findPaymentEventRecord(tx *query.Tx, event *PaymentEvent) *Subscription {
+	if event.SubscriptionID != "" {
+		subscription, err := FindSubscriptionTx(tx, event.SubscriptionID)
+		if err == nil {
+			return subscription
+		}
+		// A payment of a subscription is never recorded on its own
+		return nil
+	}
+
+	for _, id := range []string{event.PaymentID, event.OrderID} {
+		if id == "" {
+			continue
+		}
+		subscription, err := FindPaymentTx(tx, id)
+		if err == nil {
+			return subscription
+		}
+	}
+
+	return nil
+}
+
+// findPaymentEventProduct returns the product the event is for, from the event,
+// the ledger record or the gateway plan of the subscription
+func findPaymentEventProduct(tx *query.Tx, event *PaymentEvent, subscription *Subscription) *products.Story {
+	productID := event.ProductID
+	if productID == 0 && subscription != nil {
+		productID = subscription.ProductId
+	}
+
+	if productID > 0 {
+		product, err := products.FindTx(tx, productID)
+		if err == nil {
+			return product
+		}
+		log.Error(log.V{"Payment event, error finding product": err, "product_id": productID})
+	}
+
+	if event.PlanID != "" {
+		product, err := products.FindPlanIdTx(tx, event.PlanID)
+		if err == nil && product != nil {
+			return product
+		}
+		log.Error(log.V{"Payment event, error finding product by plan id": err, "plan_id": event.PlanID})
+	}
+
+	return nil
+}
+
+// recordPaymentEvent adds the payment or subscription to the ledger
+func recordPaymentEvent(tx *query.Tx, event *PaymentEvent, product *products.Story) (*Subscription, error) {
+	// Params not validated using ValidateParams as user did not create these
+	transactionParams := make(map[string]string)
+	transactionParams["pg"] = event.Gateway
+	// Subscriptions started without a payment have no payment id, the plan is shared by every subscriber
+	transactionParams["txn_id"] = event.PaymentID
+	transactionParams["subscr_id"] = event.SubscriptionID
+	transactionParams["payment_date"] = query.TimeString(event.Created)
+	transactionParams["payment_gross"] = majorUnits(event.Amount)
+	transactionParams["mc_currency"] = event.Currency
+	transactionParams["payment_status"] = event.Status
+	transactionParams["payer_id"] = event.CustomerID
+	transactionParams["payer_email"] = event.CustomerEmail
+	transactionParams["first_name"] = event.CustomerName
+	transactionParams["user_id"] = event.CustomID
+	transactionParams["receipt_id"] = event.ReceiptID
+	transactionParams["invoice"] = event.OrderID
+	transactionParams["address_street"] = event.AddressStreet
+	transactionParams["address_city"] = event.AddressCity
+	transactionParams["address_state"] = event.AddressState
+	transactionParams["address_zip"] = event.AddressZip
+	transactionParams["address_country_code"] = event.AddressCountry
+	if event.Tax > 0 {
+		transactionParams["tax"] = majorUnits(event.Tax)
+	}
+	if event.Fee > 0 {
+		transactionParams["payment_fee"] = majorUnits(event.Fee)
+	}
+	if event.AffiliateID > 0 {
+		transactionParams["affiliate_id"] = strconv.FormatInt(event.AffiliateID, 10)
+	}
+	if product != nil {
+		transactionParams["item_number"] = strconv.FormatInt(product.ID, 10)
+		transactionParams["item_name"] = product.Name
+	}
+
+	dbId, err := New().CreateTx(tx, transactionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, transaction added to db", "id": dbId, "pg": event.Gateway})
+
+	return FindFirstTx(tx, "id=?", dbId)
+}
+
+// paymentRecorded counts a new payment or subscription and returns its side effects
+func paymentRecorded(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story) ([]func(), error) {
+	if product == nil {
+		log.Error(log.V{"msg": "Payment event, no product for the transaction", "id": subscription.ID, "pg": event.Gateway})
+		return nil, nil
+	}
+
+	effects, err := productPaid(tx, event, subscription, product)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each payment gets the next invoice number
+	invoice, err := issueInvoice(tx, subscription, product)
+	if err != nil {
+		log.Error(log.V{"Payment event, error issuing invoice": err, "id": subscription.ID})
+		return nil, err
+	}
+
+	effects = append(effects, func() { sendReceipt(event, product.Name, product.Schedule) })
+	if invoice != nil {
+		effects = append(effects, func() { sendInvoice(invoice, product.Name) })
+	}
+
+	// Subscriptions of products with a free trial are first charged when the trial ends
+	if subscription.SubscriptionId != "" && product.Trial() {
+		trialEffects, err := trialStarted(tx, subscription, product)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, trialEffects...)
+	}
+
+	return effects, nil
+}
+
+// productPaid counts the payment or subscription for the product, issues its license key and download link
+// and returns the side effects which deliver them, the mailing list and the product's webhook,
+// along with those of each product of a bundle
+func productPaid(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story) ([]func(), error) {
+	productParams := make(map[string]string)
+	if subscription.SubscriptionId != "" {
+		product.TotalSubscribers = subscriberCount(tx, product, subscription, 1)
+		productParams["total_subscribers"] = strconv.FormatInt(product.TotalSubscribers, 10)
+	} else {
+		product.TotalOnetimePayments += 1
+		productParams["total_onetime_payments"] = strconv.FormatInt(product.TotalOnetimePayments, 10)
+	}
+	err := product.UpdateTx(tx, productParams)
+	if err != nil {
+		log.Error(log.V{"Payment event, error updating product counters": err})
+		return nil, err
+	}
+
+	data := WebhookEventData{
+		CustomID: subscription.UserId,
+		Status:   "active",
+		Email:    subscription.CustomerEmail,
+	}
+	eventType := WebhookPaymentSucceeded
+	if subscription.SubscriptionId != "" {
+		eventType = WebhookSubscriptionActivated
+		data.SubscriptionID = subscription.SubscriptionId
+	} else {
+		data.OrderID = subscription.PaymentId
+	}
+
+	effects := []func(){
+		func() { updateAudience(product, subscription, "subscribed") },
+	}
+
+	// Products in license mode get a key for each payment
+	if product.LicenseSeats > 0 {
+		license, err := licenses.Issue(tx, product.ID, subscription.ID, subscription.SubscriptionId, subscription.CustomerEmail, product.LicenseSeats)
+		if err != nil {
+			log.Error(log.V{"Payment event, error issuing license": err, "id": subscription.ID})
+			return nil, err
+		}
+		data.LicenseKey = license.Key
+		effects = append(effects, func() { sendLicense(event, product, license) })
+	}
+
+	// Products with a file get a download link for each payment
+	if product.S3Bucket != "" && product.S3Key != "" {
+		download, err := downloads.IssueTx(tx, product.ID, subscription.ID, subscription.CustomerEmail)
+		if err != nil {
+			log.Error(log.V{"Payment event, error issuing download link": err, "id": subscription.ID})
+			return nil, err
+		}
+		data.DownloadURL = download.URL()
+		effects = append(effects, func() { sendDownload(event, product, download) })
+	}
+
+	effects = append(effects, func() { sendProductWebhook(product, eventType, data) })
+
+	// The products of a bundle are delivered as if each had been bought on its own
+	bundled, err := products.FindBundleTx(tx, product)
+	if err != nil {
+		log.Error(log.V{"Payment event, error finding products of bundle": err, "product_id": product.ID})
+		return nil, err
+	}
+	for _, bundledProduct := range bundled {
+		bundledEffects, err := productPaid(tx, event, subscription, bundledProduct)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, bundledEffects...)
+	}
+
+	return effects, nil
+}
+
+// subscriptionEnded counts a subscription which was cancelled or has expired and returns its side effects
+func subscriptionEnded(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story) ([]func(), error) {
+	// A subscription cancelled during its free trial is never charged
+	if subscription.Trialing() {
+		err := subscription.UpdateTx(tx, map[string]string{"trial_status": TrialStatusCancelled})
+		if err != nil {
+			log.Error(log.V{"Payment event, error cancelling trial": err})
+			return nil, err
+		}
+		subscription.TrialStatus = TrialStatusCancelled
+	}
+
+	if product == nil {
+		log.Error(log.V{"msg": "Payment event, no product for the subscription", "id": subscription.ID, "pg": event.Gateway})
+		return nil, nil
+	}
+
+	product.TotalSubscribers = subscriberCount(tx, product, subscription, -1)
+	err := product.UpdateTx(tx, map[string]string{"total_subscribers": strconv.FormatInt(product.TotalSubscribers, 10)})
+	if err != nil {
+		log.Error(log.V{"Payment event, error updating total subscribers for product": err})
+		return nil, err
+	}
+
+	err = licenses.RevokeSubscription(tx, subscription.SubscriptionId)
+	if err != nil {
+		log.Error(log.V{"Payment event, error revoking licenses of the subscription": err})
+		return nil, err
+	}
+
+	err = downloads.RevokeTransaction(tx, subscription.ID)
+	if err != nil {
+		log.Error(log.V{"Payment event, error revoking download links of the subscription": err})
+		return nil, err
+	}
+
+	data := WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Status:         "cancelled",
+		Email:          subscription.CustomerEmail,
+	}
+
+	return []func(){
+		func() { updateAudience(product, subscription, "unsubscribed") },
+		func() { sendProductWebhook(product, WebhookSubscriptionCancelled, data) },
+	}, nil
+}
+
+// subscriberCount returns the number of subscribers of the product once the subscription is counted or no longer counted,
+// the subscribers of the product itself are counted from the states of its subscriptions and those of a product
+// delivered by a bundle or a cart are counted as they change
+func subscriberCount(tx *query.Tx, product *products.Story, subscription *Subscription, change int64) int64 {
+	if product.ID == subscription.ProductId {
+		return int64(CountSubscribersTx(tx, product.ID))
+	}
+	return product.TotalSubscribers + change
+}
+
+// refundRecorded records a refund or dispute against the transaction, a one-time payment refunded
+// in full or disputed is no longer counted. Subscriptions are counted until the gateway ends them.
+func refundRecorded(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story) ([]func(), error) {
+	kind := RefundKindRefund
+	if event.Type == WebhookPaymentDisputed {
+		kind = RefundKindDispute
+	}
+
+	// Gateways send more than one event for a refund e.g. when it is created and completed
+	refundID := event.RefundID
+	if refundID == "" {
+		refundID = event.ID
+	}
+	_, err := FindRefund(tx, event.Gateway, refundID)
+	if err == nil {
+		log.Info(log.V{"msg": "Payment event, refund already recorded", "refund_id": refundID, "pg": event.Gateway})
+		return nil, nil
+	}
+
+	refunded, err := RefundedAmountTx(tx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := event.Amount
+	if kind == RefundKindRefund && event.AmountRefunded > 0 {
+		// The gateway reports the total refunded, so this refund is the difference
+		amount = event.AmountRefunded - refunded
+		if amount <= 0 {
+			log.Info(log.V{"msg": "Payment event, refund already recorded", "id": subscription.ID, "pg": event.Gateway})
+			return nil, nil
+		}
+	}
+
+	refundParams := make(map[string]string)
+	refundParams["pg"] = event.Gateway
+	refundParams["refund_id"] = refundID
+	refundParams["transaction_id"] = strconv.FormatInt(subscription.ID, 10)
+	refundParams["kind"] = kind
+	refundParams["amount"] = majorUnits(amount)
+	refundParams["currency"] = event.Currency
+	refundParams["reason"] = event.Reason
+
+	_, err = NewRefund().CreateTx(tx, refundParams)
+	if err != nil {
+		log.Error(log.V{"Payment event, error recording refund": err})
+		return nil, err
+	}
+
+	log.Info(log.V{"msg": "Payment event, refund recorded", "id": subscription.ID, "kind": kind, "amount": amount, "pg": event.Gateway})
+
+	// The commission of the affiliate who referred the buyer is taken back in proportion to the refund or dispute
+	err = affiliates.Reverse(tx, subscription.ID, refundID, amount)
+	if err != nil {
+		log.Error(log.V{"Payment event, error reversing commission": err, "id": subscription.ID})
+		return nil, err
+	}
+
+	if kind == RefundKindRefund {
+		refunded += amount
+	}
+
+	data := WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Email:          subscription.CustomerEmail,
+		Currency:       event.Currency,
+	}
+
+	eventType := WebhookPaymentDisputed
+	if kind == RefundKindRefund {
+		eventType = WebhookPaymentRefunded
+		data.AmountRefunded = majorUnits(refunded)
+	}
+
+	// Each payment of a subscription is refunded separately
+	if subscription.SubscriptionId != "" {
+		data.Status = refundStatus(kind, amount, subscription.Amount)
+		return []func(){
+			func() { sendProductWebhook(product, eventType, data) },
+		}, nil
+	}
+
+	data.OrderID = subscription.PaymentId
+	data.Status = refundStatus(kind, refunded, subscription.Amount)
+
+	// A refund doesn't settle a dispute
+	if subscription.PaymentStaus == PaymentDisputed && data.Status == PaymentPartiallyRefunded {
+		data.Status = subscription.PaymentStaus
+	}
+
+	if data.Status != subscription.PaymentStaus {
+		err = subscription.UpdateTx(tx, map[string]string{"payment_status": data.Status})
+		if err != nil {
+			log.Error(log.V{"Payment event, error updating transaction": err})
+			return nil, err
+		}
+	}
+
+	// Each product of an order or a bundle is refunded with its payment
+	refundedProducts := transactionProducts(tx, subscription, product)
+
+	var effects []func()
+	for _, product := range refundedProducts {
+		effects = append(effects, func() { sendProductWebhook(product, eventType, data) })
+	}
+
+	if !isReversedStatus(data.Status) {
+		return effects, nil
+	}
+
+	// A payment refunded in full or disputed is no longer counted, once
+	reversed, err := subscription.Transition(tx, StateRefunded, event)
+	if err != nil {
+		return nil, err
+	}
+	if !reversed {
+		return effects, nil
+	}
+
+	err = downloads.RevokeTransaction(tx, subscription.ID)
+	if err != nil {
+		log.Error(log.V{"Payment event, error revoking download links of the payment": err})
+		return nil, err
+	}
+
+	for _, product := range refundedProducts {
+		product.TotalOnetimePayments -= 1
+		err = product.UpdateTx(tx, map[string]string{"total_onetime_payments": strconv.FormatInt(product.TotalOnetimePayments, 10)})
+		if err != nil {
+			log.Error(log.V{"Payment event, error updating total one-time payments for product": err})
+			return nil, err
+		}
+
+		effects = append(effects, func() { updateAudience(product, subscription, "unsubscribed") })
+	}
+
+	return effects, nil
+}
+
+// refundStatus returns the payment status after a refund or dispute, the refunded amount is
+// in the smallest currency unit and the gross amount is a decimal amount as in the ledger
+func refundStatus(kind string, refunded int64, gross float64) string {
+	if kind == RefundKindDispute {
+		return PaymentDisputed
+	}
+	if refunded >= minorUnits(strconv.FormatFloat(gross, 'f', 2, 64)) {
+		return PaymentRefunded
+	}
+	return PaymentPartiallyRefunded
+}
+
+// isReversedStatus reports whether the payment was refunded in full or disputed
+func isReversedStatus(status string) bool {
+	return status == PaymentRefunded || status == PaymentDisputed
+}
+
+// updateAudience sets the status of the customer in the product's mailchimp audience
+func updateAudience(product *products.Story, subscription *Subscription, status string) {
+	// If mailchimp list id and mailchimp token is available update the mailchimp list
+	if product.MailchimpAudienceID == "" || config.Get("mailchimp_token") == "" || subscription.CustomerEmail == "" {
+		return
+	}
+
+	audience := mailchimp.Audience{
+		MergeFields: mailchimp.Merge{FirstName: subscription.FirstName},
+		Email:       subscription.CustomerEmail,
+		Status:      status,
+	}
+
+	if status == "subscribed" {
+		go mailchimp.AddToAudience(audience, product.MailchimpAudienceID, mailchimp.GetMD5Hash(subscription.CustomerEmail), config.Get("mailchimp_token"))
+	} else {
+		go mailchimp.UpdateToAudience(audience, product.MailchimpAudienceID, mailchimp.GetMD5Hash(subscription.CustomerEmail), config.Get("mailchimp_token"))
+	}
+}
+
+// sendProductWebhook queues the event for the product's webhook if it has one
+func sendProductWebhook(product *products.Story, eventType string, data WebhookEventData) {
+	if product == nil || product.WebhookURL == "" || product.WebhookSecret == "" {
+		return
+	}
+
+	err := SendWebhook(product.ID, eventType, product.WebhookURL, product.WebhookSecret, data)
+	if err != nil {
+		log.Error(log.V{"Payment event, error queuing webhook to product's URL": err, "event": eventType})
+	} else {
+		log.Info(log.V{"msg": "Queued webhook to product's URL", "event": eventType})
+	}
+}
+
+// sendReceipt emails the customer a receipt for the payment of the item, the name of the product
+// or the products of an order, when email_receipts is enabled
+func sendReceipt(event *PaymentEvent, item string, schedule string) {
+	if !config.GetBool("email_receipts") || event.CustomerEmail == "" {
+		return
+	}
+
+	email := mail.New(event.CustomerEmail)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your receipt for " + item
+	email.Template = "subscriptions/views/receipt.html.got"
+
+	context := mail.Context{
+		"name":      config.Get("name"),
+		"product":   item,
+		"firstName": event.CustomerName,
+		"amount":    majorUnits(event.Amount),
+		"currency":  strings.ToUpper(event.Currency),
+		"tax":       majorUnits(event.Tax),
+		"paymentId": event.PaymentID,
+		"date":      event.Created.Format(time.RFC1123),
+		"schedule":  scheduleLabel(schedule),
+	}
+
+	go func() {
+		err := mail.Send(email, context)
+		if err != nil {
+			log.Error(log.V{"Payment event, error sending receipt": err})
+		}
+	}()
+}
+
+// sendLicense emails the customer the license key issued for the payment
+func sendLicense(event *PaymentEvent, product *products.Story, license *licenses.License) {
+	if license.Email == "" {
+		return
+	}
+
+	email := mail.New(license.Email)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your license key for " + product.Name
+	email.Template = "licenses/views/license.html.got"
+
+	context := mail.Context{
+		"name":       config.Get("name"),
+		"product":    product.Name,
+		"firstName":  event.CustomerName,
+		"licenseKey": license.Key,
+		"seats":      license.Seats,
+	}
+
+	go func() {
+		err := mail.Send(email, context)
+		if err != nil {
+			log.Error(log.V{"Payment event, error sending license": err})
+		}
+	}()
+}
+
+// sendDownload emails the customer the download link issued for the payment
+func sendDownload(event *PaymentEvent, product *products.Story, download *downloads.Download) {
+	if download.Email == "" {
+		return
+	}
+
+	email := mail.New(download.Email)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your download for " + product.Name
+	email.Template = "downloads/views/download.html.got"
+
+	context := mail.Context{
+		"name":         config.Get("name"),
+		"product":      product.Name,
+		"firstName":    event.CustomerName,
+		"downloadURL":  download.URL(),
+		"expires":      download.ExpiresAt.Format(time.RFC1123),
+		"maxDownloads": download.MaxDownloads,
+	}
+
+	go func() {
+		err := mail.Send(email, context)
+		if err != nil {
+			log.Error(log.V{"Payment event, error sending download link": err})
+		}
+	}()
+}
+
+// majorUnits converts an amount in the smallest currency unit into a decimal amount like 10.50
+func majorUnits(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/100, 'f', 2, 64)
+}
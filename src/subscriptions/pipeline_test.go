@@ -0,0 +1,109 @@
+// Tests for the payment event pipeline
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+)
+
+// Test only new payments and subscriptions create a ledger record
+func TestCreatesRecord(t *testing.T) {
+	tests := []struct {
+		event   PaymentEvent
+		creates bool
+	}{
+		{PaymentEvent{Type: WebhookPaymentSucceeded, PaymentID: "pay_1"}, true},
+		{PaymentEvent{Type: WebhookPaymentSucceeded, PaymentID: "pay_1", SubscriptionID: "sub_1"}, false},
+		{PaymentEvent{Type: WebhookSubscriptionActivated, SubscriptionID: "sub_1"}, true},
+		{PaymentEvent{Type: WebhookSubscriptionUpdated, SubscriptionID: "sub_1"}, false},
+		{PaymentEvent{Type: WebhookSubscriptionCancelled, SubscriptionID: "sub_1"}, false},
+		{PaymentEvent{Type: WebhookPaymentRefunded, PaymentID: "pay_1"}, false},
+	}
+
+	for _, test := range tests {
+		if createsRecord(&test.event) != test.creates {
+			t.Fatalf("pipeline: expected %s creates record to be %t", test.event.Type, test.creates)
+		}
+	}
+}
+
+// Test amounts are stored in the ledger as decimals
+func TestMajorUnits(t *testing.T) {
+	if amount := majorUnits(1050); amount != "10.50" {
+		t.Fatalf("pipeline: expected 10.50 got:%s", amount)
+	}
+	if amount := minorUnits(majorUnits(99)); amount != 99 {
+		t.Fatalf("pipeline: expected 99 got:%d", amount)
+	}
+}
+
+// Test the status of a payment after refunds and disputes
+func TestRefundStatus(t *testing.T) {
+	testCases := []struct {
+		kind     string
+		refunded int64
+		gross    float64
+		want     string
+	}{
+		{RefundKindRefund, 500, 10.50, PaymentPartiallyRefunded},
+		{RefundKindRefund, 1050, 10.50, PaymentRefunded},
+		{RefundKindDispute, 0, 10.50, PaymentDisputed},
+	}
+
+	for _, tc := range testCases {
+		if status := refundStatus(tc.kind, tc.refunded, tc.gross); status != tc.want {
+			t.Fatalf("pipeline: expected %s got:%s for %+v", tc.want, status, tc)
+		}
+	}
+}
+
+// Test subscriptions started without a payment are not recorded with the plan they share as their payment id
+func TestRecordSubscription(t *testing.T) {
+	openTestDatabase(t)
+
+	for _, id := range []string{"I-FIRST", "I-SECOND"} {
+		event := &PaymentEvent{ID: "WH-" + id, Gateway: "paypal", Type: WebhookSubscriptionActivated, PlanID: "P-SHARED", SubscriptionID: id, Status: "ACTIVE"}
+		subscription, err := recordPaymentEvent(nil, event, nil)
+		if err != nil || subscription.PaymentId != "" {
+			t.Fatalf("pipeline: expected subscription %s without payment id got:%v %v", id, subscription, err)
+		}
+	}
+
+	if subscription, err := FindPayment("P-SHARED"); err == nil {
+		t.Fatalf("pipeline: expected no payment for the plan got:%v", subscription)
+	}
+}
+
+// Test events are found once they are processed, and a transaction making a query outside it is rolled back rather than waiting forever
+func TestProcessedEvent(t *testing.T) {
+	openTestDatabase(t)
+
+	_, err := FindProcessedEvent(nil, "paypal", "WH-ONCE")
+	if err != ErrEventNotProcessed {
+		t.Fatalf("pipeline: expected event not to be processed got:%v", err)
+	}
+
+	err = ProcessPaymentEvent(&PaymentEvent{ID: "WH-ONCE", Gateway: "paypal", Type: WebhookSubscriptionUpdated, SubscriptionID: "I-NONE"})
+	if err != nil {
+		t.Fatalf("pipeline: error processing event %s", err)
+	}
+
+	event, err := FindProcessedEvent(nil, "paypal", "WH-ONCE")
+	if err != nil || event.EventType != WebhookSubscriptionUpdated {
+		t.Fatalf("pipeline: expected event to be processed got:%v %v", event, err)
+	}
+
+	timeout := query.TransactionTimeout
+	query.TransactionTimeout = 100 * time.Millisecond
+	defer func() { query.TransactionTimeout = timeout }()
+
+	err = query.Transaction(func(tx *query.Tx) error {
+		_, err := FindProcessedEvent(nil, "paypal", "WH-ONCE")
+		return err
+	})
+	if err == nil {
+		t.Fatalf("pipeline: expected transaction making a query outside it to fail")
+	}
+}
@@ -0,0 +1,541 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/razorpay/razorpay-go"
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/sub"
+)
+
+const (
+	// PlanChangesTableName is the database table of the changes of the plans of subscriptions
+	PlanChangesTableName = "subscription_plan_changes"
+
+	// PlanChangePending is a change which the customer hasn't approved at the gateway yet
+	PlanChangePending = "pending"
+	// PlanChangeChanged is a change made at the gateway and recorded against the subscription
+	PlanChangeChanged = "changed"
+)
+
+// ErrPlanChange is returned when the subscription can't be changed to the plan
+var ErrPlanChange = errors.New("subscription can't be changed to this plan")
+
+// PlanChange is a change of a subscription from the plan of one product to the plan of another
+type PlanChange struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// TransactionID is the subscription in the subscriptions table
+	TransactionID int64
+	FromProductID int64
+	ToProductID   int64
+	Gateway       string
+	// PlanID is the price or plan of the product changed to at the gateway
+	PlanID string
+	Status string
+}
+
+// NewPlanChange creates and initialises a new plan change instance.
+func NewPlanChange() *PlanChange {
+	change := &PlanChange{}
+	change.CreatedAt = time.Now()
+	change.UpdatedAt = time.Now()
+	change.TableName = PlanChangesTableName
+	change.KeyName = KeyName
+	return change
+}
+
+// NewPlanChangeWithColumns creates a new plan change instance and fills it with data from the database cols provided.
+func NewPlanChangeWithColumns(cols map[string]interface{}) *PlanChange {
+	change := NewPlanChange()
+	change.ID = resource.ValidateInt(cols["id"])
+	change.CreatedAt = resource.ValidateTime(cols["created_at"])
+	change.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	change.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	change.FromProductID = resource.ValidateInt(cols["from_product_id"])
+	change.ToProductID = resource.ValidateInt(cols["to_product_id"])
+	change.Gateway = resource.ValidateString(cols["pg"])
+	change.PlanID = resource.ValidateString(cols["plan_id"])
+	change.Status = resource.ValidateString(cols["status"])
+	return change
+}
+
+// FindPendingPlanChange fetches the latest change of the subscription to the plan which is waiting for the customer's approval
+// in the transaction.
+func FindPendingPlanChange(tx *query.Tx, transactionID int64, planID string) (*PlanChange, error) {
+	result, err := PlanChangesQueryTx(tx).Where("transaction_id=?", transactionID).Where("plan_id=?", planID).Where("status=?", PlanChangePending).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewPlanChangeWithColumns(result), nil
+}
+
+// FindAllPlanChanges fetches all plan change records matching this query from the database.
+func FindAllPlanChanges(q *query.Query) ([]*PlanChange, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*PlanChange
+	for _, cols := range results {
+		changes = append(changes, NewPlanChangeWithColumns(cols))
+	}
+
+	return changes, nil
+}
+
+// PlanChangesQuery returns a new query for plan changes with a default order.
+func PlanChangesQuery() *query.Query {
+	return PlanChangesQueryTx(nil)
+}
+
+// PlanChangesQueryTx returns a new query for plan changes with a default order in the transaction.
+func PlanChangesQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(PlanChangesTableName, KeyName).Order("id desc")
+}
+
+// PlanChangeable reports whether the customer can change the plan of the subscription at its gateway,
+// a subscription which is past due is recovered first and Square isn't supported
+func (s *Subscription) PlanChangeable() bool {
+	if s.SubscriptionId == "" || (s.State != StateActive && s.State != StateTrialing) {
+		return false
+	}
+	switch s.PaymentGateway {
+	case "stripe", "paypal", "razorpay":
+		return true
+	}
+	return false
+}
+
+// ChangeablePlans returns the plans of the product the subscription can be changed to, those with a recurring
+// price at the gateway of the subscription in the country it was bought in
+func ChangeablePlans(subscription *Subscription, product *products.Story) ([]*products.Story, error) {
+	if product == nil || !subscription.PlanChangeable() {
+		return nil, nil
+	}
+
+	plans, err := products.FindPlans(product)
+	if err != nil {
+		return nil, err
+	}
+
+	country := planCountry(subscription, product)
+
+	var changeable []*products.Story
+	for _, plan := range plans {
+		if gatewayPlanID(subscription.PaymentGateway, plan, country) != "" {
+			changeable = append(changeable, plan)
+		}
+	}
+	return changeable, nil
+}
+
+// ChangePlan changes the subscription to the plan of the product at its gateway, which prorates it by its own rules,
+// and records the change against the subscription. PayPal asks the customer to approve the change, the page where they
+// approve it is returned and the change is recorded once PayPal's webhook reports the subscription on the new plan.
+func ChangePlan(subscription *Subscription, plan *products.Story, returnURL string) (string, error) {
+	product, err := products.Find(subscription.ProductId)
+	if err != nil {
+		return "", err
+	}
+
+	plans, err := ChangeablePlans(subscription, product)
+	if err != nil {
+		return "", err
+	}
+
+	var changeable bool
+	for _, p := range plans {
+		if p.ID == plan.ID {
+			changeable = true
+		}
+	}
+	if !changeable {
+		return "", ErrPlanChange
+	}
+
+	planID := gatewayPlanID(subscription.PaymentGateway, plan, planCountry(subscription, product))
+
+	var approveURL string
+	var amount int64
+	switch subscription.PaymentGateway {
+	case "stripe":
+		amount, err = changeStripePlan(subscription.SubscriptionId, planID)
+	case "paypal":
+		approveURL, err = revisePaypalPlan(subscription.SubscriptionId, planID, returnURL)
+	case "razorpay":
+		amount, err = changeRazorpayPlan(subscription.SubscriptionId, planID)
+	default:
+		err = ErrPlanChange
+	}
+	if err != nil {
+		return "", err
+	}
+
+	changeParams := make(map[string]string)
+	changeParams["transaction_id"] = strconv.FormatInt(subscription.ID, 10)
+	changeParams["from_product_id"] = strconv.FormatInt(product.ID, 10)
+	changeParams["to_product_id"] = strconv.FormatInt(plan.ID, 10)
+	changeParams["pg"] = subscription.PaymentGateway
+	changeParams["plan_id"] = planID
+	changeParams["status"] = PlanChangePending
+
+	changeID, err := NewPlanChange().Create(changeParams)
+	if err != nil {
+		log.Error(log.V{"Plan change, error recording plan change": err, "id": subscription.ID})
+		return "", err
+	}
+
+	log.Info(log.V{"msg": "Plan change, subscription changed at the gateway", "id": subscription.ID, "from": product.ID, "to": plan.ID, "pg": subscription.PaymentGateway})
+
+	if approveURL != "" {
+		return approveURL, nil
+	}
+
+	var effects []func()
+	err = query.Transaction(func(tx *query.Tx) error {
+		change, err := FindPlanChange(tx, changeID)
+		if err != nil {
+			return err
+		}
+
+		// The gateway's webhook may have reported the subscription on its new plan already
+		if change.Status != PlanChangePending {
+			return nil
+		}
+
+		subscription, err := FindFirstTx(tx, "id=?", subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		effects, err = planChanged(tx, &PaymentEvent{Gateway: subscription.PaymentGateway, CustomerName: subscription.FirstName}, subscription, change, amount)
+		return err
+	})
+	if err != nil {
+		log.Error(log.V{"Plan change, error recording plan change": err, "id": subscription.ID})
+		return "", err
+	}
+
+	for _, effect := range effects {
+		effect()
+	}
+
+	return "", nil
+}
+
+// FindPlanChange fetches a single plan change record by id in the transaction.
+func FindPlanChange(tx *query.Tx, id int64) (*PlanChange, error) {
+	result, err := PlanChangesQueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewPlanChangeWithColumns(result), nil
+}
+
+// planApproved records the change the customer approved at the gateway when the event reports the subscription on its plan,
+// it reports whether the subscription was changed to another product
+func planApproved(tx *query.Tx, event *PaymentEvent, subscription *Subscription) ([]func(), bool, error) {
+	if event.PlanID == "" {
+		return nil, false, nil
+	}
+
+	change, err := FindPendingPlanChange(tx, subscription.ID, event.PlanID)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	// The amount of the event is the last payment at the old price
+	effects, err := planChanged(tx, event, subscription, change, 0)
+	return effects, err == nil, err
+}
+
+// planChanged moves the subscription to the product of its new plan, the subscribers of both products are counted again.
+// The license keys and download links of the subscription are kept and moved to the new product with its seats, they are
+// issued when the subscription had none and revoked when the new product has no license or file.
+// The amount is the new price in the smallest currency unit, 0 if the gateway didn't report it.
+func planChanged(tx *query.Tx, event *PaymentEvent, subscription *Subscription, change *PlanChange, amount int64) ([]func(), error) {
+	plan, err := products.FindTx(tx, change.ToProductID)
+	if err != nil {
+		log.Error(log.V{"Plan change, error finding product of plan": err, "id": subscription.ID, "product_id": change.ToProductID})
+		return nil, err
+	}
+
+	// The product may have been deleted since the subscription was bought
+	product, err := products.FindTx(tx, change.FromProductID)
+	if err != nil {
+		product = nil
+	}
+
+	// The price stored with the product is used when the gateway doesn't report it
+	if amount == 0 {
+		quote, err := storedQuote(plan, subscription.PaymentGateway, planCountry(subscription, plan))
+		if err == nil {
+			amount = minorUnits(quote.Amount)
+		}
+	}
+
+	transactionParams := make(map[string]string)
+	transactionParams["item_number"] = strconv.FormatInt(plan.ID, 10)
+	transactionParams["item_name"] = plan.Name
+	if amount > 0 {
+		transactionParams["payment_gross"] = majorUnits(amount)
+	}
+	err = subscription.UpdateTx(tx, transactionParams)
+	if err != nil {
+		log.Error(log.V{"Plan change, error updating subscription": err, "id": subscription.ID})
+		return nil, err
+	}
+	subscription.ProductId = plan.ID
+	if amount > 0 {
+		subscription.Amount = float64(amount) / 100
+	}
+
+	err = change.UpdateTx(tx, map[string]string{"status": PlanChangeChanged})
+	if err != nil {
+		log.Error(log.V{"Plan change, error updating plan change": err, "id": subscription.ID})
+		return nil, err
+	}
+
+	for _, p := range []*products.Story{product, plan} {
+		if p == nil {
+			continue
+		}
+		p.TotalSubscribers = int64(CountSubscribersTx(tx, p.ID))
+		err = p.UpdateTx(tx, map[string]string{"total_subscribers": strconv.FormatInt(p.TotalSubscribers, 10)})
+		if err != nil {
+			log.Error(log.V{"Plan change, error updating total subscribers for product": err, "product_id": p.ID})
+			return nil, err
+		}
+	}
+
+	data := WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Status:         subscription.State,
+		Email:          subscription.CustomerEmail,
+		ProductID:      plan.ID,
+	}
+
+	var effects []func()
+	if product != nil {
+		effects = append(effects, func() { updateAudience(product, subscription, "unsubscribed") })
+	}
+	effects = append(effects, func() { updateAudience(plan, subscription, "subscribed") })
+
+	if plan.LicenseSeats > 0 {
+		changed, err := licenses.ChangeSubscriptionProduct(tx, subscription.SubscriptionId, plan.ID, plan.LicenseSeats)
+		if err != nil {
+			log.Error(log.V{"Plan change, error moving licenses of the subscription": err, "id": subscription.ID})
+			return nil, err
+		}
+
+		if len(changed) > 0 {
+			data.LicenseKey = changed[0].Key
+		} else {
+			license, err := licenses.Issue(tx, plan.ID, subscription.ID, subscription.SubscriptionId, subscription.CustomerEmail, plan.LicenseSeats)
+			if err != nil {
+				log.Error(log.V{"Plan change, error issuing license": err, "id": subscription.ID})
+				return nil, err
+			}
+			data.LicenseKey = license.Key
+			effects = append(effects, func() { sendLicense(event, plan, license) })
+		}
+	} else {
+		err = licenses.RevokeSubscription(tx, subscription.SubscriptionId)
+		if err != nil {
+			log.Error(log.V{"Plan change, error revoking licenses of the subscription": err})
+			return nil, err
+		}
+	}
+
+	if plan.S3Bucket != "" && plan.S3Key != "" {
+		changed, err := downloads.ChangeTransactionProduct(tx, subscription.ID, plan.ID)
+		if err != nil {
+			log.Error(log.V{"Plan change, error moving download links of the subscription": err, "id": subscription.ID})
+			return nil, err
+		}
+
+		// A new link is issued when the links of the subscription can't be used anymore e.g. they have expired
+		var download *downloads.Download
+		for _, d := range changed {
+			if d.Check() == nil {
+				download = d
+				break
+			}
+		}
+
+		if download != nil {
+			data.DownloadURL = download.URL()
+		} else {
+			download, err = downloads.IssueTx(tx, plan.ID, subscription.ID, subscription.CustomerEmail)
+			if err != nil {
+				log.Error(log.V{"Plan change, error issuing download link": err, "id": subscription.ID})
+				return nil, err
+			}
+			data.DownloadURL = download.URL()
+			effects = append(effects, func() { sendDownload(event, plan, download) })
+		}
+	} else {
+		err = downloads.RevokeTransaction(tx, subscription.ID)
+		if err != nil {
+			log.Error(log.V{"Plan change, error revoking download links of the subscription": err})
+			return nil, err
+		}
+	}
+
+	// The integration of the old product is told the subscriber left it unless it is also the integration of the new product
+	effects = append(effects, func() { sendProductWebhook(plan, WebhookSubscriptionUpdated, data) })
+	if product != nil && product.WebhookURL != plan.WebhookURL {
+		effects = append(effects, func() { sendProductWebhook(product, WebhookSubscriptionUpdated, data) })
+	}
+
+	log.Info(log.V{"msg": "Plan change, subscription plan changed", "id": subscription.ID, "from": change.FromProductID, "to": plan.ID})
+
+	return effects, nil
+}
+
+// planCountry returns the country of the price the subscription was bought at, from the location evidence of the buyer
+func planCountry(subscription *Subscription, product *products.Story) string {
+	for _, country := range []string{subscription.BillingCountry, subscription.TaxCountry, subscription.IPCountry} {
+		country = strings.ToUpper(country)
+		if country != "" && gatewayPlanID(subscription.PaymentGateway, product, country) != "" {
+			return country
+		}
+	}
+	return DefaultCountry
+}
+
+// gatewayPlanID returns the recurring price or plan of the product for the country at the gateway, an empty string if it has none
+func gatewayPlanID(gateway string, product *products.Story, country string) string {
+	if product.Schedule == "onetime" {
+		return ""
+	}
+
+	switch gateway {
+	case "stripe":
+		return product.StripePrice[country]
+	case "paypal":
+		return quoteValue(product.PaypalPrice[country]["plan_id"])
+	case "razorpay":
+		return quoteValue(product.RazorpayPrice[country]["plan_id"])
+	}
+	return ""
+}
+
+// changeStripePlan changes the price of the item of the Stripe subscription, Stripe prorates the time left in the period
+// on the next invoice. It returns the new price in the smallest currency unit.
+func changeStripePlan(subscriptionID string, priceID string) (int64, error) {
+	stripe.Key = config.Get("stripe_secret")
+
+	s, err := sub.Get(subscriptionID, nil)
+	if err != nil {
+		return 0, err
+	}
+	if s.Items == nil || len(s.Items.Data) != 1 {
+		return 0, errors.New("stripe subscription should have one item")
+	}
+
+	params := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(s.Items.Data[0].ID),
+				Price: stripe.String(priceID),
+			},
+		},
+		ProrationBehavior: stripe.String(string(stripe.SubscriptionProrationBehaviorCreateProrations)),
+	}
+	s, err = sub.Update(subscriptionID, params)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(s.Items.Data) > 0 && s.Items.Data[0].Price != nil {
+		return s.Items.Data[0].Price.UnitAmount, nil
+	}
+	return 0, nil
+}
+
+// revisePaypalPlan revises the PayPal subscription to the plan, PayPal charges the new price from the next billing cycle
+// once the customer approves the change and they come back to returnURL. It returns the page where they approve it.
+func revisePaypalPlan(subscriptionID string, planID string, returnURL string) (string, error) {
+	data := map[string]interface{}{
+		"plan_id": planID,
+		"application_context": map[string]string{
+			"return_url": returnURL,
+			"cancel_url": config.Get("root_url") + "/customers",
+		},
+	}
+
+	resp, err := paypalRequest(http.MethodPost, fmt.Sprintf("/v1/billing/subscriptions/%s/revise", subscriptionID), data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to revise paypal subscription, status code: %d", resp.StatusCode)
+	}
+
+	var revision struct {
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"links"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&revision)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range revision.Links {
+		if link.Rel == "approve" {
+			return link.Href, nil
+		}
+	}
+	return "", errors.New("paypal revision has no link to approve it")
+}
+
+// changeRazorpayPlan updates the Razorpay subscription to the plan now, Razorpay charges for the change by its own rules.
+// It returns the new price in the smallest currency unit.
+func changeRazorpayPlan(subscriptionID string, planID string) (int64, error) {
+	client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	data := map[string]interface{}{
+		"plan_id":            planID,
+		"schedule_change_at": "now",
+		"customer_notify":    1,
+	}
+	body, err := client.Subscription.Update(subscriptionID, data, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if updated, _ := body["plan_id"].(string); updated != planID {
+		return 0, errors.New("razorpay subscription wasn't changed to the plan")
+	}
+
+	plan, err := client.Plan.Fetch(planID, nil, nil)
+	if err != nil {
+		// The subscription was changed, only its new price is unknown
+		return 0, nil
+	}
+	item, _ := plan["item"].(map[string]interface{})
+	amount, _ := item["amount"].(float64)
+	return int64(amount), nil
+}
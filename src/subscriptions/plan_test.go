@@ -0,0 +1,72 @@
+// Tests for the plan changes of subscriptions
+package subscriptions
+
+import (
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test only active subscriptions on gateways which change plans can be changed
+func TestPlanChangeable(t *testing.T) {
+	subscription := New()
+	subscription.SubscriptionId = "sub_1"
+	subscription.PaymentGateway = "stripe"
+	subscription.State = StateActive
+	if !subscription.PlanChangeable() {
+		t.Fatalf("plans: expected active stripe subscription to be changeable")
+	}
+
+	subscription.State = StatePastDue
+	if subscription.PlanChangeable() {
+		t.Fatalf("plans: expected past due subscription not to be changeable")
+	}
+
+	subscription.State = StateTrialing
+	subscription.PaymentGateway = "square"
+	if subscription.PlanChangeable() {
+		t.Fatalf("plans: expected square subscription not to be changeable")
+	}
+
+	payment := New()
+	payment.PaymentGateway = "stripe"
+	payment.State = StateActive
+	if payment.PlanChangeable() {
+		t.Fatalf("plans: expected one time payment not to be changeable")
+	}
+}
+
+// Test the plan of a product is found for the country the subscription was bought in
+func TestPlanCountry(t *testing.T) {
+	plan := products.New()
+	plan.Schedule = "yearly"
+	plan.StripePrice = map[string]string{"DE": "price_de", DefaultCountry: "price_df"}
+	plan.PaypalPrice = map[string]map[string]interface{}{"US": {"plan_id": "P-US", "amount": 100.0}}
+
+	subscription := New()
+	subscription.PaymentGateway = "stripe"
+	subscription.BillingCountry = "de"
+	if country := planCountry(subscription, plan); country != "DE" || gatewayPlanID("stripe", plan, country) != "price_de" {
+		t.Fatalf("plans: expected stripe plan of DE got:%s", country)
+	}
+
+	subscription.BillingCountry = "FR"
+	if country := planCountry(subscription, plan); country != DefaultCountry {
+		t.Fatalf("plans: expected default country without a price got:%s", country)
+	}
+
+	subscription.PaymentGateway = "paypal"
+	subscription.IPCountry = "US"
+	if country := planCountry(subscription, plan); gatewayPlanID("paypal", plan, country) != "P-US" {
+		t.Fatalf("plans: expected paypal plan of US got:%s", country)
+	}
+
+	if gatewayPlanID("razorpay", plan, "US") != "" {
+		t.Fatalf("plans: expected no razorpay plan")
+	}
+
+	plan.Schedule = "onetime"
+	if gatewayPlanID("stripe", plan, "DE") != "" {
+		t.Fatalf("plans: expected one time product to have no plan")
+	}
+}
@@ -0,0 +1,83 @@
+package subscriptions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+// ProcessedEventsTableName is the database table for the gateway events already processed
+const ProcessedEventsTableName = "processed_events"
+
+// ProcessedEvent records a gateway webhook event which has been processed,
+// redeliveries of the event are acknowledged without being processed again
+type ProcessedEvent struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Gateway   string
+	EventID   string
+	EventType string
+}
+
+// ErrEventNotProcessed is returned by FindProcessedEvent for an event which hasn't been processed
+var ErrEventNotProcessed = errors.New("event has not been processed")
+
+// NewProcessedEvent creates and initialises a new processed event instance.
+func NewProcessedEvent() *ProcessedEvent {
+	event := &ProcessedEvent{}
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = time.Now()
+	event.TableName = ProcessedEventsTableName
+	event.KeyName = KeyName
+	return event
+}
+
+// NewProcessedEventWithColumns creates a new processed event instance and fills it with data from the database cols provided.
+func NewProcessedEventWithColumns(cols map[string]interface{}) *ProcessedEvent {
+	event := NewProcessedEvent()
+	event.ID = resource.ValidateInt(cols["id"])
+	event.CreatedAt = resource.ValidateTime(cols["created_at"])
+	event.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	event.Gateway = resource.ValidateString(cols["pg"])
+	event.EventID = resource.ValidateString(cols["event_id"])
+	event.EventType = resource.ValidateString(cols["event_type"])
+	return event
+}
+
+// FindProcessedEvent fetches the processed event of the gateway with the given event id in the transaction,
+// ErrEventNotProcessed is returned if there is none and other errors are those of the database.
+func FindProcessedEvent(tx *query.Tx, gateway string, eventID string) (*ProcessedEvent, error) {
+	results, err := ProcessedEventsQueryTx(tx).Where("pg=?", gateway).Where("event_id=?", eventID).Limit(1).Results()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrEventNotProcessed
+	}
+	return NewProcessedEventWithColumns(results[0]), nil
+}
+
+// recordProcessedEvent stores the event as processed in the transaction, the unique index on pg and
+// event_id stops the same event being recorded twice.
+func recordProcessedEvent(tx *query.Tx, event *PaymentEvent) error {
+	eventParams := make(map[string]string)
+	eventParams["pg"] = event.Gateway
+	eventParams["event_id"] = event.ID
+	eventParams["event_type"] = event.Type
+
+	_, err := NewProcessedEvent().CreateTx(tx, eventParams)
+	return err
+}
+
+// ProcessedEventsQuery returns a new query for processed events with a default order.
+func ProcessedEventsQuery() *query.Query {
+	return ProcessedEventsQueryTx(nil)
+}
+
+// ProcessedEventsQueryTx returns a new query for processed events with a default order in the transaction.
+func ProcessedEventsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(ProcessedEventsTableName, KeyName).Order("id desc")
+}
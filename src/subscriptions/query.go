@@ -1,7 +1,9 @@
 package subscriptions
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/abishekmuthian/open-payment-host/src/lib/query"
@@ -45,8 +47,31 @@ func NewWithColumns(cols map[string]interface{}) *Subscription {
 	subscription.Plan = resource.ValidateString(cols["transaction_subject"])
 	subscription.ProductId = resource.ValidateInt(cols["item_number"])
 	subscription.PaymentStaus = resource.ValidateString(cols["payment_status"])
+	subscription.State = resource.ValidateString(cols["state"])
 	subscription.PaymentGateway = resource.ValidateString(cols["pg"])
 	subscription.FirstName = resource.ValidateString(cols["first_name"])
+	subscription.CouponCode = resource.ValidateString(cols["coupon_code"])
+	subscription.Discount = resource.ValidateFloat(cols["discount"])
+	subscription.TrialStatus = resource.ValidateString(cols["trial_status"])
+	subscription.TrialEndsAt = resource.ValidateTime(cols["trial_ends_at"])
+	subscription.TrialRemindedAt = resource.ValidateTime(cols["trial_reminded_at"])
+	subscription.Tax = resource.ValidateFloat(cols["tax"])
+	subscription.TaxCountry = resource.ValidateString(cols["tax_country"])
+	subscription.TaxRate = resource.ValidateFloat(cols["tax_rate"])
+	subscription.TaxID = resource.ValidateString(cols["tax_id"])
+	subscription.ReverseCharge = resource.ValidateInt(cols["reverse_charge"]) == 1
+	subscription.IPCountry = resource.ValidateString(cols["ip_country"])
+	subscription.BillingCountry = resource.ValidateString(cols["address_country_code"])
+	subscription.AddressStreet = resource.ValidateString(cols["address_street"])
+	subscription.AddressCity = resource.ValidateString(cols["address_city"])
+	subscription.AddressState = resource.ValidateString(cols["address_state"])
+	subscription.AddressZip = resource.ValidateString(cols["address_zip"])
+	// address_zip is an integer column, so only postcodes with letters are read back as text
+	if zip := resource.ValidateInt(cols["address_zip"]); zip > 0 {
+		subscription.AddressZip = strconv.FormatInt(zip, 10)
+	}
+	subscription.AffiliateID = resource.ValidateInt(cols["affiliate_id"])
+	subscription.ResumesAt = resource.ValidateTime(cols["resumes_at"])
 
 	return subscription
 }
@@ -64,7 +89,13 @@ func New() *Subscription {
 // FindFirst fetches a single user record from the database using
 // a where query with the format and args provided.
 func FindFirst(format string, args ...interface{}) (*Subscription, error) {
-	result, err := Query().Where(format, args...).FirstResult()
+	return FindFirstTx(nil, format, args...)
+}
+
+// FindFirstTx fetches a single subscription record using a where query with the format and args provided
+// in the transaction.
+func FindFirstTx(tx *query.Tx, format string, args ...interface{}) (*Subscription, error) {
+	result, err := QueryTx(tx).Where(format, args...).FirstResult()
 	if err != nil {
 		return nil, err
 	}
@@ -82,10 +113,52 @@ func Find(id string) (*Subscription, error) {
 
 // FindPayment fetches a single subscription record from the database by PaymentIntent id.
 func FindPayment(transaction_id string) (*Subscription, error) {
+	return FindPaymentTx(nil, transaction_id)
+}
+
+// FindPaymentTx fetches a single subscription record by PaymentIntent id in the transaction.
+func FindPaymentTx(tx *query.Tx, transaction_id string) (*Subscription, error) {
 	if transaction_id == "" {
 		return nil, nil
 	}
-	result, err := Query().Where("txn_id=?", transaction_id).FirstResult()
+	result, err := QueryTx(tx).Where("txn_id=?", transaction_id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindTransactionReference fetches the payment or subscription with the given payment, subscription,
+// receipt or order id of its gateway.
+func FindTransactionReference(reference string) (*Subscription, error) {
+	return FindTransactionReferenceTx(nil, reference)
+}
+
+// FindTransactionReferenceTx fetches the payment or subscription with the given reference of its gateway in the transaction.
+func FindTransactionReferenceTx(tx *query.Tx, reference string) (*Subscription, error) {
+	if reference == "" {
+		return nil, errors.New("no reference for the transaction")
+	}
+	result, err := QueryTx(tx).Where("txn_id=? OR subscr_id=? OR receipt_id=? OR invoice=?", reference, reference, reference, reference).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// gatewayReferenceColumns are the columns in which the references of the gateways are recorded
+var gatewayReferenceColumns = map[string]bool{"txn_id": true, "subscr_id": true, "receipt_id": true, "invoice": true}
+
+// FindGatewayReference fetches the payment or subscription of the gateway with the reference in the given column,
+// one of txn_id, subscr_id, receipt_id or invoice.
+func FindGatewayReference(gateway string, column string, reference string) (*Subscription, error) {
+	if !gatewayReferenceColumns[column] {
+		return nil, fmt.Errorf("no reference column %s for the transaction", column)
+	}
+	if reference == "" {
+		return nil, errors.New("no reference for the transaction")
+	}
+	result, err := Query().Where("pg=?", gateway).Where(column+"=?", reference).FirstResult()
 	if err != nil {
 		return nil, err
 	}
@@ -94,10 +167,15 @@ func FindPayment(transaction_id string) (*Subscription, error) {
 
 // FindSubscription fetches a single subscription record from the database by Subscriber id.
 func FindSubscription(subscription_id string) (*Subscription, error) {
+	return FindSubscriptionTx(nil, subscription_id)
+}
+
+// FindSubscriptionTx fetches a single subscription record by Subscriber id in the transaction.
+func FindSubscriptionTx(tx *query.Tx, subscription_id string) (*Subscription, error) {
 	if subscription_id == "" {
 		return nil, nil
 	}
-	result, err := Query().Where("subscr_id=?", subscription_id).FirstResult()
+	result, err := QueryTx(tx).Where("subscr_id=?", subscription_id).FirstResult()
 	if err != nil {
 		return nil, err
 	}
@@ -145,43 +223,46 @@ func FindAll(q *query.Query) ([]*Subscription, error) {
 	return subscriptions, nil
 }
 
-// CountSubscribers returns the number of subscribers for a product given a product id.
+// CountSubscribers returns the number of subscribers for a product given a product id,
+// the subscriptions which are in their trial, active or past due whichever gateway they are on.
 func CountSubscribers(productId int64) int {
-	var subscriberCount int
-	// Count the subscribers for Square
-	/* 	if len(s.SquareSubscriptionPlanId) > 0 {
-		for _, planId := range s.SquareSubscriptionPlanId {
+	return CountSubscribersTx(nil, productId)
+}
 
-			q := Query()
+// CountSubscribersTx returns the number of subscribers for a product given a product id in the transaction.
+func CountSubscribersTx(tx *query.Tx, productId int64) int {
+	q := QueryTx(tx).Where("item_number=?", productId).Where("subscr_id IS NOT NULL AND subscr_id != ''")
+	q.Where("state IN (?,?,?)", StateTrialing, StateActive, StatePastDue)
 
-			q.Where(fmt.Sprintf("txn_id = '%s' and payment_status= '%s'", planId, "ACTIVE"))
+	count, err := q.Count()
+	if err != nil {
+		return 0
+	}
 
-			subscriptions, err := FindAll(q)
+	return int(count)
+}
 
-			if err == nil {
-				subscriberCount = subscriberCount + len(subscriptions)
-			}
+// CountStates returns the number of payments and subscriptions of a product in each state
+func CountStates(productId int64) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, state := range States {
+		count, err := Query().Where("item_number=?", productId).Where("state=?", state).Count()
+		if err != nil {
+			return nil, err
 		}
-	} */
-	// Count the subscribers for all PG
-	q := Query()
-
-	//FIXME: Check if this gets all the active subscriptions, In some PG the satus might be in lower case
-
-	q.Where(fmt.Sprintf("item_number = '%d' and payment_status= '%s'", productId, "ACTIVE"))
-
-	subscriptions, err := FindAll(q)
-
-	if err == nil {
-		subscriberCount = subscriberCount + len(subscriptions)
+		counts[state] = count
 	}
-
-	return subscriberCount
+	return counts, nil
 }
 
 // Query returns a new query for subscriptions with a default order.
 func Query() *query.Query {
-	return query.New(TableName, KeyName).Order(Order)
+	return QueryTx(nil)
+}
+
+// QueryTx returns a new query for subscriptions with a default order in the transaction.
+func QueryTx(tx *query.Tx) *query.Query {
+	return tx.New(TableName, KeyName).Order(Order)
 }
 
 // Where returns a new query for subscriptions with the format and arguments supplied.
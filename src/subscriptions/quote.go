@@ -0,0 +1,181 @@
+package subscriptions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// quoteLifetime is how long the price on the product page can be paid before it has to be reloaded
+const quoteLifetime = time.Hour
+
+var (
+	// ErrQuoteInvalid is returned for a quote which is missing or wasn't signed by OPH
+	ErrQuoteInvalid = errors.New("price quote is invalid")
+	// ErrQuoteExpired is returned for a quote older than quoteLifetime
+	ErrQuoteExpired = errors.New("price quote has expired")
+	// ErrQuoteMismatch is returned when the price sent with the checkout isn't the quoted price
+	ErrQuoteMismatch = errors.New("price doesn't match the quote")
+)
+
+// Quote is the price of a product offered on the product page, it is signed so the checkout
+// handlers can refuse a price which was changed in the browser.
+type Quote struct {
+	ProductID int64  `json:"product_id"`
+	Gateway   string `json:"pg"`
+	Country   string `json:"country"`
+	// PriceID is the price or plan id at the gateway if the product has one
+	PriceID string `json:"price_id,omitempty"`
+	// Amount and Currency are as stored with the product
+	Amount    string    `json:"amount,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Schedule  string    `json:"schedule"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Pay is the amount chosen by the buyer of a pay what you want product in the smallest currency unit
+	Pay int64 `json:"pay,omitempty"`
+}
+
+// NewQuote returns the signed quote for the price of the product for the country on the gateway,
+// pay is the amount chosen by the buyer of a pay what you want product or 0.
+func NewQuote(product *products.Story, gateway string, country string, pay int64) (string, error) {
+	quote, err := storedQuote(product, gateway, country)
+	if err != nil {
+		return "", err
+	}
+	quote.ExpiresAt = time.Now().Add(quoteLifetime).UTC()
+	quote.Pay = pay
+
+	b, err := json.Marshal(quote)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(signQuote(b)), nil
+}
+
+// VerifyQuote checks the quote was signed by OPH for the product on the gateway, has not expired
+// and is still the price stored with the product, and returns it.
+func VerifyQuote(token string, product *products.Story, gateway string) (*Quote, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrQuoteInvalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrQuoteInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signQuote(b)) {
+		return nil, ErrQuoteInvalid
+	}
+
+	quote := &Quote{}
+	err = json.Unmarshal(b, quote)
+	if err != nil {
+		return nil, ErrQuoteInvalid
+	}
+
+	if quote.ProductID != product.ID || quote.Gateway != gateway {
+		return nil, ErrQuoteMismatch
+	}
+
+	if quote.Pay > 0 && !product.PayWhatYouWant() {
+		return nil, ErrQuoteMismatch
+	}
+
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	// The admin may have changed the price since the quote was signed
+	stored, err := storedQuote(product, gateway, quote.Country)
+	if err != nil {
+		return nil, ErrQuoteMismatch
+	}
+	stored.ExpiresAt = quote.ExpiresAt
+	stored.Pay = quote.Pay
+	if *stored != *quote {
+		return nil, ErrQuoteMismatch
+	}
+
+	return quote, nil
+}
+
+// Matches reports whether the amount and currency of the checkout are the quoted price,
+// they may be numbers or strings.
+func (q *Quote) Matches(amount interface{}, currency interface{}) bool {
+	return quoteValue(amount) == q.Amount && strings.EqualFold(quoteValue(currency), q.Currency)
+}
+
+// storedQuote returns the unsigned quote for the price stored with the product
+func storedQuote(product *products.Story, gateway string, country string) (*Quote, error) {
+	quote := &Quote{
+		ProductID: product.ID,
+		Gateway:   gateway,
+		Country:   country,
+		Schedule:  product.Schedule,
+	}
+
+	var price map[string]interface{}
+	switch gateway {
+	case "stripe":
+		quote.PriceID = product.StripePrice[country]
+	case "square":
+		price = product.SquarePrice[country]
+	case "paypal":
+		price = product.PaypalPrice[country]
+	case "razorpay":
+		price = product.RazorpayPrice[country]
+	default:
+		return nil, ErrQuoteInvalid
+	}
+
+	if price != nil {
+		quote.PriceID = quoteValue(price["plan_id"])
+		quote.Amount = quoteValue(price["amount"])
+		quote.Currency = quoteValue(price["currency"])
+	}
+
+	if quote.PriceID == "" && quote.Amount == "" {
+		return nil, errors.New("no price for country: " + country)
+	}
+
+	return quote, nil
+}
+
+// quoteValue formats an amount or id of a price the same way whether it was stored or sent as a param
+func quoteValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case int:
+		return strconv.Itoa(value)
+	}
+	return ""
+}
+
+// signQuote returns the HMAC of the quote using the hmac key
+func signQuote(b []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(config.Get("hmac_key")))
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// quoteFailure returns the failure page explaining why the price couldn't be paid
+func quoteFailure(err error) string {
+	return "/subscriptions/failure?errorDetail=" + url.QueryEscape("The "+err.Error()+", please go back to the product page and try again.")
+}
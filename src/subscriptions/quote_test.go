@@ -0,0 +1,73 @@
+// Tests for the signed price quotes
+package subscriptions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test a quote is accepted for the price it was signed for and refused once anything changes
+func TestQuote(t *testing.T) {
+	product := products.New()
+	product.ID = 1
+	product.Schedule = "onetime"
+	product.SquarePrice = map[string]map[string]interface{}{"US": {"amount": 1000.0, "currency": "USD"}}
+
+	token, err := NewQuote(product, "square", "US", 0)
+	if err != nil {
+		t.Fatalf("quotes: error signing quote: %s", err)
+	}
+
+	quote, err := VerifyQuote(token, product, "square")
+	if err != nil {
+		t.Fatalf("quotes: expected quote to verify got:%s", err)
+	}
+	if !quote.Matches(int64(1000), "usd") {
+		t.Fatalf("quotes: expected 1000 USD to match got:%s %s", quote.Amount, quote.Currency)
+	}
+	if quote.Matches(int64(1), "USD") {
+		t.Fatalf("quotes: expected 1 USD not to match")
+	}
+
+	if _, err = VerifyQuote(token+"x", product, "square"); err != ErrQuoteInvalid {
+		t.Fatalf("quotes: expected tampered quote to be invalid got:%v", err)
+	}
+
+	if _, err = VerifyQuote("", product, "square"); err != ErrQuoteInvalid {
+		t.Fatalf("quotes: expected missing quote to be invalid got:%v", err)
+	}
+
+	if _, err = VerifyQuote(token, product, "stripe"); err != ErrQuoteMismatch {
+		t.Fatalf("quotes: expected quote for another gateway to be refused got:%v", err)
+	}
+
+	other := products.New()
+	other.ID = 2
+	other.SquarePrice = product.SquarePrice
+	if _, err = VerifyQuote(token, other, "square"); err != ErrQuoteMismatch {
+		t.Fatalf("quotes: expected quote for another product to be refused got:%v", err)
+	}
+
+	product.SquarePrice["US"]["amount"] = 2000.0
+	if _, err = VerifyQuote(token, product, "square"); err != ErrQuoteMismatch {
+		t.Fatalf("quotes: expected quote to be refused after the price changed got:%v", err)
+	}
+}
+
+// Test an expired quote is refused
+func TestQuoteExpired(t *testing.T) {
+	product := products.New()
+	product.ID = 1
+	product.StripePrice = map[string]string{"DF": "price_default"}
+
+	b, _ := json.Marshal(Quote{ProductID: 1, Gateway: "stripe", Country: "DF", PriceID: "price_default", ExpiresAt: time.Now().Add(-time.Minute)})
+	token := base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(signQuote(b))
+
+	if _, err := VerifyQuote(token, product, "stripe"); err != ErrQuoteExpired {
+		t.Fatalf("quotes: expected expired quote to be refused got:%v", err)
+	}
+}
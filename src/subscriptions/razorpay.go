@@ -5,13 +5,16 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
 	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
 	razorpay "github.com/razorpay/razorpay-go"
 )
 
@@ -25,6 +28,11 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 	// Get current user
 	currentUser := session.CurrentUser(w, r)
 
+	// The order of a cart is paid in one Razorpay checkout
+	if params.Get("order") != "" {
+		return razorpayOrderShow(w, r, params.Get("order"))
+	}
+
 	productId := params.GetInt("product_id")
 	customerName := params.Get("customer_name")
 	customerEmail := params.Get("customer_email")
@@ -37,6 +45,12 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 		return server.InternalError(err)
 	}
 
+	// The price must be the one signed on the product page
+	quote, err := VerifyQuote(params.Get("quote"), product, "razorpay")
+	if err != nil {
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
 	// Get the country from IP
 	clientCountry := r.Header.Get("CF-IPCountry")
 	if !config.Production() {
@@ -46,6 +60,9 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 
 	log.Info(log.V{"Subscription, Client Country": clientCountry})
 
+	// The country of the buyer's IP address is kept as clientCountry falls back to the default price
+	ipCountry := clientCountry
+
 	// Render the template
 	view := view.NewRenderer(w, r)
 
@@ -77,11 +94,40 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 			return server.InternalError(errors.New("razorpay price not configured for this product"))
 		}
 
+		if !quote.Matches(amount, currency) {
+			return server.Redirect(w, r, quoteFailure(ErrQuoteMismatch))
+		}
+
 		// Convert the amount string to integer and multiply by 100 to get the amount in paisa
 		amountInt := int(amount.(float64))
 
 		amountInt = amountInt * 100
 
+		// The buyer of a pay what you want product pays the amount they chose
+		if quote.Pay > 0 {
+			amountInt = int(quote.Pay)
+		}
+
+		// The coupon entered on the product page is taken off the amount of the order
+		var coupon *coupons.Coupon
+		var discount int64
+		if params.Get("coupon") != "" {
+			coupon, err = FindCoupon(params.Get("coupon"), product, "razorpay")
+			if err == nil {
+				discount, err = coupon.Discount(int64(amountInt), currency.(string))
+			}
+			if err != nil {
+				return server.Redirect(w, r, couponFailure(err))
+			}
+			amountInt -= int(discount)
+			view.AddKey("couponLabel", coupon.Code+": "+coupon.Label())
+		}
+
+		// The tax is added to the amount of the order unless prices include it
+		tax := checkoutTax(int64(amountInt), ipCountry, "", params.Get("tax_id"), taxes.Inclusive())
+		amountInt = int(tax.Gross)
+		view.AddKey("taxLabel", tax.Label())
+
 		// Create Order ID
 		client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
 
@@ -100,12 +146,51 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 			log.Error(log.V{"Razorpay Order ID is nil": err})
 			return server.InternalError(err)
 		}
+
+		orderId, _ := order["id"].(string)
+
+		if coupon != nil {
+			_, err = applyCoupon(coupon, product, "razorpay", orderId, discount, currency.(string))
+			if err == coupons.ErrLimitReached {
+				return server.Redirect(w, r, couponFailure(err))
+			} else if err != nil {
+				log.Error(log.V{"Razorpay order, error applying coupon": err, "code": coupon.Code})
+				return server.InternalError(err)
+			}
+		}
+
+		err = recordTax(tax, tax.Tax, product.ID, "razorpay", orderId, ipCountry, "", currency.(string))
+		if err != nil {
+			log.Error(log.V{"Razorpay order, error recording tax evidence": err})
+			return server.InternalError(err)
+		}
+
 		view.AddKey("meta_product_amount", amountInt)
 		view.AddKey("meta_product_currency", currency)
 		view.AddKey("meta_product_order_id", order["id"])
 		view.AddKey("meta_payment_script_type", "checkout")
 
 	case "monthly", "yearly":
+		// The price of the plan is fixed so its tax is included
+		var amount int64
+		var currency string
+		if priceMap := product.RazorpayPrice[clientCountry]; priceMap != nil {
+			if a, ok := priceMap["amount"].(float64); ok {
+				amount = int64(a * 100)
+			}
+			currency, _ = priceMap["currency"].(string)
+		}
+		tax := checkoutTax(amount, ipCountry, "", params.Get("tax_id"), true)
+		view.AddKey("taxLabel", tax.Label())
+
+		if subscriptionId != "" {
+			err = recordTax(tax, tax.Tax, product.ID, "razorpay", subscriptionId, ipCountry, "", currency)
+			if err != nil {
+				log.Error(log.V{"Razorpay subscription, error recording tax evidence": err})
+				return server.InternalError(err)
+			}
+		}
+
 		// Subscription ID retrieved from product
 		view.AddKey("meta_product_subscription_ID", subscriptionId)
 		view.AddKey("meta_payment_script_type", "subscription")
@@ -128,6 +213,51 @@ func HandleRazorpayShow(w http.ResponseWriter, r *http.Request) error {
 	view.AddKey("meta_razorpay_key_id", config.Get("razorpay_key_id"))
 	view.AddKey("clientCountry", clientCountry)
 
+	// The affiliate who referred the buyer is sent in the notes of the payment
+	if affiliateID := referrer(r); affiliateID > 0 {
+		view.AddKey("meta_affiliate_id", affiliateID)
+	}
+
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	return view.Render()
+}
+
+// razorpayOrderShow shows the Razorpay checkout for the Razorpay order of the cart's order with the token
+func razorpayOrderShow(w http.ResponseWriter, r *http.Request, token string) error {
+	order, err := orders.FindToken(token)
+	if err != nil || order.Gateway != "razorpay" {
+		return server.NotFoundError(err)
+	}
+
+	if order.Paid() {
+		return server.Redirect(w, r, "/subscriptions/success?razorpay_order_id="+order.Reference)
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("currentUser", session.CurrentUser(w, r))
+
+	if order.Tax > 0 {
+		view.AddKey("taxLabel", order.Money(order.Tax))
+	}
+
+	view.AddKey("meta_product_amount", order.Amount)
+	view.AddKey("meta_product_currency", order.Currency)
+	view.AddKey("meta_product_order_id", order.Reference)
+	view.AddKey("meta_payment_script_type", "checkout")
+	view.AddKey("meta_product_title", order.Description())
+	view.AddKey("meta_razorpay_key_id", config.Get("razorpay_key_id"))
+	view.AddKey("clientCountry", RequestCountry(r))
+	if affiliateID := referrer(r); affiliateID > 0 {
+		view.AddKey("meta_affiliate_id", affiliateID)
+	}
+
+	view.AddKey("loadRazorpayScript", true)
+	view.AddKey("loadHypermedia", true)
+	view.AddKey("loadSweetAlert", true)
+
 	// Set the name and year
 	view.AddKey("name", config.Get("name"))
 	view.AddKey("year", time.Now().Year())
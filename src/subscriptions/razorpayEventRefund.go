@@ -0,0 +1,46 @@
+package subscriptions
+
+type RazorpayEventRefund struct {
+	Entity    string   `json:"entity,omitempty"`
+	AccountID string   `json:"account_id,omitempty"`
+	Event     string   `json:"event,omitempty"`
+	Contains  []string `json:"contains,omitempty"`
+	Payload   struct {
+		Refund struct {
+			Entity struct {
+				ID        string `json:"id,omitempty"`
+				Entity    string `json:"entity,omitempty"`
+				Amount    int    `json:"amount,omitempty"`
+				Currency  string `json:"currency,omitempty"`
+				PaymentID string `json:"payment_id,omitempty"`
+				Status    string `json:"status,omitempty"`
+				CreatedAt int64  `json:"created_at,omitempty"`
+			} `json:"entity,omitempty"`
+		} `json:"refund,omitempty"`
+		Dispute struct {
+			Entity struct {
+				ID         string `json:"id,omitempty"`
+				Entity     string `json:"entity,omitempty"`
+				Amount     int    `json:"amount,omitempty"`
+				Currency   string `json:"currency,omitempty"`
+				PaymentID  string `json:"payment_id,omitempty"`
+				ReasonCode string `json:"reason_code,omitempty"`
+				Status     string `json:"status,omitempty"`
+				CreatedAt  int64  `json:"created_at,omitempty"`
+			} `json:"entity,omitempty"`
+		} `json:"dispute,omitempty"`
+		Payment struct {
+			Entity struct {
+				ID             string `json:"id,omitempty"`
+				Entity         string `json:"entity,omitempty"`
+				Amount         int    `json:"amount,omitempty"`
+				Currency       string `json:"currency,omitempty"`
+				Status         string `json:"status,omitempty"`
+				OrderID        string `json:"order_id,omitempty"`
+				AmountRefunded int    `json:"amount_refunded,omitempty"`
+				Email          string `json:"email,omitempty"`
+			} `json:"entity,omitempty"`
+		} `json:"payment,omitempty"`
+	} `json:"payload,omitempty"`
+	CreatedAt int64 `json:"created_at,omitempty"`
+}
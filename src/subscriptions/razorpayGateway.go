@@ -0,0 +1,325 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	razorpay "github.com/razorpay/razorpay-go"
+	"github.com/razorpay/razorpay-go/utils"
+)
+
+// RazorpayGateway is the Gateway adapter for Razorpay
+type RazorpayGateway struct{}
+
+// Name returns the name of the gateway
+func (g *RazorpayGateway) Name() string {
+	return "razorpay"
+}
+
+// Enabled reports whether Razorpay is switched on
+func (g *RazorpayGateway) Enabled() bool {
+	return config.GetBool("razorpay")
+}
+
+// HasPrice reports whether the product has a Razorpay price or plan for the country
+func (g *RazorpayGateway) HasPrice(product *products.Story, country string) bool {
+	return product.RazorpayPrice != nil && product.RazorpayPrice[country] != nil && (product.RazorpayPrice[country]["amount"] != nil || product.RazorpayPrice[country]["plan_id"] != nil)
+}
+
+// Checkout returns the Razorpay price of the product for the country, for subscriptions
+// a Razorpay subscription is created from the plan so the customer can authorise it.
+func (g *RazorpayGateway) Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error) {
+	checkout := &Checkout{Type: checkoutType(product.Schedule)}
+
+	if checkout.Type == "onetime" {
+		amount := product.RazorpayPrice[country]["amount"]
+		currency := product.RazorpayPrice[country]["currency"]
+
+		amountValue, ok := amount.(float64)
+		currencyValue, ok2 := currency.(string)
+		if !ok || !ok2 {
+			return nil, errors.New("Invalid price details for client country: " + country)
+		}
+
+		checkout.Price = strconv.FormatFloat(amountValue, 'g', 5, 64) + " " + currencyValue + "/" + scheduleLabel(product.Schedule)
+		checkout.Amount = amount
+		checkout.Currency = currency
+		// Orders are created for the whole amount in paisa
+		checkout.UnitAmount = int64(amountValue) * 100
+		checkout.Link = "/subscriptions/razorpay?" + fmt.Sprintf("type=%s&product_id=%d&redirect_uri=%s&custom_id=%s", "onetime", product.ID, redirectURI, customID)
+		return checkout, nil
+	}
+
+	planId, ok := product.RazorpayPrice[country]["plan_id"].(string)
+	if !ok {
+		return nil, errors.New("Invalid plan details for client country: " + country)
+	}
+
+	razorpayClient := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	// Set total_count based on schedule: 120 for monthly (10 years), 30 for yearly (30 years)
+	// Razorpay UPI payment method requires expire_at to be max 30 years
+	totalCount := 120
+	if product.Schedule == "yearly" {
+		totalCount = 30
+	}
+
+	data := map[string]interface{}{
+		"plan_id":     planId,
+		"total_count": totalCount,
+	}
+
+	// The first charge of a subscription with a free trial is when the trial ends
+	if product.Trial() {
+		data["start_at"] = TrialEnd(product, time.Now()).Unix()
+	}
+
+	subscription, err := razorpayClient.Subscription.Create(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionId, _ := subscription["id"].(string)
+	if subscriptionId == "" {
+		return nil, errors.New("razorpay subscription was not created")
+	}
+
+	checkout.Link = "/subscriptions/razorpay?" + fmt.Sprintf("type=%s&product_id=%d&subscription_id=%s&redirect_uri=%s&custom_id=%s", "subscription", product.ID, subscriptionId, redirectURI, customID)
+
+	razorpayPlan, err := razorpayClient.Plan.Fetch(planId, nil, nil)
+	if err != nil {
+		// The subscribe button still works without the price label
+		log.Error(log.V{"Razorpay checkout, Error fetching razorpay amount": err})
+		return checkout, nil
+	}
+
+	razorpayItem, _ := razorpayPlan["item"].(map[string]interface{})
+	razorpayAmount, _ := razorpayItem["amount"].(float64)
+	razorpayCurrency, _ := razorpayItem["currency"].(string)
+
+	checkout.Price = strconv.FormatFloat(razorpayAmount/100, 'g', 5, 64) + " " + razorpayCurrency + "/" + scheduleLabel(product.Schedule)
+
+	return checkout, nil
+}
+
+// VerifyWebhook checks the X-Razorpay-Signature header of the request
+func (g *RazorpayGateway) VerifyWebhook(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.VerifyWebhookSignature(string(b), r.Header.Get("X-Razorpay-Signature"), config.Get("razorpay_webhook_secret")) {
+		return nil, errors.New("invalid razorpay webhook signature")
+	}
+
+	return b, nil
+}
+
+// NormaliseEvent converts a Razorpay order or subscription event into a PaymentEvent
+func (g *RazorpayGateway) NormaliseEvent(body []byte) (*PaymentEvent, error) {
+	var razorpayWebhookEvent RazorpayWebhookEvent
+	err := json.Unmarshal(body, &razorpayWebhookEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch razorpayWebhookEvent.Event {
+	case "order.paid":
+		var razorpayEventOrderPaid RazorpayEventOrderPaid
+		err = json.Unmarshal(body, &razorpayEventOrderPaid)
+		if err != nil {
+			return nil, err
+		}
+
+		order := razorpayEventOrderPaid.Payload.Order.Entity
+		payment := razorpayEventOrderPaid.Payload.Payment.Entity
+
+		paymentEvent := &PaymentEvent{
+			// Razorpay sends the event id only in a header, the order is paid once
+			ID:            razorpayWebhookEvent.Event + ":" + order.ID,
+			Gateway:       g.Name(),
+			Type:          WebhookPaymentSucceeded,
+			PaymentID:     order.ID,
+			CustomerEmail: payment.Email,
+			CustomerName:  payment.Name,
+			Amount:        int64(payment.Amount),
+			Fee:           int64(payment.Fee),
+			Currency:      payment.Currency,
+			Status:        payment.Status,
+			Created:       time.Unix(razorpayEventOrderPaid.CreatedAt, 0).UTC(),
+		}
+
+		razorpayNotes(paymentEvent, payment.Notes)
+
+		return paymentEvent, nil
+
+	case "refund.processed", "payment.dispute.created":
+		var razorpayEventRefund RazorpayEventRefund
+		err = json.Unmarshal(body, &razorpayEventRefund)
+		if err != nil {
+			return nil, err
+		}
+
+		payment := razorpayEventRefund.Payload.Payment.Entity
+
+		// Orders are stored by order id, payments of a subscription by the payment id
+		paymentEvent := &PaymentEvent{
+			Gateway:       g.Name(),
+			PaymentID:     payment.ID,
+			OrderID:       payment.OrderID,
+			CustomerEmail: payment.Email,
+			Created:       time.Unix(razorpayEventRefund.CreatedAt, 0).UTC(),
+		}
+
+		if razorpayWebhookEvent.Event == "refund.processed" {
+			refund := razorpayEventRefund.Payload.Refund.Entity
+			paymentEvent.ID = razorpayWebhookEvent.Event + ":" + refund.ID
+			paymentEvent.Type = WebhookPaymentRefunded
+			paymentEvent.RefundID = refund.ID
+			paymentEvent.Amount = int64(refund.Amount)
+			paymentEvent.AmountRefunded = int64(payment.AmountRefunded)
+			paymentEvent.Currency = refund.Currency
+			paymentEvent.Status = refund.Status
+		} else {
+			dispute := razorpayEventRefund.Payload.Dispute.Entity
+			paymentEvent.ID = razorpayWebhookEvent.Event + ":" + dispute.ID
+			paymentEvent.Type = WebhookPaymentDisputed
+			paymentEvent.RefundID = dispute.ID
+			paymentEvent.Amount = int64(dispute.Amount)
+			paymentEvent.Currency = dispute.Currency
+			paymentEvent.Reason = dispute.ReasonCode
+			paymentEvent.Status = dispute.Status
+		}
+
+		return paymentEvent, nil
+
+	case "subscription.authenticated", "subscription.activated", "subscription.charged", "subscription.completed", "subscription.updated",
+		"subscription.pending", "subscription.halted", "subscription.cancelled", "subscription.paused", "subscription.resumed":
+		var razorpayEventSubscriptionCompleted RazorpayEventSubscriptionCompleted
+		err = json.Unmarshal(body, &razorpayEventSubscriptionCompleted)
+		if err != nil {
+			return nil, err
+		}
+
+		subscription := razorpayEventSubscriptionCompleted.Payload.Subscription.Entity
+		payment := razorpayEventSubscriptionCompleted.Payload.Payment.Entity
+
+		paymentEvent := &PaymentEvent{
+			ID:             fmt.Sprintf("%s:%s:%d", razorpayWebhookEvent.Event, subscription.ID, razorpayEventSubscriptionCompleted.CreatedAt),
+			Gateway:        g.Name(),
+			Type:           WebhookSubscriptionUpdated,
+			PlanID:         subscription.PlanID,
+			SubscriptionID: subscription.ID,
+			PaymentID:      payment.ID,
+			CustomerID:     subscription.CustomerID,
+			CustomerEmail:  payment.Email,
+			Amount:         int64(payment.Amount),
+			Fee:            int64(payment.Fee),
+			Currency:       payment.Currency,
+			Status:         subscription.Status,
+			Created:        time.Unix(razorpayEventSubscriptionCompleted.CreatedAt, 0).UTC(),
+		}
+
+		razorpayNotes(paymentEvent, payment.Notes)
+
+		switch razorpayWebhookEvent.Event {
+		case "subscription.authenticated", "subscription.activated":
+			// A subscription with a free trial is authenticated when it starts and activated when the trial ends
+			paymentEvent.Type = WebhookSubscriptionActivated
+		case "subscription.charged":
+			paymentEvent.Type = WebhookPaymentSucceeded
+		case "subscription.cancelled":
+			paymentEvent.Type = WebhookSubscriptionCancelled
+		case "subscription.halted":
+			paymentEvent.Type = WebhookPaymentFailed
+		}
+
+		return paymentEvent, nil
+	}
+
+	return nil, nil
+}
+
+// razorpayNotes copies the customer details collected on the checkout form from the payment notes
+func razorpayNotes(paymentEvent *PaymentEvent, notes map[string]any) {
+	note := func(key string) string {
+		value, _ := notes[key].(string)
+		return value
+	}
+
+	if customID := note("custom_id"); customID != "" {
+		paymentEvent.CustomID = customID
+	}
+	if productID := note("product_id"); productID != "" {
+		paymentEvent.ProductID, _ = strconv.ParseInt(productID, 10, 64)
+	}
+	if affiliateID := note("affiliate_id"); affiliateID != "" {
+		paymentEvent.AffiliateID, _ = strconv.ParseInt(affiliateID, 10, 64)
+	}
+	if email := note("email"); email != "" {
+		paymentEvent.CustomerEmail = email
+	}
+	if name := note("name"); name != "" {
+		paymentEvent.CustomerName = name
+	}
+
+	// Phone number is sent to Razorpay but not stored locally for privacy
+	paymentEvent.AddressStreet = note("address")
+	paymentEvent.AddressCity = note("address_city")
+	paymentEvent.AddressState = note("address_state")
+	paymentEvent.AddressZip = note("address_pincode")
+}
+
+// Cancel cancels the Razorpay subscription at the end of the billing cycle
+func (g *RazorpayGateway) Cancel(subscriptionID string) error {
+	return CancelRazorpaySubscription(subscriptionID)
+}
+
+// Refund refunds the Razorpay payment, for an order the captured payment of the order is refunded
+func (g *RazorpayGateway) Refund(paymentID string, amount int64, currency string) error {
+	client := razorpay.NewClient(config.Get("razorpay_key_id"), config.Get("razorpay_key_secret"))
+
+	// One-time payments are stored by their order id
+	if strings.HasPrefix(paymentID, "order_") {
+		payments, err := client.Order.Payments(paymentID, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		paymentID = ""
+		items, _ := payments["items"].([]interface{})
+		for _, item := range items {
+			payment, _ := item.(map[string]interface{})
+			if payment["status"] == "captured" {
+				paymentID, _ = payment["id"].(string)
+				break
+			}
+		}
+
+		if paymentID == "" {
+			return errors.New("razorpay order has no captured payment")
+		}
+	}
+
+	if amount == 0 {
+		payment, err := client.Payment.Fetch(paymentID, nil, nil)
+		if err != nil {
+			return err
+		}
+		paymentAmount, _ := payment["amount"].(float64)
+		amount = int64(paymentAmount)
+	}
+
+	_, err := client.Payment.Refund(paymentID, int(amount), nil, nil)
+	return err
+}
@@ -0,0 +1,184 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// RefundsTableName is the database table for the refunds and disputes of payments
+	RefundsTableName = "refunds"
+
+	// RefundKindRefund is a refund issued from the gateway or the admin
+	RefundKindRefund = "refund"
+	// RefundKindDispute is a dispute or chargeback opened by the customer's bank
+	RefundKindDispute = "dispute"
+
+	// PaymentRefunded is the payment status of a one-time payment refunded in full
+	PaymentRefunded = "refunded"
+	// PaymentPartiallyRefunded is the payment status of a one-time payment refunded in part
+	PaymentPartiallyRefunded = "partially_refunded"
+	// PaymentDisputed is the payment status of a one-time payment under dispute
+	PaymentDisputed = "disputed"
+)
+
+// Refund is a refund or dispute recorded against a transaction in the subscriptions table
+type Refund struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	Gateway       string
+	RefundID      string
+	TransactionID int64
+	Kind          string
+	Amount        float64
+	Currency      string
+	Reason        string
+}
+
+// NewRefund creates and initialises a new refund instance.
+func NewRefund() *Refund {
+	refund := &Refund{}
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = time.Now()
+	refund.TableName = RefundsTableName
+	refund.KeyName = KeyName
+	return refund
+}
+
+// NewRefundWithColumns creates a new refund instance and fills it with data from the database cols provided.
+func NewRefundWithColumns(cols map[string]interface{}) *Refund {
+	refund := NewRefund()
+	refund.ID = resource.ValidateInt(cols["id"])
+	refund.CreatedAt = resource.ValidateTime(cols["created_at"])
+	refund.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	refund.Gateway = resource.ValidateString(cols["pg"])
+	refund.RefundID = resource.ValidateString(cols["refund_id"])
+	refund.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	refund.Kind = resource.ValidateString(cols["kind"])
+	refund.Amount = resource.ValidateFloat(cols["amount"])
+	refund.Currency = resource.ValidateString(cols["currency"])
+	refund.Reason = resource.ValidateString(cols["reason"])
+	return refund
+}
+
+// FindRefund fetches the refund or dispute of the gateway with the given refund id in the transaction.
+func FindRefund(tx *query.Tx, gateway string, refundID string) (*Refund, error) {
+	result, err := RefundsQueryTx(tx).Where("pg=?", gateway).Where("refund_id=?", refundID).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewRefundWithColumns(result), nil
+}
+
+// FindAllRefunds fetches all refund records matching this query from the database.
+func FindAllRefunds(q *query.Query) ([]*Refund, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var refunds []*Refund
+	for _, cols := range results {
+		refunds = append(refunds, NewRefundWithColumns(cols))
+	}
+
+	return refunds, nil
+}
+
+// FindTransactionRefunds fetches the refunds and disputes of the given transactions, keyed by transaction id.
+func FindTransactionRefunds(transactions []*Subscription) (map[int64][]*Refund, error) {
+	refunds := make(map[int64][]*Refund)
+	if len(transactions) == 0 {
+		return refunds, nil
+	}
+
+	var ids []int64
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+	}
+
+	results, err := FindAllRefunds(RefundsQuery().WhereIn("transaction_id", ids).Order("id asc"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, refund := range results {
+		refunds[refund.TransactionID] = append(refunds[refund.TransactionID], refund)
+	}
+
+	return refunds, nil
+}
+
+// RefundedAmount returns the total refunded of the transaction in the smallest currency unit,
+// disputes are not included.
+func RefundedAmount(transactionID int64) (int64, error) {
+	return RefundedAmountTx(nil, transactionID)
+}
+
+// RefundedAmountTx returns the total refunded of the transaction in the smallest currency unit in the database transaction.
+func RefundedAmountTx(tx *query.Tx, transactionID int64) (int64, error) {
+	refunds, err := FindAllRefunds(RefundsQueryTx(tx).Where("transaction_id=?", transactionID).Where("kind=?", RefundKindRefund))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, refund := range refunds {
+		total += int64(math.Round(refund.Amount * 100))
+	}
+	return total, nil
+}
+
+// RefundPayment refunds a one-time payment through its gateway, amount is a decimal amount like 10.50
+// and an empty amount refunds the rest of the payment. The refund is recorded when the gateway's webhook confirms it.
+func RefundPayment(transaction *Subscription, amount string) error {
+	if transaction.SubscriptionId != "" {
+		return errors.New("payments of a subscription are refunded at the gateway")
+	}
+
+	gateway, err := FindGateway(transaction.PaymentGateway)
+	if err != nil {
+		return err
+	}
+
+	refunded, err := RefundedAmount(transaction.ID)
+	if err != nil {
+		return err
+	}
+
+	remaining := minorUnits(fmt.Sprintf("%.2f", transaction.Amount)) - refunded
+	if remaining <= 0 {
+		return errors.New("payment is already refunded")
+	}
+
+	refund := remaining
+	if amount != "" {
+		refund = minorUnits(amount)
+		if refund <= 0 || refund > remaining {
+			return fmt.Errorf("refund must be more than 0 and at most %s", majorUnits(remaining))
+		}
+	}
+
+	// A full refund is requested with 0 so the gateway refunds what is left
+	if refund == remaining && refunded == 0 {
+		refund = 0
+	}
+
+	return gateway.Refund(transaction.PaymentId, refund, transaction.Currency)
+}
+
+// RefundsQuery returns a new query for refunds with a default order.
+func RefundsQuery() *query.Query {
+	return RefundsQueryTx(nil)
+}
+
+// RefundsQueryTx returns a new query for refunds with a default order in the transaction.
+func RefundsQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(RefundsTableName, KeyName).Order("id desc")
+}
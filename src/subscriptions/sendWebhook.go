@@ -2,57 +2,220 @@ package subscriptions
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/webhook"
+	"github.com/abishekmuthian/open-payment-host/src/products"
 )
 
-// SendWebhook sends a webhook to the specified URL with the given payload.
-func SendWebhook(url string, secret string, params map[string]interface{}) error {
-	// payload := fmt.Sprint(params["subscription_id"], "|", params["custom_id"], "|", params["status"])
+const (
+	// webhookBatchSize is the number of due deliveries sent on each run of the worker
+	webhookBatchSize = 50
+	// webhookMaxResponseBody is the number of response bytes stored for each attempt
+	webhookMaxResponseBody = 1024
+	// webhookMaxBackoff caps the exponential delay between attempts
+	webhookMaxBackoff = 24 * time.Hour
+)
+
+// webhookClient is used for outbound webhooks so a slow endpoint can't stall the worker
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookWorker makes sure only one worker is delivering webhooks at a time
+var webhookWorker sync.Mutex
+
+// SendWebhook queues an event of eventType for the product, the worker delivers it
+// and retries with exponential backoff until the endpoint acknowledges it.
+func SendWebhook(productId int64, eventType string, url string, secret string, data WebhookEventData) error {
+	event := NewWebhookEvent(eventType, data)
 
-	// Marshal params to JSON
-	jsonParams, err := json.Marshal(params)
+	// Marshal the event to JSON
+	payload, err := json.Marshal(event)
 	if err != nil {
-		// Handle error appropriately
-		log.Error(log.V{"Error marshaling params: ": err})
+		log.Error(log.V{"Error marshaling webhook event: ": err})
+		return err
 	}
 
-	body := bytes.NewReader([]byte(jsonParams))
+	return queueWebhook(productId, eventType, url, secret, payload)
+}
+
+// Replay queues the payload of this delivery again, signed with the product's current secret.
+func (d *WebhookDelivery) Replay(url string, secret string) error {
+	return queueWebhook(d.ProductID, d.EventType, url, secret, []byte(d.Payload))
+}
+
+// queueWebhook signs the payload and stores it as a pending delivery.
+func queueWebhook(productId int64, eventType string, url string, secret string, payload []byte) error {
+	signature := webhook.Sign(payload, secret, time.Now())
 
-	signature := GenerateSignature([]byte(jsonParams), secret)
+	deliveryParams := make(map[string]string)
+	deliveryParams["product_id"] = strconv.FormatInt(productId, 10)
+	deliveryParams["event_type"] = eventType
+	deliveryParams["url"] = url
+	deliveryParams["payload"] = string(payload)
+	deliveryParams["signature"] = signature
+	deliveryParams["status"] = WebhookPending
+	deliveryParams["attempts"] = "0"
+	deliveryParams["next_attempt_at"] = query.TimeString(time.Now().UTC())
 
-	request, err := http.NewRequest(http.MethodPost, url, body)
+	_, err := NewWebhookDelivery().Create(deliveryParams)
 	if err != nil {
-		// handle err
-		log.Error(log.V{"SendWebhook error": err})
+		log.Error(log.V{"SendWebhook, Error queuing webhook": err})
 		return err
 	}
 
-	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	request.Header.Add("X-OPH-Signature", signature)
+	// Attempt the first delivery right away instead of waiting for the next scheduled run
+	go DeliverWebhooks()
+
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(request)
+// DeliverWebhooks sends the pending webhooks which are due, it is run by the scheduler.
+func DeliverWebhooks() {
+	if !webhookWorker.TryLock() {
+		return
+	}
+	defer webhookWorker.Unlock()
+
+	deliveries, err := FindDueWebhookDeliveries(webhookBatchSize)
 	if err != nil {
-		log.Error(log.V{"SendWebhook error": err})
+		log.Error(log.V{"DeliverWebhooks, Error fetching due webhooks": err})
+		return
+	}
 
-		return err
+	for _, delivery := range deliveries {
+		delivery.Deliver()
+	}
+}
+
+// Deliver makes one attempt at sending the webhook and records the outcome,
+// the payload is signed again on each attempt so the timestamp is current.
+func (d *WebhookDelivery) Deliver() {
+	attempt := d.Attempts + 1
+
+	var statusCode int
+	var latency time.Duration
+	var responseBody string
+
+	signature, err := d.sign()
+	if err == nil {
+		statusCode, latency, responseBody, err = postWebhook(d.URL, signature, []byte(d.Payload))
+	}
+
+	attemptParams := make(map[string]string)
+	attemptParams["delivery_id"] = strconv.FormatInt(d.ID, 10)
+	attemptParams["attempt"] = strconv.FormatInt(attempt, 10)
+	attemptParams["status_code"] = strconv.Itoa(statusCode)
+	attemptParams["latency_ms"] = strconv.FormatInt(latency.Milliseconds(), 10)
+	attemptParams["response_body"] = responseBody
+
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("webhook endpoint responded with status %d", statusCode)
+	}
+
+	deliveryParams := make(map[string]string)
+	deliveryParams["attempts"] = strconv.FormatInt(attempt, 10)
+	deliveryParams["last_status_code"] = strconv.Itoa(statusCode)
+	if signature != "" {
+		deliveryParams["signature"] = signature
 	}
 
+	now := time.Now().UTC()
+
+	if err == nil {
+		deliveryParams["status"] = WebhookDelivered
+		deliveryParams["delivered_at"] = query.TimeString(now)
+		deliveryParams["last_error"] = ""
+	} else {
+		attemptParams["error"] = err.Error()
+		deliveryParams["last_error"] = err.Error()
+
+		if attempt >= webhookMaxAttempts() {
+			deliveryParams["status"] = WebhookFailed
+			log.Error(log.V{"Webhook delivery failed, giving up after attempts": attempt, "delivery_id": d.ID})
+		} else {
+			deliveryParams["next_attempt_at"] = query.TimeString(now.Add(webhookBackoff(attempt)))
+			log.Info(log.V{"Webhook delivery failed, will retry": err, "delivery_id": d.ID})
+		}
+	}
+
+	_, err = NewWebhookAttempt().Create(attemptParams)
+	if err != nil {
+		log.Error(log.V{"Deliver, Error recording webhook attempt": err})
+	}
+
+	err = d.Update(deliveryParams)
+	if err != nil {
+		log.Error(log.V{"Deliver, Error updating webhook delivery": err})
+	}
+}
+
+// sign returns the signature of the payload with the product's current webhook secret.
+func (d *WebhookDelivery) sign() (string, error) {
+	product, err := products.Find(d.ProductID)
+	if err != nil {
+		return "", err
+	}
+
+	if product.WebhookSecret == "" {
+		return "", errors.New("product has no webhook secret")
+	}
+
+	return webhook.Sign([]byte(d.Payload), product.WebhookSecret, time.Now()), nil
+}
+
+// postWebhook sends the signed payload and returns the status code, latency and response body.
+func postWebhook(url string, signature string, payload []byte) (int, time.Duration, string, error) {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add(webhook.SignatureHeader, signature)
+
+	start := time.Now()
+	resp, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, time.Since(start), "", err
+	}
 	defer resp.Body.Close()
 
-	return err
+	body, err := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	latency := time.Since(start)
+	if err != nil {
+		return resp.StatusCode, latency, "", err
+	}
+
+	return resp.StatusCode, latency, string(body), nil
+}
 
+// webhookBackoff returns the delay before the next attempt, doubling from a minute up to a day.
+func webhookBackoff(attempt int64) time.Duration {
+	backoff := time.Minute
+	for i := int64(1); i < attempt; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
 }
 
-// GenerateSignature generates a signature for the given payload and secret.
-func GenerateSignature(body []byte, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(body)
-	signature := hex.EncodeToString(h.Sum(nil))
-	return signature
+// webhookMaxAttempts returns the number of attempts made before a delivery is marked as failed.
+func webhookMaxAttempts() int64 {
+	maxAttempts := int64(config.GetInt("webhook_max_attempts"))
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	return maxAttempts
 }
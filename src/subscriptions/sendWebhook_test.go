@@ -0,0 +1,146 @@
+// Tests for delivering product webhooks with retries
+package subscriptions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/webhook"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test the delay between attempts doubles from a minute and is capped at a day
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int64
+		backoff time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{11, 1024 * time.Minute},
+		{12, webhookMaxBackoff},
+		{50, webhookMaxBackoff},
+	}
+
+	for _, test := range tests {
+		if backoff := webhookBackoff(test.attempt); backoff != test.backoff {
+			t.Fatalf("webhooks: expected backoff of %s after attempt %d got:%s", test.backoff, test.attempt, backoff)
+		}
+	}
+}
+
+// Test the attempts made before a delivery fails are read from webhook_max_attempts with a default of 10
+func TestWebhookMaxAttempts(t *testing.T) {
+	tests := []struct {
+		value       string
+		maxAttempts int64
+	}{
+		{"", 10},
+		{"3", 3},
+		{"0", 10},
+		{"-1", 10},
+		{"many", 10},
+	}
+
+	for _, test := range tests {
+		setTestConfig(t, map[string]string{"webhook_max_attempts": test.value})
+		if maxAttempts := webhookMaxAttempts(); maxAttempts != test.maxAttempts {
+			t.Fatalf("webhooks: expected %d attempts for %q got:%d", test.maxAttempts, test.value, maxAttempts)
+		}
+	}
+}
+
+// Test 2xx responses deliver the webhook, other responses are retried with backoff until the last attempt fails it,
+// and each attempt is signed afresh
+func TestDeliver(t *testing.T) {
+	openTestDatabase(t)
+	setTestConfig(t, map[string]string{"webhook_max_attempts": "3"})
+
+	tests := []struct {
+		statusCode int
+		attempts   int64
+		status     string
+	}{
+		{http.StatusOK, 0, WebhookDelivered},
+		{http.StatusNoContent, 0, WebhookDelivered},
+		{299, 0, WebhookDelivered},
+		{http.StatusMovedPermanently, 0, WebhookPending},
+		{http.StatusNotFound, 0, WebhookPending},
+		{http.StatusInternalServerError, 1, WebhookPending},
+		{http.StatusInternalServerError, 2, WebhookFailed},
+		{http.StatusOK, 2, WebhookDelivered},
+	}
+
+	var signature string
+	var statusCode int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(webhook.SignatureHeader)
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	productID, err := products.New().Create(map[string]string{"name": "Webhooks", "webhook_url": server.URL, "webhook_secret": "secret"})
+	if err != nil {
+		t.Fatalf("webhooks: error creating product %s", err)
+	}
+
+	for _, test := range tests {
+		statusCode = test.statusCode
+
+		// The signature made when the webhook was queued is too old to be accepted
+		payload, _ := json.Marshal(NewWebhookEvent(WebhookPaymentSucceeded, WebhookEventData{ProductID: productID}))
+		queued := webhook.Sign(payload, "secret", time.Now().Add(-time.Hour))
+
+		id, err := NewWebhookDelivery().Create(map[string]string{
+			"product_id":      strconv.FormatInt(productID, 10),
+			"event_type":      WebhookPaymentSucceeded,
+			"url":             server.URL,
+			"payload":         string(payload),
+			"signature":       queued,
+			"status":          WebhookPending,
+			"attempts":        strconv.FormatInt(test.attempts, 10),
+			"next_attempt_at": query.TimeString(time.Now().UTC()),
+		})
+		if err != nil {
+			t.Fatalf("webhooks: error creating delivery %s", err)
+		}
+
+		delivery, err := FindWebhookDelivery(id)
+		if err != nil {
+			t.Fatalf("webhooks: error finding delivery %s", err)
+		}
+
+		delivery.Deliver()
+
+		if signature == queued || webhook.Verify(payload, signature, "secret", time.Minute) != nil {
+			t.Fatalf("webhooks: expected attempt %d to be signed afresh got:%s", test.attempts+1, signature)
+		}
+
+		delivery, err = FindWebhookDelivery(id)
+		if err != nil {
+			t.Fatalf("webhooks: error finding delivery %s", err)
+		}
+		if delivery.Status != test.status || delivery.Attempts != test.attempts+1 || delivery.LastStatusCode != int64(test.statusCode) || delivery.Signature != signature {
+			t.Fatalf("webhooks: expected %s delivery after attempt %d with status %d got:%+v", test.status, test.attempts+1, test.statusCode, delivery)
+		}
+
+		if test.status == WebhookPending {
+			retryAt := time.Now().UTC().Add(webhookBackoff(delivery.Attempts))
+			if delivery.NextAttemptAt.Sub(retryAt).Abs() > 5*time.Second {
+				t.Fatalf("webhooks: expected retry at %s got:%s", retryAt, delivery.NextAttemptAt)
+			}
+		}
+
+		attempts, err := FindWebhookAttempts([]*WebhookDelivery{delivery})
+		if err != nil || len(attempts[id]) != 1 || attempts[id][0].StatusCode != int64(test.statusCode) {
+			t.Fatalf("webhooks: expected attempt with status %d to be recorded got:%v %v", test.statusCode, attempts[id], err)
+		}
+	}
+}
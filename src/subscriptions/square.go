@@ -10,14 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
-	s3 "github.com/abishekmuthian/open-payment-host/src/lib/s3"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
 	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
 	"github.com/google/uuid"
 )
 
@@ -36,11 +38,38 @@ func HandleSquareShow(w http.ResponseWriter, r *http.Request) error {
 	currency := params.Get("currency")
 	paymentType := params.Get("type")
 
+	// The price must be the one signed on the product page, or the total of the order of the cart
+	if params.Get("order") != "" {
+		_, err = checkSquareOrder(params.Get("order"), amount, currency)
+	} else {
+		err = checkSquareQuote(params.Get("quote"), params.GetInt("productId"), amount, currency, paymentType)
+	}
+	if err != nil {
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
 	// Render the template
 	view := view.NewRenderer(w, r)
 
 	view.AddKey("currentUser", currentUser)
 
+	// Show the price after the discount of the coupon entered on the product page
+	if params.Get("coupon") != "" {
+		coupon, discount, err := squareCoupon(params.Get("coupon"), params.GetInt("productId"), amount, currency)
+		if err != nil {
+			return server.Redirect(w, r, couponFailure(err))
+		}
+		amount -= discount
+		view.AddKey("couponLabel", coupon.Code+": "+coupon.Label())
+	}
+
+	// The tax of a one time payment is added to the amount charged unless prices include it,
+	// the price of a subscription plan is fixed so its tax is included
+	inclusive := taxes.Inclusive() || paymentType == "subscription"
+	tax := checkoutTax(amount, RequestCountry(r), params.Get("country"), params.Get("tax_id"), inclusive)
+	amount = tax.Gross
+	view.AddKey("taxLabel", tax.Label())
+
 	if paymentType == "onetime" {
 		view.AddKey("price", fmt.Sprintf("%d %s/One Time", amount/1000, currency))
 	} else if paymentType == "subscription" {
@@ -78,34 +107,140 @@ func HandleSquare(w http.ResponseWriter, r *http.Request) error {
 	currency := params.Get("currency")
 	productId := params.GetInt("productId")
 
+	// The price must be the one signed on the product page, or the total of the order of the cart
+	var order *orders.Order
+	referenceID := fmt.Sprintf("Product Id: %d", productId)
+	if params.Get("order") != "" {
+		order, err = checkSquareOrder(params.Get("order"), amount, currency)
+		if order != nil {
+			referenceID = fmt.Sprintf("Order Id: %d", order.ID)
+		}
+	} else {
+		err = checkSquareQuote(params.Get("quote"), productId, amount, currency, "onetime")
+	}
+	if err != nil {
+		log.Error(log.V{"Square Payment, price refused": err, "product_id": productId, "amount": amount})
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
+	// The coupon entered on the product page is taken off the amount charged
+	var coupon *coupons.Coupon
+	var discount int64
+	if params.Get("coupon") != "" {
+		coupon, discount, err = squareCoupon(params.Get("coupon"), productId, amount, currency)
+		if err != nil {
+			return server.Redirect(w, r, couponFailure(err))
+		}
+		amount -= discount
+	}
+
+	// The tax is added to the amount charged unless prices include it
+	ipCountry := RequestCountry(r)
+	billingCountry := params.Get("country")
+	tax := checkoutTax(amount, ipCountry, billingCountry, params.Get("tax_id"), taxes.Inclusive())
+	amount = tax.Gross
+
+	// The card of a buyer who is offered an upsell after the purchase is saved so that the upsell is paid with one click,
+	// the payment is made with the token when the card can't be saved
+	sourceID := paymentToken
+	var customerId, cardId string
+	if order == nil && upsellOffered(productId) {
+		customerId, err = CreateCustomer(paymentToken, verificationToken, amount, currency, productId, params.Get("addressLine1"), params.Get("addressLine2"),
+			params.Get("givenName"), params.Get("email"), billingCountry, params.Get("city"), params.Get("state"), params.Get("postalcode"))
+		if err == nil {
+			cardId, err = CreateCard(paymentToken, verificationToken, amount, currency, productId, params.Get("addressLine1"), params.Get("addressLine2"),
+				params.Get("givenName"), params.Get("email"), billingCountry, params.Get("city"), params.Get("state"), params.Get("postalcode"), customerId)
+		}
+		if err != nil {
+			log.Error(log.V{"Square Payment, error saving card for the upsell": err, "product_id": productId})
+			customerId, cardId = "", ""
+		} else {
+			sourceID = cardId
+		}
+	}
+
 	// Generate a new Version 4 UUID
 	u, err := uuid.NewRandom()
 	if err != nil {
 		return server.InternalError(err)
 	}
 
+	// The coupon holds one of its uses with the idempotency key while the card is charged, the hold is moved
+	// to the payment once it is made and given back if the charge fails
+	var redemption *coupons.Redemption
+	if coupon != nil && order == nil {
+		product, err := products.Find(productId)
+		if err != nil {
+			return server.NotFoundError(err)
+		}
+
+		redemption, err = applyCoupon(coupon, product, "square", u.String(), discount, currency)
+		if err == coupons.ErrLimitReached {
+			return server.Redirect(w, r, couponFailure(err))
+		} else if err != nil {
+			return server.InternalError(err)
+		}
+	}
+
+	charged := false
+	defer func() {
+		if redemption != nil && !charged {
+			err := redemption.Release()
+			if err != nil {
+				log.Error(log.V{"Square Payment, error releasing coupon": err, "code": redemption.Code})
+			}
+		}
+	}()
+
 	type AmountMoney struct {
 		Amount   int64  `json:"amount"`
 		Currency string `json:"currency"`
 	}
 
-	type Payload struct {
-		IdempotencyKey    string      `json:"idempotency_key"`
-		AmountMoney       AmountMoney `json:"amount_money"`
-		SourceID          string      `json:"source_id"`
-		VerificationToken string      `json:"verification_token"`
-		ReferenceID       string      `json:"reference_id,omitempty"`
+	type BillingAddress struct {
+		FirstName                    string `json:"first_name,omitempty"`
+		AddressLine1                 string `json:"address_line_1,omitempty"`
+		AddressLine2                 string `json:"address_line_2,omitempty"`
+		Locality                     string `json:"locality,omitempty"`
+		AdministrativeDistrictLevel1 string `json:"administrative_district_level_1,omitempty"`
+		PostalCode                   string `json:"postal_code,omitempty"`
+		Country                      string `json:"country,omitempty"`
 	}
 
+	type Payload struct {
+		IdempotencyKey    string         `json:"idempotency_key"`
+		AmountMoney       AmountMoney    `json:"amount_money"`
+		SourceID          string         `json:"source_id"`
+		CustomerID        string         `json:"customer_id,omitempty"`
+		VerificationToken string         `json:"verification_token"`
+		ReferenceID       string         `json:"reference_id,omitempty"`
+		Note              string         `json:"note,omitempty"`
+		BuyerEmailAddress string         `json:"buyer_email_address,omitempty"`
+		BillingAddress    BillingAddress `json:"billing_address"`
+	}
+
+	// The billing details entered by the buyer are sent with the payment for its invoice
 	data := Payload{
 		IdempotencyKey: u.String(),
 		AmountMoney: AmountMoney{
 			Amount:   amount,
 			Currency: currency,
 		},
-		SourceID:          paymentToken,
+		SourceID:          sourceID,
+		CustomerID:        customerId,
 		VerificationToken: verificationToken,
-		ReferenceID:       fmt.Sprintf("Product Id: %d", productId),
+		ReferenceID:       referenceID,
+		Note:              squareAffiliateNote(referrer(r)),
+		BuyerEmailAddress: params.Get("email"),
+		BillingAddress: BillingAddress{
+			FirstName:                    params.Get("givenName"),
+			AddressLine1:                 params.Get("addressLine1"),
+			AddressLine2:                 params.Get("addressLine2"),
+			Locality:                     params.Get("city"),
+			AdministrativeDistrictLevel1: params.Get("state"),
+			PostalCode:                   params.Get("postalcode"),
+			Country:                      billingCountry,
+		},
 	}
 	payloadBytes, err := json.Marshal(data)
 	if err != nil {
@@ -160,20 +295,45 @@ func HandleSquare(w http.ResponseWriter, r *http.Request) error {
 
 	if charge.Payment.Status == "COMPLETED" {
 		log.Info(log.V{"Square Payment Status": "COMPLETED"})
+		charged = true
+
+		// The order of the cart is paid by the payment, the tax evidence is recorded first for its invoice
+		if order != nil {
+			err = recordTax(tax, tax.Tax, 0, "square", charge.Payment.ID, ipCountry, billingCountry, currency)
+			if err != nil {
+				log.Error(log.V{"Square Payment, error recording tax evidence": err})
+			}
+
+			err = attachOrder(order, charge.Payment.ID)
+			if err != nil {
+				log.Error(log.V{"Square Payment, error attaching order": err, "order": order.ID})
+			}
+
+			return server.Redirect(w, r, "/subscriptions/success?square_payment_id="+charge.Payment.ID)
+		}
 
 		product, err := products.Find(productId)
 
 		if err == nil {
-			if product.S3Bucket != "" && product.S3Key != "" {
+			if redemption != nil {
+				err = attachCoupon(redemption, charge.Payment.ID)
+				if err != nil {
+					log.Error(log.V{"Square Payment, error applying coupon": err, "code": coupon.Code})
+				}
+			}
 
-				downloadUrl, err := s3.GeneratePresignedUrl(product.S3Bucket, product.S3Key)
+			err = recordTax(tax, tax.Tax, product.ID, "square", charge.Payment.ID, ipCountry, billingCountry, currency)
+			if err != nil {
+				log.Error(log.V{"Square Payment, error recording tax evidence": err})
+			}
 
-				if err == nil {
-					return server.RedirectExternal(w, r, downloadUrl)
-				}
+			_, err = offerUpsell(product, "square", charge.Payment.ID, customerId, cardId)
+			if err != nil {
+				log.Error(log.V{"Square Payment, error offering upsell": err, "product_id": product.ID})
 			}
 
-			return server.Redirect(w, r, "/subscriptions/success")
+			// The download link of the product's file is shown on the success page once the payment is recorded
+			return server.Redirect(w, r, fmt.Sprintf("/subscriptions/success?product_id=%d&square_payment_id=%s", productId, charge.Payment.ID))
 
 		}
 
@@ -184,6 +344,59 @@ func HandleSquare(w http.ResponseWriter, r *http.Request) error {
 	return err
 }
 
+// squareCoupon returns the coupon with the code and its discount on the amount of the product,
+// the amount is in the smallest currency unit.
+func squareCoupon(code string, productId int64, amount int64, currency string) (*coupons.Coupon, int64, error) {
+	product, err := products.Find(productId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	coupon, err := FindCoupon(code, product, "square")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	discount, err := coupon.Discount(amount, currency)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return coupon, discount, nil
+}
+
+// checkSquareQuote checks the amount, currency and payment type sent back by the browser are the price
+// or the pay what you want amount signed on the product page, the amount is in the smallest currency unit.
+func checkSquareQuote(token string, productId int64, amount int64, currency string, paymentType string) error {
+	product, err := products.Find(productId)
+	if err != nil {
+		return ErrQuoteMismatch
+	}
+
+	quote, err := VerifyQuote(token, product, "square")
+	if err != nil {
+		return err
+	}
+
+	if checkoutType(quote.Schedule) != paymentType {
+		return ErrQuoteMismatch
+	}
+
+	// The buyer of a pay what you want product pays the amount they chose
+	if quote.Pay > 0 {
+		if amount != quote.Pay || !strings.EqualFold(currency, quote.Currency) {
+			return ErrQuoteMismatch
+		}
+		return nil
+	}
+
+	if !quote.Matches(amount, currency) {
+		return ErrQuoteMismatch
+	}
+
+	return nil
+}
+
 // HandleCreateSubscription creates a subscription for the customer on POST request to /subscriptions/subscribe
 func HandleCreateSubscription(w http.ResponseWriter, r *http.Request) error {
 	// Check the authenticity token
@@ -211,6 +424,13 @@ func HandleCreateSubscription(w http.ResponseWriter, r *http.Request) error {
 	state := params.Get("state")
 	postalCode := params.Get("postalcode")
 
+	// The price must be the one signed on the product page
+	err = checkSquareQuote(params.Get("quote"), productId, amount, currency, "subscription")
+	if err != nil {
+		log.Error(log.V{"Square Subscription, price refused": err, "product_id": productId, "amount": amount})
+		return server.Redirect(w, r, quoteFailure(err))
+	}
+
 	customerId, err := CreateCustomer(paymentToken, verificationToken, amount, currency, productId, addressLine1, addressLine2, givenName, email, country, city, state, postalCode)
 
 	if err != nil {
@@ -259,23 +479,32 @@ func HandleCreateSubscription(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	subscriptionId, err := CreateSubscription(config.Get("square_location_id"), catalogId, customerId, cardId)
+	// The subscription of a product with a free trial starts billing when the trial ends
+	startDate := ""
+	if product.Trial() {
+		startDate = TrialEnd(product, time.Now()).Format("2006-01-02")
+	}
+
+	subscriptionId, err := CreateSubscription(config.Get("square_location_id"), catalogId, customerId, cardId, startDate)
 
 	if err != nil {
 		return server.Redirect(w, r, "/subscriptions/failure?errorDetail="+strings.Replace(err.Error(), ":", "", -1))
 	} else {
 		log.Info(log.V{"Subscription Id is: ": subscriptionId})
 
-		if product.S3Bucket != "" && product.S3Key != "" {
-
-			downloadUrl, err := s3.GeneratePresignedUrl(product.S3Bucket, product.S3Key)
+		// The price of the plan is fixed so its tax is included
+		tax := checkoutTax(amount, RequestCountry(r), country, params.Get("tax_id"), true)
+		err = recordTax(tax, tax.Tax, product.ID, "square", subscriptionId, RequestCountry(r), country, currency)
+		if err != nil {
+			log.Error(log.V{"Square Subscription, error recording tax evidence": err})
+		}
 
-			if err == nil {
-				return server.RedirectExternal(w, r, downloadUrl)
-			}
+		_, err = offerUpsell(product, "square", subscriptionId, customerId, cardId)
+		if err != nil {
+			log.Error(log.V{"Square Subscription, error offering upsell": err, "product_id": product.ID})
 		}
 
-		return server.Redirect(w, r, "/subscriptions/success")
+		return server.Redirect(w, r, fmt.Sprintf("/subscriptions/success?product_id=%d&square_subscription_id=%s", productId, subscriptionId))
 	}
 
 	return err
@@ -498,8 +727,9 @@ func CreateCard(paymentToken string, verificationToken string, amount int64, cur
 	return card.Card.ID, err
 }
 
-// CreateSubscription creates a subscription for the user
-func CreateSubscription(locationId string, planId string, customerId string, cardId string) (string, error) {
+// CreateSubscription creates a subscription for the user, the subscription is first charged on the
+// start date given as YYYY-MM-DD or at once when it is empty
+func CreateSubscription(locationId string, planId string, customerId string, cardId string, startDate string) (string, error) {
 
 	type Payload struct {
 		IdempotencyKey string `json:"idempotency_key"`
@@ -507,6 +737,7 @@ func CreateSubscription(locationId string, planId string, customerId string, car
 		PlanID         string `json:"plan_id"`
 		CustomerID     string `json:"customer_id"`
 		CardID         string `json:"card_id"`
+		StartDate      string `json:"start_date,omitempty"`
 	}
 
 	// Generate a new Version 4 UUID
@@ -521,6 +752,7 @@ func CreateSubscription(locationId string, planId string, customerId string, car
 		PlanID:         planId,
 		CustomerID:     customerId,
 		CardID:         cardId,
+		StartDate:      startDate,
 	}
 
 	payloadBytes, err := json.Marshal(data)
@@ -573,7 +805,8 @@ func CreateSubscription(locationId string, planId string, customerId string, car
 
 	log.Info(log.V{"Square Payment parsed": subscription})
 
-	if subscription.Subscription.Status != "ACTIVE" {
+	// A subscription starting on a later date is pending until then
+	if subscription.Subscription.Status != "ACTIVE" && subscription.Subscription.Status != "PENDING" {
 		return "", errors.New("Creating subscription failed,")
 	}
 
@@ -0,0 +1,41 @@
+package subscriptions
+
+import "time"
+
+// EventInvoiceModel is the invoice.payment_made webhook event of Square, a subscription is charged with an invoice
+type EventInvoiceModel struct {
+	MerchantID string    `json:"merchant_id"`
+	Type       string    `json:"type"`
+	EventID    string    `json:"event_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Data       struct {
+		Type   string `json:"type"`
+		ID     string `json:"id"`
+		Object struct {
+			Invoice struct {
+				ID               string `json:"id"`
+				Status           string `json:"status"`
+				OrderID          string `json:"order_id"`
+				SubscriptionID   string `json:"subscription_id"`
+				PrimaryRecipient struct {
+					CustomerID   string `json:"customer_id"`
+					EmailAddress string `json:"email_address"`
+					GivenName    string `json:"given_name"`
+					Address      struct {
+						AddressLine1                 string `json:"address_line_1"`
+						Locality                     string `json:"locality"`
+						AdministrativeDistrictLevel1 string `json:"administrative_district_level_1"`
+						PostalCode                   string `json:"postal_code"`
+						Country                      string `json:"country"`
+					} `json:"address"`
+				} `json:"primary_recipient"`
+				PaymentRequests []struct {
+					TotalCompletedAmountMoney struct {
+						Amount   int64  `json:"amount"`
+						Currency string `json:"currency"`
+					} `json:"total_completed_amount_money"`
+				} `json:"payment_requests"`
+			} `json:"invoice"`
+		} `json:"object"`
+	} `json:"data"`
+}
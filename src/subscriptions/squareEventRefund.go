@@ -0,0 +1,54 @@
+package subscriptions
+
+import "time"
+
+// EventRefundModel is the refund.created and refund.updated webhook event of Square
+type EventRefundModel struct {
+	MerchantID string    `json:"merchant_id"`
+	Type       string    `json:"type"`
+	EventID    string    `json:"event_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Data       struct {
+		Type   string `json:"type"`
+		ID     string `json:"id"`
+		Object struct {
+			Refund struct {
+				ID          string `json:"id"`
+				Status      string `json:"status"`
+				PaymentID   string `json:"payment_id"`
+				OrderID     string `json:"order_id"`
+				Reason      string `json:"reason"`
+				AmountMoney struct {
+					Amount   int64  `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"amount_money"`
+			} `json:"refund"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// EventDisputeModel is the dispute.created webhook event of Square
+type EventDisputeModel struct {
+	MerchantID string    `json:"merchant_id"`
+	Type       string    `json:"type"`
+	EventID    string    `json:"event_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Data       struct {
+		Type   string `json:"type"`
+		ID     string `json:"id"`
+		Object struct {
+			Dispute struct {
+				ID          string `json:"id"`
+				Reason      string `json:"reason"`
+				State       string `json:"state"`
+				AmountMoney struct {
+					Amount   int64  `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"amount_money"`
+				DisputedPayment struct {
+					PaymentID string `json:"payment_id"`
+				} `json:"disputed_payment"`
+			} `json:"dispute"`
+		} `json:"object"`
+	} `json:"data"`
+}
@@ -54,9 +54,19 @@ type EventPaymentModel struct {
 				LocationID         string `json:"location_id"`
 				OrderID            string `json:"order_id"`
 				ReferenceID        string `json:"reference_id"`
+				Note               string `json:"note"`
 				ReceiptNumber      string `json:"receipt_number"`
 				ReceiptURL         string `json:"receipt_url"`
 				VersionToken       string `json:"version_token"`
+				BuyerEmailAddress  string `json:"buyer_email_address"`
+				BillingAddress     struct {
+					FirstName                    string `json:"first_name"`
+					AddressLine1                 string `json:"address_line_1"`
+					Locality                     string `json:"locality"`
+					AdministrativeDistrictLevel1 string `json:"administrative_district_level_1"`
+					PostalCode                   string `json:"postal_code"`
+					Country                      string `json:"country"`
+				} `json:"billing_address"`
 			} `json:"payment"`
 		} `json:"object"`
 	} `json:"data"`
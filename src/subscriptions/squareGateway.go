@@ -0,0 +1,349 @@
+package subscriptions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/google/uuid"
+)
+
+// SquareGateway is the Gateway adapter for Square
+type SquareGateway struct{}
+
+// Name returns the name of the gateway
+func (g *SquareGateway) Name() string {
+	return "square"
+}
+
+// Enabled reports whether Square is switched on
+func (g *SquareGateway) Enabled() bool {
+	return config.GetBool("square")
+}
+
+// HasPrice reports whether the product has a Square price for the country
+func (g *SquareGateway) HasPrice(product *products.Story, country string) bool {
+	return product.SquarePrice != nil && product.SquarePrice[country] != nil && product.SquarePrice[country]["amount"] != nil
+}
+
+// Checkout returns the Square price of the product for the country
+func (g *SquareGateway) Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error) {
+	amount := product.SquarePrice[country]["amount"]
+	currency := product.SquarePrice[country]["currency"]
+
+	amountValue, ok := amount.(float64)
+	currencyValue, ok2 := currency.(string)
+	if !ok || !ok2 {
+		return nil, errors.New("Invalid price details for client country: " + country)
+	}
+
+	return &Checkout{
+		Type:       checkoutType(product.Schedule),
+		Price:      strconv.FormatFloat(amountValue/1000, 'g', 5, 64) + " " + currencyValue + "/" + scheduleLabel(product.Schedule),
+		Amount:     amount,
+		Currency:   currency,
+		UnitAmount: int64(amountValue),
+	}, nil
+}
+
+// VerifyWebhook checks the x-square-hmacsha256-signature header of the request
+func (g *SquareGateway) VerifyWebhook(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isFromSquare(r.Header.Get("x-square-hmacsha256-signature"), b) {
+		return nil, errors.New("invalid square webhook signature")
+	}
+
+	return b, nil
+}
+
+// NormaliseEvent converts a Square payment or subscription event into a PaymentEvent
+func (g *SquareGateway) NormaliseEvent(body []byte) (*PaymentEvent, error) {
+	var baseEvent struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(body, &baseEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch baseEvent.Type {
+	case "payment.created", "payment.updated":
+		var eventPayment EventPaymentModel
+		err = json.Unmarshal(body, &eventPayment)
+		if err != nil {
+			return nil, err
+		}
+
+		payment := eventPayment.Data.Object.Payment
+
+		// Only completed payments are of interest
+		if payment.Status != "COMPLETED" {
+			return nil, nil
+		}
+
+		paymentEvent := &PaymentEvent{
+			ID:         eventPayment.EventID,
+			Gateway:    g.Name(),
+			Type:       WebhookPaymentSucceeded,
+			PaymentID:  payment.ID,
+			OrderID:    payment.OrderID,
+			ReceiptID:  payment.ReceiptNumber,
+			CustomerID: payment.CustomerID,
+			Amount:     payment.TotalMoney.Amount,
+			Currency:   payment.TotalMoney.Currency,
+			Status:     payment.Status,
+			Created:    eventPayment.CreatedAt.UTC(),
+		}
+
+		// The billing details are sent with the payment when it is created
+		paymentEvent.CustomerEmail = payment.BuyerEmailAddress
+		paymentEvent.CustomerName = payment.BillingAddress.FirstName
+		paymentEvent.AddressStreet = payment.BillingAddress.AddressLine1
+		paymentEvent.AddressCity = payment.BillingAddress.Locality
+		paymentEvent.AddressState = payment.BillingAddress.AdministrativeDistrictLevel1
+		paymentEvent.AddressZip = payment.BillingAddress.PostalCode
+		paymentEvent.AddressCountry = payment.BillingAddress.Country
+
+		// The reference is set as "Product Id: 123" when the payment is created
+		if payment.ReferenceID != "" {
+			fmt.Sscanf(payment.ReferenceID, "Product Id: %d", &paymentEvent.ProductID)
+		}
+		// The note is set as "Affiliate Id: 12" when the buyer was referred by an affiliate
+		if payment.Note != "" {
+			fmt.Sscanf(payment.Note, squareAffiliateFormat, &paymentEvent.AffiliateID)
+		}
+
+		return paymentEvent, nil
+
+	case "refund.created", "refund.updated":
+		var eventRefund EventRefundModel
+		err = json.Unmarshal(body, &eventRefund)
+		if err != nil {
+			return nil, err
+		}
+
+		refund := eventRefund.Data.Object.Refund
+
+		// Only completed refunds are recorded
+		if refund.Status != "COMPLETED" {
+			return nil, nil
+		}
+
+		return &PaymentEvent{
+			ID:        eventRefund.EventID,
+			Gateway:   g.Name(),
+			Type:      WebhookPaymentRefunded,
+			RefundID:  refund.ID,
+			PaymentID: refund.PaymentID,
+			OrderID:   refund.OrderID,
+			Amount:    refund.AmountMoney.Amount,
+			Currency:  refund.AmountMoney.Currency,
+			Reason:    refund.Reason,
+			Status:    refund.Status,
+			Created:   eventRefund.CreatedAt.UTC(),
+		}, nil
+
+	case "dispute.created":
+		var eventDispute EventDisputeModel
+		err = json.Unmarshal(body, &eventDispute)
+		if err != nil {
+			return nil, err
+		}
+
+		dispute := eventDispute.Data.Object.Dispute
+
+		return &PaymentEvent{
+			ID:        eventDispute.EventID,
+			Gateway:   g.Name(),
+			Type:      WebhookPaymentDisputed,
+			RefundID:  dispute.ID,
+			PaymentID: dispute.DisputedPayment.PaymentID,
+			Amount:    dispute.AmountMoney.Amount,
+			Currency:  dispute.AmountMoney.Currency,
+			Reason:    dispute.Reason,
+			Status:    dispute.State,
+			Created:   eventDispute.CreatedAt.UTC(),
+		}, nil
+
+	case "invoice.payment_made":
+		var eventInvoice EventInvoiceModel
+		err = json.Unmarshal(body, &eventInvoice)
+		if err != nil {
+			return nil, err
+		}
+
+		invoice := eventInvoice.Data.Object.Invoice
+
+		// Only the invoices of subscriptions are of interest
+		if invoice.SubscriptionID == "" {
+			return nil, nil
+		}
+
+		paymentEvent := &PaymentEvent{
+			ID:             eventInvoice.EventID,
+			Gateway:        g.Name(),
+			Type:           WebhookPaymentSucceeded,
+			SubscriptionID: invoice.SubscriptionID,
+			OrderID:        invoice.OrderID,
+			CustomerID:     invoice.PrimaryRecipient.CustomerID,
+			CustomerEmail:  invoice.PrimaryRecipient.EmailAddress,
+			CustomerName:   invoice.PrimaryRecipient.GivenName,
+			Created:        eventInvoice.CreatedAt.UTC(),
+		}
+
+		paymentEvent.AddressStreet = invoice.PrimaryRecipient.Address.AddressLine1
+		paymentEvent.AddressCity = invoice.PrimaryRecipient.Address.Locality
+		paymentEvent.AddressState = invoice.PrimaryRecipient.Address.AdministrativeDistrictLevel1
+		paymentEvent.AddressZip = invoice.PrimaryRecipient.Address.PostalCode
+		paymentEvent.AddressCountry = invoice.PrimaryRecipient.Address.Country
+
+		if len(invoice.PaymentRequests) > 0 {
+			paymentEvent.Amount = invoice.PaymentRequests[0].TotalCompletedAmountMoney.Amount
+			paymentEvent.Currency = invoice.PaymentRequests[0].TotalCompletedAmountMoney.Currency
+		}
+
+		return paymentEvent, nil
+
+	case "subscription.created", "subscription.updated":
+		var eventSubscription EventSubscriptionModel
+		err = json.Unmarshal(body, &eventSubscription)
+		if err != nil {
+			return nil, err
+		}
+
+		subscription := eventSubscription.Data.Object.Subscription
+
+		paymentEvent := &PaymentEvent{
+			ID:             eventSubscription.EventID,
+			Gateway:        g.Name(),
+			Type:           WebhookSubscriptionUpdated,
+			PlanID:         subscription.PlanID,
+			SubscriptionID: subscription.ID,
+			CustomerID:     subscription.CustomerID,
+			Status:         subscription.Status,
+			Created:        eventSubscription.CreatedAt.UTC(),
+		}
+
+		// A subscription with a free trial is pending until it is first charged when the trial ends
+		switch subscription.Status {
+		case "ACTIVE", "PENDING":
+			paymentEvent.Type = WebhookSubscriptionActivated
+		case "CANCELED", "DEACTIVATED":
+			paymentEvent.Type = WebhookSubscriptionCancelled
+		}
+
+		return paymentEvent, nil
+	}
+
+	return nil, nil
+}
+
+// Cancel cancels the Square subscription at the end of its billing period
+func (g *SquareGateway) Cancel(subscriptionID string) error {
+	_, err := squareRequest(http.MethodPost, "/subscriptions/"+subscriptionID+"/cancel", map[string]interface{}{})
+	return err
+}
+
+// Refund refunds the Square payment, fetching the payment total for a full refund
+func (g *SquareGateway) Refund(paymentID string, amount int64, currency string) error {
+	if amount == 0 {
+		b, err := squareRequest(http.MethodGet, "/payments/"+paymentID, nil)
+		if err != nil {
+			return err
+		}
+
+		var payment struct {
+			Payment struct {
+				TotalMoney struct {
+					Amount   int64  `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"total_money"`
+				RefundedMoney struct {
+					Amount int64 `json:"amount"`
+				} `json:"refunded_money"`
+			} `json:"payment"`
+		}
+		err = json.Unmarshal(b, &payment)
+		if err != nil {
+			return err
+		}
+
+		// A full refund is of what is left after earlier partial refunds
+		amount = payment.Payment.TotalMoney.Amount - payment.Payment.RefundedMoney.Amount
+		currency = payment.Payment.TotalMoney.Currency
+		if amount <= 0 {
+			return errors.New("square payment is already refunded")
+		}
+	}
+
+	// Generate a new Version 4 UUID
+	u, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"idempotency_key": u.String(),
+		"payment_id":      paymentID,
+		"amount_money": map[string]interface{}{
+			"amount":   amount,
+			"currency": currency,
+		},
+	}
+
+	_, err = squareRequest(http.MethodPost, "/refunds", data)
+	return err
+}
+
+// squareRequest calls the Square API and returns the response body, a nil payload sends no body
+func squareRequest(method string, path string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequest(method, config.Get("square_domain")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Square-Version", "2023-04-19")
+	req.Header.Set("Authorization", "Bearer "+config.Get("square_access_token"))
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errorModel ErrorModel
+		if json.Unmarshal(b, &errorModel) == nil && len(errorModel.Errors) > 0 {
+			return nil, errors.New(errorModel.Errors[0].Detail)
+		}
+		return nil, fmt.Errorf("square request failed, status code: %d", resp.StatusCode)
+	}
+
+	return b, nil
+}
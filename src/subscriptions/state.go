@@ -0,0 +1,286 @@
+package subscriptions
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+)
+
+// The canonical states of a payment or subscription, the statuses and events of each gateway are mapped onto them
+// while the status reported by the gateway is kept in payment_status
+const (
+	// StateTrialing is a subscription in its free trial which hasn't been charged yet
+	StateTrialing = "trialing"
+	// StateActive is a subscription which is paid up or a one-time payment which was made
+	StateActive = "active"
+	// StatePastDue is a subscription whose last payment failed and is being retried by the gateway
+	StatePastDue = "past_due"
+	// StateUnpaid is a subscription whose grace period ran out without its failed payment being recovered,
+	// it has no access until a later charge succeeds
+	StateUnpaid = "unpaid"
+	// StatePaused is a subscription which isn't charged until it is resumed
+	StatePaused = "paused"
+	// StateCancelled is a subscription cancelled by the customer, the admin or the gateway
+	StateCancelled = "cancelled"
+	// StateExpired is a subscription which ran its course or was ended by the gateway after failed payments
+	StateExpired = "expired"
+	// StateRefunded is a one-time payment refunded in full or disputed
+	StateRefunded = "refunded"
+
+	// StateChangesTableName is the database table of the history of the states of payments and subscriptions
+	StateChangesTableName = "subscription_state_changes"
+)
+
+// States are the canonical states in the order of the lifecycle of a subscription
+var States = []string{StateTrialing, StateActive, StatePastDue, StateUnpaid, StatePaused, StateCancelled, StateExpired, StateRefunded}
+
+// subscriberStates are the states of a subscription whose customer is counted as a subscriber and has access
+var subscriberStates = []string{StateTrialing, StateActive, StatePastDue}
+
+// stateTransitions are the states which can follow each state, a payment or subscription without a state
+// is one which has just been recorded. Cancelled, expired and refunded are final but for a refund.
+var stateTransitions = map[string][]string{
+	"":             States,
+	StateTrialing:  {StateActive, StatePastDue, StatePaused, StateCancelled, StateExpired},
+	StateActive:    {StatePastDue, StatePaused, StateCancelled, StateExpired, StateRefunded},
+	StatePastDue:   {StateActive, StateUnpaid, StatePaused, StateCancelled, StateExpired, StateRefunded},
+	StateUnpaid:    {StateActive, StateCancelled, StateExpired, StateRefunded},
+	StatePaused:    {StateActive, StatePastDue, StateCancelled, StateExpired},
+	StateCancelled: {StateRefunded},
+	StateExpired:   {StateRefunded},
+	StateRefunded:  {},
+}
+
+// gatewayStates maps the statuses reported by each gateway in lower case onto the canonical states,
+// statuses which aren't listed don't change the state
+var gatewayStates = map[string]map[string]string{
+	"stripe": {
+		"paid":               StateActive,
+		"trialing":           StateTrialing,
+		"active":             StateActive,
+		"past_due":           StatePastDue,
+		"unpaid":             StatePastDue,
+		"paused":             StatePaused,
+		"canceled":           StateCancelled,
+		"incomplete_expired": StateExpired,
+	},
+	"square": {
+		"active":      StateActive,
+		"paused":      StatePaused,
+		"canceled":    StateCancelled,
+		"deactivated": StateExpired,
+	},
+	"paypal": {
+		"active":    StateActive,
+		"suspended": StatePaused,
+		"cancelled": StateCancelled,
+		"expired":   StateExpired,
+	},
+	"razorpay": {
+		"active":    StateActive,
+		"pending":   StatePastDue,
+		"halted":    StatePastDue,
+		"paused":    StatePaused,
+		"cancelled": StateCancelled,
+		"completed": StateExpired,
+		"expired":   StateExpired,
+	},
+}
+
+// StateChange is a change in the state of a payment or subscription with the gateway event which caused it
+type StateChange struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// TransactionID is the payment or subscription in the subscriptions table
+	TransactionID int64
+	FromState     string
+	ToState       string
+	Gateway       string
+	EventID       string
+	EventType     string
+	// RawStatus is the status reported by the gateway with the event
+	RawStatus string
+}
+
+// NewStateChange creates and initialises a new state change instance.
+func NewStateChange() *StateChange {
+	change := &StateChange{}
+	change.CreatedAt = time.Now()
+	change.UpdatedAt = time.Now()
+	change.TableName = StateChangesTableName
+	change.KeyName = KeyName
+	return change
+}
+
+// NewStateChangeWithColumns creates a new state change instance and fills it with data from the database cols provided.
+func NewStateChangeWithColumns(cols map[string]interface{}) *StateChange {
+	change := NewStateChange()
+	change.ID = resource.ValidateInt(cols["id"])
+	change.CreatedAt = resource.ValidateTime(cols["created_at"])
+	change.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	change.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	change.FromState = resource.ValidateString(cols["from_state"])
+	change.ToState = resource.ValidateString(cols["to_state"])
+	change.Gateway = resource.ValidateString(cols["pg"])
+	change.EventID = resource.ValidateString(cols["event_id"])
+	change.EventType = resource.ValidateString(cols["event_type"])
+	change.RawStatus = resource.ValidateString(cols["raw_status"])
+	return change
+}
+
+// FindAllStateChanges fetches all state change records matching this query from the database.
+func FindAllStateChanges(q *query.Query) ([]*StateChange, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*StateChange
+	for _, cols := range results {
+		changes = append(changes, NewStateChangeWithColumns(cols))
+	}
+
+	return changes, nil
+}
+
+// FindTransactionStateChanges fetches the history of the states of the given transactions, keyed by transaction id.
+func FindTransactionStateChanges(transactions []*Subscription) (map[int64][]*StateChange, error) {
+	changes := make(map[int64][]*StateChange)
+	if len(transactions) == 0 {
+		return changes, nil
+	}
+
+	var ids []int64
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+	}
+
+	results, err := FindAllStateChanges(StateChangesQuery().WhereIn("transaction_id", ids).Order("id asc"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range results {
+		changes[change.TransactionID] = append(changes[change.TransactionID], change)
+	}
+
+	return changes, nil
+}
+
+// StateChangesQuery returns a new query for state changes with a default order.
+func StateChangesQuery() *query.Query {
+	return query.New(StateChangesTableName, KeyName).Order("id desc")
+}
+
+// CanTransition reports whether a payment or subscription in the state from can move to the state to
+func CanTransition(from string, to string) bool {
+	for _, state := range stateTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// GatewayState returns the canonical state for the status reported by the gateway, or an empty string
+// if the status doesn't change the state. Gateways which aren't mapped report the canonical states.
+func GatewayState(gateway string, status string) string {
+	status = strings.ToLower(status)
+
+	statuses, ok := gatewayStates[gateway]
+	if ok {
+		return statuses[status]
+	}
+
+	for _, state := range States {
+		if state == status {
+			return state
+		}
+	}
+	return ""
+}
+
+// eventState returns the state a payment or subscription in the current state moves to for the gateway event,
+// or an empty string if the event doesn't change it
+func eventState(current string, event *PaymentEvent) string {
+	switch event.Type {
+	case WebhookPaymentRefunded, WebhookPaymentDisputed:
+		// Refunds are weighed against the amount paid when they are recorded
+		return ""
+	case WebhookPaymentFailed:
+		return StatePastDue
+	case WebhookPaymentSucceeded:
+		// Invoices of nothing, like the first one of a free trial, don't pay for anything
+		if event.Amount == 0 && current != "" {
+			return ""
+		}
+		return StateActive
+	}
+
+	state := GatewayState(event.Gateway, event.Status)
+	switch event.Type {
+	case WebhookSubscriptionCancelled:
+		if state != StateExpired {
+			state = StateCancelled
+		}
+	case WebhookSubscriptionActivated:
+		if state == "" {
+			state = StateActive
+		}
+	}
+
+	// A free trial ends with the first charge rather than the gateway reporting the subscription active
+	if current == StateTrialing && state == StateActive {
+		return ""
+	}
+
+	return state
+}
+
+// Transition moves the payment or subscription to the state and records the change in its history with the
+// event which caused it, the event is nil for changes made by the admin. It reports whether the state changed,
+// moves which aren't allowed from the current state are logged and ignored. The change is saved in the transaction.
+func (s *Subscription) Transition(tx *query.Tx, state string, event *PaymentEvent) (bool, error) {
+	if state == "" || state == s.State {
+		return false, nil
+	}
+
+	if !CanTransition(s.State, state) {
+		log.Info(log.V{"msg": "Subscription state, transition not allowed", "id": s.ID, "from": s.State, "to": state})
+		return false, nil
+	}
+
+	err := s.UpdateTx(tx, map[string]string{"state": state})
+	if err != nil {
+		log.Error(log.V{"Subscription state, error updating state": err, "id": s.ID})
+		return false, err
+	}
+
+	changeParams := make(map[string]string)
+	changeParams["transaction_id"] = strconv.FormatInt(s.ID, 10)
+	changeParams["from_state"] = s.State
+	changeParams["to_state"] = state
+	changeParams["pg"] = s.PaymentGateway
+	if event != nil {
+		changeParams["pg"] = event.Gateway
+		changeParams["event_id"] = event.ID
+		changeParams["event_type"] = event.Type
+		changeParams["raw_status"] = event.Status
+	}
+
+	_, err = NewStateChange().CreateTx(tx, changeParams)
+	if err != nil {
+		log.Error(log.V{"Subscription state, error recording state change": err, "id": s.ID})
+		return false, err
+	}
+
+	log.Info(log.V{"msg": "Subscription state changed", "id": s.ID, "from": s.State, "to": state})
+
+	s.State = state
+	return true, nil
+}
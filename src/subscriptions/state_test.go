@@ -0,0 +1,118 @@
+// Tests for the subscription state machine
+package subscriptions
+
+import (
+	"testing"
+)
+
+// Test the statuses of every gateway map onto the canonical states
+func TestGatewayState(t *testing.T) {
+	tests := []struct {
+		gateway string
+		status  string
+		state   string
+	}{
+		{"stripe", "canceled", StateCancelled},
+		{"stripe", "past_due", StatePastDue},
+		{"stripe", "paid", StateActive},
+		{"square", "CANCELED", StateCancelled},
+		{"square", "DEACTIVATED", StateExpired},
+		{"square", "ACTIVE", StateActive},
+		{"paypal", "ACTIVE", StateActive},
+		{"paypal", "SUSPENDED", StatePaused},
+		{"paypal", "CANCELLED", StateCancelled},
+		{"paypal", "EXPIRED", StateExpired},
+		{"razorpay", "active", StateActive},
+		{"razorpay", "halted", StatePastDue},
+		{"razorpay", "paused", StatePaused},
+		{"razorpay", "completed", StateExpired},
+		{"razorpay", "authenticated", ""},
+		{"fake", "cancelled", StateCancelled},
+		{"fake", "unknown", ""},
+		{"stripe", "", ""},
+	}
+
+	for _, test := range tests {
+		if state := GatewayState(test.gateway, test.status); state != test.state {
+			t.Fatalf("state: expected %s %s to be %q got:%q", test.gateway, test.status, test.state, state)
+		}
+	}
+}
+
+// Test only the allowed transitions are made and the final states stay final
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{"", StateActive, true},
+		{"", StateTrialing, true},
+		{StateTrialing, StateActive, true},
+		{StateActive, StatePastDue, true},
+		{StatePastDue, StateActive, true},
+		{StatePastDue, StateUnpaid, true},
+		{StateUnpaid, StateActive, true},
+		{StateUnpaid, StatePastDue, false},
+		{StateActive, StatePaused, true},
+		{StatePaused, StateActive, true},
+		{StateActive, StateRefunded, true},
+		{StateCancelled, StateRefunded, true},
+		{StatePaused, StateRefunded, false},
+		{StateActive, StateTrialing, false},
+		{StateCancelled, StateActive, false},
+		{StateExpired, StatePastDue, false},
+		{StateRefunded, StateActive, false},
+	}
+
+	for _, test := range tests {
+		if CanTransition(test.from, test.to) != test.allowed {
+			t.Fatalf("state: expected %q to %q allowed to be %t", test.from, test.to, test.allowed)
+		}
+	}
+}
+
+// Test the events of each gateway move a subscription to the right state
+func TestEventState(t *testing.T) {
+	tests := []struct {
+		current string
+		event   PaymentEvent
+		state   string
+	}{
+		{StateActive, PaymentEvent{Gateway: "stripe", Type: WebhookSubscriptionCancelled, Status: "canceled"}, StateCancelled},
+		{StateActive, PaymentEvent{Gateway: "stripe", Type: WebhookPaymentFailed}, StatePastDue},
+		{StatePastDue, PaymentEvent{Gateway: "stripe", Type: WebhookPaymentSucceeded, Amount: 1000}, StateActive},
+		{StateTrialing, PaymentEvent{Gateway: "stripe", Type: WebhookPaymentSucceeded}, ""},
+		{StateTrialing, PaymentEvent{Gateway: "stripe", Type: WebhookPaymentSucceeded, Amount: 1000}, StateActive},
+		{StateTrialing, PaymentEvent{Gateway: "paypal", Type: WebhookSubscriptionActivated, Status: "ACTIVE"}, ""},
+		{StateActive, PaymentEvent{Gateway: "paypal", Type: WebhookPaymentFailed, Status: "ACTIVE"}, StatePastDue},
+		{StateActive, PaymentEvent{Gateway: "paypal", Type: WebhookSubscriptionUpdated, Status: "SUSPENDED"}, StatePaused},
+		{StateActive, PaymentEvent{Gateway: "paypal", Type: WebhookSubscriptionUpdated, Status: "EXPIRED"}, StateExpired},
+		{StateActive, PaymentEvent{Gateway: "square", Type: WebhookSubscriptionCancelled, Status: "DEACTIVATED"}, StateExpired},
+		{StateActive, PaymentEvent{Gateway: "square", Type: WebhookPaymentRefunded, Status: "COMPLETED"}, ""},
+		{StateActive, PaymentEvent{Gateway: "razorpay", Type: WebhookSubscriptionUpdated, Status: "completed"}, StateExpired},
+		{StatePaused, PaymentEvent{Gateway: "razorpay", Type: WebhookSubscriptionUpdated, Status: "active"}, StateActive},
+		{StateActive, PaymentEvent{Gateway: "razorpay", Type: WebhookPaymentDisputed, Status: "open"}, ""},
+	}
+
+	for _, test := range tests {
+		if state := eventState(test.current, &test.event); state != test.state {
+			t.Fatalf("state: expected %s %s %s from %q to be %q got:%q", test.event.Gateway, test.event.Type, test.event.Status, test.current, test.state, state)
+		}
+	}
+}
+
+// Test only subscriptions in their trial, active or past due are counted as subscribers
+func TestSubscribed(t *testing.T) {
+	for _, state := range States {
+		subscription := &Subscription{SubscriptionId: "sub_1", State: state}
+		subscribed := state == StateTrialing || state == StateActive || state == StatePastDue
+		if subscription.Subscribed() != subscribed {
+			t.Fatalf("state: expected %s subscribed to be %t", state, subscribed)
+		}
+	}
+
+	if (&Subscription{State: StateActive}).Subscribed() {
+		t.Fatalf("state: expected a one-time payment not to be a subscriber")
+	}
+}
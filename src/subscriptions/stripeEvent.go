@@ -11,6 +11,7 @@ import (
 // Stripe event object
 type Event struct {
 	ID           string `json:"id"`
+	Type         string `json:"type"`
 	Data         Data   `json:"data"`
 	Created      Time   `json:"created"`
 	Subscription string `json:"subscription"`
@@ -28,6 +29,7 @@ type Object struct {
 	Customer        string          `json:"customer"`
 	CustomerDetails CustomerDetails `json:"customer_details"`
 	CustomerEmail   string          `json:"customer_email"`
+	ReceiptEmail    string          `json:"receipt_email"`
 	Subscription    string          `json:"subscription"`
 	MetaData        MetaData        `json:"metadata"`
 	Mode            string          `json:"mode"`
@@ -35,10 +37,28 @@ type Object struct {
 	TotalDetails    TotalDetails    `json:"total_details"`
 	PaymentIntent   string          `json:"payment_intent"`
 	BillingDetails  BillingDetails  `json:"billing_details"`
+	Amount          float64         `json:"amount"`
+	AmountRefunded  float64         `json:"amount_refunded"`
+	AmountPaid      float64         `json:"amount_paid"`
+	AmountDue       float64         `json:"amount_due"`
+	Invoice         string          `json:"invoice"`
+	Reason          string          `json:"reason"`
+	Status          string          `json:"status"`
+	Refunds         Refunds         `json:"refunds"`
+}
+
+// Refunds of a charge, the latest refund is first
+type Refunds struct {
+	Data []struct {
+		ID     string  `json:"id"`
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	} `json:"data"`
 }
 
 type CustomerDetails struct {
-	Email string `json:"email"`
+	Email   string  `json:"email"`
+	Address Address `json:"address"`
 }
 
 type BillingDetails struct {
@@ -57,10 +77,12 @@ type Address struct {
 }
 
 type MetaData struct {
-	UserID    string `json:"user_id"`
-	UserName  string `json:"user_name"`
-	Plan      string `json:"plan"`
-	ProductID string `json:"product_id"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	Plan        string `json:"plan"`
+	ProductID   string `json:"product_id"`
+	Offer       string `json:"offer"`
+	AffiliateID string `json:"affiliate_id"`
 }
 
 type TotalDetails struct {
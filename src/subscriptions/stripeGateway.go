@@ -0,0 +1,279 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/coupons"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+	"github.com/stripe/stripe-go/v72"
+	stripecoupon "github.com/stripe/stripe-go/v72/coupon"
+	"github.com/stripe/stripe-go/v72/price"
+	"github.com/stripe/stripe-go/v72/refund"
+	"github.com/stripe/stripe-go/v72/sub"
+	"github.com/stripe/stripe-go/v72/taxrate"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// StripeGateway is the Gateway adapter for Stripe
+type StripeGateway struct{}
+
+// Name returns the name of the gateway
+func (g *StripeGateway) Name() string {
+	return "stripe"
+}
+
+// Enabled reports whether Stripe is switched on
+func (g *StripeGateway) Enabled() bool {
+	return config.GetBool("stripe")
+}
+
+// HasPrice reports whether the product has a Stripe price for the country
+func (g *StripeGateway) HasPrice(product *products.Story, country string) bool {
+	return product.StripePrice != nil && product.StripePrice[country] != ""
+}
+
+// Checkout fetches the Stripe price of the product for the country
+func (g *StripeGateway) Checkout(product *products.Story, country string, redirectURI string, customID string) (*Checkout, error) {
+	priceId := product.StripePrice[country]
+	if priceId == "" {
+		return nil, errors.New("Invalid price details for client country: " + country)
+	}
+
+	log.Info(log.V{"Price ID: ": priceId})
+
+	stripe.Key = config.Get("stripe_secret")
+
+	checkout := &Checkout{PriceID: priceId, Type: checkoutType(product.Schedule)}
+
+	p, err := price.Get(priceId, nil)
+	if err != nil {
+		// The subscribe button still works without the price label
+		log.Error(log.V{"Stripe checkout, Error fetching price": err})
+		return checkout, nil
+	}
+
+	log.Info(log.V{"Currency:": p.Currency})
+
+	checkout.UnitAmount = p.UnitAmount
+	checkout.Currency = string(p.Currency)
+
+	if p.Type == "recurring" {
+		checkout.Price = strconv.FormatInt(p.UnitAmount/100, 10) + " " + string(p.Currency) + "/" + string(p.Recurring.Interval)
+	} else if p.Type == "one_time" {
+		checkout.Price = strconv.FormatInt(p.UnitAmount/100, 10) + " " + string(p.Currency) + "/" + "One Time"
+	}
+
+	return checkout, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header of the request
+func (g *StripeGateway) VerifyWebhook(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = webhook.ConstructEvent(b, r.Header.Get("Stripe-Signature"), config.Get("stripe_webhook_secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// NormaliseEvent converts a Stripe event into a PaymentEvent
+func (g *StripeGateway) NormaliseEvent(body []byte) (*PaymentEvent, error) {
+	var event Event
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, err
+	}
+
+	object := event.Data.Object
+
+	paymentEvent := &PaymentEvent{
+		ID:      event.ID,
+		Gateway: g.Name(),
+		Created: time.Now().UTC(),
+	}
+	if event.Created.Time != nil {
+		paymentEvent.Created = event.Created.Time.UTC()
+	}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		paymentEvent.Type = WebhookPaymentSucceeded
+		if object.Mode == "subscription" {
+			paymentEvent.Type = WebhookSubscriptionActivated
+		}
+		paymentEvent.PaymentID = object.PaymentIntent
+		paymentEvent.SubscriptionID = object.Subscription
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.CustomerEmail = object.CustomerDetails.Email
+		paymentEvent.CustomerName = object.BillingDetails.Name
+		paymentEvent.CustomID = object.MetaData.UserID
+		paymentEvent.ReceiptID = object.ID
+		paymentEvent.Amount = int64(object.AmountTotal)
+		paymentEvent.Tax = int64(object.TotalDetails.AmountTax)
+		paymentEvent.Currency = object.Currency
+		paymentEvent.Status = object.PaymentStatus
+		paymentEvent.ProductID, _ = strconv.ParseInt(object.MetaData.ProductID, 10, 64)
+		paymentEvent.AffiliateID, _ = strconv.ParseInt(object.MetaData.AffiliateID, 10, 64)
+		// The billing address is collected by the checkout
+		paymentEvent.AddressStreet = object.CustomerDetails.Address.Line1
+		paymentEvent.AddressCity = object.CustomerDetails.Address.City
+		paymentEvent.AddressState = object.CustomerDetails.Address.State
+		paymentEvent.AddressZip = object.CustomerDetails.Address.PostalCode
+		paymentEvent.AddressCountry = object.CustomerDetails.Address.Country
+	case "payment_intent.succeeded":
+		// Only the upsells paid with one click, other payments are recorded from their checkout session or invoice
+		if object.MetaData.Offer == "" {
+			return nil, nil
+		}
+		paymentEvent.Type = WebhookPaymentSucceeded
+		paymentEvent.PaymentID = object.ID
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.CustomerEmail = object.ReceiptEmail
+		paymentEvent.Amount = int64(object.Amount)
+		paymentEvent.Currency = object.Currency
+		paymentEvent.Status = "paid"
+		paymentEvent.ProductID, _ = strconv.ParseInt(object.MetaData.ProductID, 10, 64)
+		paymentEvent.AffiliateID, _ = strconv.ParseInt(object.MetaData.AffiliateID, 10, 64)
+	case "invoice.paid":
+		// Only the invoices of subscriptions are of interest, the first is paid with the checkout session
+		if object.Subscription == "" {
+			return nil, nil
+		}
+		paymentEvent.Type = WebhookPaymentSucceeded
+		paymentEvent.SubscriptionID = object.Subscription
+		paymentEvent.PaymentID = object.PaymentIntent
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.CustomerEmail = object.CustomerEmail
+		paymentEvent.Amount = int64(object.AmountPaid)
+		paymentEvent.Currency = object.Currency
+	case "invoice.payment_failed":
+		paymentEvent.Type = WebhookPaymentFailed
+		paymentEvent.SubscriptionID = object.Subscription
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.CustomerEmail = object.CustomerEmail
+		paymentEvent.Amount = int64(object.AmountDue)
+		paymentEvent.Currency = object.Currency
+	case "customer.subscription.deleted":
+		paymentEvent.Type = WebhookSubscriptionCancelled
+		paymentEvent.SubscriptionID = object.ID
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.Status = "canceled"
+	case "charge.refunded":
+		paymentEvent.Type = WebhookPaymentRefunded
+		paymentEvent.PaymentID = object.PaymentIntent
+		paymentEvent.CustomerID = object.Customer
+		paymentEvent.Amount = int64(object.AmountRefunded)
+		paymentEvent.AmountRefunded = int64(object.AmountRefunded)
+		paymentEvent.Currency = object.Currency
+		paymentEvent.Status = "refunded"
+		if len(object.Refunds.Data) > 0 {
+			paymentEvent.RefundID = object.Refunds.Data[0].ID
+			paymentEvent.Amount = int64(object.Refunds.Data[0].Amount)
+			paymentEvent.Reason = object.Refunds.Data[0].Reason
+		}
+	case "charge.dispute.created":
+		paymentEvent.Type = WebhookPaymentDisputed
+		paymentEvent.RefundID = object.ID
+		paymentEvent.PaymentID = object.PaymentIntent
+		paymentEvent.Amount = int64(object.Amount)
+		paymentEvent.Currency = object.Currency
+		paymentEvent.Reason = object.Reason
+		paymentEvent.Status = object.Status
+	default:
+		return nil, nil
+	}
+
+	return paymentEvent, nil
+}
+
+// Cancel cancels the Stripe subscription immediately
+func (g *StripeGateway) Cancel(subscriptionID string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	_, err := sub.Cancel(subscriptionID, nil)
+	return err
+}
+
+// Refund refunds the Stripe payment intent
+func (g *StripeGateway) Refund(paymentID string, amount int64, currency string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentID),
+	}
+	if amount > 0 {
+		params.Amount = stripe.Int64(amount)
+	}
+
+	_, err := refund.New(params)
+	return err
+}
+
+// stripeCoupon creates a Stripe coupon for the coupon entered on the product page, it can only be
+// redeemed once so it is used only by the checkout session it is created for.
+func stripeCoupon(c *coupons.Coupon, p *stripe.Price) (string, error) {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.CouponParams{
+		Name:           stripe.String(c.Code),
+		MaxRedemptions: stripe.Int64(1),
+		Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+	}
+
+	if c.Kind == coupons.KindFixed {
+		params.AmountOff = stripe.Int64(c.Value)
+		params.Currency = stripe.String(string(p.Currency))
+	} else {
+		params.PercentOff = stripe.Float64(float64(c.Value))
+	}
+
+	// Subscriptions are discounted every month or only for the coupon's first months
+	if p.Type == "recurring" {
+		params.Duration = stripe.String(string(stripe.CouponDurationForever))
+		if c.DurationMonths > 0 {
+			params.Duration = stripe.String(string(stripe.CouponDurationRepeating))
+			params.DurationInMonths = stripe.Int64(c.DurationMonths)
+		}
+	}
+
+	stripeCoupon, err := stripecoupon.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	return stripeCoupon.ID, nil
+}
+
+// stripeTaxRate creates the Stripe tax rate for the tax calculated for the buyer, it is
+// created for the checkout so a change to the rate or tax_inclusive applies at once.
+func stripeTaxRate(c *taxes.Calculation) (string, error) {
+	stripe.Key = config.Get("stripe_secret")
+
+	params := &stripe.TaxRateParams{
+		DisplayName:  stripe.String(c.Name),
+		Percentage:   stripe.Float64(c.Percent),
+		Inclusive:    stripe.Bool(c.Inclusive),
+		Country:      stripe.String(c.Country),
+		Jurisdiction: stripe.String(c.Country),
+	}
+
+	stripeTaxRate, err := taxrate.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	return stripeTaxRate.ID, nil
+}
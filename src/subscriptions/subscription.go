@@ -27,7 +27,63 @@ type Subscription struct {
 	UserId         string
 	Plan           string
 	ProductId      int64
+	// PaymentStaus is the status last reported by the gateway and State the canonical state it maps onto
 	PaymentStaus   string
+	State          string
 	PaymentGateway string
 	FirstName      string
+	// CouponCode is the coupon redeemed for the payment and Discount the amount it took off
+	CouponCode string
+	Discount   float64
+	// TrialStatus is the state of the free trial of a subscription, TrialEndsAt is when it is first charged
+	// and TrialRemindedAt is when the customer was emailed about the charge
+	TrialStatus     string
+	TrialEndsAt     time.Time
+	TrialRemindedAt time.Time
+	// Tax is the tax of the payment at TaxRate percent for TaxCountry, IPCountry and BillingCountry are the
+	// location evidence of the buyer and TaxID is the tax ID of a business which was reverse charged
+	Tax            float64
+	TaxCountry     string
+	TaxRate        float64
+	TaxID          string
+	ReverseCharge  bool
+	IPCountry      string
+	BillingCountry string
+	// The billing address of the buyer, as reported by the gateway
+	AddressStreet string
+	AddressCity   string
+	AddressState  string
+	AddressZip    string
+	// AffiliateID is the affiliate whose referral link the buyer followed
+	AffiliateID int64
+	// ResumesAt is when a paused subscription is resumed, zero if it is paused until it is resumed
+	ResumesAt time.Time
+}
+
+// Ended reports whether this is a subscription which has been cancelled or has expired
+func (s *Subscription) Ended() bool {
+	return s.SubscriptionId != "" && (s.State == StateCancelled || s.State == StateExpired)
+}
+
+// Reversed reports whether the payment has been refunded in full or disputed
+func (s *Subscription) Reversed() bool {
+	return s.State == StateRefunded
+}
+
+// Subscribed reports whether this is a subscription whose customer is counted as a subscriber
+func (s *Subscription) Subscribed() bool {
+	if s.SubscriptionId == "" {
+		return false
+	}
+	for _, state := range subscriberStates {
+		if s.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Trialing reports whether this is a subscription in its free trial
+func (s *Subscription) Trialing() bool {
+	return s.TrialStatus == TrialStatusTrialing
 }
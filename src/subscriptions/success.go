@@ -1,20 +1,30 @@
 package subscriptions
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/abishekmuthian/open-payment-host/src/downloads"
+	"github.com/abishekmuthian/open-payment-host/src/invoices"
 	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
-	"github.com/abishekmuthian/open-payment-host/src/lib/s3"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
 	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
 	"github.com/abishekmuthian/open-payment-host/src/lib/session"
 	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/licenses"
+	"github.com/abishekmuthian/open-payment-host/src/offers"
+	"github.com/abishekmuthian/open-payment-host/src/orders"
 	"github.com/abishekmuthian/open-payment-host/src/products"
 	"github.com/razorpay/razorpay-go/utils"
+	"github.com/stripe/stripe-go/v72"
+	stripesession "github.com/stripe/stripe-go/v72/checkout/session"
+	"github.com/stripe/stripe-go/v72/paymentintent"
 )
 
 // contains checks if a string contains a substring
@@ -105,30 +115,7 @@ func HandlePaymentSuccess(w http.ResponseWriter, r *http.Request) error {
 		if razorpayOrderCompleted {
 			log.Info(log.V{"Razorpay subscription completed": razorpayOrderId})
 
-			// Send webhook if available
-			product, err := products.Find(productId)
-			if err != nil {
-				log.Error(log.V{"Success, Error finding product": err})
-				return server.InternalError(err)
-			}
-
-			if product.WebhookURL != "" && product.WebhookSecret != "" {
-				params := map[string]interface{}{
-					"subscription_id": razorpaySubscriptionId,
-					"custom_id":       customId,
-					"status":          "active",
-					"email":           "",
-				}
-
-				go func() {
-					err := SendWebhook(product.WebhookURL, product.WebhookSecret, params)
-					if err != nil {
-						log.Error(log.V{"Razorpay webhook, Error sending webhook to product's URL": err})
-					} else {
-						log.Info(log.V{"msg": "Successfully sent webhook to product's URL"})
-					}
-				}()
-			}
+			// The subscription is recorded and the product webhook is sent from the Razorpay webhook
 
 			if (redirectURI != "" && redirectURI != "null") && (customId != "" && customId != "null") {
 				params := map[string]string{
@@ -164,50 +151,6 @@ func HandlePaymentSuccess(w http.ResponseWriter, r *http.Request) error {
 	if paypalOrderCompleted || paypalSubscriptionCompleted {
 		log.Info(log.V{"Paypal Order/Subscription Completed: ": paypalOrderId})
 
-		// Handle the download file
-		// FIXME: Implement a better way to check if download file is enabled
-
-		product, err := products.Find(productId)
-
-		if err != nil {
-			return server.InternalError(err)
-		}
-		if product.S3Bucket != "" && product.S3Key != "" {
-
-			downloadUrl, err := s3.GeneratePresignedUrl(product.S3Bucket, product.S3Key)
-
-			if err == nil {
-				return server.RedirectExternal(w, r, downloadUrl)
-			}
-		}
-
-		if paypalSubscriptionCompleted {
-			// Send webhook if available
-			product, err := products.Find(productId)
-			if err != nil {
-				log.Error(log.V{"Success, Error finding product": err})
-				return server.InternalError(err)
-			}
-
-			if product.WebhookURL != "" && product.WebhookSecret != "" {
-				params := map[string]interface{}{
-					"subscription_id": paypalSubscriptionId,
-					"custom_id":       customId,
-					"status":          "active",
-					"email":           "",
-				}
-
-				go func() {
-					err := SendWebhook(product.WebhookURL, product.WebhookSecret, params)
-					if err != nil {
-						log.Error(log.V{"Razorpay webhook, Error sending webhook to product's URL": err})
-					} else {
-						log.Info(log.V{"msg": "Successfully sent webhook to product's URL"})
-					}
-				}()
-			}
-		}
-
 		if (redirectURI != "" && redirectURI != "null") && (customId != "" && customId != "null") {
 			if paypalOrderCompleted {
 				params := map[string]string{
@@ -228,6 +171,85 @@ func HandlePaymentSuccess(w http.ResponseWriter, r *http.Request) error {
 	// Render the template
 	view := view.NewRenderer(w, r)
 	view.AddKey("currentUser", currentUser)
+
+	// Only the payments the gateways verify are shown with their license keys, download links and invoices
+	references := verifySuccessReferences(params)
+
+	// The cart is paid with its order, each product of the order is shown with its license key and download link
+	order := findSuccessOrder(references)
+	if order != nil {
+		// Only the products of the order are taken out of the cart, an order may be of a product and its bump
+		for _, item := range order.Items {
+			err = orders.RemoveFromCart(w, r, item.ProductID)
+			if err != nil {
+				log.Error(log.V{"Payment Success, error removing product from cart": err})
+			}
+		}
+		view.AddKey("order", order)
+		view.AddKey("orderItems", successItems(order))
+	}
+
+	// Show the license key and download link of the payment, they are issued once the gateway's webhook is processed
+	transaction, product := findSuccessTransaction(references, productId)
+	if order != nil {
+		// The invoice of the order is shown below its products
+		if transaction != nil {
+			invoice, err := invoices.FindTransaction(transaction.ID)
+			if err == nil {
+				view.AddKey("invoiceURL", invoice.URL())
+				view.AddKey("invoiceCode", invoice.Code)
+			}
+		}
+	} else if transaction != nil {
+		// The license key and download link are of the product rather than of the products of its bundle
+		license, err := licenses.FindTransactionProduct(transaction.ID, transaction.ProductId)
+		if err == nil {
+			view.AddKey("licenseKey", license.Key)
+			view.AddKey("licenseSeats", license.Seats)
+		}
+		download := successDownload(transaction.ID, transaction.ProductId)
+		if download != nil {
+			view.AddKey("downloadURL", download.URL())
+			view.AddKey("downloadExpires", download.ExpiresAt)
+			view.AddKey("downloadLimit", download.MaxDownloads)
+		}
+		invoice, err := invoices.FindTransaction(transaction.ID)
+		if err == nil {
+			view.AddKey("invoiceURL", invoice.URL())
+			view.AddKey("invoiceCode", invoice.Code)
+		}
+	} else if product != nil {
+		view.AddKey("licensePending", product.LicenseSeats > 0)
+		view.AddKey("downloadPending", product.S3Bucket != "" && product.S3Key != "")
+	}
+
+	// Each product of a bundle is shown with its license key and download link
+	if order == nil && product != nil && product.Bundle() {
+		var transactionID int64
+		if transaction != nil {
+			transactionID = transaction.ID
+		}
+		view.AddKey("bundle", product)
+		view.AddKey("bundleItems", bundleSuccessItems(transactionID, product))
+	}
+
+	// The upsell of the product is offered to the buyer once it has been bought
+	if order == nil && product != nil {
+		offer := findSuccessOffer(references, product)
+		if offer != nil && offer.Open() {
+			upsell, err := UpsellProduct(product)
+			if err == nil && upsell.ID == offer.OfferProductID {
+				err = offers.Remember(w, r, offer.Token)
+				if err != nil {
+					log.Error(log.V{"Payment Success, error remembering offer": err})
+				} else {
+					view.AddKey("upsell", offer)
+					view.AddKey("upsellProduct", upsell)
+				}
+			}
+		}
+	}
+
 	// Set the name and year
 	view.AddKey("name", config.Get("name"))
 	view.AddKey("year", time.Now().Year())
@@ -236,3 +258,316 @@ func HandlePaymentSuccess(w http.ResponseWriter, r *http.Request) error {
 
 	return view.Render()
 }
+
+// successParam is a param with which a gateway returns the payment to the success page
+type successParam struct {
+	Key     string
+	Gateway string
+	// Column is the column of the ledger the reference of the param is recorded in
+	Column string
+	// Upsell is whether the upsell is offered on the success page, the upsell of a Square purchase
+	// is offered with the payment as its card is saved then
+	Upsell bool
+	// Verify asks the gateway whether the reference is of a payment made, the params are those of the success page
+	Verify func(params *mux.RequestParams, reference string) error
+}
+
+// successParams are the params with which the gateways return the payment to the success page, in order of preference
+var successParams = []*successParam{
+	{Key: "session_id", Gateway: "stripe", Column: "receipt_id", Upsell: true, Verify: verifyStripeSession},
+	{Key: "paypal_orderid", Gateway: "paypal", Column: "invoice", Upsell: true, Verify: verifyPaypalOrder},
+	{Key: "paypal_subscriptionid", Gateway: "paypal", Column: "subscr_id", Upsell: true, Verify: verifyPaypalSubscription},
+	{Key: "razorpay_order_id", Gateway: "razorpay", Column: "txn_id", Upsell: true, Verify: verifyRazorpayOrder},
+	{Key: "razorpay_subscription_id", Gateway: "razorpay", Column: "subscr_id", Upsell: true, Verify: verifyRazorpaySubscription},
+	{Key: "square_payment_id", Gateway: "square", Column: "txn_id", Verify: verifySquarePayment},
+	{Key: "square_subscription_id", Gateway: "square", Column: "subscr_id", Verify: verifySquareSubscription},
+	{Key: "payment_intent", Gateway: "stripe", Column: "txn_id", Verify: verifyStripePaymentIntent},
+}
+
+// successReference is a reference returned to the success page which its gateway has verified
+type successReference struct {
+	*successParam
+	Reference string
+}
+
+// verifySuccessReferences returns the references of the success page params which their gateways verify,
+// the license keys, download links and invoices of a payment are only shown for a verified reference
+func verifySuccessReferences(params *mux.RequestParams) []*successReference {
+	var references []*successReference
+	for _, param := range successParams {
+		reference := params.Get(param.Key)
+		if reference == "" || reference == "null" {
+			continue
+		}
+
+		err := param.Verify(params, reference)
+		if err != nil {
+			log.Error(log.V{"Payment Success, reference not verified": err, "param": param.Key, "pg": param.Gateway})
+			continue
+		}
+
+		references = append(references, &successReference{successParam: param, Reference: reference})
+	}
+	return references
+}
+
+// verifyStripeSession verifies the Stripe checkout session has been paid
+func verifyStripeSession(params *mux.RequestParams, reference string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	s, err := stripesession.Get(reference, nil)
+	if err != nil {
+		return err
+	}
+	if s.PaymentStatus == stripe.CheckoutSessionPaymentStatusUnpaid {
+		return errors.New("stripe checkout session is unpaid")
+	}
+	return nil
+}
+
+// verifyStripePaymentIntent verifies the Stripe payment intent has succeeded
+func verifyStripePaymentIntent(params *mux.RequestParams, reference string) error {
+	stripe.Key = config.Get("stripe_secret")
+
+	pi, err := paymentintent.Get(reference, nil)
+	if err != nil {
+		return err
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		return errors.New("stripe payment intent has not succeeded")
+	}
+	return nil
+}
+
+// verifyPaypalOrder verifies the PayPal order has been captured
+func verifyPaypalOrder(params *mux.RequestParams, reference string) error {
+	var order struct {
+		Status string `json:"status"`
+	}
+	err := paypalGet("/v2/checkout/orders/"+url.PathEscape(reference), &order)
+	if err != nil {
+		return err
+	}
+	if order.Status != "COMPLETED" {
+		return fmt.Errorf("paypal order is %s", order.Status)
+	}
+	return nil
+}
+
+// verifyPaypalSubscription verifies the PayPal subscription has been approved by the subscriber
+func verifyPaypalSubscription(params *mux.RequestParams, reference string) error {
+	var subscription struct {
+		Status string `json:"status"`
+	}
+	err := paypalGet("/v1/billing/subscriptions/"+url.PathEscape(reference), &subscription)
+	if err != nil {
+		return err
+	}
+	if subscription.Status != "ACTIVE" && subscription.Status != "APPROVED" {
+		return fmt.Errorf("paypal subscription is %s", subscription.Status)
+	}
+	return nil
+}
+
+// paypalGet fetches the resource at the path of PayPal's API into v
+func paypalGet(path string, v interface{}) error {
+	resp, err := paypalRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("paypal request failed, status code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// verifyRazorpayOrder verifies the signature of the payment of the Razorpay order
+func verifyRazorpayOrder(params *mux.RequestParams, reference string) error {
+	razorpayParams := map[string]interface{}{
+		"razorpay_order_id":   reference,
+		"razorpay_payment_id": params.Get("razorpay_payment_id"),
+	}
+	if !utils.VerifyPaymentSignature(razorpayParams, params.Get("razorpay_signature"), config.Get("razorpay_key_secret")) {
+		return errors.New("razorpay order signature is not valid")
+	}
+	return nil
+}
+
+// verifyRazorpaySubscription verifies the signature of the payment of the Razorpay subscription
+func verifyRazorpaySubscription(params *mux.RequestParams, reference string) error {
+	razorpayParams := map[string]interface{}{
+		"razorpay_subscription_id": reference,
+		"razorpay_payment_id":      params.Get("razorpay_payment_id"),
+	}
+	if !utils.VerifySubscriptionSignature(razorpayParams, params.Get("razorpay_signature"), config.Get("razorpay_key_secret")) {
+		return errors.New("razorpay subscription signature is not valid")
+	}
+	return nil
+}
+
+// verifySquarePayment verifies the Square payment has been completed
+func verifySquarePayment(params *mux.RequestParams, reference string) error {
+	b, err := squareRequest(http.MethodGet, "/payments/"+url.PathEscape(reference), nil)
+	if err != nil {
+		return err
+	}
+
+	var payment struct {
+		Payment struct {
+			Status string `json:"status"`
+		} `json:"payment"`
+	}
+	err = json.Unmarshal(b, &payment)
+	if err != nil {
+		return err
+	}
+	if payment.Payment.Status != "COMPLETED" {
+		return fmt.Errorf("square payment is %s", payment.Payment.Status)
+	}
+	return nil
+}
+
+// verifySquareSubscription verifies the Square subscription has been created, it is pending until it starts
+func verifySquareSubscription(params *mux.RequestParams, reference string) error {
+	b, err := squareRequest(http.MethodGet, "/subscriptions/"+url.PathEscape(reference), nil)
+	if err != nil {
+		return err
+	}
+
+	var subscription struct {
+		Subscription struct {
+			Status string `json:"status"`
+		} `json:"subscription"`
+	}
+	err = json.Unmarshal(b, &subscription)
+	if err != nil {
+		return err
+	}
+	if subscription.Subscription.Status != "ACTIVE" && subscription.Subscription.Status != "PENDING" {
+		return fmt.Errorf("square subscription is %s", subscription.Subscription.Status)
+	}
+	return nil
+}
+
+// findSuccessTransaction returns the payment or subscription of the verified references if it has been recorded,
+// along with its product if it is known
+func findSuccessTransaction(references []*successReference, productId int64) (*Subscription, *products.Story) {
+	var product *products.Story
+	if productId > 0 {
+		product, _ = products.Find(productId)
+	}
+
+	for _, reference := range references {
+		transaction, err := FindGatewayReference(reference.Gateway, reference.Column, reference.Reference)
+		if err != nil {
+			continue
+		}
+
+		if product == nil {
+			product, _ = products.Find(transaction.ProductId)
+		}
+
+		return transaction, product
+	}
+
+	return nil, product
+}
+
+// findSuccessOffer returns the upsell offered after the purchase of the verified references, it is offered once
+func findSuccessOffer(references []*successReference, product *products.Story) *offers.Offer {
+	for _, reference := range references {
+		offer, err := offers.FindPurchase(reference.Reference)
+		if err == nil {
+			return offer
+		}
+
+		if !reference.Upsell {
+			continue
+		}
+
+		offer, err = offerUpsell(product, reference.Gateway, reference.Reference, "", "")
+		if err != nil {
+			log.Error(log.V{"Payment Success, error offering upsell": err, "product_id": product.ID})
+		}
+		return offer
+	}
+
+	return nil
+}
+
+// successItem is a product of an order or a bundle on the success page with the license key and download link issued for it
+type successItem struct {
+	Name     string
+	License  *licenses.License
+	Download *downloads.Download
+}
+
+// findSuccessOrder returns the order of the cart of the verified references
+func findSuccessOrder(references []*successReference) *orders.Order {
+	for _, reference := range references {
+		order, err := orders.FindReference(reference.Reference)
+		if err == nil && order.Gateway == reference.Gateway {
+			return order
+		}
+	}
+
+	return nil
+}
+
+// successItems returns the products of the order with their license keys and download links once it is paid
+func successItems(order *orders.Order) []*successItem {
+	var transactionID int64
+	if order.Paid() {
+		transactionID = order.TransactionID
+	}
+
+	var items []*successItem
+	for _, item := range order.Items {
+		items = append(items, newSuccessItem(transactionID, item.ProductID, item.Name))
+
+		product, err := products.Find(item.ProductID)
+		if err == nil {
+			items = append(items, bundleSuccessItems(transactionID, product)...)
+		}
+	}
+	return items
+}
+
+// bundleSuccessItems returns the products of the bundle with their license keys and download links,
+// the transaction id is 0 until the payment is recorded
+func bundleSuccessItems(transactionID int64, bundle *products.Story) []*successItem {
+	bundled, err := products.FindBundle(bundle)
+	if err != nil {
+		log.Error(log.V{"Payment Success, error finding products of bundle": err})
+		return nil
+	}
+
+	var items []*successItem
+	for _, product := range bundled {
+		items = append(items, newSuccessItem(transactionID, product.ID, product.Name))
+	}
+	return items
+}
+
+// newSuccessItem returns the product with the license key and download link issued for it by the payment
+func newSuccessItem(transactionID int64, productID int64, name string) *successItem {
+	item := &successItem{Name: name}
+	if transactionID > 0 {
+		item.License, _ = licenses.FindTransactionProduct(transactionID, productID)
+		item.Download = successDownload(transactionID, productID)
+	}
+	return item
+}
+
+// successDownload returns the download link issued for the product by the payment of a verified reference,
+// a link which has been revoked, suspended or used up isn't shown
+func successDownload(transactionID int64, productID int64) *downloads.Download {
+	download, err := downloads.FindTransactionProduct(transactionID, productID)
+	if err != nil || download.Check() != nil {
+		return nil
+	}
+	return download
+}
@@ -0,0 +1,54 @@
+// Tests for the success page
+package subscriptions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"testing"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+)
+
+// Test only the Razorpay references signed with the key secret are verified, and a reference is only found in its own column
+func TestVerifySuccessReferences(t *testing.T) {
+	openTestDatabase(t)
+	setTestConfig(t, map[string]string{"razorpay_key_secret": "secret"})
+
+	hash := hmac.New(sha256.New, []byte("secret"))
+	hash.Write([]byte("order_1|pay_1"))
+	signature := hex.EncodeToString(hash.Sum(nil))
+
+	tests := []struct {
+		values   url.Values
+		verified int
+	}{
+		{url.Values{"razorpay_order_id": {"order_1"}, "razorpay_payment_id": {"pay_1"}, "razorpay_signature": {signature}}, 1},
+		{url.Values{"razorpay_order_id": {"order_1"}, "razorpay_payment_id": {"pay_2"}, "razorpay_signature": {signature}}, 0},
+		{url.Values{"razorpay_order_id": {"order_1"}, "razorpay_payment_id": {"pay_1"}}, 0},
+		{url.Values{"razorpay_order_id": {"null"}}, 0},
+	}
+
+	for _, test := range tests {
+		references := verifySuccessReferences(&mux.RequestParams{Values: test.values})
+		if len(references) != test.verified {
+			t.Fatalf("success: expected %d verified references for %v got:%d", test.verified, test.values, len(references))
+		}
+	}
+
+	_, err := New().Create(map[string]string{"pg": "razorpay", "txn_id": "order_1", "subscr_id": "sub_1"})
+	if err != nil {
+		t.Fatalf("success: error creating transaction %s", err)
+	}
+
+	if _, err := FindGatewayReference("razorpay", "txn_id", "order_1"); err != nil {
+		t.Fatalf("success: expected transaction of the order got:%v", err)
+	}
+	if transaction, err := FindGatewayReference("razorpay", "txn_id", "sub_1"); err == nil {
+		t.Fatalf("success: expected no transaction with the subscription as its order got:%v", transaction)
+	}
+	if transaction, err := FindGatewayReference("paypal", "txn_id", "order_1"); err == nil {
+		t.Fatalf("success: expected no transaction of another gateway got:%v", transaction)
+	}
+}
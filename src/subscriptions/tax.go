@@ -0,0 +1,93 @@
+package subscriptions
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+)
+
+// RequestCountry returns the country of the buyer's IP address from Cloudflare,
+// or subscription_client_country in development as there is no Cloudflare header
+func RequestCountry(r *http.Request) string {
+	if !config.Production() {
+		return config.Get("subscription_client_country")
+	}
+	return r.Header.Get("CF-IPCountry")
+}
+
+// checkoutTax returns the tax on the amount in the smallest currency unit for the buyer,
+// the rate of the billing country is charged when the buyer entered one, otherwise of the IP country.
+func checkoutTax(amount int64, ipCountry string, billingCountry string, taxID string, inclusive bool) *taxes.Calculation {
+	country := billingCountry
+	if country == "" {
+		country = ipCountry
+	}
+	return taxes.Calculate(amount, country, taxID, inclusive)
+}
+
+// recordTax records the location evidence and tax of the checkout with the reference at the gateway, if the payment
+// was already recorded from the gateway's webhook the evidence is attached to it at once. The product id is 0 for
+// the checkout of a cart.
+func recordTax(c *taxes.Calculation, tax int64, productID int64, gateway string, reference string, ipCountry string, billingCountry string, currency string) error {
+	// The evidence is recorded and attached to a payment recorded already in one transaction
+	return query.Transaction(func(tx *query.Tx) error {
+		evidence, err := taxes.Record(tx, productID, gateway, reference, ipCountry, billingCountry, c, tax, currency)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := FindTransactionReferenceTx(tx, reference)
+		if err != nil {
+			return nil
+		}
+
+		return attachEvidence(tx, evidence, transaction)
+	})
+}
+
+// attachEvidence records the location evidence and tax rate on the payment or subscription,
+// the tax is recorded from the evidence when the gateway didn't report it.
+func attachEvidence(tx *query.Tx, evidence *taxes.Evidence, transaction *Subscription) error {
+	transactionParams := map[string]string{
+		"ip_country":     evidence.IPCountry,
+		"tax_country":    evidence.TaxCountry,
+		"tax_id":         evidence.TaxID,
+		"tax_rate":       strconv.FormatFloat(evidence.TaxPercent, 'f', -1, 64),
+		"reverse_charge": "0",
+	}
+	if evidence.ReverseCharge {
+		transactionParams["reverse_charge"] = "1"
+	}
+	// The billing country reported by the gateway is kept
+	if transaction.BillingCountry == "" && evidence.BillingCountry != "" {
+		transactionParams["address_country_code"] = evidence.BillingCountry
+	}
+	if transaction.Tax == 0 && evidence.Tax > 0 {
+		transactionParams["tax"] = majorUnits(evidence.Tax)
+	}
+
+	err := transaction.UpdateTx(tx, transactionParams)
+	if err != nil {
+		return err
+	}
+
+	transaction.IPCountry = evidence.IPCountry
+	transaction.TaxCountry = evidence.TaxCountry
+	transaction.TaxID = evidence.TaxID
+	transaction.TaxRate = evidence.TaxPercent
+	transaction.ReverseCharge = evidence.ReverseCharge
+	if transactionParams["address_country_code"] != "" {
+		transaction.BillingCountry = evidence.BillingCountry
+	}
+	if transactionParams["tax"] != "" {
+		transaction.Tax = float64(evidence.Tax) / 100
+	}
+
+	log.Info(log.V{"msg": "Tax evidence attached", "id": transaction.ID, "country": evidence.TaxCountry, "pg": evidence.Gateway})
+
+	return evidence.Attach(tx, transaction.ID)
+}
@@ -0,0 +1,92 @@
+package subscriptions
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+)
+
+// TaxReportRow is the total of the payments and subscriptions in a period for a country and currency,
+// the amounts are in the smallest currency unit
+type TaxReportRow struct {
+	// Country is the country whose tax was charged, or the billing or IP country for payments without tax evidence
+	Country        string
+	Currency       string
+	Payments       int64
+	ReverseCharged int64
+	Gross          int64
+	Tax            int64
+	Refunded       int64
+}
+
+// Net returns the gross amount without the tax
+func (r *TaxReportRow) Net() int64 {
+	return r.Gross - r.Tax
+}
+
+// Amounts returns the gross, tax, net and refunded amounts as decimal amounts like 10.50
+func (r *TaxReportRow) Amounts() []string {
+	return []string{majorUnits(r.Gross), majorUnits(r.Tax), majorUnits(r.Net()), majorUnits(r.Refunded)}
+}
+
+// TaxReport totals the payments and subscriptions recorded from the start of the period until its end
+// by the country of the tax and currency, subscriptions are counted with their first payment.
+func TaxReport(from time.Time, to time.Time) ([]*TaxReportRow, error) {
+	q := Where("payment_date >= ?", query.TimeString(from.UTC())).Where("payment_date < ?", query.TimeString(to.UTC()))
+	transactions, err := FindAll(q)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := FindTransactionRefunds(transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[string]*TaxReportRow)
+	for _, transaction := range transactions {
+		country := transaction.TaxCountry
+		if country == "" {
+			country = transaction.BillingCountry
+		}
+		if country == "" {
+			country = transaction.IPCountry
+		}
+		currency := strings.ToUpper(transaction.Currency)
+
+		key := country + "/" + currency
+		row, ok := rows[key]
+		if !ok {
+			row = &TaxReportRow{Country: country, Currency: currency}
+			rows[key] = row
+		}
+
+		row.Payments++
+		if transaction.ReverseCharge {
+			row.ReverseCharged++
+		}
+		row.Gross += int64(math.Round(transaction.Amount * 100))
+		row.Tax += int64(math.Round(transaction.Tax * 100))
+		for _, refund := range refunds[transaction.ID] {
+			if refund.Kind == RefundKindRefund {
+				row.Refunded += int64(math.Round(refund.Amount * 100))
+			}
+		}
+	}
+
+	var report []*TaxReportRow
+	for _, row := range rows {
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Country != report[j].Country {
+			return report[i].Country < report[j].Country
+		}
+		return report[i].Currency < report[j].Currency
+	})
+
+	return report, nil
+}
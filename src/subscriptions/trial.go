@@ -0,0 +1,165 @@
+package subscriptions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mail"
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+const (
+	// TrialStatusTrialing is the trial status of a subscription which hasn't been charged yet
+	TrialStatusTrialing = "trialing"
+	// TrialStatusConverted is the trial status of a subscription charged once its trial ended
+	TrialStatusConverted = "converted"
+	// TrialStatusCancelled is the trial status of a subscription which ended during its trial
+	TrialStatusCancelled = "cancelled"
+
+	// DefaultTrialReminderDays is how many days before the end of a free trial the customer is reminded
+	// when trial_reminder_days is not set
+	DefaultTrialReminderDays = 3
+
+	// trialReminderBatchSize is the number of customers reminded on each run of the worker
+	trialReminderBatchSize = 50
+)
+
+// trialWorker makes sure only one worker is reminding customers at a time
+var trialWorker sync.Mutex
+
+// TrialEnd returns when the free trial of the product started at the given time ends
+func TrialEnd(product *products.Story, start time.Time) time.Time {
+	return start.UTC().AddDate(0, 0, int(product.TrialDays))
+}
+
+// trialStarted records the free trial of a new subscription and returns the trial.started webhook
+func trialStarted(tx *query.Tx, subscription *Subscription, product *products.Story) ([]func(), error) {
+	trialEnds := TrialEnd(product, subscription.Created)
+
+	err := subscription.UpdateTx(tx, map[string]string{
+		"trial_status":  TrialStatusTrialing,
+		"trial_ends_at": query.TimeString(trialEnds),
+	})
+	if err != nil {
+		log.Error(log.V{"Payment event, error starting trial": err, "id": subscription.ID})
+		return nil, err
+	}
+	subscription.TrialStatus = TrialStatusTrialing
+	subscription.TrialEndsAt = trialEnds
+
+	data := trialWebhookData(subscription)
+	data.Status = TrialStatusTrialing
+
+	return []func(){
+		func() { sendProductWebhook(product, WebhookTrialStarted, data) },
+	}, nil
+}
+
+// trialConverted records the first charge of a subscription after its free trial and returns the trial.converted webhook
+func trialConverted(tx *query.Tx, event *PaymentEvent, subscription *Subscription, product *products.Story) ([]func(), error) {
+	err := subscription.UpdateTx(tx, map[string]string{"trial_status": TrialStatusConverted})
+	if err != nil {
+		log.Error(log.V{"Payment event, error converting trial": err, "id": subscription.ID})
+		return nil, err
+	}
+	subscription.TrialStatus = TrialStatusConverted
+
+	log.Info(log.V{"msg": "Payment event, trial converted", "id": subscription.ID, "pg": event.Gateway})
+
+	// The first charge is the first payment the affiliate who referred the subscriber earns a commission on
+	err = earnCommission(tx, subscription, nil, product, event.Amount, event.Tax)
+	if err != nil {
+		log.Error(log.V{"Payment event, error recording commission": err, "id": subscription.ID})
+		return nil, err
+	}
+
+	data := trialWebhookData(subscription)
+	data.Status = TrialStatusConverted
+	data.Currency = event.Currency
+
+	return []func(){
+		func() { sendProductWebhook(product, WebhookTrialConverted, data) },
+	}, nil
+}
+
+// trialWebhookData returns the webhook data for the trial of the subscription
+func trialWebhookData(subscription *Subscription) WebhookEventData {
+	return WebhookEventData{
+		SubscriptionID: subscription.SubscriptionId,
+		CustomID:       subscription.UserId,
+		Email:          subscription.CustomerEmail,
+		TrialEndsAt:    subscription.TrialEndsAt.Unix(),
+	}
+}
+
+// RemindTrials emails the customers whose free trial ends within trial_reminder_days before they are charged,
+// it is run by the scheduler and each customer is reminded once.
+func RemindTrials() {
+	if !trialWorker.TryLock() {
+		return
+	}
+	defer trialWorker.Unlock()
+
+	days := config.GetInt("trial_reminder_days")
+	if days <= 0 {
+		days = DefaultTrialReminderDays
+	}
+
+	subscriptions, err := FindDueTrialReminders(time.Now().UTC().AddDate(0, 0, int(days)), trialReminderBatchSize)
+	if err != nil {
+		log.Error(log.V{"RemindTrials, Error fetching trials": err})
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		product, err := products.Find(subscription.ProductId)
+		if err != nil {
+			log.Error(log.V{"RemindTrials, Error finding product": err, "id": subscription.ID})
+			continue
+		}
+
+		// The reminder is recorded first so a customer is never emailed twice
+		err = subscription.Update(map[string]string{"trial_reminded_at": query.TimeString(time.Now().UTC())})
+		if err != nil {
+			log.Error(log.V{"RemindTrials, Error recording reminder": err, "id": subscription.ID})
+			continue
+		}
+
+		sendTrialReminder(subscription, product)
+	}
+}
+
+// FindDueTrialReminders fetches the subscriptions in their free trial ending before the given time
+// whose customer hasn't been reminded.
+func FindDueTrialReminders(before time.Time, limit int) ([]*Subscription, error) {
+	q := Where("trial_status=?", TrialStatusTrialing).Where("trial_reminded_at IS NULL").Where("trial_ends_at <= ?", query.TimeString(before.UTC())).Order("trial_ends_at asc").Limit(limit)
+	return FindAll(q)
+}
+
+// sendTrialReminder emails the customer when their free trial ends and the subscription is first charged
+func sendTrialReminder(subscription *Subscription, product *products.Story) {
+	if subscription.CustomerEmail == "" {
+		return
+	}
+
+	email := mail.New(subscription.CustomerEmail)
+	email.ReplyTo = config.Get("mail_from")
+	email.Subject = "Your free trial of " + product.Name + " is ending"
+	email.Template = "subscriptions/views/trial.html.got"
+
+	context := mail.Context{
+		"name":      config.Get("name"),
+		"product":   product.Name,
+		"firstName": subscription.FirstName,
+		"trialEnds": subscription.TrialEndsAt.Format(time.RFC1123),
+		"portalURL": config.Get("root_url") + "/customers",
+	}
+
+	err := mail.Send(email, context)
+	if err != nil {
+		log.Error(log.V{"RemindTrials, Error sending reminder": err, "id": subscription.ID})
+	}
+}
@@ -0,0 +1,63 @@
+// Tests for the free trials of subscriptions
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/products"
+)
+
+// Test only subscriptions have a trial and it ends after the trial days
+func TestTrialEnd(t *testing.T) {
+	product := products.New()
+	product.Schedule = "monthly"
+	product.TrialDays = 14
+
+	if !product.Trial() {
+		t.Fatalf("trials: expected monthly product with trial days to have a trial")
+	}
+
+	start := time.Date(2026, 1, 25, 10, 0, 0, 0, time.UTC)
+	if end := TrialEnd(product, start); !end.Equal(time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("trials: expected trial to end 14 days after start got:%s", end)
+	}
+
+	product.Schedule = "onetime"
+	if product.Trial() {
+		t.Fatalf("trials: expected one time product not to have a trial")
+	}
+}
+
+// Test the payments of subscriptions which convert a trial are normalised for each gateway
+func TestNormaliseTrialEvents(t *testing.T) {
+	stripeBody := []byte(`{"id":"evt_i","type":"invoice.paid","data":{"object":{"subscription":"sub_s","payment_intent":"pi_2","amount_paid":1000,"currency":"usd"}}}`)
+	event, err := (&StripeGateway{}).NormaliseEvent(stripeBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentSucceeded || event.SubscriptionID != "sub_s" || event.Amount != 1000 || event.Status != "" {
+		t.Fatalf("trials: stripe invoice normalised incorrectly: %+v %v", event, err)
+	}
+
+	paypalBody := []byte(`{"id":"evt_p","event_type":"PAYMENT.SALE.COMPLETED","resource":{"id":"S1","state":"completed","billing_agreement_id":"I-SUB","amount":{"total":"10.50","currency":"USD"}}}`)
+	event, err = (&PaypalGateway{}).NormaliseEvent(paypalBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentSucceeded || event.SubscriptionID != "I-SUB" || event.Amount != 1050 || event.Status != "" {
+		t.Fatalf("trials: paypal sale normalised incorrectly: %+v %v", event, err)
+	}
+
+	squareBody := []byte(`{"type":"invoice.payment_made","event_id":"evt_q","data":{"object":{"invoice":{"id":"inv_1","status":"PAID","subscription_id":"sub_q","payment_requests":[{"total_completed_amount_money":{"amount":250,"currency":"USD"}}]}}}}`)
+	event, err = (&SquareGateway{}).NormaliseEvent(squareBody)
+	if err != nil || event == nil || event.Type != WebhookPaymentSucceeded || event.SubscriptionID != "sub_q" || event.Amount != 250 {
+		t.Fatalf("trials: square invoice normalised incorrectly: %+v %v", event, err)
+	}
+
+	razorpayBody := []byte(`{"event":"subscription.authenticated","created_at":1700000000,"payload":{"subscription":{"entity":{"id":"sub_r","status":"authenticated"}}}}`)
+	event, err = (&RazorpayGateway{}).NormaliseEvent(razorpayBody)
+	if err != nil || event == nil || event.Type != WebhookSubscriptionActivated || event.SubscriptionID != "sub_r" {
+		t.Fatalf("trials: razorpay authenticated subscription normalised incorrectly: %+v %v", event, err)
+	}
+
+	// Sales and invoices which aren't for a subscription are not of interest
+	event, err = (&PaypalGateway{}).NormaliseEvent([]byte(`{"id":"evt_o","event_type":"PAYMENT.SALE.COMPLETED","resource":{"id":"S2"}}`))
+	if err != nil || event != nil {
+		t.Fatalf("trials: paypal sale without subscription normalised: %+v %v", event, err)
+	}
+}
@@ -0,0 +1,187 @@
+package subscriptions
+
+import (
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// WebhookDeliveriesTableName is the database table for queued product webhooks
+	WebhookDeliveriesTableName = "webhook_deliveries"
+	// WebhookAttemptsTableName is the database table for the delivery attempts log
+	WebhookAttemptsTableName = "webhook_delivery_attempts"
+
+	// WebhookPending is the status of a delivery waiting to be sent or retried
+	WebhookPending = "pending"
+	// WebhookDelivered is the status of a delivery acknowledged with a 2xx response
+	WebhookDelivered = "delivered"
+	// WebhookFailed is the status of a delivery which ran out of attempts
+	WebhookFailed = "failed"
+)
+
+// WebhookDelivery is an outbound webhook to a product's WebhookURL
+type WebhookDelivery struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	ProductID      int64
+	EventType      string
+	URL            string
+	Payload        string
+	Signature      string
+	Status         string
+	Attempts       int64
+	NextAttemptAt  time.Time
+	LastStatusCode int64
+	LastError      string
+	DeliveredAt    time.Time
+}
+
+// WebhookAttempt records the outcome of a single delivery attempt
+type WebhookAttempt struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	DeliveryID   int64
+	Attempt      int64
+	StatusCode   int64
+	LatencyMs    int64
+	ResponseBody string
+	Error        string
+}
+
+// NewWebhookDelivery creates and initialises a new webhook delivery instance.
+func NewWebhookDelivery() *WebhookDelivery {
+	delivery := &WebhookDelivery{}
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = time.Now()
+	delivery.TableName = WebhookDeliveriesTableName
+	delivery.KeyName = KeyName
+	return delivery
+}
+
+// NewWebhookDeliveryWithColumns creates a new webhook delivery instance and fills it with data from the database cols provided.
+func NewWebhookDeliveryWithColumns(cols map[string]interface{}) *WebhookDelivery {
+	delivery := NewWebhookDelivery()
+	delivery.ID = resource.ValidateInt(cols["id"])
+	delivery.CreatedAt = resource.ValidateTime(cols["created_at"])
+	delivery.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	delivery.ProductID = resource.ValidateInt(cols["product_id"])
+	delivery.EventType = resource.ValidateString(cols["event_type"])
+	delivery.URL = resource.ValidateString(cols["url"])
+	delivery.Payload = resource.ValidateString(cols["payload"])
+	delivery.Signature = resource.ValidateString(cols["signature"])
+	delivery.Status = resource.ValidateString(cols["status"])
+	delivery.Attempts = resource.ValidateInt(cols["attempts"])
+	delivery.NextAttemptAt = resource.ValidateTime(cols["next_attempt_at"])
+	delivery.LastStatusCode = resource.ValidateInt(cols["last_status_code"])
+	delivery.LastError = resource.ValidateString(cols["last_error"])
+	delivery.DeliveredAt = resource.ValidateTime(cols["delivered_at"])
+	return delivery
+}
+
+// NewWebhookAttempt creates and initialises a new webhook attempt instance.
+func NewWebhookAttempt() *WebhookAttempt {
+	attempt := &WebhookAttempt{}
+	attempt.CreatedAt = time.Now()
+	attempt.UpdatedAt = time.Now()
+	attempt.TableName = WebhookAttemptsTableName
+	attempt.KeyName = KeyName
+	return attempt
+}
+
+// NewWebhookAttemptWithColumns creates a new webhook attempt instance and fills it with data from the database cols provided.
+func NewWebhookAttemptWithColumns(cols map[string]interface{}) *WebhookAttempt {
+	attempt := NewWebhookAttempt()
+	attempt.ID = resource.ValidateInt(cols["id"])
+	attempt.CreatedAt = resource.ValidateTime(cols["created_at"])
+	attempt.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	attempt.DeliveryID = resource.ValidateInt(cols["delivery_id"])
+	attempt.Attempt = resource.ValidateInt(cols["attempt"])
+	attempt.StatusCode = resource.ValidateInt(cols["status_code"])
+	attempt.LatencyMs = resource.ValidateInt(cols["latency_ms"])
+	attempt.ResponseBody = resource.ValidateString(cols["response_body"])
+	attempt.Error = resource.ValidateString(cols["error"])
+	return attempt
+}
+
+// FindWebhookDelivery fetches a single webhook delivery record from the database by id.
+func FindWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	result, err := WebhookDeliveriesQuery().Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookDeliveryWithColumns(result), nil
+}
+
+// FindAllWebhookDeliveries fetches all webhook delivery records matching this query from the database.
+func FindAllWebhookDeliveries(q *query.Query) ([]*WebhookDelivery, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []*WebhookDelivery
+	for _, cols := range results {
+		deliveries = append(deliveries, NewWebhookDeliveryWithColumns(cols))
+	}
+
+	return deliveries, nil
+}
+
+// FindDueWebhookDeliveries fetches the pending webhook deliveries whose next attempt is due.
+func FindDueWebhookDeliveries(limit int) ([]*WebhookDelivery, error) {
+	q := WebhookDeliveriesQuery().Where("status=?", WebhookPending).Where("next_attempt_at <= ?", query.TimeString(time.Now().UTC())).Order("next_attempt_at asc").Limit(limit)
+	return FindAllWebhookDeliveries(q)
+}
+
+// FindWebhookAttempts fetches the attempts for the given deliveries, keyed by delivery id.
+func FindWebhookAttempts(deliveries []*WebhookDelivery) (map[int64][]*WebhookAttempt, error) {
+	attempts := make(map[int64][]*WebhookAttempt)
+	if len(deliveries) == 0 {
+		return attempts, nil
+	}
+
+	var ids []int64
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+
+	results, err := FindAllWebhookAttempts(WebhookAttemptsQuery().WhereIn("delivery_id", ids).Order("attempt asc"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attempt := range results {
+		attempts[attempt.DeliveryID] = append(attempts[attempt.DeliveryID], attempt)
+	}
+
+	return attempts, nil
+}
+
+// FindAllWebhookAttempts fetches all webhook attempt records matching this query from the database.
+func FindAllWebhookAttempts(q *query.Query) ([]*WebhookAttempt, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []*WebhookAttempt
+	for _, cols := range results {
+		attempts = append(attempts, NewWebhookAttemptWithColumns(cols))
+	}
+
+	return attempts, nil
+}
+
+// WebhookDeliveriesQuery returns a new query for webhook deliveries with a default order.
+func WebhookDeliveriesQuery() *query.Query {
+	return query.New(WebhookDeliveriesTableName, KeyName).Order("id desc")
+}
+
+// WebhookAttemptsQuery returns a new query for webhook attempts with a default order.
+func WebhookAttemptsQuery() *query.Query {
+	return query.New(WebhookAttemptsTableName, KeyName).Order("id desc")
+}
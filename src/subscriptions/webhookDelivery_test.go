@@ -0,0 +1,60 @@
+// Tests for the queue of product webhooks
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+)
+
+// Test only pending deliveries whose next attempt has come are due, the earliest first
+func TestFindDueWebhookDeliveries(t *testing.T) {
+	openTestDatabase(t)
+
+	tests := []struct {
+		status      string
+		nextAttempt time.Duration
+		due         bool
+	}{
+		{WebhookPending, -time.Minute, true},
+		{WebhookPending, -time.Hour, true},
+		{WebhookPending, time.Hour, false},
+		{WebhookDelivered, -time.Minute, false},
+		{WebhookFailed, -time.Minute, false},
+	}
+
+	var due []int64
+	for _, test := range tests {
+		id, err := NewWebhookDelivery().Create(map[string]string{
+			"product_id":      "1",
+			"event_type":      WebhookPaymentSucceeded,
+			"url":             "http://localhost/webhooks",
+			"payload":         "{}",
+			"status":          test.status,
+			"attempts":        "1",
+			"next_attempt_at": query.TimeString(time.Now().UTC().Add(test.nextAttempt)),
+		})
+		if err != nil {
+			t.Fatalf("webhooks: error creating delivery %s", err)
+		}
+		if test.due {
+			due = append([]int64{id}, due...)
+		}
+	}
+
+	deliveries, err := FindDueWebhookDeliveries(webhookBatchSize)
+	if err != nil || len(deliveries) != len(due) {
+		t.Fatalf("webhooks: expected %d due deliveries got:%d %v", len(due), len(deliveries), err)
+	}
+	for i, delivery := range deliveries {
+		if delivery.ID != due[i] {
+			t.Fatalf("webhooks: expected delivery %d to be due at %d got:%d", due[i], i, delivery.ID)
+		}
+	}
+
+	deliveries, err = FindDueWebhookDeliveries(1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("webhooks: expected the due deliveries to be limited got:%d %v", len(deliveries), err)
+	}
+}
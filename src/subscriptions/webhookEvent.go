@@ -0,0 +1,68 @@
+package subscriptions
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookAPIVersion is the version of the webhook envelope, bump it on breaking changes to WebhookEvent
+const WebhookAPIVersion = "2026-10-18"
+
+// Event types are shared by the webhooks sent to products and the PaymentEvents normalised from gateways
+const (
+	// WebhookPaymentSucceeded is sent when a one-time payment is completed
+	WebhookPaymentSucceeded = "payment.succeeded"
+	// WebhookPaymentFailed is a failed payment of a subscription
+	WebhookPaymentFailed = "payment.failed"
+	// WebhookPaymentRefunded is a payment refunded in full or in part
+	WebhookPaymentRefunded = "payment.refunded"
+	// WebhookPaymentDisputed is a payment disputed by the customer with their bank
+	WebhookPaymentDisputed = "payment.disputed"
+	// WebhookSubscriptionActivated is sent when a subscription is started
+	WebhookSubscriptionActivated = "subscription.activated"
+	// WebhookSubscriptionUpdated is a change in the status of a subscription at the gateway
+	WebhookSubscriptionUpdated = "subscription.updated"
+	// WebhookSubscriptionCancelled is sent when a subscription is cancelled
+	WebhookSubscriptionCancelled = "subscription.cancelled"
+	// WebhookTrialStarted is sent when a subscription starts with a free trial
+	WebhookTrialStarted = "trial.started"
+	// WebhookTrialConverted is sent when a subscription is charged for the first time after its free trial
+	WebhookTrialConverted = "trial.converted"
+)
+
+// WebhookEvent is the envelope sent to a product's WebhookURL
+type WebhookEvent struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	APIVersion string           `json:"api_version"`
+	Created    int64            `json:"created"`
+	Data       WebhookEventData `json:"data"`
+}
+
+// WebhookEventData is the payment or subscription the event is about
+type WebhookEventData struct {
+	SubscriptionID string `json:"subscription_id,omitempty"`
+	OrderID        string `json:"order_id,omitempty"`
+	CustomID       string `json:"custom_id"`
+	Status         string `json:"status"`
+	Email          string `json:"email"`
+	AmountRefunded string `json:"amount_refunded,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	LicenseKey     string `json:"license_key,omitempty"`
+	DownloadURL    string `json:"download_url,omitempty"`
+	TrialEndsAt    int64  `json:"trial_ends_at,omitempty"`
+	// ProductID is the product a subscription was changed to by a change of its plan
+	ProductID int64 `json:"product_id,omitempty"`
+}
+
+// NewWebhookEvent returns an event of the given type wrapping data
+func NewWebhookEvent(eventType string, data WebhookEventData) *WebhookEvent {
+	return &WebhookEvent{
+		ID:         "evt_" + uuid.NewString(),
+		Type:       eventType,
+		APIVersion: WebhookAPIVersion,
+		Created:    time.Now().UTC().Unix(),
+		Data:       data,
+	}
+}
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/log"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+)
+
+// HandleCreate responds to POST /taxes/create by adding the tax rate.
+func HandleCreate(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can add tax rates"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	rateParams, err := taxes.CreateParams(params.Map())
+	if err != nil {
+		return server.Redirect(w, r, "/taxes?error="+url.QueryEscape(err.Error()))
+	}
+
+	id, err := taxes.New().Create(rateParams)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	log.Info(log.V{"msg": "Tax rate added", "id": id, "country": rateParams["country"]})
+
+	return server.Redirect(w, r, "/taxes")
+}
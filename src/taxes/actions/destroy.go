@@ -0,0 +1,46 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/taxes"
+)
+
+// HandleDestroy responds to POST /taxes/n/destroy by deleting a tax rate, the payments
+// it was charged for keep their rate.
+func HandleDestroy(w http.ResponseWriter, r *http.Request) error {
+
+	// Check the authenticity token
+	err := session.CheckAuthenticity(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can delete tax rates"))
+	}
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	rate, err := taxes.Find(params.GetInt(taxes.KeyName))
+	if err != nil {
+		return server.NotFoundError(err)
+	}
+
+	err = rate.Destroy()
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	return server.Redirect(w, r, "/taxes")
+}
@@ -0,0 +1,91 @@
+package actions
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/mux"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+	"github.com/abishekmuthian/open-payment-host/src/lib/session"
+	"github.com/abishekmuthian/open-payment-host/src/lib/view"
+	"github.com/abishekmuthian/open-payment-host/src/subscriptions"
+)
+
+// reportDateFormat is the format of the from and to dates of the report
+const reportDateFormat = "2006-01-02"
+
+// HandleReport responds to GET /taxes/report by totalling the payments from the from date until the end of
+// the to date in UTC by country and currency, the report is downloaded as CSV from /taxes/report.csv.
+// The period is the current month when no dates are given.
+func HandleReport(w http.ResponseWriter, r *http.Request) error {
+
+	// Fetch the  params
+	params, err := mux.Params(r)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	// Authorise only admin
+	currentUser := session.CurrentUser(w, r)
+	if !currentUser.Admin() {
+		return server.NotAuthorizedError(errors.New("only admin can view the tax report"))
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if params.Get("from") != "" {
+		from, err = time.Parse(reportDateFormat, params.Get("from"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The from date should be in the format 2006-01-02.")
+		}
+	}
+	if params.Get("to") != "" {
+		to, err = time.Parse(reportDateFormat, params.Get("to"))
+		if err != nil {
+			return server.BadRequestError(err, "Invalid date", "The to date should be in the format 2006-01-02.")
+		}
+	}
+
+	// The to date is included in the period
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	report, err := subscriptions.TaxReport(from, end)
+	if err != nil {
+		return server.InternalError(err)
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=tax-report-"+from.Format(reportDateFormat)+"-"+to.Format(reportDateFormat)+".csv")
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"country", "currency", "payments", "reverse_charged", "gross", "tax", "net", "refunded"})
+		for _, row := range report {
+			record := []string{row.Country, row.Currency, strconv.FormatInt(row.Payments, 10), strconv.FormatInt(row.ReverseCharged, 10)}
+			writer.Write(append(record, row.Amounts()...))
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	// Render the template
+	view := view.NewRenderer(w, r)
+	view.AddKey("report", report)
+	view.AddKey("from", from.Format(reportDateFormat))
+	view.AddKey("to", to.Format(reportDateFormat))
+	view.AddKey("currentUser", currentUser)
+	view.AddKey("meta_title", "Tax Report")
+	view.AddKey("meta_foot", config.Get("meta_desc"))
+	// Set the name and year
+	view.AddKey("name", config.Get("name"))
+	view.AddKey("year", time.Now().Year())
+	view.Template("taxes/views/report.html.got")
+
+	return view.Render()
+}
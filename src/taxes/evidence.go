@@ -0,0 +1,190 @@
+package taxes
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// EvidenceTableName is the database table for evidence
+	EvidenceTableName = "tax_evidence"
+
+	// EvidencePending is the status of evidence whose checkout hasn't been paid yet
+	EvidencePending = "pending"
+	// EvidenceAttached is the status of evidence whose payment has been recorded
+	EvidenceAttached = "attached"
+)
+
+// Evidence is the location of the buyer and the tax of a checkout at a payment gateway, it is attached
+// to the payment or subscription when the gateway's webhook for the payment is recorded.
+type Evidence struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	ProductID int64
+	// Gateway and Reference identify the checkout at the gateway e.g. the Stripe checkout session
+	Gateway   string
+	Reference string
+	// IPCountry is the country of the buyer's IP address and BillingCountry the country of their billing address
+	IPCountry      string
+	BillingCountry string
+	// TaxCountry is the country whose rate was charged
+	TaxCountry    string
+	TaxID         string
+	TaxName       string
+	TaxPercent    float64
+	ReverseCharge bool
+	// Tax is in the smallest currency unit, it is 0 when the gateway calculates the tax
+	Tax           int64
+	Currency      string
+	TransactionID int64
+	Status        string
+}
+
+// NewEvidenceWithColumns creates a new evidence instance and fills it with data from the database cols provided.
+func NewEvidenceWithColumns(cols map[string]interface{}) *Evidence {
+	evidence := NewEvidence()
+	evidence.ID = resource.ValidateInt(cols["id"])
+	evidence.CreatedAt = resource.ValidateTime(cols["created_at"])
+	evidence.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	evidence.ProductID = resource.ValidateInt(cols["product_id"])
+	evidence.Gateway = resource.ValidateString(cols["pg"])
+	evidence.Reference = resource.ValidateString(cols["reference"])
+	evidence.IPCountry = resource.ValidateString(cols["ip_country"])
+	evidence.BillingCountry = resource.ValidateString(cols["billing_country"])
+	evidence.TaxCountry = resource.ValidateString(cols["tax_country"])
+	evidence.TaxID = resource.ValidateString(cols["tax_id"])
+	evidence.TaxName = resource.ValidateString(cols["tax_name"])
+	evidence.TaxPercent = resource.ValidateFloat(cols["tax_percent"])
+	evidence.ReverseCharge = resource.ValidateInt(cols["reverse_charge"]) == 1
+	evidence.Tax = resource.ValidateInt(cols["tax"])
+	evidence.Currency = resource.ValidateString(cols["currency"])
+	evidence.TransactionID = resource.ValidateInt(cols["transaction_id"])
+	evidence.Status = resource.ValidateString(cols["status"])
+	return evidence
+}
+
+// NewEvidence creates and initialises a new evidence instance.
+func NewEvidence() *Evidence {
+	evidence := &Evidence{}
+	evidence.CreatedAt = time.Now()
+	evidence.UpdatedAt = time.Now()
+	evidence.TableName = EvidenceTableName
+	evidence.KeyName = KeyName
+	return evidence
+}
+
+// Record records the location of the buyer and the tax calculated for the checkout with the reference at the gateway
+// in the transaction, tax is the tax charged in the smallest currency unit or 0 when the gateway calculates it.
+func Record(tx *query.Tx, productID int64, gateway string, reference string, ipCountry string, billingCountry string, c *Calculation, tax int64, currency string) (*Evidence, error) {
+	evidenceParams := make(map[string]string)
+	evidenceParams["product_id"] = strconv.FormatInt(productID, 10)
+	evidenceParams["pg"] = gateway
+	evidenceParams["reference"] = reference
+	evidenceParams["ip_country"] = NormaliseCountry(ipCountry)
+	evidenceParams["billing_country"] = NormaliseCountry(billingCountry)
+	evidenceParams["tax_country"] = c.Country
+	evidenceParams["tax_id"] = c.TaxID
+	evidenceParams["tax_name"] = c.Name
+	evidenceParams["tax_percent"] = strconv.FormatFloat(c.Percent, 'f', -1, 64)
+	evidenceParams["reverse_charge"] = "0"
+	if c.ReverseCharge {
+		evidenceParams["reverse_charge"] = "1"
+	}
+	evidenceParams["tax"] = strconv.FormatInt(tax, 10)
+	evidenceParams["currency"] = currency
+	evidenceParams["status"] = EvidencePending
+
+	id, err := NewEvidence().CreateTx(tx, evidenceParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindEvidenceTx(tx, id)
+}
+
+// Attach records the evidence as attached to the payment or subscription in the subscriptions table in the transaction
+func (e *Evidence) Attach(tx *query.Tx, transactionID int64) error {
+	err := e.UpdateTx(tx, map[string]string{
+		"transaction_id": strconv.FormatInt(transactionID, 10),
+		"status":         EvidenceAttached,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.TransactionID = transactionID
+	e.Status = EvidenceAttached
+
+	return nil
+}
+
+// FindEvidence fetches a single evidence record from the database by id.
+func FindEvidence(id int64) (*Evidence, error) {
+	return FindEvidenceTx(nil, id)
+}
+
+// FindEvidenceTx fetches a single evidence record by id in the transaction.
+func FindEvidenceTx(tx *query.Tx, id int64) (*Evidence, error) {
+	result, err := EvidenceQueryTx(tx).Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewEvidenceWithColumns(result), nil
+}
+
+// FindPendingEvidence fetches the latest pending evidence for the checkout at the gateway with any of the references
+// in the transaction.
+func FindPendingEvidence(tx *query.Tx, gateway string, references ...string) (*Evidence, error) {
+	for _, reference := range references {
+		if reference == "" {
+			continue
+		}
+
+		result, err := EvidenceQueryTx(tx).Where("pg=?", gateway).Where("reference=?", reference).Where("status=?", EvidencePending).FirstResult()
+		if err == nil {
+			return NewEvidenceWithColumns(result), nil
+		}
+	}
+
+	return nil, errors.New("no pending evidence for the checkout")
+}
+
+// FindTransactionEvidence fetches the evidence attached to the payment or subscription in the subscriptions table
+// in the transaction.
+func FindTransactionEvidence(tx *query.Tx, transactionID int64) (*Evidence, error) {
+	result, err := EvidenceQueryTx(tx).Where("transaction_id=?", transactionID).Where("status=?", EvidenceAttached).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewEvidenceWithColumns(result), nil
+}
+
+// FindAllEvidence fetches all evidence records matching this query from the database.
+func FindAllEvidence(q *query.Query) ([]*Evidence, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var evidence []*Evidence
+	for _, cols := range results {
+		evidence = append(evidence, NewEvidenceWithColumns(cols))
+	}
+
+	return evidence, nil
+}
+
+// EvidenceQuery returns a new query for evidence with a default order.
+func EvidenceQuery() *query.Query {
+	return EvidenceQueryTx(nil)
+}
+
+// EvidenceQueryTx returns a new query for evidence with a default order in the transaction.
+func EvidenceQueryTx(tx *query.Tx) *query.Query {
+	return tx.New(EvidenceTableName, KeyName).Order("id desc")
+}
@@ -0,0 +1,134 @@
+package taxes
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/query"
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+)
+
+const (
+	// TableName is the database table for this resource
+	TableName = "tax_rates"
+	// KeyName is the primary key value for this resource
+	KeyName = "id"
+	// Order defines the default sort order in sql for this resource
+	Order = "country asc"
+)
+
+// AllowedParams returns an array of acceptable params in create
+func AllowedParams() []string {
+	return []string{"country", "name", "percent", "reverse_charge"}
+}
+
+var (
+	// countryPattern is the format of a country code after it is normalised
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	// namePattern is the format of the name of a tax
+	namePattern = regexp.MustCompile(`^[A-Za-z ]{1,16}$`)
+)
+
+// CreateParams validates the rate submitted by the admin and returns the params to create it with
+func CreateParams(params map[string]string) (map[string]string, error) {
+	params = New().ValidateParams(params, AllowedParams())
+
+	rateParams := make(map[string]string)
+
+	country := NormaliseCountry(params["country"])
+	if !countryPattern.MatchString(country) {
+		return nil, errors.New("country should be a 2 letter code like DE")
+	}
+	if _, err := FindCountry(country); err == nil {
+		return nil, errors.New("a rate for this country already exists")
+	}
+	rateParams["country"] = country
+
+	name := strings.TrimSpace(params["name"])
+	if !namePattern.MatchString(name) {
+		return nil, errors.New("name should be up to 16 letters like VAT or GST")
+	}
+	rateParams["name"] = name
+
+	percent, err := strconv.ParseFloat(params["percent"], 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return nil, errors.New("percentage should be more than 0 and less than 100")
+	}
+	rateParams["percent"] = strconv.FormatFloat(percent, 'f', -1, 64)
+
+	rateParams["reverse_charge"] = "0"
+	if params["reverse_charge"] != "" {
+		rateParams["reverse_charge"] = "1"
+	}
+
+	return rateParams, nil
+}
+
+// NewWithColumns creates a new rate instance and fills it with data from the database cols provided.
+func NewWithColumns(cols map[string]interface{}) *Rate {
+	rate := New()
+	rate.ID = resource.ValidateInt(cols["id"])
+	rate.CreatedAt = resource.ValidateTime(cols["created_at"])
+	rate.UpdatedAt = resource.ValidateTime(cols["updated_at"])
+	rate.Country = resource.ValidateString(cols["country"])
+	rate.Name = resource.ValidateString(cols["name"])
+	rate.Percent = resource.ValidateFloat(cols["percent"])
+	rate.ReverseCharge = resource.ValidateInt(cols["reverse_charge"]) == 1
+	return rate
+}
+
+// New creates and initialises a new rate instance.
+func New() *Rate {
+	rate := &Rate{}
+	rate.CreatedAt = time.Now()
+	rate.UpdatedAt = time.Now()
+	rate.TableName = TableName
+	rate.KeyName = KeyName
+	return rate
+}
+
+// NormaliseCountry returns the country code in the form it is stored
+func NormaliseCountry(country string) string {
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// Find fetches a single rate record from the database by id.
+func Find(id int64) (*Rate, error) {
+	result, err := Query().Where("id=?", id).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindCountry fetches the rate for buyers in the country.
+func FindCountry(country string) (*Rate, error) {
+	result, err := Query().Where("country=?", NormaliseCountry(country)).FirstResult()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithColumns(result), nil
+}
+
+// FindAll fetches all rate records matching this query from the database.
+func FindAll(q *query.Query) ([]*Rate, error) {
+	results, err := q.Results()
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []*Rate
+	for _, cols := range results {
+		rates = append(rates, NewWithColumns(cols))
+	}
+
+	return rates, nil
+}
+
+// Query returns a new query for rates with a default order.
+func Query() *query.Query {
+	return query.New(TableName, KeyName).Order(Order)
+}
@@ -0,0 +1,108 @@
+// Package taxes represents the VAT and GST rates charged by the country of the buyer
+package taxes
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/abishekmuthian/open-payment-host/src/lib/resource"
+	"github.com/abishekmuthian/open-payment-host/src/lib/server/config"
+)
+
+// Rate is the VAT or GST charged to buyers in a country
+type Rate struct {
+	// resource.Base defines behaviour and fields shared between all resources
+	resource.Base
+
+	// Country is the ISO 3166-1 alpha-2 code of the buyer's country e.g. DE
+	Country string
+	// Name is the name of the tax shown to the buyer e.g. VAT
+	Name    string
+	Percent float64
+	// ReverseCharge is set for countries where businesses with a valid tax ID account for the tax themselves
+	ReverseCharge bool
+}
+
+// Calculation is the tax on a price for a buyer, it has no Name when there is no rate for the buyer's country
+type Calculation struct {
+	Country string
+	Name    string
+	Percent float64
+	TaxID   string
+	// Net, Tax and Gross are in the smallest currency unit
+	Net   int64
+	Tax   int64
+	Gross int64
+	// Inclusive is set when the tax is included in the price, otherwise it is added to it
+	Inclusive bool
+	// ReverseCharge is set when the buyer is a business with a valid tax ID which accounts for the tax
+	ReverseCharge bool
+	// ReverseChargeAllowed is set when businesses in the country can enter their tax ID
+	ReverseChargeAllowed bool
+}
+
+// Inclusive reports whether prices include the tax, set with tax_inclusive
+func Inclusive() bool {
+	return config.GetBool("tax_inclusive")
+}
+
+// Calculate returns the tax on the amount in the smallest currency unit for a buyer in the country,
+// no tax is charged when there is no rate for the country or the buyer's tax ID is reverse charged.
+func Calculate(amount int64, country string, taxID string, inclusive bool) *Calculation {
+	rate, err := FindCountry(country)
+	if err != nil {
+		return &Calculation{Country: NormaliseCountry(country), Net: amount, Gross: amount, Inclusive: inclusive}
+	}
+	return rate.Calculate(amount, taxID, inclusive)
+}
+
+// Calculate returns the tax at this rate on the amount in the smallest currency unit
+func (r *Rate) Calculate(amount int64, taxID string, inclusive bool) *Calculation {
+	c := &Calculation{
+		Country:              r.Country,
+		Name:                 r.Name,
+		Percent:              r.Percent,
+		Net:                  amount,
+		Gross:                amount,
+		Inclusive:            inclusive,
+		ReverseChargeAllowed: r.ReverseCharge,
+	}
+
+	// Businesses are charged the price without tax whether or not prices include it
+	if r.ReverseCharge && ValidTaxID(r.Country, taxID) {
+		c.TaxID = NormaliseTaxID(r.Country, taxID)
+		c.ReverseCharge = true
+		return c
+	}
+
+	if inclusive {
+		c.Tax = int64(math.Round(float64(amount) * r.Percent / (100 + r.Percent)))
+		c.Net = amount - c.Tax
+	} else {
+		c.Tax = int64(math.Round(float64(amount) * r.Percent / 100))
+		c.Gross = amount + c.Tax
+	}
+
+	return c
+}
+
+// Label returns the tax shown to the buyer with the price e.g. incl. 19% VAT
+func (c *Calculation) Label() string {
+	if c.Name == "" {
+		return ""
+	}
+	if c.ReverseCharge {
+		return c.Name + " reverse charged to " + c.TaxID
+	}
+
+	label := strconv.FormatFloat(c.Percent, 'f', -1, 64) + "% " + c.Name
+	if c.Inclusive {
+		return "incl. " + label
+	}
+	return "+ " + label
+}
+
+// Label returns the rate shown to the admin e.g. 19% VAT
+func (r *Rate) Label() string {
+	return strconv.FormatFloat(r.Percent, 'f', -1, 64) + "% " + r.Name
+}
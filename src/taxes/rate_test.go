@@ -0,0 +1,78 @@
+// Tests for tax rates
+package taxes
+
+import (
+	"testing"
+)
+
+// Test the tax is added to or taken from the price, and businesses with a valid tax ID are reverse charged
+func TestCalculate(t *testing.T) {
+	rate := New()
+	rate.Country = "DE"
+	rate.Name = "VAT"
+	rate.Percent = 19
+	rate.ReverseCharge = true
+
+	tests := []struct {
+		amount    int64
+		taxID     string
+		inclusive bool
+		net       int64
+		tax       int64
+		gross     int64
+		label     string
+	}{
+		{1000, "", false, 1000, 190, 1190, "+ 19% VAT"},
+		{1190, "", true, 1000, 190, 1190, "incl. 19% VAT"},
+		{999, "", true, 839, 160, 999, "incl. 19% VAT"},
+		{1000, "de 123 456 789", false, 1000, 0, 1000, "VAT reverse charged to DE123456789"},
+		{1190, "DE123456789", true, 1190, 0, 1190, "VAT reverse charged to DE123456789"},
+		{1000, "D", false, 1000, 190, 1190, "+ 19% VAT"},
+	}
+
+	for _, test := range tests {
+		c := rate.Calculate(test.amount, test.taxID, test.inclusive)
+		if c.Net != test.net || c.Tax != test.tax || c.Gross != test.gross {
+			t.Fatalf("taxes: expected %d+%d=%d for %d got:%d+%d=%d", test.net, test.tax, test.gross, test.amount, c.Net, c.Tax, c.Gross)
+		}
+		if c.Label() != test.label {
+			t.Fatalf("taxes: expected label %q got:%q", test.label, c.Label())
+		}
+	}
+
+	// Countries without reverse charge tax businesses like consumers
+	rate.ReverseCharge = false
+	c := rate.Calculate(1000, "DE123456789", false)
+	if c.ReverseCharge || c.Tax != 190 {
+		t.Fatalf("taxes: expected no reverse charge got:%v", c)
+	}
+}
+
+// Test the format of EU VAT numbers and Indian GSTINs
+func TestValidTaxID(t *testing.T) {
+	tests := []struct {
+		country string
+		taxID   string
+		valid   bool
+	}{
+		{"DE", "DE123456789", true},
+		{"de", "123456789", true},
+		{"GR", "EL123456789", true},
+		{"GR", "123456789", true},
+		{"FR", "FR-12.345.678.901", true},
+		{"DE", "", false},
+		{"DE", "DE1", false},
+		{"DE", "DE12345678901234", false},
+		{"IN", "27AAPFU0939F1ZV", true},
+		{"IN", "27aapfu0939f1zv", true},
+		{"IN", "27AAPFU0939F1XV", false},
+		{"IN", "AAPFU0939F", false},
+		{"US", "123456789", false},
+	}
+
+	for _, test := range tests {
+		if ValidTaxID(test.country, test.taxID) != test.valid {
+			t.Fatalf("taxes: expected valid %t for %s %q", test.valid, test.country, test.taxID)
+		}
+	}
+}
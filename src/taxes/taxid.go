@@ -0,0 +1,52 @@
+package taxes
+
+import (
+	"regexp"
+	"strings"
+)
+
+// euVATPrefixes are the prefixes of the VAT numbers of the EU countries, Greece uses EL
+var euVATPrefixes = map[string]string{
+	"AT": "AT", "BE": "BE", "BG": "BG", "CY": "CY", "CZ": "CZ", "DE": "DE", "DK": "DK", "EE": "EE",
+	"ES": "ES", "FI": "FI", "FR": "FR", "GR": "EL", "HR": "HR", "HU": "HU", "IE": "IE", "IT": "IT",
+	"LT": "LT", "LU": "LU", "LV": "LV", "MT": "MT", "NL": "NL", "PL": "PL", "PT": "PT", "RO": "RO",
+	"SE": "SE", "SI": "SI", "SK": "SK",
+}
+
+var (
+	// euVATPattern is the format of an EU VAT number after its prefix
+	euVATPattern = regexp.MustCompile(`^[0-9A-Z+*]{2,12}$`)
+	// gstinPattern is the format of an Indian GSTIN, the state code, PAN, entity number, Z and check character
+	gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+)
+
+// NormaliseTaxID returns the tax ID of a business in the country in the form it is stored,
+// EU VAT numbers are given the prefix of the country if it was left out.
+func NormaliseTaxID(country string, taxID string) string {
+	taxID = strings.ToUpper(taxID)
+	taxID = strings.NewReplacer(" ", "", "-", "", ".", "").Replace(taxID)
+
+	prefix, eu := euVATPrefixes[NormaliseCountry(country)]
+	if eu && taxID != "" && !strings.HasPrefix(taxID, prefix) {
+		taxID = prefix + taxID
+	}
+
+	return taxID
+}
+
+// ValidTaxID reports whether the tax ID has the format of an EU VAT number or an Indian GSTIN
+// of a business in the country, it is not checked with the tax authority.
+func ValidTaxID(country string, taxID string) bool {
+	country = NormaliseCountry(country)
+	taxID = NormaliseTaxID(country, taxID)
+
+	if prefix, eu := euVATPrefixes[country]; eu {
+		return euVATPattern.MatchString(strings.TrimPrefix(taxID, prefix))
+	}
+
+	if country == "IN" {
+		return gstinPattern.MatchString(taxID)
+	}
+
+	return false
+}